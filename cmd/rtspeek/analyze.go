@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	rtpeek "github.com/0x524A/rtspeek/pkg/rtspeek"
+	cli "github.com/urfave/cli/v2"
+)
+
+// analyzeCommand runs the describe and live probe analysis over a packet capture.
+func analyzeCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "analyze",
+		Usage:     "Analyze the RTSP sessions of a pcap/pcapng capture as if they were probed live",
+		ArgsUsage: "<capture.pcap>",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "file", Usage: "Capture file to read (or pass it as the argument)"},
+			&cli.BoolFlag{Name: "all", Usage: "Print every RTSP connection as a JSON array instead of the first described one"},
+			&cli.BoolFlag{Name: "raw-sdp", Usage: "Include the raw SDP text in the session output"},
+			&cli.BoolFlag{Name: "debug", Usage: "Include the captured RTSP exchange as the debug trace"},
+			&cli.BoolFlag{Name: "bitrate-series", Usage: "Include the per-second bitrate series of each track"},
+			&cli.BoolFlag{Name: "metrics", Usage: "Print Prometheus text-format metrics instead of JSON"},
+			&cli.BoolFlag{Name: "pretty", Usage: "Pretty-print JSON output", Value: true},
+		},
+		Action: runAnalyze,
+	}
+}
+
+func runAnalyze(c *cli.Context) error {
+	path := c.String("file")
+	if path == "" {
+		path = c.Args().First()
+	}
+	if path == "" {
+		return fmt.Errorf("a capture file is required")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open capture: %w", err)
+	}
+	defer f.Close()
+
+	ctx := rtpeek.WithLiveProbe(context.Background(), rtpeek.LiveProbeOptions{BitrateSeries: c.Bool("bitrate-series")})
+	if c.Bool("raw-sdp") {
+		ctx = rtpeek.WithRawSDP(ctx)
+	}
+	if c.Bool("debug") {
+		ctx = rtpeek.WithDebug(ctx)
+	}
+	infos, err := rtpeek.AnalyzeCapture(ctx, f)
+	if err != nil {
+		return fmt.Errorf("analyze failed: %w", err)
+	}
+
+	selected := infos
+	if !c.Bool("all") {
+		// The first connection that described successfully, as a live probe would report it
+		selected = infos[:1]
+		for _, info := range infos {
+			if info.IsDescribeSucceeded() {
+				selected = []rtpeek.StreamInfo{info}
+				break
+			}
+		}
+	}
+
+	if c.Bool("metrics") {
+		var metrics []rtpeek.Metric
+		for _, info := range selected {
+			metrics = append(metrics, rtpeek.CollectMetrics(info)...)
+		}
+		return rtpeek.WritePrometheus(os.Stdout, metrics)
+	}
+
+	out := NewOutputFormatter(os.Stdout, c.Bool("pretty"))
+	if c.Bool("all") {
+		err = out.WriteStreamInfos(selected)
+	} else {
+		err = out.WriteStreamInfo(selected[0])
+	}
+	if err != nil {
+		return fmt.Errorf("output formatting failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	rtpeek "github.com/0x524A/rtspeek/pkg/rtspeek"
+	cli "github.com/urfave/cli/v2"
+)
+
+// baselineCommand saves the streams of a fleet and reports drift from them.
+func baselineCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "baseline",
+		Usage: "Save what the targets of a config file look like and report what changed since",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "save",
+				Usage: "Describe every target and write the normalized results to a baseline file",
+				Flags: append(targetFlags(),
+					&cli.StringFlag{Name: "output", Aliases: []string{"o"}, Usage: "Baseline file to write", Required: true},
+				),
+				Action: runBaselineSave,
+			},
+			{
+				Name:  "diff",
+				Usage: "Describe every target again (or read --against) and report changes from a baseline",
+				Flags: append(selectionFlags(),
+					&cli.StringFlag{Name: "config", Usage: "Config file listing targets, profiles and credentials"},
+					&cli.StringFlag{Name: "baseline", Usage: "Baseline file to compare with", Required: true},
+					&cli.StringFlag{Name: "against", Usage: "Compare with this later baseline file instead of probing"},
+					&cli.BoolFlag{Name: "json", Usage: "Print the diff as JSON instead of text"},
+					&cli.BoolFlag{Name: "pretty", Usage: "Pretty-print JSON output", Value: true},
+					&cli.BoolFlag{Name: "fail-on-change", Usage: "Exit with status 2 when anything changed"},
+				),
+				Action: runBaselineDiff,
+			},
+		},
+	}
+}
+
+// probeBaseline describes the selected targets of the config file.
+func probeBaseline(c *cli.Context) (*rtpeek.Baseline, error) {
+	cfg, targets, err := loadTargets(c)
+	if err != nil {
+		return nil, err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	results := rtpeek.ProbeTargets(ctx, cfg, targets, c.Int("concurrency"), nil)
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("interrupted")
+	}
+	return rtpeek.NewBaseline(results), nil
+}
+
+func runBaselineSave(c *cli.Context) error {
+	b, err := probeBaseline(c)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(c.String("output"))
+	if err != nil {
+		return fmt.Errorf("create baseline file: %w", err)
+	}
+	if err := rtpeek.WriteBaseline(f, b); err != nil {
+		f.Close()
+		return fmt.Errorf("write baseline file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	ok := 0
+	for _, e := range b.Targets {
+		if e.DescribeOK {
+			ok++
+		}
+	}
+	fmt.Fprintf(os.Stderr, "saved %d targets (%d described) to %s\n", len(b.Targets), ok, c.String("output"))
+	return nil
+}
+
+func runBaselineDiff(c *cli.Context) error {
+	before, err := readBaselineFile(c.String("baseline"))
+	if err != nil {
+		return err
+	}
+	var after *rtpeek.Baseline
+	switch {
+	case c.String("against") != "":
+		after, err = readBaselineFile(c.String("against"))
+	case c.String("config") != "":
+		after, err = probeBaseline(c)
+	default:
+		return fmt.Errorf("either --config or --against is required")
+	}
+	if err != nil {
+		return err
+	}
+
+	d := rtpeek.DiffBaselines(before, after)
+	if c.Bool("json") {
+		err = NewOutputFormatter(os.Stdout, c.Bool("pretty")).WriteJSON(d)
+	} else {
+		err = writeBaselineDiff(os.Stdout, d)
+	}
+	if err != nil {
+		return fmt.Errorf("output formatting failed: %w", err)
+	}
+	if c.Bool("fail-on-change") && d.HasChanges() {
+		return cli.Exit("", 2)
+	}
+	return nil
+}
+
+func readBaselineFile(path string) (*rtpeek.Baseline, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b, err := rtpeek.ReadBaseline(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return b, nil
+}
+
+// writeBaselineDiff prints a diff for people: one block per changed target, then a summary line.
+func writeBaselineDiff(w io.Writer, d *rtpeek.BaselineDiff) error {
+	fmt.Fprintf(w, "baseline %s -> %s\n", d.Before.Format(time.RFC3339), d.After.Format(time.RFC3339))
+	for _, t := range d.Changed {
+		fmt.Fprintf(w, "%s (%s)\n", t.Name, t.URL)
+		for _, ch := range t.Changes {
+			fmt.Fprintf(w, "  %s: %s -> %s\n", ch.Field, orNone(ch.Before), orNone(ch.After))
+		}
+	}
+	for _, name := range d.Added {
+		fmt.Fprintf(w, "added: %s\n", name)
+	}
+	for _, name := range d.Removed {
+		fmt.Fprintf(w, "removed: %s\n", name)
+	}
+	_, err := fmt.Fprintf(w, "%d unchanged, %d changed, %d added, %d removed\n",
+		d.Unchanged, len(d.Changed), len(d.Added), len(d.Removed))
+	return err
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	rtpeek "github.com/0x524A/rtspeek/pkg/rtspeek"
+	cli "github.com/urfave/cli/v2"
+)
+
+// targetFlags name a config file and select its targets.
+func targetFlags() []cli.Flag {
+	return append([]cli.Flag{
+		&cli.StringFlag{Name: "config", Usage: "Config file listing targets, profiles and credentials", Required: true},
+	}, selectionFlags()...)
+}
+
+// selectionFlags select the targets of a config file.
+func selectionFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{Name: "target", Usage: "Only probe the target with this name (repeatable)"},
+		&cli.StringFlag{Name: "site", Usage: "Only probe targets of this site"},
+		&cli.StringSliceFlag{Name: "label", Usage: "Only probe targets with this key=value label (repeatable)"},
+		&cli.IntFlag{Name: "concurrency", Usage: "Targets probed at once", Value: 8},
+	}
+}
+
+// loadTargets reads the config file and applies the target selection flags. Expectations given as flags
+// override those of the config on every selected target.
+func loadTargets(c *cli.Context) (*rtpeek.Config, []*rtpeek.ConfigTarget, error) {
+	cfg, err := rtpeek.LoadConfigFile(c.String("config"))
+	if err != nil {
+		return nil, nil, err
+	}
+	filter := rtpeek.TargetFilter{Names: c.StringSlice("target"), Site: c.String("site")}
+	for _, l := range c.StringSlice("label") {
+		k, v, ok := strings.Cut(l, "=")
+		if !ok {
+			return nil, nil, fmt.Errorf("invalid label %q: want key=value", l)
+		}
+		if filter.Labels == nil {
+			filter.Labels = make(map[string]string)
+		}
+		filter.Labels[k] = v
+	}
+	targets := cfg.Select(filter)
+	if len(targets) == 0 {
+		return nil, nil, fmt.Errorf("no targets match the selection")
+	}
+	expect, err := expectationsFromFlags(c)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !expect.IsZero() {
+		for _, t := range targets {
+			var e rtpeek.Expectations
+			if t.Expect != nil {
+				e = *t.Expect
+			}
+			e = e.Merge(expect)
+			t.Expect = &e
+		}
+	}
+	return cfg, targets, nil
+}
+
+// batchCommand probes every configured target once.
+func batchCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "batch",
+		Usage: "Describe every target of a config file once and print the results as a JSON array",
+		Flags: append(append(targetFlags(), expectFlags()...),
+			&cli.BoolFlag{Name: "pretty", Usage: "Pretty-print JSON output", Value: true},
+		),
+		Action: runBatch,
+	}
+}
+
+func runBatch(c *cli.Context) error {
+	cfg, targets, err := loadTargets(c)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	out := NewOutputFormatter(os.Stdout, c.Bool("pretty"))
+	results := rtpeek.ProbeTargets(ctx, cfg, targets, c.Int("concurrency"), nil)
+	list := make([]map[string]any, 0, len(results))
+	failed := false
+	for _, r := range results {
+		list = append(list, out.buildTargetOutput(r))
+		failed = failed || (r.Expect != nil && !r.Expect.Pass)
+	}
+	if err := out.WriteJSON(list); err != nil {
+		return fmt.Errorf("output formatting failed: %w", err)
+	}
+	if failed {
+		return expectationExit()
+	}
+	return nil
+}
+
+// watchCommand probes every configured target at an interval.
+func watchCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "watch",
+		Usage: "Describe every target of a config file at an interval, printing one JSON line per result",
+		Flags: append(append(append(targetFlags(), expectFlags()...), monitorFlags()...),
+			&cli.IntFlag{Name: "rounds", Usage: "Stop after this many rounds (0 runs until interrupted)"},
+		),
+		Action: runWatch,
+	}
+}
+
+func runWatch(c *cli.Context) error {
+	cfg, targets, err := loadTargets(c)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	mon, err := openMonitor(c, cfg)
+	if err != nil {
+		return err
+	}
+	defer mon.close()
+
+	out := NewOutputFormatter(os.Stdout, false)
+	probeRounds(ctx, c, cfg, targets, c.Int("rounds"), func(round int, r rtpeek.TargetResult) {
+		line := out.buildTargetOutput(r)
+		line["time"] = r.Start.UTC().Format(time.RFC3339Nano)
+		line["round"] = round
+		if ev := mon.observe(r); ev != nil {
+			line["alert"] = ev.State
+		}
+		_ = out.WriteJSON(line)
+	})
+	return nil
+}
+
+// monitorFlags configure the rounds, history and alerts of watch and serve.
+func monitorFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.DurationFlag{Name: "interval", Usage: "Time between the starts of two rounds", Value: time.Minute},
+		&cli.StringFlag{Name: "history", Usage: "Also append every result to the history store in this directory"},
+		&cli.DurationFlag{Name: "retention", Usage: "How long the history store keeps results", Value: rtpeek.DefaultHistoryRetention},
+		&cli.StringSliceFlag{Name: "alert-webhook", Usage: "POST state changes as JSON to this URL (repeatable)"},
+		&cli.StringSliceFlag{Name: "alert-slack", Usage: "Post state changes to this Slack-compatible incoming webhook (repeatable)"},
+		&cli.StringSliceFlag{Name: "alert-teams", Usage: "Post state changes to this Microsoft Teams webhook (repeatable)"},
+		&cli.StringSliceFlag{Name: "alert-exec", Usage: "Run this command per state change with the event JSON on stdin; split on spaces, without quoting (repeatable)"},
+	}
+}
+
+// probeRounds probes the targets every --interval until ctx ends or rounds (if positive) are done, calling
+// onResult with each result and the number of its round.
+func probeRounds(ctx context.Context, c *cli.Context, cfg *rtpeek.Config, targets []*rtpeek.ConfigTarget, rounds int, onResult func(round int, r rtpeek.TargetResult)) {
+	ticker := time.NewTicker(c.Duration("interval"))
+	defer ticker.Stop()
+	for round := 1; ; round++ {
+		rtpeek.ProbeTargets(ctx, cfg, targets, c.Int("concurrency"), func(r rtpeek.TargetResult) {
+			if ctx.Err() == nil {
+				onResult(round, r)
+			}
+		})
+		if rounds > 0 && round >= rounds {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// monitor records the results of watch and serve in the history store and turns them into alerts; either
+// part is nil when not configured.
+type monitor struct {
+	history *rtpeek.HistoryStore
+	alerter *rtpeek.Alerter
+}
+
+func openMonitor(c *cli.Context, cfg *rtpeek.Config) (*monitor, error) {
+	m := &monitor{}
+	if dir := c.String("history"); dir != "" {
+		history, err := rtpeek.OpenHistoryStore(dir, c.Duration("retention"))
+		if err != nil {
+			return nil, err
+		}
+		m.history = history
+	}
+	alerter, err := newAlerter(c, cfg)
+	if err != nil {
+		m.close()
+		return nil, err
+	}
+	m.alerter = alerter
+	return m, nil
+}
+
+// observe records r and returns the state change it caused, if any.
+func (m *monitor) observe(r rtpeek.TargetResult) *rtpeek.AlertEvent {
+	if m.history != nil {
+		if err := m.history.Append(rtpeek.NewHistoryRecord(r)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+	}
+	if m.alerter == nil {
+		return nil
+	}
+	return m.alerter.Observe(r)
+}
+
+// close delivers the queued alerts, giving up after 30s, and closes the history store.
+func (m *monitor) close() {
+	if m.alerter != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		_ = m.alerter.Close(ctx)
+	}
+	if m.history != nil {
+		_ = m.history.Close()
+	}
+}
+
+// configCommand groups config file subcommands.
+func configCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "config",
+		Usage: "Config file utilities",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "check",
+				Usage: "Validate a config file and report every problem with its position",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "config", Usage: "Config file to check", Required: true},
+				},
+				Action: func(c *cli.Context) error {
+					cfg, err := rtpeek.LoadConfigFile(c.String("config"))
+					if err != nil {
+						return err
+					}
+					sites := make(map[string]bool)
+					for _, t := range cfg.Targets {
+						sites[t.Site] = true
+					}
+					fmt.Printf("%s: %d targets in %d sites, %d profiles, %d credentials\n", c.String("config"),
+						len(cfg.Targets), len(sites), len(cfg.Profiles), len(cfg.Credentials))
+					return nil
+				},
+			},
+		},
+	}
+}
+
+// newAlerter builds the notifiers of the config's alerts block and the --alert-* flags (nil if none).
+func newAlerter(c *cli.Context, cfg *rtpeek.Config) (*rtpeek.Alerter, error) {
+	var notifiers []rtpeek.Notifier
+	opts := rtpeek.AlerterOptions{}
+	if cfg.Alerts != nil {
+		opts = cfg.Alerts.Options()
+		for i, n := range cfg.Alerts.Notifiers {
+			notifier, err := n.Notifier()
+			if err != nil {
+				return nil, fmt.Errorf("alerts.notifiers[%d]: %w", i, err)
+			}
+			notifiers = append(notifiers, notifier)
+		}
+	}
+	flags := []struct{ flag, format string }{
+		{"alert-webhook", rtpeek.WebhookJSON}, {"alert-slack", rtpeek.WebhookSlack}, {"alert-teams", rtpeek.WebhookTeams},
+	}
+	for _, f := range flags {
+		for _, u := range c.StringSlice(f.flag) {
+			notifiers = append(notifiers, &rtpeek.WebhookNotifier{URL: u, Format: f.format, Retries: rtpeek.DefaultWebhookRetries})
+		}
+	}
+	for _, command := range c.StringSlice("alert-exec") {
+		// Quotes are not parsed: quoted arguments need the config's command list
+		if strings.ContainsAny(command, `"'\`) {
+			return nil, fmt.Errorf("--alert-exec %q: quoting is not supported, use an exec notifier in the config file", command)
+		}
+		notifiers = append(notifiers, &rtpeek.ExecNotifier{Command: strings.Fields(command)})
+	}
+	if len(notifiers) == 0 {
+		return nil, nil
+	}
+	opts.OnError = func(notifier string, ev rtpeek.AlertEvent, err error) {
+		fmt.Fprintf(os.Stderr, "Error: %s notification for %s: %v\n", notifier, ev.Target, err)
+	}
+	opts.OnSuppressed = func(ev rtpeek.AlertEvent) {
+		fmt.Fprintf(os.Stderr, "rate limited: %s\n", ev.Summary())
+	}
+	return rtpeek.NewAlerter(notifiers, opts), nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	rtpeek "github.com/0x524A/rtspeek/pkg/rtspeek"
+	cli "github.com/urfave/cli/v2"
+)
+
+// discoverCommand scans address ranges for hosts that answer RTSP.
+func discoverCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "discover",
+		Usage:     "Scan CIDR ranges for RTSP endpoints, or find ONVIF devices on the local segment with --onvif",
+		ArgsUsage: "<cidr|ip> ...",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{Name: "cidr", Usage: "CIDR range or address to scan (repeatable, or pass them as arguments)"},
+			&cli.IntSliceFlag{Name: "ports", Usage: "Ports to probe on every host", Value: cli.NewIntSlice(rtpeek.DefaultDiscoverPorts...)},
+			&cli.IntFlag{Name: "concurrency", Usage: "Targets probed at once", Value: rtpeek.DefaultDiscoverConcurrency},
+			&cli.Float64Flag{Name: "rate", Usage: "Connection attempts started per second (negative for no limit)", Value: rtpeek.DefaultDiscoverRate},
+			&cli.DurationFlag{Name: "timeout", Usage: "Timeout for the connect and OPTIONS steps of each target", Value: 2 * time.Second},
+			&cli.StringFlag{Name: "path", Usage: "Path of the OPTIONS request URL", Value: "/"},
+			&cli.BoolFlag{Name: "onvif", Usage: "Find ONVIF devices with a WS-Discovery multicast Probe instead of scanning ranges"},
+			&cli.DurationFlag{Name: "wait", Usage: "With --onvif: how long to collect answers", Value: rtpeek.DefaultWSDiscoveryWait},
+			&cli.StringFlag{Name: "interface", Usage: "With --onvif: network interface to send the Probe from"},
+			&cli.StringFlag{Name: "probe-address", Usage: "With --onvif: send the Probe to this address instead of the multicast group"},
+			&cli.BoolFlag{Name: "streams", Usage: "With --onvif: resolve each device's stream URIs and describe them"},
+			&cli.StringFlag{Name: "user", Usage: "With --streams: user for ONVIF and RTSP"},
+			&cli.StringFlag{Name: "pass", Usage: "With --streams: password for ONVIF and RTSP"},
+			&cli.BoolFlag{Name: "events", Usage: "Stream endpoints or devices to stderr as JSON lines as they are found"},
+			&cli.BoolFlag{Name: "pretty", Usage: "Pretty-print JSON output", Value: true},
+		},
+		Action: runDiscover,
+	}
+}
+
+func runDiscover(c *cli.Context) error {
+	if c.Bool("onvif") {
+		return runDiscoverONVIF(c)
+	}
+	targets := append(c.StringSlice("cidr"), c.Args().Slice()...)
+	if len(targets) == 0 {
+		return fmt.Errorf("at least one CIDR range or address is required")
+	}
+	opts := rtpeek.DiscoverOptions{
+		Ports:       c.IntSlice("ports"),
+		Concurrency: c.Int("concurrency"),
+		Rate:        c.Float64("rate"),
+		Path:        c.String("path"),
+	}
+	if c.Bool("events") {
+		enc := json.NewEncoder(os.Stderr)
+		opts.OnEndpoint = func(ep rtpeek.DiscoveredEndpoint) { _ = enc.Encode(ep) }
+	}
+
+	// Ctrl-C ends the scan early but still prints what was found
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	report, err := rtpeek.Discover(ctx, targets, c.Duration("timeout"), opts)
+	if err != nil {
+		return fmt.Errorf("discover failed: %w", err)
+	}
+	if err := NewOutputFormatter(os.Stdout, c.Bool("pretty")).WriteJSON(report); err != nil {
+		return fmt.Errorf("output formatting failed: %w", err)
+	}
+	return nil
+}
+
+// runDiscoverONVIF lists the ONVIF devices answering a WS-Discovery Probe.
+func runDiscoverONVIF(c *cli.Context) error {
+	opts := rtpeek.WSDiscoveryOptions{
+		Address:        c.String("probe-address"),
+		Interface:      c.String("interface"),
+		Wait:           c.Duration("wait"),
+		ResolveStreams: c.Bool("streams"),
+		User:           c.String("user"),
+		Pass:           c.String("pass"),
+	}
+	if c.Bool("events") {
+		enc := json.NewEncoder(os.Stderr)
+		opts.OnDevice = func(d rtpeek.ONVIFDevice) { _ = enc.Encode(d) }
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	devices, err := rtpeek.DiscoverONVIF(ctx, c.Duration("timeout"), opts)
+	if err != nil {
+		return fmt.Errorf("onvif discovery failed: %w", err)
+	}
+	if err := NewOutputFormatter(os.Stdout, c.Bool("pretty")).WriteJSON(devices); err != nil {
+		return fmt.Errorf("output formatting failed: %w", err)
+	}
+	return nil
+}
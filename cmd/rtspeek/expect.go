@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	rtpeek "github.com/0x524A/rtspeek/pkg/rtspeek"
+	cli "github.com/urfave/cli/v2"
+)
+
+// expectFlags declare what the described stream must look like.
+func expectFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{Name: "expect-codec", Usage: "Fail unless the video codec is this one, e.g. H264"},
+		&cli.StringFlag{Name: "expect-min-resolution", Usage: "Fail unless a video track is at least WIDTHxHEIGHT"},
+		&cli.BoolFlag{Name: "expect-audio", Usage: "Fail unless an audio track is present (--expect-audio=false: absent)"},
+		&cli.Float64Flag{Name: "expect-min-fps", Usage: "Fail if the video frame rate is below this"},
+		&cli.Float64Flag{Name: "expect-max-fps", Usage: "Fail if the video frame rate is above this"},
+		&cli.DurationFlag{Name: "expect-max-gop", Usage: "Fail if the keyframe interval is longer (needs --live-probe)"},
+		&cli.DurationFlag{Name: "expect-max-latency", Usage: "Fail if connect and DESCRIBE take longer"},
+	}
+}
+
+// expectationsFromFlags returns the expectations given on the command line.
+func expectationsFromFlags(c *cli.Context) (rtpeek.Expectations, error) {
+	e := rtpeek.Expectations{
+		Codec:         c.String("expect-codec"),
+		MinResolution: c.String("expect-min-resolution"),
+		MinFPS:        c.Float64("expect-min-fps"),
+		MaxFPS:        c.Float64("expect-max-fps"),
+		MaxGOP:        rtpeek.ConfigDuration(c.Duration("expect-max-gop")),
+		MaxLatency:    rtpeek.ConfigDuration(c.Duration("expect-max-latency")),
+	}
+	if c.IsSet("expect-audio") {
+		audio := c.Bool("expect-audio")
+		e.Audio = &audio
+	}
+	if err := e.Validate(); err != nil {
+		return e, fmt.Errorf("invalid expectation: %w", err)
+	}
+	return e, nil
+}
+
+// expectationExit is the exit status of failed expectations, the same as lint failures.
+func expectationExit() error {
+	return cli.Exit("", 2)
+}
+
+// checkExpectations writes the describe output with the expectation report and fails when an
+// expectation is not met. With --metrics only the exit status reflects the report.
+func checkExpectations(c *cli.Context, of *OutputFormatter, url string, info rtpeek.StreamInfo, err error, expect rtpeek.Expectations) error {
+	report := expect.Check(info)
+	switch {
+	case c.Bool("metrics") && info != nil:
+		if werr := rtpeek.WritePrometheus(os.Stdout, rtpeek.CollectMetrics(info)); werr != nil {
+			return werr
+		}
+	default:
+		output := map[string]any{"url": url, "describe_ok": false}
+		if info != nil {
+			output = of.buildOutput(info)
+		}
+		if err != nil {
+			output["error"] = err.Error()
+		}
+		output["expectations"] = report
+		if werr := of.WriteJSON(output); werr != nil {
+			return fmt.Errorf("output formatting failed: %w", werr)
+		}
+	}
+	if !report.Pass {
+		return expectationExit()
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	rtpeek "github.com/0x524A/rtspeek/pkg/rtspeek"
+	cli "github.com/urfave/cli/v2"
+)
+
+// historyCommand summarizes the results recorded by watch --history.
+func historyCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "history",
+		Usage: "Summarize recorded results per target: uptime, failures, latency percentiles and last state change",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "dir", Usage: "History store directory (see watch --history)", Required: true},
+			&cli.DurationFlag{Name: "window", Usage: "Summarize the results of this last period", Value: 24 * time.Hour},
+			&cli.StringSliceFlag{Name: "target", Usage: "Only summarize the target with this name (repeatable)"},
+			&cli.BoolFlag{Name: "pretty", Usage: "Pretty-print JSON output", Value: true},
+		},
+		Action: runHistory,
+	}
+}
+
+func runHistory(c *cli.Context) error {
+	if _, err := os.Stat(c.String("dir")); err != nil {
+		return fmt.Errorf("history store: %w", err)
+	}
+	// A negative retention: queries never delete anything
+	store, err := rtpeek.OpenHistoryStore(c.String("dir"), -1)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	to := time.Now().UTC()
+	from := to.Add(-c.Duration("window"))
+	targets, err := store.Summary(from, time.Time{}, c.StringSlice("target"))
+	if err != nil {
+		return err
+	}
+	out := map[string]any{
+		"from":    from.Format(time.RFC3339),
+		"to":      to.Format(time.RFC3339),
+		"targets": targets,
+	}
+	if err := NewOutputFormatter(os.Stdout, c.Bool("pretty")).WriteJSON(out); err != nil {
+		return fmt.Errorf("output formatting failed: %w", err)
+	}
+	return nil
+}
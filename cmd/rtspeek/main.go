@@ -15,23 +15,59 @@ func main() {
 	app := &cli.App{
 		Name:  "rtpeek",
 		Usage: "Inspect an RTSP URL and output stream description JSON",
-		Flags: []cli.Flag{
-			&cli.StringFlag{Name: "url", Usage: "RTSP URL to inspect", Required: true},
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{Name: "url", Usage: "RTSP URL to inspect"},
 			&cli.DurationFlag{Name: "timeout", Usage: "Timeout for describe", Value: 5 * time.Second},
 			&cli.BoolFlag{Name: "pretty", Usage: "Pretty-print JSON output", Value: true},
 			&cli.BoolFlag{Name: "verbose", Usage: "Include failure reason on stderr"},
 			&cli.BoolFlag{Name: "debug", Usage: "Enable debug logging (legacy compatibility)"},
+			&cli.BoolFlag{Name: "raw-sdp", Usage: "Include the raw SDP text in the session output"},
+			&cli.BoolFlag{Name: "backchannel", Usage: "Request ONVIF backchannel tracks during DESCRIBE"},
+			&cli.DurationFlag{Name: "live-probe", Usage: "SETUP/PLAY the stream for this long after DESCRIBE and analyze received packets (0 disables)"},
+			&cli.StringFlag{Name: "transport", Usage: "Live probe transport: auto, udp, tcp, multicast", Value: "auto"},
+			&cli.BoolFlag{Name: "bitrate-series", Usage: "Include the per-second bitrate series of each track in the live probe output"},
+			&cli.BoolFlag{Name: "metrics", Usage: "Print Prometheus text-format metrics instead of JSON"},
+			&cli.StringFlag{Name: "record-session", Usage: "Write the RTSP exchange and first media packets to this session file (see replay)"},
+			&cli.IntFlag{Name: "record-packets", Usage: "Media packets kept in the session file", Value: rtpeek.DefaultRecordedPackets},
 			&cli.StringFlag{Name: "log-level", Usage: "Log level: disabled, error, warn, info, debug, trace", Value: "disabled"},
 			&cli.BoolFlag{Name: "log-console", Usage: "Enable pretty console logging to stderr", Value: false},
+		}, expectFlags()...),
+		Commands: []*cli.Command{
+			sdpCommand(),
+			snapshotCommand(),
+			recordCommand(),
+			soakCommand(),
+			analyzeCommand(),
+			replayCommand(),
+			discoverCommand(),
+			pathsCommand(),
+			onvifCommand(),
+			batchCommand(),
+			watchCommand(),
+			serveCommand(),
+			configCommand(),
+			baselineCommand(),
+			historyCommand(),
 		},
 		Action: func(c *cli.Context) error {
 			url := c.String("url")
+			if url == "" {
+				_ = cli.ShowAppHelp(c)
+				return fmt.Errorf("Required flag \"url\" not set")
+			}
 			timeout := c.Duration("timeout")
 			pretty := c.Bool("pretty")
 			verbose := c.Bool("verbose")
 			debug := c.Bool("debug")
 			logLevel := c.String("log-level")
 			logConsole := c.Bool("log-console")
+			rawSDP := c.Bool("raw-sdp")
+			backchannel := c.Bool("backchannel")
+			liveProbe := c.Duration("live-probe")
+			expect, err := expectationsFromFlags(c)
+			if err != nil {
+				return err
+			}
 
 			// Setup output formatter
 			outputFormatter := NewOutputFormatter(os.Stdout, pretty)
@@ -53,17 +89,46 @@ func main() {
 			if logger != nil {
 				ctx = rtpeek.WithLogger(ctx, logger)
 			}
+			if rawSDP {
+				ctx = rtpeek.WithRawSDP(ctx)
+			}
+			if backchannel {
+				ctx = rtpeek.WithBackchannel(ctx)
+			}
+			if liveProbe > 0 {
+				ctx = rtpeek.WithLiveProbe(ctx, rtpeek.LiveProbeOptions{
+					Duration:      liveProbe,
+					Transport:     c.String("transport"),
+					BitrateSeries: c.Bool("bitrate-series"),
+				})
+			}
+
+			var recorder *rtpeek.SessionRecorder
+			if c.String("record-session") != "" {
+				recorder = rtpeek.NewSessionRecorder(c.Int("record-packets"))
+				ctx = rtpeek.WithSessionRecorder(ctx, recorder)
+			}
 
 			// Perform RTSP describe operation
 			info, err := rtpeek.DescribeStream(ctx, url, timeout)
-			if err != nil {
-				// Print verbose error information to stderr if requested
-				if verbose {
-					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			if recorder != nil {
+				if werr := writeSessionFile(c.String("record-session"), recorder.Recording()); werr != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", werr)
 				}
-
+			}
+			if err != nil && verbose {
+				// Print verbose error information to stderr if requested
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			}
+			if !expect.IsZero() {
+				return checkExpectations(c, outputFormatter, url, info, err, expect)
+			}
+			if err != nil {
 				// For partial results (connection successful but RTSP failed), output the info
 				if info != nil {
+					if c.Bool("metrics") {
+						return rtpeek.WritePrometheus(os.Stdout, rtpeek.CollectMetrics(info))
+					}
 					return outputFormatter.WriteStreamInfo(info)
 				}
 
@@ -71,6 +136,10 @@ func main() {
 				return outputFormatter.WriteErrorOutput(url, err)
 			}
 
+			if c.Bool("metrics") {
+				return rtpeek.WritePrometheus(os.Stdout, rtpeek.CollectMetrics(info))
+			}
+
 			// Write main JSON output to stdout
 			if err := outputFormatter.WriteStreamInfo(info); err != nil {
 				return fmt.Errorf("output formatting failed: %w", err)
@@ -85,6 +154,19 @@ func main() {
 	}
 }
 
+// writeSessionFile saves a session recording.
+func writeSessionFile(path string, rec *rtpeek.SessionRecording) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create session file: %w", err)
+	}
+	if err := rtpeek.WriteSessionRecording(f, rec); err != nil {
+		f.Close()
+		return fmt.Errorf("write session file: %w", err)
+	}
+	return f.Close()
+}
+
 // parseLogLevel converts string log level to LogLevel enum
 func parseLogLevel(level string) rtpeek.LogLevel {
 	switch strings.ToLower(level) {
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	rtpeek "github.com/0x524A/rtspeek/pkg/rtspeek"
+	cli "github.com/urfave/cli/v2"
+)
+
+// onvifCommand resolves stream URIs through ONVIF and checks them against the device configuration.
+func onvifCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "onvif",
+		Usage: "Resolve the stream URI of every ONVIF media profile, describe it and compare it with the profile's encoder configuration",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "address", Usage: "Device address (host[:port]) or device service URL", Required: true},
+			&cli.StringFlag{Name: "user", Usage: "User for ONVIF and RTSP"},
+			&cli.StringFlag{Name: "pass", Usage: "Password for ONVIF and RTSP"},
+			&cli.DurationFlag{Name: "timeout", Usage: "Timeout for each ONVIF call and each describe", Value: 5 * time.Second},
+			&cli.BoolFlag{Name: "pretty", Usage: "Pretty-print JSON output", Value: true},
+		},
+		Action: runONVIF,
+	}
+}
+
+func runONVIF(c *cli.Context) error {
+	report, err := rtpeek.ProbeONVIF(context.Background(), c.String("address"), c.String("user"), c.String("pass"), c.Duration("timeout"))
+	if err != nil {
+		return fmt.Errorf("onvif probe failed: %w", err)
+	}
+	if err := NewOutputFormatter(os.Stdout, c.Bool("pretty")).WriteJSON(report); err != nil {
+		return fmt.Errorf("output formatting failed: %w", err)
+	}
+	return nil
+}
@@ -37,6 +37,24 @@ func (of *OutputFormatter) WriteStreamInfo(info rtpeek.StreamInfo) error {
 	return enc.Encode(output)
 }
 
+// WriteStreamInfos writes several StreamInfo values as a JSON array.
+func (of *OutputFormatter) WriteStreamInfos(infos []rtpeek.StreamInfo) error {
+	list := make([]map[string]any, 0, len(infos))
+	for _, info := range infos {
+		list = append(list, of.buildOutput(info))
+	}
+	return of.WriteJSON(list)
+}
+
+// WriteJSON writes an arbitrary value as JSON to the output.
+func (of *OutputFormatter) WriteJSON(v any) error {
+	enc := json.NewEncoder(of.writer)
+	if of.pretty {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(v)
+}
+
 // WriteErrorOutput writes a minimal error JSON response.
 func (of *OutputFormatter) WriteErrorOutput(url string, err error) error {
 	enc := json.NewEncoder(of.writer)
@@ -75,6 +93,21 @@ func (of *OutputFormatter) buildOutput(info rtpeek.StreamInfo) map[string]any {
 		output["other_medias"] = other
 	}
 
+	// Add session-level SDP details if present
+	if session := info.GetSessionDetails(); session != nil {
+		output["session"] = session
+	}
+
+	// Add live probe summary if present
+	if live := info.GetLiveProbe(); live != nil {
+		output["live_probe"] = live
+	}
+
+	// Add the capture summary of an analyzed capture
+	if capture := info.GetCapture(); capture != nil {
+		output["capture"] = capture
+	}
+
 	// Add debug trace if present
 	if debug := info.GetDebugData(); len(debug) > 0 {
 		output["debug_trace"] = debug
@@ -82,3 +115,28 @@ func (of *OutputFormatter) buildOutput(info rtpeek.StreamInfo) map[string]any {
 
 	return output
 }
+
+// buildTargetOutput is the output of a configured target: the stream output (or a failure) with the
+// target's name, site and labels, and its URL without credentials.
+func (of *OutputFormatter) buildTargetOutput(r rtpeek.TargetResult) map[string]any {
+	output := map[string]any{"describe_ok": false}
+	if r.Info != nil {
+		output = of.buildOutput(r.Info)
+	}
+	output["name"] = r.Target.Name
+	output["url"] = r.URL
+	if r.Target.Site != "" {
+		output["site"] = r.Target.Site
+	}
+	if len(r.Target.Labels) > 0 {
+		output["labels"] = r.Target.Labels
+	}
+	if r.Err != nil {
+		output["error"] = r.Err.Error()
+		output["failure"] = rtpeek.NewErrorClassifier().Classify(r.Err)
+	}
+	if r.Expect != nil {
+		output["expectations"] = r.Expect
+	}
+	return output
+}
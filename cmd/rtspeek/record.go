@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	rtpeek "github.com/0x524A/rtspeek/pkg/rtspeek"
+	cli "github.com/urfave/cli/v2"
+)
+
+// keyframeRecordCap bounds keyframe-based recordings when no --duration is given.
+const keyframeRecordCap = time.Minute
+
+// recordCommand captures a short clip of every supported track.
+func recordCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "record",
+		Usage: "Record N seconds or N keyframes of a stream into fragmented MP4 or MPEG-TS",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "url", Usage: "RTSP URL to record", Required: true},
+			&cli.StringFlag{Name: "output", Aliases: []string{"o"}, Usage: "Output file (default clip.mp4 or clip.ts)"},
+			&cli.StringFlag{Name: "format", Usage: "Container: fmp4 or mpegts (default from --output extension, else fmp4)"},
+			&cli.DurationFlag{Name: "duration", Usage: "Media duration to record", Value: 10 * time.Second},
+			&cli.IntFlag{Name: "keyframes", Usage: "Stop after N keyframes (GOPs); --duration still caps, 1m if not set"},
+			&cli.DurationFlag{Name: "timeout", Usage: "Timeout for connecting and waiting for the first keyframe", Value: 10 * time.Second},
+			&cli.StringFlag{Name: "transport", Usage: "Transport: auto, udp, tcp, multicast", Value: "auto"},
+			&cli.BoolFlag{Name: "pretty", Usage: "Pretty-print JSON output", Value: true},
+		},
+		Action: runRecord,
+	}
+}
+
+// recordOutput is the JSON document emitted by `record`.
+type recordOutput struct {
+	*rtpeek.RecordReport
+	File string `json:"file"`
+}
+
+func runRecord(c *cli.Context) error {
+	file := c.String("output")
+	opts := rtpeek.RecordOptions{
+		Format:    c.String("format"),
+		Duration:  c.Duration("duration"),
+		Keyframes: c.Int("keyframes"),
+		Transport: c.String("transport"),
+	}
+	if opts.Format == "" {
+		opts.Format = rtpeek.RecordFormatFMP4
+		if ext := strings.ToLower(filepath.Ext(file)); ext == ".ts" || ext == ".m2ts" {
+			opts.Format = rtpeek.RecordFormatMPEGTS
+		}
+	}
+	if file == "" {
+		file = "clip.mp4"
+		if opts.Format == rtpeek.RecordFormatMPEGTS {
+			file = "clip.ts"
+		}
+	}
+	if opts.Keyframes > 0 && !c.IsSet("duration") {
+		opts.Duration = keyframeRecordCap
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return fmt.Errorf("create output: %w", err)
+	}
+	report, err := rtpeek.Record(context.Background(), c.String("url"), c.Duration("timeout"), f, opts)
+	if cerr := f.Close(); err == nil && cerr != nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(file)
+		return fmt.Errorf("record failed: %w", err)
+	}
+
+	out := recordOutput{RecordReport: report, File: file}
+	if err := NewOutputFormatter(os.Stdout, c.Bool("pretty")).WriteJSON(out); err != nil {
+		return fmt.Errorf("output formatting failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	rtpeek "github.com/0x524A/rtspeek/pkg/rtspeek"
+	cli "github.com/urfave/cli/v2"
+)
+
+// replayCommand serves a recorded session file and, by default, probes it like the original run.
+func replayCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "replay",
+		Usage: "Serve a session file recorded with --record-session and reproduce the original probe against it",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "file", Usage: "Session file to replay", Required: true},
+			&cli.StringFlag{Name: "listen", Usage: "Address to serve on", Value: "127.0.0.1:0"},
+			&cli.BoolFlag{Name: "serve", Usage: "Keep serving until interrupted instead of probing once"},
+			&cli.DurationFlag{Name: "timeout", Usage: "Timeout for describe", Value: 5 * time.Second},
+			&cli.BoolFlag{Name: "pretty", Usage: "Pretty-print JSON output", Value: true},
+		},
+		Action: runReplay,
+	}
+}
+
+func runReplay(c *cli.Context) error {
+	f, err := os.Open(c.String("file"))
+	if err != nil {
+		return fmt.Errorf("open session file: %w", err)
+	}
+	rec, err := rtpeek.ReadSessionRecording(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	srv, err := rtpeek.NewReplayServer(rec, c.String("listen"))
+	if err != nil {
+		return fmt.Errorf("start replay server: %w", err)
+	}
+	defer srv.Close()
+
+	if c.Bool("serve") {
+		fmt.Fprintf(os.Stderr, "Replaying %s at %s\n", rec.URL, srv.URL)
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		<-ctx.Done()
+		return nil
+	}
+
+	// Probe with the options of the original run
+	ctx := context.Background()
+	if rec.Options.Backchannel {
+		ctx = rtpeek.WithBackchannel(ctx)
+	}
+	if rec.Options.LiveProbe > 0 {
+		ctx = rtpeek.WithLiveProbe(ctx, rtpeek.LiveProbeOptions{
+			Duration: time.Duration(rec.Options.LiveProbe * float64(time.Second)),
+		})
+	}
+	out := NewOutputFormatter(os.Stdout, c.Bool("pretty"))
+	info, err := rtpeek.DescribeStream(ctx, srv.URL, c.Duration("timeout"))
+	if err != nil && info == nil {
+		return out.WriteErrorOutput(srv.URL, err)
+	}
+	if err := out.WriteStreamInfo(info); err != nil {
+		return fmt.Errorf("output formatting failed: %w", err)
+	}
+	return nil
+}
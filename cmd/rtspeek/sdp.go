@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	rtpeek "github.com/0x524A/rtspeek/pkg/rtspeek"
+	cli "github.com/urfave/cli/v2"
+)
+
+// sdpCommand groups SDP-related subcommands.
+func sdpCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "sdp",
+		Usage: "SDP inspection tools",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "lint",
+				Usage: "Check a stream's SDP (or an SDP file) for spec violations and interop hazards",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "url", Usage: "RTSP URL to DESCRIBE and lint"},
+					&cli.StringFlag{Name: "file", Usage: "Lint SDP read from a file instead of a live DESCRIBE"},
+					&cli.StringFlag{Name: "base-url", Usage: "Base URL for resolving relative controls when linting a file"},
+					&cli.DurationFlag{Name: "timeout", Usage: "Timeout for describe", Value: 5 * time.Second},
+					&cli.StringFlag{Name: "fail-on", Usage: "Exit non-zero on findings at this severity or above: error, warning, never", Value: "error"},
+					&cli.BoolFlag{Name: "pretty", Usage: "Pretty-print JSON output", Value: true},
+				},
+				Action: runSDPLint,
+			},
+		},
+	}
+}
+
+// lintOutput is the JSON document emitted by `sdp lint`.
+type lintOutput struct {
+	Source   string           `json:"source"`
+	Findings []rtpeek.Finding `json:"findings"`
+	Errors   int              `json:"errors"`
+	Warnings int              `json:"warnings"`
+	Infos    int              `json:"infos"`
+}
+
+func runSDPLint(c *cli.Context) error {
+	url := c.String("url")
+	file := c.String("file")
+	if (url == "") == (file == "") {
+		return fmt.Errorf("exactly one of --url or --file is required")
+	}
+	// A mistyped --fail-on must not quietly weaken a CI gate
+	failOn := c.String("fail-on")
+	switch failOn {
+	case "error", "warning", "never":
+	default:
+		return fmt.Errorf("invalid --fail-on %q: want error, warning or never", failOn)
+	}
+
+	out := lintOutput{}
+	linter := rtpeek.NewSDPLinter()
+
+	if file != "" {
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("read SDP file: %w", err)
+		}
+		out.Source = file
+		out.Findings = linter.Lint(raw, c.String("base-url"))
+	} else {
+		ctx := rtpeek.WithRawSDP(context.Background())
+		info, err := rtpeek.DescribeStream(ctx, url, c.Duration("timeout"))
+		if err != nil {
+			return fmt.Errorf("describe failed: %w", err)
+		}
+		out.Source = url
+		if out.Findings, err = linter.LintStreamInfo(info); err != nil {
+			return err
+		}
+	}
+
+	if out.Findings == nil {
+		out.Findings = []rtpeek.Finding{}
+	}
+	for _, f := range out.Findings {
+		switch f.Severity {
+		case rtpeek.SeverityError:
+			out.Errors++
+		case rtpeek.SeverityWarning:
+			out.Warnings++
+		default:
+			out.Infos++
+		}
+	}
+
+	if err := NewOutputFormatter(os.Stdout, c.Bool("pretty")).WriteJSON(out); err != nil {
+		return fmt.Errorf("output formatting failed: %w", err)
+	}
+
+	switch failOn {
+	case "warning":
+		if out.Errors+out.Warnings > 0 {
+			return cli.Exit("", 2)
+		}
+	case "error":
+		if out.Errors > 0 {
+			return cli.Exit("", 2)
+		}
+	}
+	return nil
+}
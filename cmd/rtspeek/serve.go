@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	rtpeek "github.com/0x524A/rtspeek/pkg/rtspeek"
+	cli "github.com/urfave/cli/v2"
+)
+
+// serveCommand probes every configured target at an interval and serves the latest results over HTTP.
+func serveCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "serve",
+		Usage: "Describe every target of a config file at an interval and serve the latest results, metrics and history over HTTP",
+		Flags: append(append(append(targetFlags(), expectFlags()...), monitorFlags()...),
+			&cli.StringFlag{Name: "listen", Usage: "HTTP listen address", Value: "127.0.0.1:9455"},
+		),
+		Action: runServe,
+	}
+}
+
+func runServe(c *cli.Context) error {
+	cfg, targets, err := loadTargets(c)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	mon, err := openMonitor(c, cfg)
+	if err != nil {
+		return err
+	}
+	defer mon.close()
+
+	l, err := net.Listen("tcp", c.String("listen"))
+	if err != nil {
+		return err
+	}
+	state := &serveState{history: mon.history, latest: make(map[string]serveResult)}
+	srv := &http.Server{Handler: state.handler(), ReadHeaderTimeout: 10 * time.Second}
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- srv.Serve(l) }()
+	fmt.Fprintf(os.Stderr, "serving %d targets on http://%s\n", len(targets), l.Addr())
+
+	rounds := make(chan struct{})
+	go func() {
+		defer close(rounds)
+		out := NewOutputFormatter(nil, false)
+		probeRounds(ctx, c, cfg, targets, 0, func(round int, r rtpeek.TargetResult) {
+			line := out.buildTargetOutput(r)
+			line["time"] = r.Start.UTC().Format(time.RFC3339Nano)
+			line["round"] = round
+			if ev := mon.observe(r); ev != nil {
+				line["alert"] = ev.State
+			}
+			state.set(r, line)
+		})
+	}()
+
+	select {
+	case <-ctx.Done():
+		err = nil
+	case err = <-serveErr:
+		stop()
+	}
+	<-rounds
+	shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = srv.Shutdown(shutdown)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// serveResult is the latest result of one target.
+type serveResult struct {
+	result rtpeek.TargetResult
+	output map[string]any
+}
+
+// serveState holds the latest result of each target for the HTTP handlers.
+type serveState struct {
+	history *rtpeek.HistoryStore // nil without --history
+
+	mu     sync.Mutex
+	latest map[string]serveResult
+}
+
+func (s *serveState) set(r rtpeek.TargetResult, output map[string]any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latest[r.Target.Name] = serveResult{result: r, output: output}
+}
+
+// snapshot returns the latest results sorted by target name.
+func (s *serveState) snapshot() []serveResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]serveResult, 0, len(s.latest))
+	for _, r := range s.latest {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].result.Target.Name < list[j].result.Target.Name })
+	return list
+}
+
+// handler serves /status (latest output per target), /metrics (Prometheus), /history (see the history
+// command) and /healthz.
+func (s *serveState) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		list := []map[string]any{}
+		for _, res := range s.snapshot() {
+			list = append(list, res.output)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = NewOutputFormatter(w, true).WriteJSON(list)
+	})
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, r *http.Request) {
+		var metrics []rtpeek.Metric
+		for _, res := range s.snapshot() {
+			metrics = append(metrics, rtpeek.CollectTargetMetrics(res.result)...)
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = rtpeek.WritePrometheus(w, metrics)
+	})
+	mux.HandleFunc("GET /history", func(w http.ResponseWriter, r *http.Request) {
+		if s.history == nil {
+			http.Error(w, "history is not enabled (start serve with --history)", http.StatusNotFound)
+			return
+		}
+		window := 24 * time.Hour
+		if v := r.URL.Query().Get("window"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				http.Error(w, fmt.Sprintf("invalid window %q", v), http.StatusBadRequest)
+				return
+			}
+			window = d
+		}
+		to := time.Now().UTC()
+		from := to.Add(-window)
+		targets, err := s.history.Summary(from, time.Time{}, r.URL.Query()["target"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = NewOutputFormatter(w, true).WriteJSON(map[string]any{
+			"from":    from.Format(time.RFC3339),
+			"to":      to.Format(time.RFC3339),
+			"targets": targets,
+		})
+	})
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok\n"))
+	})
+	return mux
+}
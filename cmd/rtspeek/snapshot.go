@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	rtpeek "github.com/0x524A/rtspeek/pkg/rtspeek"
+	cli "github.com/urfave/cli/v2"
+)
+
+// snapshotCommand captures the first keyframe of a stream to a file.
+func snapshotCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "snapshot",
+		Usage: "Save the first keyframe (.jpg for MJPEG, Annex-B .h264/.h265 otherwise) and print its metadata",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "url", Usage: "RTSP URL to capture", Required: true},
+			&cli.StringFlag{Name: "output", Aliases: []string{"o"}, Usage: "Output file (default snapshot<ext> by codec)"},
+			&cli.IntFlag{Name: "media", Usage: "SDP media index to capture (-1 picks the first video track)", Value: -1},
+			&cli.DurationFlag{Name: "timeout", Usage: "Timeout for the whole capture, including the wait for a keyframe", Value: 10 * time.Second},
+			&cli.StringFlag{Name: "transport", Usage: "Transport: auto, udp, tcp, multicast", Value: "auto"},
+			&cli.BoolFlag{Name: "pretty", Usage: "Pretty-print JSON output", Value: true},
+		},
+		Action: runSnapshot,
+	}
+}
+
+// snapshotOutput is the JSON document emitted by `snapshot`.
+type snapshotOutput struct {
+	*rtpeek.Snapshot
+	File string `json:"file"`
+}
+
+func runSnapshot(c *cli.Context) error {
+	opts := rtpeek.SnapshotOptions{Transport: c.String("transport"), MediaIndex: c.Int("media")}
+	snap, err := rtpeek.CaptureSnapshot(context.Background(), c.String("url"), c.Duration("timeout"), opts)
+	if err != nil {
+		return fmt.Errorf("snapshot failed: %w", err)
+	}
+
+	file := c.String("output")
+	if file == "" {
+		file = "snapshot" + snap.Extension
+	}
+	if err := os.WriteFile(file, snap.Data, 0o644); err != nil {
+		return fmt.Errorf("write snapshot: %w", err)
+	}
+
+	out := snapshotOutput{Snapshot: snap, File: file}
+	if err := NewOutputFormatter(os.Stdout, c.Bool("pretty")).WriteJSON(out); err != nil {
+		return fmt.Errorf("output formatting failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	rtpeek "github.com/0x524A/rtspeek/pkg/rtspeek"
+	cli "github.com/urfave/cli/v2"
+)
+
+// soakCommand holds a session open for a long time and reports its stability.
+func soakCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "soak",
+		Usage: "Keep a PLAY session open for a long time and record disconnects, stalls and stream changes",
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "url", Usage: "RTSP URL to soak", Required: true},
+			&cli.DurationFlag{Name: "duration", Usage: "How long to keep the stream open", Value: time.Hour},
+			&cli.DurationFlag{Name: "stall", Usage: "Silence on a track that counts as a stall", Value: rtpeek.DefaultSoakStallThreshold},
+			&cli.BoolFlag{Name: "stall-metadata", Usage: "Also detect stalls on ONVIF metadata and KLV tracks"},
+			&cli.DurationFlag{Name: "reconnect-delay", Usage: "Pause before reconnecting after a disconnect", Value: rtpeek.DefaultSoakReconnectDelay},
+			&cli.DurationFlag{Name: "timeout", Usage: "Timeout for each connection attempt", Value: 10 * time.Second},
+			&cli.StringFlag{Name: "transport", Usage: "Transport: auto, udp, tcp, multicast", Value: "auto"},
+			&cli.BoolFlag{Name: "events", Usage: "Stream timeline events to stderr as JSON lines while soaking"},
+			&cli.BoolFlag{Name: "pretty", Usage: "Pretty-print JSON output", Value: true},
+		},
+		Action: runSoak,
+	}
+}
+
+func runSoak(c *cli.Context) error {
+	opts := rtpeek.SoakOptions{
+		Duration:       c.Duration("duration"),
+		StallThreshold: c.Duration("stall"),
+		StallMetadata:  c.Bool("stall-metadata"),
+		ReconnectDelay: c.Duration("reconnect-delay"),
+		Transport:      c.String("transport"),
+	}
+	if c.Bool("events") {
+		enc := json.NewEncoder(os.Stderr)
+		opts.OnEvent = func(e rtpeek.SoakEvent) { _ = enc.Encode(e) }
+	}
+
+	// Ctrl-C ends the soak early but still prints the report
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	report, err := rtpeek.Soak(ctx, c.String("url"), c.Duration("timeout"), opts)
+	if err != nil {
+		return fmt.Errorf("soak failed: %w", err)
+	}
+	if err := NewOutputFormatter(os.Stdout, c.Bool("pretty")).WriteJSON(report); err != nil {
+		return fmt.Errorf("output formatting failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package rtspeek
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Alert states.
+const (
+	AlertStateDown = "down"
+	AlertStateUp   = "up"
+)
+
+// DefaultAlertQueue is the number of events an Alerter buffers while notifiers are slow.
+const DefaultAlertQueue = 256
+
+// ErrAlertQueueFull is reported to OnError for an event dropped because DefaultAlertQueue events were
+// already waiting for delivery.
+var ErrAlertQueueFull = errors.New("alert queue full, event dropped")
+
+// AlertEvent is a state change of a target.
+type AlertEvent struct {
+	Target string            `json:"target"`
+	URL    string            `json:"url"` // without credentials
+	Site   string            `json:"site,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+	State  string            `json:"state"` // AlertStateDown or AlertStateUp
+	// Resolved marks the up event that ends an outage that was notified.
+	Resolved bool      `json:"resolved"`
+	Time     time.Time `json:"time"`
+	// Since is when the outage began (the first failed probe); on up events it is the outage start too.
+	Since   time.Time `json:"since"`
+	Failure string    `json:"failure,omitempty"` // error classification of the last failed probe
+	Error   string    `json:"error,omitempty"`
+	// Failures is the number of consecutive failed probes that led to a down event.
+	Failures int `json:"failures,omitempty"`
+}
+
+// Summary is a one-line description, e.g. "lobby is down (timeout)".
+func (ev AlertEvent) Summary() string {
+	if ev.State == AlertStateUp {
+		return fmt.Sprintf("%s is up again after %s", ev.Target, ev.Time.Sub(ev.Since).Round(time.Second))
+	}
+	return fmt.Sprintf("%s is down (%s)", ev.Target, ev.Failure)
+}
+
+// AlerterOptions configures an Alerter.
+type AlerterOptions struct {
+	// FailAfter is the number of consecutive failed probes that make a target down (1 if lower), so a
+	// single lost probe does not page anyone.
+	FailAfter int
+	// MinInterval is the least time between two down notices of the same target; a target that flaps
+	// faster is only notified once. Resolution notices of notified outages are always sent.
+	MinInterval time.Duration
+	// MaxPerHour caps the down notices sent in any hour, across targets (0 for no cap).
+	MaxPerHour int
+	// OnError, if set, is called when a notifier fails to deliver an event, and from Observe with the
+	// notifier "queue" and ErrAlertQueueFull when an event is dropped because notifiers fall behind.
+	OnError func(notifier string, ev AlertEvent, err error)
+	// OnSuppressed, if set, is called for events withheld by MinInterval or MaxPerHour, and for the
+	// resolution of a down event that was dropped.
+	OnSuppressed func(ev AlertEvent)
+}
+
+// Alerter turns probe results into state change events and delivers them through notifiers, in order,
+// from a background goroutine. Targets start in an unknown state: a target first seen up raises nothing.
+type Alerter struct {
+	notifiers []Notifier
+	opts      AlerterOptions
+	queue     chan AlertEvent
+	done      chan struct{}
+	ctx       context.Context
+	cancel    context.CancelFunc
+
+	mu      sync.Mutex
+	targets map[string]*alertTarget
+	dropped map[string]bool // targets whose down event was dropped
+
+	// delivery state, owned by the run goroutine
+	sent       []time.Time // down notices of the last hour
+	lastNotice map[string]time.Time
+	suppressed map[string]bool // outages whose down notice was withheld
+}
+
+type alertTarget struct {
+	state    string
+	failures int
+	since    time.Time
+}
+
+// NewAlerter starts an Alerter; Close stops it.
+func NewAlerter(notifiers []Notifier, opts AlerterOptions) *Alerter {
+	ctx, cancel := context.WithCancel(context.Background())
+	a := &Alerter{
+		notifiers:  notifiers,
+		opts:       opts,
+		queue:      make(chan AlertEvent, DefaultAlertQueue),
+		done:       make(chan struct{}),
+		ctx:        ctx,
+		cancel:     cancel,
+		targets:    make(map[string]*alertTarget),
+		dropped:    make(map[string]bool),
+		lastNotice: make(map[string]time.Time),
+		suppressed: make(map[string]bool),
+	}
+	go a.run()
+	return a
+}
+
+// Observe feeds a probe result and returns the state change it caused, if any, after queueing it for
+// delivery. It never blocks on notifiers: when the queue is full the event is dropped (see OnError).
+func (a *Alerter) Observe(r TargetResult) *AlertEvent {
+	rec := NewHistoryRecord(r)
+	a.mu.Lock()
+	t := a.targets[rec.Target]
+	if t == nil {
+		t = &alertTarget{}
+		a.targets[rec.Target] = t
+	}
+	ev := AlertEvent{Target: rec.Target, URL: rec.URL, Site: r.Target.Site, Labels: r.Target.Labels, Time: rec.Time}
+	changed := false
+	if rec.OK {
+		if t.state == AlertStateDown {
+			ev.State, ev.Resolved, ev.Since = AlertStateUp, true, t.since
+			changed = true
+		}
+		t.state, t.failures = AlertStateUp, 0
+	} else {
+		if t.failures == 0 {
+			t.since = rec.Time
+		}
+		t.failures++
+		if t.state != AlertStateDown && t.failures >= max(a.opts.FailAfter, 1) {
+			t.state = AlertStateDown
+			ev.State, ev.Since, ev.Failure, ev.Failures = AlertStateDown, t.since, rec.Failure, t.failures
+			switch {
+			case r.Err != nil:
+				ev.Error = r.Err.Error()
+			case r.Expect != nil:
+				ev.Error = fmt.Sprintf("%d of %d expectations failed", r.Expect.Failed, len(r.Expect.Assertions))
+			}
+			changed = true
+		}
+	}
+	if !changed {
+		a.mu.Unlock()
+		return nil
+	}
+	full, withheld := false, ev.State == AlertStateUp && a.dropped[ev.Target]
+	delete(a.dropped, ev.Target)
+	if !withheld {
+		select {
+		case a.queue <- ev:
+		default:
+			full = true
+			a.dropped[ev.Target] = ev.State == AlertStateDown
+		}
+	}
+	a.mu.Unlock()
+	switch {
+	case full && a.opts.OnError != nil:
+		a.opts.OnError("queue", ev, ErrAlertQueueFull)
+	case withheld && a.opts.OnSuppressed != nil:
+		a.opts.OnSuppressed(ev)
+	}
+	return &ev
+}
+
+// Close delivers the queued events (giving up when ctx ends) and stops the Alerter.
+func (a *Alerter) Close(ctx context.Context) error {
+	close(a.queue)
+	select {
+	case <-a.done:
+		return nil
+	case <-ctx.Done():
+		a.cancel()
+		<-a.done
+		return ctx.Err()
+	}
+}
+
+func (a *Alerter) run() {
+	defer close(a.done)
+	for ev := range a.queue {
+		if !a.admit(ev, time.Now()) {
+			if a.opts.OnSuppressed != nil {
+				a.opts.OnSuppressed(ev)
+			}
+			continue
+		}
+		for _, n := range a.notifiers {
+			if err := n.Notify(a.ctx, ev); err != nil && a.opts.OnError != nil {
+				a.opts.OnError(n.Name(), ev, err)
+			}
+		}
+	}
+}
+
+// admit applies the rate limits. Resolution notices follow their down notice: sent if it was.
+func (a *Alerter) admit(ev AlertEvent, now time.Time) bool {
+	if ev.State == AlertStateUp {
+		if a.suppressed[ev.Target] {
+			delete(a.suppressed, ev.Target)
+			return false
+		}
+		return true
+	}
+	cutoff := now.Add(-time.Hour)
+	for len(a.sent) > 0 && !a.sent[0].After(cutoff) {
+		a.sent = a.sent[1:]
+	}
+	last, seen := a.lastNotice[ev.Target]
+	if seen && now.Sub(last) < a.opts.MinInterval || a.opts.MaxPerHour > 0 && len(a.sent) >= a.opts.MaxPerHour {
+		a.suppressed[ev.Target] = true
+		return false
+	}
+	a.sent = append(a.sent, now)
+	a.lastNotice[ev.Target] = now
+	return true
+}
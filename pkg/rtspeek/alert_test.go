@@ -0,0 +1,266 @@
+package rtspeek
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingNotifier keeps the events it is given.
+type recordingNotifier struct {
+	mu     sync.Mutex
+	events []AlertEvent
+}
+
+func (r *recordingNotifier) Name() string { return "recording" }
+
+func (r *recordingNotifier) Notify(_ context.Context, ev AlertEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, ev)
+	return nil
+}
+
+func (r *recordingNotifier) states() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var s []string
+	for _, ev := range r.events {
+		s = append(s, ev.Target+":"+ev.State)
+	}
+	return strings.Join(s, " ")
+}
+
+// probeResult fakes a ProbeTargets result: up, or down with a timeout.
+func probeResult(name string, up bool, at time.Time) TargetResult {
+	r := TargetResult{Target: &ConfigTarget{Name: name}, URL: "rtsp://" + name + "/s", Start: at}
+	if up {
+		r.Info = &streamInfo{DescribeOK: true}
+	} else {
+		r.Err = errors.New("operation timed out after 5s")
+	}
+	return r
+}
+
+func TestAlerterTransitions(t *testing.T) {
+	rec := &recordingNotifier{}
+	a := NewAlerter([]Notifier{rec}, AlerterOptions{FailAfter: 2})
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var raised []string
+	for i, step := range []struct {
+		target string
+		up     bool
+	}{
+		{"a", true}, {"a", false}, {"a", true}, // one lost probe is not an outage
+		{"a", false}, {"a", false}, {"a", false}, {"a", true},
+		{"b", false}, {"b", false},
+	} {
+		if ev := a.Observe(probeResult(step.target, step.up, start.Add(time.Duration(i)*time.Minute))); ev != nil {
+			raised = append(raised, ev.Target+":"+ev.State)
+		}
+	}
+	if err := a.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(raised, " "), "a:down a:up b:down"; got != want {
+		t.Fatalf("raised %q, want %q", got, want)
+	}
+	if got := rec.states(); got != "a:down a:up b:down" {
+		t.Fatalf("delivered %q", got)
+	}
+	down, up := rec.events[0], rec.events[1]
+	if down.Failure != "timeout" || down.Failures != 2 || !down.Since.Equal(start.Add(3*time.Minute)) {
+		t.Fatalf("unexpected down event: %+v", down)
+	}
+	if !up.Resolved || up.Summary() != "a is up again after 3m0s" {
+		t.Fatalf("unexpected up event: %+v (%s)", up, up.Summary())
+	}
+}
+
+func TestAlerterRateLimits(t *testing.T) {
+	rec := &recordingNotifier{}
+	var suppressed []string
+	a := NewAlerter([]Notifier{rec}, AlerterOptions{
+		MinInterval:  time.Hour,
+		MaxPerHour:   2,
+		OnSuppressed: func(ev AlertEvent) { suppressed = append(suppressed, ev.Target+":"+ev.State) },
+	})
+	now := time.Now()
+	for _, step := range []struct {
+		target string
+		up     bool
+	}{
+		{"a", false}, {"a", true}, // notified and resolved
+		{"a", false}, {"a", true}, // flapping within MinInterval: withheld, resolution too
+		{"b", false}, {"c", false}, {"c", true}, // c is over MaxPerHour
+	} {
+		a.Observe(probeResult(step.target, step.up, now))
+	}
+	if err := a.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := rec.states(); got != "a:down a:up b:down" {
+		t.Fatalf("delivered %q", got)
+	}
+	if got := strings.Join(suppressed, " "); got != "a:down a:up c:down c:up" {
+		t.Fatalf("suppressed %q", got)
+	}
+}
+
+// blockingNotifier holds every delivery until release is closed.
+type blockingNotifier struct{ release chan struct{} }
+
+func (b *blockingNotifier) Name() string { return "blocking" }
+
+func (b *blockingNotifier) Notify(ctx context.Context, _ AlertEvent) error {
+	select {
+	case <-b.release:
+	case <-ctx.Done():
+	}
+	return nil
+}
+
+func TestAlerterQueueFull(t *testing.T) {
+	slow := &blockingNotifier{release: make(chan struct{})}
+	var mu sync.Mutex
+	var dropped, suppressed []string
+	a := NewAlerter([]Notifier{slow}, AlerterOptions{
+		OnError: func(notifier string, ev AlertEvent, err error) {
+			if notifier != "queue" || !errors.Is(err, ErrAlertQueueFull) {
+				t.Errorf("unexpected error from %s: %v", notifier, err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			dropped = append(dropped, ev.Target)
+		},
+		OnSuppressed: func(ev AlertEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			suppressed = append(suppressed, ev.Target+":"+ev.State)
+		},
+	})
+	now := time.Now()
+	observed := make(chan struct{})
+	go func() {
+		defer close(observed)
+		// One event is held by the notifier, DefaultAlertQueue wait in the queue, the rest are dropped
+		for i := 0; i < DefaultAlertQueue+4; i++ {
+			a.Observe(probeResult(fmt.Sprintf("cam%03d", i), false, now))
+		}
+	}()
+	select {
+	case <-observed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Observe blocked on a full queue")
+	}
+
+	mu.Lock()
+	n := len(dropped)
+	last := ""
+	if n > 0 {
+		last = dropped[n-1]
+	}
+	mu.Unlock()
+	if n < 3 {
+		t.Fatalf("%d events reported dropped, want at least 3", n)
+	}
+	// The resolution of a dropped outage is withheld rather than sent on its own
+	if ev := a.Observe(probeResult(last, true, now)); ev == nil || ev.State != AlertStateUp {
+		t.Fatalf("expected an up event for %s, got %+v", last, ev)
+	}
+	close(slow.release)
+	if err := a.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(suppressed, " "); got != last+":up" {
+		t.Fatalf("suppressed %q, want %s:up", got, last)
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var mu sync.Mutex
+	var bodies []string
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts == 1 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, r.Header.Get("X-Token")+" "+string(b))
+	}))
+	defer srv.Close()
+
+	ev := AlertEvent{Target: "lobby", URL: "rtsp://10.0.0.5/s", State: AlertStateDown, Failure: "timeout"}
+	body, err := ParseWebhookBody(`{"camera": {{json .Target}}, "text": {{json .Summary}}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &WebhookNotifier{URL: srv.URL, Body: body, Headers: map[string]string{"X-Token": "t"}, Retries: 1, Backoff: time.Millisecond}
+	if err := w.Notify(context.Background(), ev); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	for _, format := range []string{WebhookSlack, WebhookTeams} {
+		if err := (&WebhookNotifier{URL: srv.URL, Format: format}).Notify(context.Background(), ev); err != nil {
+			t.Fatalf("Notify %s: %v", format, err)
+		}
+	}
+	if attempts != 4 || len(bodies) != 3 {
+		t.Fatalf("got %d attempts, %d deliveries", attempts, len(bodies))
+	}
+	if want := `t {"camera": "lobby", "text": "lobby is down (timeout)"}`; bodies[0] != want {
+		t.Fatalf("templated body = %q, want %q", bodies[0], want)
+	}
+	var slack struct{ Text string }
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(bodies[1], " ")), &slack); err != nil || !strings.HasSuffix(slack.Text, "lobby is down (timeout)") {
+		t.Fatalf("unexpected slack payload %q", bodies[1])
+	}
+	var teams struct {
+		Type    string `json:"@type"`
+		Summary string `json:"summary"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(bodies[2], " ")), &teams); err != nil || teams.Type != "MessageCard" || teams.Summary == "" {
+		t.Fatalf("unexpected teams payload %q", bodies[2])
+	}
+
+	failing := &WebhookNotifier{URL: srv.URL + "/missing", Retries: 3, Backoff: time.Millisecond}
+	if err := failing.Notify(context.Background(), ev); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("expected a 404 error without retries, got %v", err)
+	}
+}
+
+func TestExecNotifier(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "event")
+	x := &ExecNotifier{Command: []string{"sh", "-c", `printf '%s ' "$RTSPEEK_STATE" > "$0"; cat >> "$0"`, out}}
+	ev := AlertEvent{Target: "lobby", State: AlertStateDown, Failure: "timeout"}
+	if err := x.Notify(context.Background(), ev); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), `down {"target":"lobby"`) {
+		t.Fatalf("unexpected command input %q", data)
+	}
+	if err := (&ExecNotifier{Command: []string{"sh", "-c", "echo nope >&2; exit 3"}}).Notify(context.Background(), ev); err == nil || !strings.Contains(err.Error(), "nope") {
+		t.Fatalf("expected the command failure with its output, got %v", err)
+	}
+}
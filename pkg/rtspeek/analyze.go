@@ -0,0 +1,626 @@
+package rtspeek
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/headers"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+// ErrNoRTSPConversation is returned by AnalyzeCapture when the capture holds no RTSP over TCP.
+var ErrNoRTSPConversation = errors.New("no RTSP conversation found in capture")
+
+// maxRequestLine bounds the first line inspected when looking for RTSP in a TCP stream.
+const maxRequestLine = 4096
+
+// AnalyzeCapture reads a pcap or pcapng capture and rebuilds one StreamInfo per RTSP connection in it,
+// in order of appearance. OPTIONS/DESCRIBE exchanges and the SDP go through the same classification as
+// DescribeStream; when the capture also holds SETUP/PLAY and media (interleaved or UDP), the packets are
+// fed to the live probe analyzers with their capture timestamps. Every StreamInfo carries a summary of the
+// capture frames that could not be decoded (GetCapture).
+//
+// The context takes the same options as DescribeStream: WithRawSDP, WithDebug (adds the RTSP exchange as
+// the debug trace) and the BitrateSeries field of WithLiveProbe; the capture decides the PLAY window.
+func AnalyzeCapture(ctx context.Context, r io.Reader) ([]StreamInfo, error) {
+	pkts, st, err := readCapture(r)
+	if err != nil && len(pkts) == 0 {
+		return nil, err
+	}
+
+	convs := findRTSPConversations(pkts)
+	if len(convs) == 0 {
+		if unused := st.unused(); unused != "" {
+			return nil, fmt.Errorf("%w (%s)", ErrNoRTSPConversation, unused)
+		}
+		return nil, ErrNoRTSPConversation
+	}
+
+	opts, _ := ctx.Value(liveProbeKey).(LiveProbeOptions)
+	var infos []StreamInfo
+	var bindings []udpBinding
+	for _, c := range convs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		info, b := c.analyze(opts, wantRawSDP(ctx), isDebug(ctx))
+		info.Capture = st.summary()
+		infos = append(infos, info)
+		bindings = append(bindings, b...)
+	}
+
+	// UDP media is attributed to the conversation that negotiated its ports
+	if len(bindings) > 0 {
+		for i := range pkts {
+			if p := &pkts[i]; p.proto == ipProtoUDP {
+				for _, b := range bindings {
+					if b.matches(p) {
+						b.feed(p)
+						break
+					}
+				}
+			}
+		}
+	}
+	for _, c := range convs {
+		c.finish(st)
+	}
+	return infos, nil
+}
+
+// tcpStream is one direction of a TCP connection, reassembled.
+type tcpStream struct {
+	data    []byte
+	chunks  []streamChunk // ascending offsets
+	missing int64         // bytes absent from the capture
+}
+
+// streamChunk records when the bytes from offset onward were captured.
+type streamChunk struct {
+	offset int
+	ts     time.Time
+}
+
+// timeAt returns the capture time of the byte at offset.
+func (s *tcpStream) timeAt(offset int) time.Time {
+	i := sort.Search(len(s.chunks), func(i int) bool { return s.chunks[i].offset > offset })
+	if i == 0 {
+		return time.Time{}
+	}
+	return s.chunks[i-1].ts
+}
+
+// reassembleTCP orders the segments of one direction by sequence number, dropping retransmissions
+// and skipping over bytes the capture missed.
+func reassembleTCP(segs []*capturedPacket) *tcpStream {
+	type segment struct {
+		rel  int64
+		pkt  *capturedPacket
+		syn  bool
+		data []byte
+	}
+	var list []segment
+	var last int64
+	for i, p := range segs {
+		// Unwrap sequence numbers relative to the previous segment
+		rel := int64(0)
+		if i > 0 {
+			rel = last + int64(int32(p.seq-segs[i-1].seq))
+		}
+		last = rel
+		list = append(list, segment{rel: rel, pkt: p, syn: p.flags&tcpFlagSYN != 0, data: p.payload})
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].rel < list[j].rel })
+
+	s := &tcpStream{}
+	var next int64
+	started := false
+	for _, seg := range list {
+		if seg.syn {
+			seg.rel++ // SYN occupies one sequence number
+			if !started {
+				next, started = seg.rel, true
+			}
+		}
+		if len(seg.data) == 0 {
+			continue
+		}
+		if !started {
+			next, started = seg.rel, true
+		}
+		end := seg.rel + int64(len(seg.data))
+		if end <= next {
+			continue // retransmission
+		}
+		data := seg.data
+		if seg.rel < next {
+			data = data[next-seg.rel:]
+		} else if seg.rel > next {
+			s.missing += seg.rel - next
+		}
+		s.chunks = append(s.chunks, streamChunk{offset: len(s.data), ts: seg.pkt.ts})
+		s.data = append(s.data, data...)
+		next = end
+	}
+	return s
+}
+
+// rtspMessage is a request, response or interleaved frame read from a stream, stamped with the capture
+// time of its last byte.
+type rtspMessage struct {
+	ts    time.Time
+	req   *base.Request
+	res   *base.Response
+	frame *base.InterleavedFrame
+}
+
+// countingReader counts the bytes handed to the bufio.Reader above it.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+// readRTSPMessages splits a reassembled stream the way the gortsplib connection reader does. A message
+// cut short by the end of the capture is dropped; a malformed one ends the stream with an error.
+func readRTSPMessages(s *tcpStream) ([]rtspMessage, error) {
+	cr := &countingReader{r: bytes.NewReader(s.data)}
+	br := bufio.NewReader(cr)
+	var msgs []rtspMessage
+	for {
+		head, err := br.Peek(2)
+		if err != nil {
+			return msgs, nil
+		}
+
+		var msg rtspMessage
+		switch {
+		case head[0] == base.InterleavedFrameMagicByte:
+			msg.frame = &base.InterleavedFrame{}
+			err = msg.frame.Unmarshal(br)
+		case head[0] == 'R' && head[1] == 'T':
+			msg.res = &base.Response{}
+			err = msg.res.Unmarshal(br)
+		case isRequestPrefix(head):
+			msg.req = &base.Request{}
+			err = msg.req.Unmarshal(br)
+		default:
+			if _, err := br.Discard(1); err != nil {
+				return msgs, nil
+			}
+			continue
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return msgs, nil
+		}
+		if err != nil {
+			return msgs, err
+		}
+		msg.ts = s.timeAt(cr.n - br.Buffered() - 1)
+		msgs = append(msgs, msg)
+	}
+}
+
+// isRequestPrefix matches the first two letters of the RTSP methods, as gortsplib does.
+func isRequestPrefix(b []byte) bool {
+	if len(b) < 2 {
+		return false
+	}
+	switch string(b[:2]) {
+	case "AN", "DE", "GE", "OP", "PA", "PL", "RE", "SE", "TE":
+		return true
+	}
+	return false
+}
+
+// looksLikeRTSPRequest reports whether a stream starts with an RTSP request line.
+func looksLikeRTSPRequest(data []byte) bool {
+	line := data[:min(len(data), maxRequestLine)]
+	i := bytes.IndexByte(line, '\n')
+	if i < 0 {
+		return false
+	}
+	fields := strings.Fields(string(line[:i]))
+	return len(fields) == 3 && strings.HasPrefix(fields[2], "RTSP/") && isRequestPrefix([]byte(fields[0]))
+}
+
+// rtspConversation is one TCP connection carrying RTSP.
+type rtspConversation struct {
+	client, server netip.AddrPort
+	first          time.Time // first packet of the connection
+	requests       []rtspMessage
+	responses      []rtspMessage // including interleaved frames from the server
+	missing        int64
+	parseErr       error
+
+	info      *streamInfo
+	desc      *description.Session
+	probe     *liveProbe
+	channels  map[int]*description.Media // interleaved RTP channel (RTCP is the next one)
+	lastMedia time.Time
+}
+
+// findRTSPConversations groups TCP segments into connections and keeps those that speak RTSP.
+func findRTSPConversations(pkts []capturedPacket) []*rtspConversation {
+	type flowKey struct{ src, dst netip.AddrPort }
+	flows := make(map[flowKey][]*capturedPacket)
+	var order []flowKey
+	for i := range pkts {
+		p := &pkts[i]
+		if p.proto != ipProtoTCP {
+			continue
+		}
+		k := flowKey{p.src, p.dst}
+		if _, ok := flows[k]; !ok {
+			order = append(order, k)
+		}
+		flows[k] = append(flows[k], p)
+	}
+
+	var convs []*rtspConversation
+	for _, k := range order {
+		cs := reassembleTCP(flows[k])
+		if !looksLikeRTSPRequest(cs.data) {
+			continue
+		}
+		c := &rtspConversation{client: k.src, server: k.dst, first: flows[k][0].ts, missing: cs.missing}
+		c.requests, c.parseErr = readRTSPMessages(cs)
+
+		if segs := flows[flowKey{k.dst, k.src}]; len(segs) > 0 {
+			if segs[0].ts.Before(c.first) {
+				c.first = segs[0].ts
+			}
+			ss := reassembleTCP(segs)
+			c.missing += ss.missing
+			var err error
+			c.responses, err = readRTSPMessages(ss)
+			if c.parseErr == nil {
+				c.parseErr = err
+			}
+		}
+		convs = append(convs, c)
+	}
+	return convs
+}
+
+// exchange is a request and its response (nil when the capture has none).
+type exchange struct {
+	req *rtspMessage
+	res *rtspMessage
+}
+
+// exchanges pairs requests with responses by CSeq, in request order.
+func (c *rtspConversation) exchanges() []exchange {
+	byCSeq := make(map[string]*rtspMessage)
+	for i := range c.responses {
+		if m := &c.responses[i]; m.res != nil {
+			if v, ok := m.res.Header["CSeq"]; ok && len(v) == 1 {
+				byCSeq[v[0]] = m
+			}
+		}
+	}
+	var list []exchange
+	for i := range c.requests {
+		m := &c.requests[i]
+		if m.req == nil {
+			continue
+		}
+		ex := exchange{req: m}
+		if v, ok := m.req.Header["CSeq"]; ok && len(v) == 1 {
+			ex.res = byCSeq[v[0]]
+		}
+		list = append(list, ex)
+	}
+	return list
+}
+
+// analyze rebuilds the DESCRIBE result and prepares the probe for the PLAY phase. It returns the UDP
+// flows negotiated by SETUP.
+func (c *rtspConversation) analyze(opts LiveProbeOptions, includeRaw, debug bool) (*streamInfo, []udpBinding) {
+	info := &streamInfo{Protocol: "rtsp", Reachable: true}
+	c.info = info
+	exs := c.exchanges()
+	if debug {
+		info.DebugTrace = c.trace(exs)
+	}
+
+	// The last successful DESCRIBE wins (the first one is often answered with 401)
+	var describe *exchange
+	for i := range exs {
+		ex := &exs[i]
+		if info.URL == "" || ex.req.req.Method == base.Describe {
+			info.URL = ex.req.req.URL.String()
+		}
+		if ex.req.req.Method == base.Describe && ex.res != nil && ex.res.res.StatusCode == base.StatusOK {
+			describe = ex
+		}
+	}
+	if describe == nil {
+		return info, nil
+	}
+
+	info.URL = describe.req.req.URL.String()
+	info.Latency = float64(describe.res.ts.Sub(c.first)) / float64(time.Millisecond)
+	desc, err := descriptionFromResponse(describe.req.req.URL, describe.res.res)
+	if err != nil {
+		return info, nil
+	}
+	if err := NewMediaProcessor().ProcessMedias(desc, info); err != nil {
+		return info, nil
+	}
+	info.DescribeOK = true
+	info.RawDescription = desc
+	c.desc = desc
+	applySDPDetails(info, describe.res.res, desc, includeRaw)
+
+	return info, c.preparePlay(exs, opts)
+}
+
+// preparePlay maps SETUPs to medias and starts the probe at the PLAY response.
+func (c *rtspConversation) preparePlay(exs []exchange, opts LiveProbeOptions) []udpBinding {
+	var play *exchange
+	var teardown time.Time
+	var bindings []udpBinding
+	c.channels = make(map[int]*description.Media)
+	assigned := make(map[*description.Media]bool)
+	transport := ""
+
+	for i := range exs {
+		ex := &exs[i]
+		switch ex.req.req.Method {
+		case base.Setup:
+			if ex.res == nil || ex.res.res.StatusCode != base.StatusOK {
+				continue
+			}
+			m := c.setupMedia(ex.req.req.URL, assigned)
+			if m == nil {
+				continue
+			}
+			assigned[m] = true
+			if transport == "" {
+				transport = transportFromResponse(ex.res.res)
+			}
+			var th headers.Transport
+			if err := th.Unmarshal(ex.res.res.Header["Transport"]); err != nil {
+				continue
+			}
+			if th.InterleavedIDs != nil {
+				c.channels[th.InterleavedIDs[0]] = m
+			} else if b, ok := c.udpBinding(m, &th, ex.res.ts); ok {
+				bindings = append(bindings, b)
+			}
+		case base.Play:
+			if play == nil && ex.res != nil && ex.res.res.StatusCode == base.StatusOK {
+				play = ex
+			}
+		case base.Teardown:
+			if teardown.IsZero() {
+				teardown = ex.req.ts
+			}
+		}
+	}
+	if play == nil || len(assigned) == 0 {
+		return nil
+	}
+
+	c.probe = newLiveProbe(c.desc, opts)
+	c.probe.wireOrder = true
+	c.probe.transport = transport
+	c.probe.started = play.res.ts
+	for i := range bindings {
+		bindings[i].until = teardown
+	}
+
+	// Interleaved media follows the PLAY response on the same connection
+	for _, msg := range c.responses {
+		if msg.frame == nil || msg.ts.Before(c.probe.started) {
+			continue
+		}
+		if m, ok := c.channels[msg.frame.Channel]; ok {
+			c.receiveRTP(m, msg.frame.Payload, msg.ts)
+		} else if m, ok := c.channels[msg.frame.Channel-1]; ok {
+			c.receiveRTCP(m, msg.frame.Payload, msg.ts)
+		}
+	}
+	return bindings
+}
+
+// setupMedia finds the media a SETUP URL refers to, falling back to the first media not set up yet.
+func (c *rtspConversation) setupMedia(u *base.URL, assigned map[*description.Media]bool) *description.Media {
+	want := stripURLUser(u)
+	for _, m := range c.desc.Medias {
+		if mu, err := m.URL(c.desc.BaseURL); err == nil && stripURLUser(mu) == want && !assigned[m] {
+			return m
+		}
+	}
+	for _, m := range playableMedias(c.desc) {
+		if !assigned[m] {
+			return m
+		}
+	}
+	return nil
+}
+
+// stripURLUser renders u without credentials.
+func stripURLUser(u *base.URL) string {
+	cp := *u
+	cp.User = nil
+	return cp.String()
+}
+
+// udpBinding attributes UDP datagrams to a media.
+type udpBinding struct {
+	conv      *rtspConversation
+	media     *description.Media
+	group     netip.Addr // multicast destination; zero for unicast
+	rtpPort   uint16     // destination port of RTP; RTCP uses the next one
+	server    netip.Addr // unicast source
+	from      time.Time
+	until     time.Time // zero for the end of the capture
+	serverRTP uint16    // source port of RTP when the server announced it
+}
+
+func (c *rtspConversation) udpBinding(m *description.Media, th *headers.Transport, from time.Time) (udpBinding, bool) {
+	b := udpBinding{conv: c, media: m, server: c.server.Addr(), from: from}
+	if th.Delivery != nil && *th.Delivery == headers.TransportDeliveryMulticast {
+		if th.Destination == nil || th.Ports == nil {
+			return b, false
+		}
+		addr, ok := netip.AddrFromSlice(*th.Destination)
+		if !ok {
+			return b, false
+		}
+		b.group, b.rtpPort = addr.Unmap(), uint16(th.Ports[0])
+		return b, true
+	}
+	if th.ClientPorts == nil {
+		return b, false
+	}
+	b.rtpPort = uint16(th.ClientPorts[0])
+	if th.ServerPorts != nil {
+		b.serverRTP = uint16(th.ServerPorts[0])
+	}
+	return b, true
+}
+
+func (b udpBinding) matches(p *capturedPacket) bool {
+	if p.ts.Before(b.from) || (!b.until.IsZero() && p.ts.After(b.until)) {
+		return false
+	}
+	port := p.dst.Port()
+	if port != b.rtpPort && port != b.rtpPort+1 {
+		return false
+	}
+	if b.group.IsValid() {
+		return p.dst.Addr().Unmap() == b.group
+	}
+	if b.serverRTP != 0 && p.src.Port() != b.serverRTP && p.src.Port() != b.serverRTP+1 {
+		return false
+	}
+	// Sources behind NAT keep their ports but not their address; ports are checked above
+	return p.src.Addr().Unmap() == b.server.Unmap() || b.serverRTP != 0
+}
+
+func (b udpBinding) feed(p *capturedPacket) {
+	if b.conv.probe == nil || p.ts.Before(b.conv.probe.started) {
+		return
+	}
+	if p.dst.Port() == b.rtpPort {
+		b.conv.receiveRTP(b.media, p.payload, p.ts)
+	} else {
+		b.conv.receiveRTCP(b.media, p.payload, p.ts)
+	}
+}
+
+func (c *rtspConversation) receiveRTP(m *description.Media, payload []byte, ts time.Time) {
+	var pkt rtp.Packet
+	if err := pkt.Unmarshal(payload); err != nil {
+		return
+	}
+	// Like the client, only packets of a format declared for the media are processed
+	known := false
+	for _, f := range m.Formats {
+		if f.PayloadType() == pkt.PayloadType {
+			known = true
+			break
+		}
+	}
+	if !known {
+		return
+	}
+	c.probe.receiveRTP(m, &pkt, ts)
+	if ts.After(c.lastMedia) {
+		c.lastMedia = ts
+	}
+}
+
+func (c *rtspConversation) receiveRTCP(m *description.Media, payload []byte, ts time.Time) {
+	pkts, err := rtcp.Unmarshal(payload)
+	if err != nil {
+		return
+	}
+	for _, pkt := range pkts {
+		c.probe.receiveRTCP(m, pkt, ts)
+	}
+}
+
+// finish closes the PLAY window at the last media packet and writes the analysis.
+func (c *rtspConversation) finish(st captureStats) {
+	if c.probe == nil {
+		return
+	}
+	c.probe.stopped = c.probe.started
+	if c.lastMedia.After(c.probe.started) {
+		c.probe.stopped = c.lastMedia
+	}
+	switch {
+	case c.missing > 0:
+		c.probe.err = fmt.Errorf("capture is missing %d bytes of the RTSP connection", c.missing)
+	case c.parseErr != nil:
+		c.probe.err = fmt.Errorf("malformed RTSP message: %w", c.parseErr)
+	case c.probe.packets == 0 && st.unused() != "":
+		// Media sent as fragments or over another link type never reaches the analyzers
+		c.probe.err = fmt.Errorf("no media packets in capture (%s)", st.unused())
+	case c.probe.packets == 0:
+		c.probe.err = errors.New("no media packets in capture")
+	}
+	c.probe.apply(c.info)
+}
+
+// trace renders the RTSP exchange with times relative to the start of the connection.
+func (c *rtspConversation) trace(exs []exchange) []string {
+	var lines []string
+	for _, ex := range exs {
+		lines = append(lines, fmt.Sprintf("+%.3fs > %s %s", ex.req.ts.Sub(c.first).Seconds(), ex.req.req.Method, ex.req.req.URL))
+		if ex.res != nil {
+			lines = append(lines, fmt.Sprintf("+%.3fs < %d %s", ex.res.ts.Sub(c.first).Seconds(),
+				ex.res.res.StatusCode, ex.res.res.StatusMessage))
+		}
+	}
+	return lines
+}
+
+// descriptionFromResponse decodes the SDP of a DESCRIBE response and resolves the base URL the way the
+// gortsplib client does: session control attribute, then Content-Base, then the request URL.
+func descriptionFromResponse(u *base.URL, res *base.Response) (*description.Session, error) {
+	ssd, err := parseSDP(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	var desc description.Session
+	if err := desc.Unmarshal(ssd); err != nil {
+		return nil, err
+	}
+
+	desc.BaseURL = u
+	if control, ok := ssd.Attribute("control"); ok && control != "*" {
+		if bu, err := base.ParseURL(control); err == nil {
+			desc.BaseURL = bu
+		}
+	} else if cb, ok := res.Header["Content-Base"]; ok && len(cb) == 1 {
+		raw := cb[0]
+		if strings.HasPrefix(raw, "/") {
+			raw = u.Scheme + "://" + u.Host + raw
+		}
+		if bu, err := base.ParseURL(raw); err == nil {
+			desc.BaseURL = bu
+		}
+	}
+	return &desc, nil
+}
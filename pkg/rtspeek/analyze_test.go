@@ -0,0 +1,277 @@
+package rtspeek
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0x524A/rtspeek/pkg/rtspeektest"
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+)
+
+const (
+	analyzeURL    = "rtsp://192.168.1.20/stream"
+	analyzeFrames = 50
+	analyzeFPS    = 40 * time.Millisecond
+)
+
+// rtspCapture scripts an RTSP conversation on top of a testCapture.
+type rtspCapture struct {
+	*testCapture
+	client, server netip.AddrPort
+	cseq           int
+	at             time.Duration
+}
+
+func newRTSPCapture(c *testCapture, client, server netip.AddrPort, at time.Duration) *rtspCapture {
+	rc := &rtspCapture{testCapture: c, client: client, server: server, at: at}
+	c.tcp(at, client, server, tcpFlagSYN, nil)
+	c.tcp(at, server, client, tcpFlagSYN, nil)
+	return rc
+}
+
+// exchange sends a request and its response 5ms later.
+func (rc *rtspCapture) exchange(method base.Method, url string, status base.StatusCode, header base.Header, body []byte) {
+	rc.cseq++
+	rc.at += 10 * time.Millisecond
+	u, _ := base.ParseURL(url)
+	req := base.Request{Method: method, URL: u, Header: base.Header{"CSeq": base.HeaderValue{fmt.Sprint(rc.cseq)}}}
+	raw, _ := req.Marshal()
+	rc.tcp(rc.at, rc.client, rc.server, 0, raw)
+
+	rc.at += 5 * time.Millisecond
+	if header == nil {
+		header = base.Header{}
+	}
+	header["CSeq"] = base.HeaderValue{fmt.Sprint(rc.cseq)}
+	res := base.Response{StatusCode: status, StatusMessage: "Status", Header: header, Body: body}
+	raw, _ = res.Marshal()
+	// Split large responses over two segments
+	if len(raw) > 200 {
+		rc.tcp(rc.at, rc.server, rc.client, 0, raw[:100])
+		raw = raw[100:]
+	}
+	rc.tcp(rc.at, rc.server, rc.client, 0, raw)
+}
+
+func (rc *rtspCapture) describe(desc *description.Session) {
+	for i, m := range desc.Medias {
+		m.Control = fmt.Sprintf("trackID=%d", i)
+	}
+	sdp, _ := desc.Marshal(false)
+	rc.exchange(base.Options, analyzeURL, base.StatusOK, base.Header{"Public": base.HeaderValue{"DESCRIBE, SETUP, PLAY"}}, nil)
+	rc.exchange(base.Describe, analyzeURL, base.StatusUnauthorized, base.Header{"WWW-Authenticate": base.HeaderValue{`Basic realm="cam"`}}, nil)
+	rc.exchange(base.Describe, analyzeURL, base.StatusOK, base.Header{
+		"Content-Base": base.HeaderValue{analyzeURL + "/"},
+		"Content-Type": base.HeaderValue{"application/sdp"},
+	}, sdp)
+}
+
+func (rc *rtspCapture) setupAndPlay(transport string) {
+	rc.exchange(base.Setup, analyzeURL+"/trackID=0", base.StatusOK, base.Header{
+		"Transport": base.HeaderValue{transport},
+		"Session":   base.HeaderValue{"12345678;timeout=60"},
+	}, nil)
+	rc.exchange(base.Play, analyzeURL+"/", base.StatusOK, base.Header{"Session": base.HeaderValue{"12345678"}}, nil)
+}
+
+func TestAnalyzeCaptureInterleaved(t *testing.T) {
+	desc := rtspeektest.DefaultDescription()
+	c := newTestCapture()
+	rc := newRTSPCapture(c, testClient, testServer, 0)
+	rc.describe(desc)
+	rc.setupAndPlay("RTP/AVP/TCP;unicast;interleaved=0-1")
+
+	sy := rtspeektest.NewSynthesizer(desc, analyzeFPS)
+	start := rc.at + 10*time.Millisecond
+	for n := range analyzeFrames {
+		var buf []byte
+		for _, pkt := range sy.Packets(n)[desc.Medias[0]] {
+			raw, _ := pkt.Marshal()
+			fr, _ := (&base.InterleavedFrame{Channel: 0, Payload: raw}).Marshal()
+			buf = append(buf, fr...)
+		}
+		c.tcp(start+time.Duration(n)*analyzeFPS, testServer, testClient, 0, buf)
+	}
+
+	for _, format := range []string{"pcap", "pcapng"} {
+		t.Run(format, func(t *testing.T) {
+			data := c.pcap(binary.LittleEndian, false, false)
+			if format == "pcapng" {
+				data = c.pcapng()
+			}
+			ctx := WithDebug(WithRawSDP(context.Background()))
+			infos, err := AnalyzeCapture(ctx, bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("AnalyzeCapture: %v", err)
+			}
+			if len(infos) != 1 {
+				t.Fatalf("got %d conversations, want 1", len(infos))
+			}
+			info := infos[0]
+			if !info.IsDescribeSucceeded() || info.GetURLString() != analyzeURL {
+				t.Fatalf("describe ok=%v url=%q", info.IsDescribeSucceeded(), info.GetURLString())
+			}
+			if got := info.LatencyMs(); got != 45 {
+				t.Fatalf("latency %vms, want 45 (SYN to second DESCRIBE response)", got)
+			}
+			if got := info.GetVideoResolutionString(); got != "1280x720" {
+				t.Fatalf("resolution %q", got)
+			}
+			if s := info.GetSessionDetails(); s == nil || s.RawSDP == "" || s.BaseURL != analyzeURL+"/" {
+				t.Fatalf("unexpected session details %+v", s)
+			}
+			if len(info.GetDebugData()) != 10 {
+				t.Fatalf("trace %q, want 5 exchanges", info.GetDebugData())
+			}
+
+			lp := info.GetLiveProbe()
+			if lp == nil {
+				t.Fatalf("missing live probe")
+			}
+			if lp.Transport != "tcp" || lp.Error != "" {
+				t.Fatalf("unexpected probe %+v", lp)
+			}
+			want := (analyzeFrames-1)*analyzeFPS + 10*time.Millisecond
+			if got := time.Duration(lp.Duration * float64(time.Second)); got != want {
+				t.Fatalf("window %v, want %v", got, want)
+			}
+
+			v := info.GetFirstVideoMedia()
+			if v.RTP == nil || v.RTP.Lost != 0 || v.RTP.Source != RTPSourceWire || v.RTP.Packets != lp.Packets {
+				t.Fatalf("unexpected RTP stats %+v", v.RTP)
+			}
+			if v.GOP == nil || v.GOP.Keyframes != 2 || v.GOP.IntervalFrames != rtspeektest.SyntheticGOP {
+				t.Fatalf("unexpected GOP %+v", v.GOP)
+			}
+			if v.Timing == nil || v.Timing.MeasuredFPS < 24.9 || v.Timing.MeasuredFPS > 25.1 {
+				t.Fatalf("unexpected timing %+v", v.Timing)
+			}
+		})
+	}
+}
+
+func TestAnalyzeCaptureUDP(t *testing.T) {
+	desc := rtspeektest.DefaultDescription()
+	c := newTestCapture()
+	rc := newRTSPCapture(c, testClient, testServer, 0)
+	rc.describe(desc)
+	rc.setupAndPlay("RTP/AVP;unicast;client_port=5000-5001;server_port=6000-6001")
+
+	clientRTP := netip.AddrPortFrom(testClient.Addr(), 5000)
+	serverRTP := netip.AddrPortFrom(testServer.Addr(), 6000)
+	other := netip.MustParseAddrPort("192.168.1.30:7000")
+
+	sy := rtspeektest.NewSynthesizer(desc, analyzeFPS)
+	start := rc.at + 10*time.Millisecond
+	sent := 0
+	for n := range analyzeFrames {
+		for i, pkt := range sy.Packets(n)[desc.Medias[0]] {
+			raw, _ := pkt.Marshal()
+			at := start + time.Duration(n)*analyzeFPS
+			// Another camera streams to the same client port from a different address
+			c.udp(at, other, clientRTP, raw)
+			if n == 10 && i == 0 {
+				continue // lost
+			}
+			c.udp(at, serverRTP, clientRTP, raw)
+			sent++
+		}
+	}
+
+	infos, err := AnalyzeCapture(context.Background(), bytes.NewReader(c.pcap(binary.LittleEndian, false, false)))
+	if err != nil {
+		t.Fatalf("AnalyzeCapture: %v", err)
+	}
+	lp := infos[0].GetLiveProbe()
+	if lp == nil || lp.Transport != "udp" || lp.Packets != uint64(sent) {
+		t.Fatalf("unexpected probe %+v, want %d packets", lp, sent)
+	}
+	st := infos[0].GetFirstVideoMedia().RTP
+	if st.Lost != 1 || st.Source != RTPSourceWire {
+		t.Fatalf("unexpected RTP stats %+v", st)
+	}
+}
+
+func TestAnalyzeCaptureFragments(t *testing.T) {
+	desc := rtspeektest.DefaultDescription()
+	c := newTestCapture()
+	rc := newRTSPCapture(c, testClient, testServer, 0)
+	rc.describe(desc)
+	rc.setupAndPlay("RTP/AVP;unicast;client_port=5000-5001;server_port=6000-6001")
+
+	// Every datagram of the media is the first fragment of a larger one
+	sy := rtspeektest.NewSynthesizer(desc, analyzeFPS)
+	fragments := 0
+	for n := range 5 {
+		for _, pkt := range sy.Packets(n)[desc.Medias[0]] {
+			raw, _ := pkt.Marshal()
+			c.udp(rc.at+time.Duration(n+1)*analyzeFPS, netip.AddrPortFrom(testServer.Addr(), 6000), netip.AddrPortFrom(testClient.Addr(), 5000), raw)
+			c.frames[len(c.frames)-1].data[14+6] = 0x20 // more fragments
+			fragments++
+		}
+	}
+
+	infos, err := AnalyzeCapture(context.Background(), bytes.NewReader(c.pcap(binary.LittleEndian, false, false)))
+	if err != nil {
+		t.Fatalf("AnalyzeCapture: %v", err)
+	}
+	if got := infos[0].GetCapture(); got == nil || got.Fragments != fragments || got.Frames != len(c.frames) || got.Skipped != 0 {
+		t.Fatalf("unexpected capture summary %+v, want %d fragments", got, fragments)
+	}
+	want := fmt.Sprintf("no media packets in capture (%d IPv4 fragments not reassembled)", fragments)
+	if lp := infos[0].GetLiveProbe(); lp == nil || lp.Error != want {
+		t.Fatalf("unexpected probe %+v, want error %q", lp, want)
+	}
+}
+
+func TestAnalyzeCaptureConversations(t *testing.T) {
+	c := newTestCapture()
+	first := newRTSPCapture(c, testClient, testServer, 0)
+	first.describe(rtspeektest.DefaultDescription())
+
+	second := newRTSPCapture(c, netip.MustParseAddrPort("192.168.1.10:50001"), testServer, time.Second)
+	second.exchange(base.Describe, analyzeURL+"2", base.StatusNotFound, nil, nil)
+
+	// Non-RTSP traffic on another connection
+	c.tcp(2*time.Second, netip.MustParseAddrPort("192.168.1.10:50002"), netip.MustParseAddrPort("192.168.1.20:80"), 0,
+		[]byte("GET / HTTP/1.1\r\nHost: camera\r\n\r\n"))
+
+	infos, err := AnalyzeCapture(context.Background(), bytes.NewReader(c.pcap(binary.LittleEndian, false, false)))
+	if err != nil {
+		t.Fatalf("AnalyzeCapture: %v", err)
+	}
+	if len(infos) != 2 {
+		t.Fatalf("got %d conversations, want 2", len(infos))
+	}
+	if !infos[0].IsDescribeSucceeded() || infos[0].GetLiveProbe() != nil || infos[0].GetMediaCount() != 1 {
+		t.Fatalf("unexpected first conversation %+v", infos[0])
+	}
+	if infos[1].IsDescribeSucceeded() || infos[1].GetURLString() != analyzeURL+"2" || !infos[1].IsReachable() {
+		t.Fatalf("unexpected second conversation %+v", infos[1])
+	}
+}
+
+func TestAnalyzeCaptureNoRTSP(t *testing.T) {
+	c := newTestCapture()
+	c.tcp(0, testClient, netip.MustParseAddrPort("192.168.1.20:80"), 0, []byte("GET / HTTP/1.1\r\n\r\n"))
+	_, err := AnalyzeCapture(context.Background(), bytes.NewReader(c.pcap(binary.LittleEndian, false, false)))
+	if !errors.Is(err, ErrNoRTSPConversation) {
+		t.Fatalf("got %v, want ErrNoRTSPConversation", err)
+	}
+
+	// Dropped frames are counted in the error, since RTSP may have been among them
+	c.tcp(time.Second, testClient, testServer, 0, []byte("DESCRIBE rtsp://192.168.1.20/stream RTSP/1.0\r\n"))
+	c.frames[len(c.frames)-1].data[14+6] = 0x20
+	_, err = AnalyzeCapture(context.Background(), bytes.NewReader(c.pcap(binary.LittleEndian, false, false)))
+	if !errors.Is(err, ErrNoRTSPConversation) || !strings.Contains(err.Error(), "1 IPv4 fragments not reassembled") {
+		t.Fatalf("got %v, want ErrNoRTSPConversation with the fragment count", err)
+	}
+}
@@ -0,0 +1,214 @@
+package rtspeek
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BaselineVersion is the format version written by WriteBaseline.
+const BaselineVersion = 1
+
+// Baseline is the normalized describe result of every target of a fleet at one point in time. It leaves
+// out what changes from run to run (latency, live probe statistics), so two baselines of an unchanged
+// fleet are equal.
+type Baseline struct {
+	Version int             `json:"version"`
+	Created time.Time       `json:"created"`
+	Targets []BaselineEntry `json:"targets"` // sorted by name
+}
+
+// BaselineEntry is what one target looked like.
+type BaselineEntry struct {
+	Name        string          `json:"name"`
+	URL         string          `json:"url"` // without credentials
+	DescribeOK  bool            `json:"describe_ok"`
+	Failure     string          `json:"failure,omitempty"` // error classification when DescribeOK is false
+	Server      string          `json:"server,omitempty"`
+	AuthMethods []string        `json:"auth_methods,omitempty"`
+	Medias      []BaselineMedia `json:"medias,omitempty"`
+}
+
+// BaselineMedia is the stable part of a MediaInfo.
+type BaselineMedia struct {
+	Type       string `json:"type"`
+	Format     string `json:"format,omitempty"`
+	Role       string `json:"role,omitempty"`
+	Resolution string `json:"resolution,omitempty"`
+	ClockRate  int    `json:"clock_rate,omitempty"`
+}
+
+// NewBaseline builds a baseline from the results of ProbeTargets.
+func NewBaseline(results []TargetResult) *Baseline {
+	b := &Baseline{Version: BaselineVersion, Created: time.Now().UTC(), Targets: []BaselineEntry{}}
+	for _, r := range results {
+		b.Targets = append(b.Targets, NewBaselineEntry(r.Target.Name, r.URL, r.Info, r.Err))
+	}
+	sort.Slice(b.Targets, func(i, j int) bool { return b.Targets[i].Name < b.Targets[j].Name })
+	return b
+}
+
+// NewBaselineEntry normalizes one describe result.
+func NewBaselineEntry(name, url string, info StreamInfo, err error) BaselineEntry {
+	e := BaselineEntry{Name: name, URL: url}
+	if err != nil || info == nil || !info.IsDescribeSucceeded() {
+		if err == nil {
+			err = fmt.Errorf("describe failed")
+		}
+		e.Failure = classifyError(err)
+		return e
+	}
+	e.DescribeOK = true
+	if s := info.GetSessionDetails(); s != nil {
+		e.Server = s.Server
+		e.AuthMethods = s.AuthMethods
+	}
+	for _, m := range info.GetMedias() {
+		bm := BaselineMedia{Type: m.Type, Format: m.Format, Role: m.Role}
+		if m.Resolution != nil {
+			bm.Resolution = m.Resolution.String()
+		}
+		if m.ClockRate != nil {
+			bm.ClockRate = *m.ClockRate
+		}
+		e.Medias = append(e.Medias, bm)
+	}
+	return e
+}
+
+// WriteBaseline writes a baseline as indented JSON.
+func WriteBaseline(w io.Writer, b *Baseline) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(b)
+}
+
+// ReadBaseline reads a baseline written by WriteBaseline.
+func ReadBaseline(r io.Reader) (*Baseline, error) {
+	var b Baseline
+	if err := json.NewDecoder(r).Decode(&b); err != nil {
+		return nil, fmt.Errorf("invalid baseline: %w", err)
+	}
+	if b.Version != BaselineVersion {
+		return nil, fmt.Errorf("unsupported baseline version %d (want %d)", b.Version, BaselineVersion)
+	}
+	return &b, nil
+}
+
+// BaselineChange is one field of a target that differs between two baselines.
+type BaselineChange struct {
+	Field  string `json:"field"` // describe, url, server, auth, medias, video_codec, audio_codec or resolution
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// BaselineTargetDiff lists the changes of one target.
+type BaselineTargetDiff struct {
+	Name    string           `json:"name"`
+	URL     string           `json:"url"`
+	Changes []BaselineChange `json:"changes"`
+}
+
+// BaselineDiff compares a new baseline with an older one.
+type BaselineDiff struct {
+	Before    time.Time            `json:"before"`
+	After     time.Time            `json:"after"`
+	Unchanged int                  `json:"unchanged"`
+	Changed   []BaselineTargetDiff `json:"changed"`
+	Added     []string             `json:"added"`   // targets only in the new baseline
+	Removed   []string             `json:"removed"` // targets only in the old baseline
+}
+
+// HasChanges reports whether any target changed, appeared or disappeared.
+func (d *BaselineDiff) HasChanges() bool {
+	return len(d.Changed)+len(d.Added)+len(d.Removed) > 0
+}
+
+// DiffBaselines reports how each target of after differs from the same target (by name) in before. A
+// target whose describe failed on either side only reports the describe change, since its streams are
+// unknown.
+func DiffBaselines(before, after *Baseline) *BaselineDiff {
+	d := &BaselineDiff{Before: before.Created, After: after.Created, Changed: []BaselineTargetDiff{}, Added: []string{}, Removed: []string{}}
+	old := make(map[string]*BaselineEntry, len(before.Targets))
+	for i := range before.Targets {
+		old[before.Targets[i].Name] = &before.Targets[i]
+	}
+	seen := make(map[string]bool)
+	for i := range after.Targets {
+		cur := &after.Targets[i]
+		seen[cur.Name] = true
+		prev := old[cur.Name]
+		if prev == nil {
+			d.Added = append(d.Added, cur.Name)
+			continue
+		}
+		if changes := diffBaselineEntry(prev, cur); len(changes) > 0 {
+			d.Changed = append(d.Changed, BaselineTargetDiff{Name: cur.Name, URL: cur.URL, Changes: changes})
+		} else {
+			d.Unchanged++
+		}
+	}
+	for _, e := range before.Targets {
+		if !seen[e.Name] {
+			d.Removed = append(d.Removed, e.Name)
+		}
+	}
+	return d
+}
+
+func diffBaselineEntry(prev, cur *BaselineEntry) []BaselineChange {
+	var out []BaselineChange
+	add := func(field, before, after string) {
+		if before != after {
+			out = append(out, BaselineChange{Field: field, Before: before, After: after})
+		}
+	}
+	add("url", prev.URL, cur.URL)
+	add("describe", prev.describeState(), cur.describeState())
+	if !prev.DescribeOK || !cur.DescribeOK {
+		return out
+	}
+	add("server", prev.Server, cur.Server)
+	add("auth", strings.Join(prev.AuthMethods, ", "), strings.Join(cur.AuthMethods, ", "))
+	add("medias", prev.mediaTypes(), cur.mediaTypes())
+	add("video_codec", prev.field("video", func(m BaselineMedia) string { return m.Format }),
+		cur.field("video", func(m BaselineMedia) string { return m.Format }))
+	add("audio_codec", prev.field("audio", func(m BaselineMedia) string { return m.Format }),
+		cur.field("audio", func(m BaselineMedia) string { return m.Format }))
+	add("resolution", prev.field("video", func(m BaselineMedia) string { return m.Resolution }),
+		cur.field("video", func(m BaselineMedia) string { return m.Resolution }))
+	return out
+}
+
+func (e *BaselineEntry) describeState() string {
+	if e.DescribeOK {
+		return "ok"
+	}
+	return "failed: " + e.Failure
+}
+
+// mediaTypes lists the media types in SDP order, e.g. "video, audio, application (backchannel)".
+func (e *BaselineEntry) mediaTypes() string {
+	list := make([]string, len(e.Medias))
+	for i, m := range e.Medias {
+		list[i] = m.Type
+		if m.Role != "" {
+			list[i] += " (" + m.Role + ")"
+		}
+	}
+	return strings.Join(list, ", ")
+}
+
+// field joins a value of the medias of one type.
+func (e *BaselineEntry) field(mediaType string, value func(BaselineMedia) string) string {
+	var list []string
+	for _, m := range e.Medias {
+		if m.Type == mediaType {
+			list = append(list, value(m))
+		}
+	}
+	return strings.Join(list, ", ")
+}
@@ -0,0 +1,100 @@
+package rtspeek
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0x524A/rtspeek/pkg/rtspeektest"
+)
+
+func TestNewBaselineEntry(t *testing.T) {
+	srv := rtspeektest.Start(t, rtspeektest.Config{User: "admin", Pass: "secret", FrameInterval: -1})
+	info, err := DescribeStream(context.Background(), srv.URLWithCredentials("admin", "secret"), 5*time.Second)
+	if err != nil {
+		t.Fatalf("DescribeStream: %v", err)
+	}
+	e := NewBaselineEntry("lobby", srv.URL, info, nil)
+	if !e.DescribeOK || e.Failure != "" {
+		t.Fatalf("unexpected entry: %+v", e)
+	}
+	if len(e.AuthMethods) == 0 {
+		t.Fatalf("expected the offered auth schemes, got %+v", e)
+	}
+	want := []BaselineMedia{{Type: "video", Format: "H264", Resolution: "1280x720", ClockRate: 90000}}
+	if !reflect.DeepEqual(e.Medias, want) {
+		t.Fatalf("medias = %+v, want %+v", e.Medias, want)
+	}
+
+	failed := NewBaselineEntry("dock", "rtsp://10.0.0.9/stream", nil, errors.New("dial tcp: connection refused"))
+	if failed.DescribeOK || failed.Failure != "connection_refused" {
+		t.Fatalf("unexpected entry for a failure: %+v", failed)
+	}
+}
+
+func TestBaselineRoundTrip(t *testing.T) {
+	b := &Baseline{Version: BaselineVersion, Created: time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC), Targets: []BaselineEntry{
+		{Name: "lobby", URL: "rtsp://10.0.0.5/s", DescribeOK: true, Server: "Cam/1.0", Medias: []BaselineMedia{{Type: "video", Format: "H264"}}},
+	}}
+	var buf bytes.Buffer
+	if err := WriteBaseline(&buf, b); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadBaseline(&buf)
+	if err != nil {
+		t.Fatalf("ReadBaseline: %v", err)
+	}
+	if !reflect.DeepEqual(got, b) {
+		t.Fatalf("round trip changed the baseline:\n%+v\n%+v", got, b)
+	}
+	if _, err := ReadBaseline(strings.NewReader(`{"version": 7}`)); err == nil {
+		t.Fatal("expected an unsupported version to be rejected")
+	}
+}
+
+func TestDiffBaselines(t *testing.T) {
+	video := func(format, res string) BaselineMedia {
+		return BaselineMedia{Type: "video", Format: format, Resolution: res}
+	}
+	audio := BaselineMedia{Type: "audio", Format: "MPEG4-audio"}
+	before := &Baseline{Targets: []BaselineEntry{
+		{Name: "a", URL: "rtsp://a/s", DescribeOK: true, Server: "Cam/1.0", AuthMethods: []string{"Digest"}, Medias: []BaselineMedia{video("H264", "1920x1080"), audio}},
+		{Name: "b", URL: "rtsp://b/s", DescribeOK: true, Medias: []BaselineMedia{video("H264", "1280x720")}},
+		{Name: "c", URL: "rtsp://c/s", DescribeOK: true, Medias: []BaselineMedia{video("H264", "1280x720")}},
+		{Name: "old", URL: "rtsp://old/s", DescribeOK: true},
+	}}
+	after := &Baseline{Targets: []BaselineEntry{
+		{Name: "a", URL: "rtsp://a/s", DescribeOK: true, Server: "Cam/2.0", AuthMethods: []string{"Digest", "Basic"}, Medias: []BaselineMedia{video("H265", "2560x1440")}},
+		{Name: "b", URL: "rtsp://b/s", DescribeOK: false, Failure: "timeout"},
+		{Name: "c", URL: "rtsp://c/s", DescribeOK: true, Medias: []BaselineMedia{video("H264", "1280x720")}},
+		{Name: "new", URL: "rtsp://new/s", DescribeOK: true},
+	}}
+	d := DiffBaselines(before, after)
+
+	if d.Unchanged != 1 || !reflect.DeepEqual(d.Added, []string{"new"}) || !reflect.DeepEqual(d.Removed, []string{"old"}) {
+		t.Fatalf("unexpected summary: %+v", d)
+	}
+	want := []BaselineTargetDiff{
+		{Name: "a", URL: "rtsp://a/s", Changes: []BaselineChange{
+			{Field: "server", Before: "Cam/1.0", After: "Cam/2.0"},
+			{Field: "auth", Before: "Digest", After: "Digest, Basic"},
+			{Field: "medias", Before: "video, audio", After: "video"},
+			{Field: "video_codec", Before: "H264", After: "H265"},
+			{Field: "audio_codec", Before: "MPEG4-audio", After: ""},
+			{Field: "resolution", Before: "1920x1080", After: "2560x1440"},
+		}},
+		{Name: "b", URL: "rtsp://b/s", Changes: []BaselineChange{
+			{Field: "describe", Before: "ok", After: "failed: timeout"},
+		}},
+	}
+	if !reflect.DeepEqual(d.Changed, want) {
+		t.Fatalf("changes = %+v\nwant %+v", d.Changed, want)
+	}
+	if !d.HasChanges() || DiffBaselines(before, before).HasChanges() {
+		t.Fatal("HasChanges is wrong")
+	}
+}
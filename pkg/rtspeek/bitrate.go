@@ -0,0 +1,151 @@
+package rtspeek
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+// Bitrate modes guessed from the per-second series.
+const (
+	BitrateModeCBR       = "cbr"
+	BitrateModeVBR       = "vbr"
+	BitrateModeCappedVBR = "capped_vbr"
+)
+
+// Bitrate classification thresholds.
+const (
+	// minBitrateBuckets is the number of complete seconds needed before guessing a mode.
+	minBitrateBuckets = 3
+	// cbrVariation is the highest coefficient of variation still considered constant bitrate.
+	cbrVariation = 0.1
+	// capBand is how close to the peak a second must be to count as hitting the cap.
+	capBand = 0.05
+	// capShare is the fraction of seconds that must sit at the cap for capped VBR.
+	capShare = 0.25
+)
+
+// BitrateInfo profiles the received bitrate of a track in one-second buckets.
+type BitrateInfo struct {
+	Seconds       int     `json:"seconds"` // complete buckets measured
+	Bytes         uint64  `json:"bytes"`   // RTP packet bytes (headers included) in those buckets
+	Min           float64 `json:"min_bps"`
+	Avg           float64 `json:"avg_bps"`
+	Max           float64 `json:"max_bps"`
+	P95           float64 `json:"p95_bps"`
+	PeakToAverage float64 `json:"peak_to_average,omitempty"`
+	Variation     float64 `json:"variation"`      // coefficient of variation of the series
+	Mode          string  `json:"mode,omitempty"` // cbr, vbr or capped_vbr; needs 3 seconds
+	// H264/H265 frame sizes (access unit bytes)
+	AvgFrameSize    float64 `json:"avg_frame_size,omitempty"`
+	AvgKeyframeSize float64 `json:"avg_keyframe_size,omitempty"`
+	KeyframeRatio   float64 `json:"keyframe_ratio,omitempty"` // average keyframe over average frame
+	// Series is the bitrate of each second (only with LiveProbeOptions.BitrateSeries).
+	Series []float64 `json:"series_bps,omitempty"`
+}
+
+// bitrateAnalyzer buckets received bytes per second since the first packet of the track.
+// Frame sizes come through onFrame, for the H264/H265 tracks whose decoder feeds it.
+type bitrateAnalyzer struct {
+	series bool
+
+	first   time.Time
+	buckets []uint64
+
+	frames    int
+	frameSum  int
+	keyframes int
+	keySum    int
+}
+
+func newBitrateAnalyzer(series bool) *bitrateAnalyzer {
+	return &bitrateAnalyzer{series: series}
+}
+
+func (ba *bitrateAnalyzer) onRTP(pkt *rtp.Packet, received time.Time) {
+	if ba.first.IsZero() {
+		ba.first = received
+	}
+	i := int(received.Sub(ba.first) / time.Second)
+	for len(ba.buckets) <= i {
+		ba.buckets = append(ba.buckets, 0)
+	}
+	ba.buckets[i] += uint64(pkt.MarshalSize())
+}
+
+func (ba *bitrateAnalyzer) onFrame(au *accessUnit) {
+	ba.frames++
+	ba.frameSum += au.size
+	if au.random {
+		ba.keyframes++
+		ba.keySum += au.size
+	}
+}
+
+func (ba *bitrateAnalyzer) onRTCP(rtcp.Packet, time.Time) {}
+
+func (ba *bitrateAnalyzer) finish(mi *MediaInfo, _ time.Duration) {
+	// The last bucket is cut short by the end of the window
+	if len(ba.buckets) < 2 {
+		return
+	}
+	buckets := ba.buckets[:len(ba.buckets)-1]
+
+	info := &BitrateInfo{Seconds: len(buckets)}
+	rates := make([]float64, len(buckets))
+	var sum, sq float64
+	for i, b := range buckets {
+		info.Bytes += b
+		rates[i] = float64(b) * 8
+		sum += rates[i]
+		sq += rates[i] * rates[i]
+	}
+	if ba.series {
+		info.Series = append([]float64(nil), rates...)
+	}
+
+	sorted := append([]float64(nil), rates...)
+	sort.Float64s(sorted)
+	n := float64(len(sorted))
+	info.Min, info.Max = sorted[0], sorted[len(sorted)-1]
+	info.Avg = sum / n
+	info.P95 = sorted[int(math.Ceil(0.95*n))-1]
+	if info.Avg > 0 {
+		info.PeakToAverage = info.Max / info.Avg
+		info.Variation = math.Sqrt(math.Max(0, sq/n-info.Avg*info.Avg)) / info.Avg
+		if len(rates) >= minBitrateBuckets {
+			info.Mode = bitrateMode(sorted, info.Variation)
+		}
+	}
+
+	if ba.frames > 0 {
+		info.AvgFrameSize = float64(ba.frameSum) / float64(ba.frames)
+	}
+	if ba.keyframes > 0 && info.AvgFrameSize > 0 {
+		info.AvgKeyframeSize = float64(ba.keySum) / float64(ba.keyframes)
+		info.KeyframeRatio = info.AvgKeyframeSize / info.AvgFrameSize
+	}
+	mi.Bitrate = info
+}
+
+// bitrateMode guesses the rate control from sorted per-second rates: a steady rate is CBR, a varying rate
+// that keeps returning to the same ceiling is capped VBR, anything else VBR.
+func bitrateMode(sorted []float64, variation float64) string {
+	if variation <= cbrVariation {
+		return BitrateModeCBR
+	}
+	peak := sorted[len(sorted)-1]
+	atCap := 0
+	for _, r := range sorted {
+		if r >= peak*(1-capBand) {
+			atCap++
+		}
+	}
+	if atCap > 1 && float64(atCap)/float64(len(sorted)) >= capShare {
+		return BitrateModeCappedVBR
+	}
+	return BitrateModeVBR
+}
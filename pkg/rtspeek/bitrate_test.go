@@ -0,0 +1,108 @@
+package rtspeek
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/pion/rtp"
+)
+
+// feedBitrate sends one packet per second carrying the given kilobytes (headers included; 0 sends nothing), plus a final
+// packet opening the partial bucket that finish drops.
+func feedBitrate(kilobytes []int) *BitrateInfo {
+	ba := newBitrateAnalyzer(true)
+	start := time.Now()
+	for i, kb := range append(kilobytes, 1) {
+		if kb == 0 {
+			continue
+		}
+		payload := make([]byte, kb*1000-12)
+		ba.onRTP(&rtp.Packet{Header: rtp.Header{Version: 2, SequenceNumber: uint16(i)}, Payload: payload}, start.Add(time.Duration(i)*time.Second))
+	}
+	var mi MediaInfo
+	ba.finish(&mi, time.Duration(len(kilobytes))*time.Second)
+	return mi.Bitrate
+}
+
+func TestBitrateMode(t *testing.T) {
+	tests := []struct {
+		name      string
+		kilobytes []int
+		mode      string
+	}{
+		{name: "constant", kilobytes: []int{100, 102, 98, 100, 101, 99}, mode: BitrateModeCBR},
+		{name: "variable", kilobytes: []int{40, 120, 60, 200, 80, 30}, mode: BitrateModeVBR},
+		{name: "capped", kilobytes: []int{40, 200, 199, 60, 200, 198, 90, 201}, mode: BitrateModeCappedVBR},
+		{name: "too short", kilobytes: []int{40, 200}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			br := feedBitrate(tt.kilobytes)
+			if br == nil || br.Mode != tt.mode || br.Seconds != len(tt.kilobytes) {
+				t.Fatalf("expected mode %q over %d seconds, got %+v", tt.mode, len(tt.kilobytes), br)
+			}
+		})
+	}
+}
+
+func TestBitrateStatistics(t *testing.T) {
+	br := feedBitrate([]int{10, 20, 30, 40, 50, 60, 70, 80, 90, 100, 110, 120, 130, 140, 150, 160, 170, 180, 190, 200})
+	if br.Min != 80000 || br.Max != 1600000 || br.Avg != 840000 || br.P95 != 1520000 {
+		t.Fatalf("unexpected statistics: %+v", br)
+	}
+	if br.Bytes != 2100000 || len(br.Series) != 20 || br.Series[2] != 240000 {
+		t.Fatalf("unexpected bytes/series: %+v", br)
+	}
+	if br.PeakToAverage < 1.9 || br.PeakToAverage > 1.91 {
+		t.Fatalf("unexpected peak-to-average %v", br.PeakToAverage)
+	}
+
+	// An empty second inside the window counts as zero
+	if br := feedBitrate([]int{100, 0, 100}); br.Min != 0 || br.Seconds != 3 {
+		t.Fatalf("expected a silent second, got %+v", br)
+	}
+	if br := feedBitrate(nil); br != nil {
+		t.Fatalf("expected no profile without a complete second, got %+v", br)
+	}
+}
+
+func TestDescribeStreamLiveProbeBitrate(t *testing.T) {
+	video := h264Media()
+	desc := &description.Session{Medias: []*description.Media{video}}
+	src := newH264Source(5) // IDR slices are twice the size of P slices
+	src.SliceSize = 1000
+	url := startPlayServer(t, desc, 20*time.Millisecond, func(stream *gortsplib.ServerStream, n int) {
+		for _, pkt := range src.frame(n) {
+			_ = stream.WritePacketRTP(video, pkt)
+		}
+	})
+
+	ctx := WithLiveProbe(context.Background(), LiveProbeOptions{Duration: 2500 * time.Millisecond, Transport: "tcp"})
+	info, err := DescribeStream(ctx, url, 3*time.Second)
+	if err != nil {
+		t.Fatalf("describe: %v", err)
+	}
+	br := info.GetVideoMedias()[0].Bitrate
+	if br == nil || br.Seconds != 2 || br.Series != nil {
+		t.Fatalf("expected two complete seconds without a series, got %+v", br)
+	}
+	// 50 frames/s of ~1 KB plus a doubled keyframe every fifth frame: ~480 kbit/s
+	if br.Avg < 400000 || br.Avg > 560000 || br.Max < br.Avg || br.Min > br.Avg {
+		t.Fatalf("unexpected bitrate: %+v", br)
+	}
+	if br.KeyframeRatio < 1.6 || br.KeyframeRatio > 1.8 || br.AvgKeyframeSize <= br.AvgFrameSize {
+		t.Fatalf("expected keyframes ~1.7x the average frame, got %+v", br)
+	}
+
+	var sb strings.Builder
+	if err := WritePrometheus(&sb, CollectMetrics(info)); err != nil {
+		t.Fatalf("write metrics: %v", err)
+	}
+	if !strings.Contains(sb.String(), "rtpeek_bitrate_keyframe_ratio{") {
+		t.Fatalf("missing bitrate metrics:\n%s", sb.String())
+	}
+}
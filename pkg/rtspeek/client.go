@@ -12,24 +12,40 @@ import (
 
 // DescribeStream performs connection and DESCRIBE, returning StreamInfo and underlying description pointer.
 func DescribeStream(ctx context.Context, url string, timeout time.Duration) (StreamInfo, error) {
+	info, err := describeStream(ctx, url, timeout)
+	if rec := sessionRecorder(ctx); rec != nil {
+		rec.finish(err)
+	}
+	return info, err
+}
+
+func describeStream(ctx context.Context, url string, timeout time.Duration) (StreamInfo, error) {
 	info := &streamInfo{URL: url, Protocol: "rtsp"}
 	start := time.Now()
 
-	if !ValidateURL(url) {
-		return nil, ErrInvalidURL
+	parsedURL, err := parseRTSPURL(url)
+	if err != nil {
+		return nil, err
 	}
 
-	parsedURL, err := base.ParseURL(url)
-	if err != nil {
-		return nil, fmt.Errorf("invalid URL format: %w", err)
+	liveOpts, liveProbe := liveProbeOptions(ctx)
+	if liveProbe {
+		if _, err := parseTransport(liveOpts.Transport); err != nil {
+			return nil, err
+		}
 	}
 
-	// Enforce supported schemes early
-	if parsedURL.Scheme != "rtsp" && parsedURL.Scheme != "rtsps" {
-		return nil, fmt.Errorf("unsupported scheme '%s': only rtsp and rtsps are supported", parsedURL.Scheme)
+	recorder := sessionRecorder(ctx)
+	if recorder != nil {
+		opts := RecordedOptions{Backchannel: wantBackchannel(ctx)}
+		if liveProbe {
+			opts.LiveProbe, opts.Transport = liveOpts.Duration.Seconds(), liveOpts.Transport
+		}
+		recorder.begin(parsedURL, opts)
 	}
 
-	ctx, cancel := context.WithTimeout(ctx, timeout)
+	// The live probe window extends the overall deadline
+	ctx, cancel := context.WithTimeout(ctx, timeout+liveOpts.Duration)
 	defer cancel()
 
 	debugEnabled := isDebug(ctx)
@@ -60,13 +76,31 @@ func DescribeStream(ctx context.Context, url string, timeout time.Duration) (Str
 
 		session := NewRTSPSession(timeout, logger)
 		defer session.Close()
+		if wantBackchannel(ctx) {
+			session.RequestBackChannels()
+		}
+		if liveProbe {
+			_ = session.SetTransport(liveOpts.Transport) // validated above
+		}
+		if recorder != nil {
+			session.record(recorder)
+		}
 
 		desc, trace, sessionErr := session.PerformDescribe(ctx, parsedURL)
-		resultCh <- &rtspResult{
+		res := &rtspResult{
+			// Latency covers connect and DESCRIBE only, not the live probe that follows
+			latency:     float64(time.Since(start)) / float64(time.Millisecond),
 			description: desc,
+			response:    session.DescribeResponse(),
 			trace:       trace,
 			err:         sessionErr,
+			server:      session.server,
+			authMethods: session.authMethods,
 		}
+		if sessionErr == nil && liveProbe {
+			res.probe = session.PerformLiveProbe(ctx, desc, liveOpts)
+		}
+		resultCh <- res
 	}()
 
 	var result *rtspResult
@@ -77,12 +111,12 @@ func DescribeStream(ctx context.Context, url string, timeout time.Duration) (Str
 			// We may not have trace data if timeout occurred early
 			info.DebugTrace = []string{"TIMEOUT: operation cancelled before completion"}
 		}
-		return info, fmt.Errorf("operation timed out after %v", timeout)
+		return info, fmt.Errorf("operation timed out after %v", timeout+liveOpts.Duration)
 	case result = <-resultCh:
 		// Continue with result processing
 	}
 
-	info.Latency = float64(time.Since(start)) / float64(time.Millisecond)
+	info.Latency = result.latency
 
 	if result.err != nil {
 		if debugEnabled && result.trace != nil {
@@ -110,14 +144,70 @@ func DescribeStream(ctx context.Context, url string, timeout time.Duration) (Str
 		}
 	}
 
+	applySDPDetails(info, result.response, result.description, wantRawSDP(ctx))
+	info.Session.Server, info.Session.AuthMethods = result.server, result.authMethods
+	if result.probe != nil {
+		result.probe.apply(info)
+	}
+
 	return info, nil
 }
 
+// applySDPDetails attaches session and per-media SDP attributes from the DESCRIBE response.
+func applySDPDetails(info *streamInfo, res *base.Response, desc *description.Session, includeRaw bool) {
+	var baseURL *base.URL
+	if desc != nil {
+		baseURL = desc.BaseURL
+	}
+	if res == nil {
+		info.Session = extractSessionDetails(nil, nil, baseURL)
+		return
+	}
+
+	// gortsplib already validated this body, so a parse failure here only loses the extras
+	ssd, _ := parseSDP(res.Body)
+	info.Session = extractSessionDetails(ssd, res, baseURL)
+	if includeRaw {
+		info.Session.RawSDP = string(res.Body)
+	}
+	if ssd == nil {
+		return
+	}
+	for i, md := range ssd.MediaDescriptions {
+		if mi := info.mediaByIndex(i); mi != nil {
+			applyMediaSDPDetails(mi, md)
+		}
+	}
+}
+
+// parseRTSPURL validates and parses an RTSP(S) URL.
+func parseRTSPURL(url string) (*base.URL, error) {
+	if !ValidateURL(url) {
+		return nil, ErrInvalidURL
+	}
+
+	parsedURL, err := base.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL format: %w", err)
+	}
+
+	// Enforce supported schemes early
+	if parsedURL.Scheme != "rtsp" && parsedURL.Scheme != "rtsps" {
+		return nil, fmt.Errorf("unsupported scheme '%s': only rtsp and rtsps are supported", parsedURL.Scheme)
+	}
+	return parsedURL, nil
+}
+
 // rtspResult encapsulates the result of RTSP operations.
 type rtspResult struct {
+	latency     float64 // ms
 	description *description.Session
+	response    *base.Response
+	probe       *liveProbe
 	trace       []string
 	err         error
+	server      string
+	authMethods []string
 }
 
 // CheckReachable performs a quick DESCRIBE with a shorter timeout.
@@ -144,3 +234,32 @@ func isDebug(ctx context.Context) bool {
 	b, _ := v.(bool)
 	return b
 }
+
+// backchannel context key and helpers
+type backchannelCtxKey struct{}
+
+var backchannelKey = backchannelCtxKey{}
+
+// WithBackchannel requests ONVIF backchannel tracks during DESCRIBE.
+// Servers that reject the Require header are described again without it.
+func WithBackchannel(ctx context.Context) context.Context {
+	return context.WithValue(ctx, backchannelKey, true)
+}
+func wantBackchannel(ctx context.Context) bool {
+	v := ctx.Value(backchannelKey)
+	b, _ := v.(bool)
+	return b
+}
+
+// raw SDP context key and helpers
+type rawSDPCtxKey struct{}
+
+var rawSDPKey = rawSDPCtxKey{}
+
+// WithRawSDP requests that the raw SDP text be included in the returned StreamInfo.
+func WithRawSDP(ctx context.Context) context.Context { return context.WithValue(ctx, rawSDPKey, true) }
+func wantRawSDP(ctx context.Context) bool {
+	v := ctx.Value(rawSDPKey)
+	b, _ := v.(bool)
+	return b
+}
@@ -0,0 +1,624 @@
+package rtspeek
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultProfileTimeout is the describe timeout of a probe profile that sets none.
+const DefaultProfileTimeout = 5 * time.Second
+
+// Config describes a fleet of targets with named probe profiles and credential references (see LoadConfig).
+//
+//	defaults:
+//	  profile: standard
+//	profiles:
+//	  standard: {timeout: 5s, live_probe: 3s, transport: tcp}
+//	credentials:
+//	  hq-cams: {user: admin, password_env: HQ_CAM_PASS}
+//	targets:
+//	  - name: lobby
+//	    url: rtsp://10.0.0.5/Streaming/Channels/101
+//	    site: hq
+//	    labels: {floor: "1"}
+//	    credentials: hq-cams
+//	alerts:
+//	  fail_after: 2
+//	  notifiers:
+//	    - {type: slack, url_env: SLACK_WEBHOOK}
+type Config struct {
+	Defaults    ConfigDefaults            `yaml:"defaults"`
+	Profiles    map[string]*ProbeProfile  `yaml:"profiles"`
+	Credentials map[string]*CredentialRef `yaml:"credentials"`
+	Targets     []*ConfigTarget           `yaml:"targets"`
+	Alerts      *AlertConfig              `yaml:"alerts"`
+}
+
+// ConfigDefaults names the profile and credentials of targets that name none.
+type ConfigDefaults struct {
+	Profile     string `yaml:"profile"`
+	Credentials string `yaml:"credentials"`
+}
+
+// ProbeProfile is a named set of probe options.
+type ProbeProfile struct {
+	Timeout       ConfigDuration `yaml:"timeout"`    // describe timeout (DefaultProfileTimeout if 0)
+	LiveProbe     ConfigDuration `yaml:"live_probe"` // PLAY window; 0 disables the live probe
+	Transport     string         `yaml:"transport"`  // live probe transport: auto, udp, tcp or multicast
+	Backchannel   bool           `yaml:"backchannel"`
+	RawSDP        bool           `yaml:"raw_sdp"`
+	BitrateSeries bool           `yaml:"bitrate_series"`
+	Expect        *Expectations  `yaml:"expect"` // checked on every target of the profile
+}
+
+// CredentialRef tells where the password of a user comes from: inline, an environment variable or a file
+// (for secrets mounted by an orchestrator). Exactly one source must be set.
+type CredentialRef struct {
+	User         string `yaml:"user"`
+	Password     string `yaml:"password"`
+	PasswordEnv  string `yaml:"password_env"`
+	PasswordFile string `yaml:"password_file"`
+}
+
+// ConfigTarget is one stream to probe.
+type ConfigTarget struct {
+	Name        string            `yaml:"name"`
+	URL         string            `yaml:"url"`
+	Site        string            `yaml:"site"`
+	Labels      map[string]string `yaml:"labels"`
+	Profile     string            `yaml:"profile"`
+	Credentials string            `yaml:"credentials"`
+	Expect      *Expectations     `yaml:"expect"` // fields set here override those of the profile
+}
+
+// AlertConfig configures the notifications of watch (see AlerterOptions).
+type AlertConfig struct {
+	FailAfter   int               `yaml:"fail_after"`
+	MinInterval ConfigDuration    `yaml:"min_interval"`
+	MaxPerHour  int               `yaml:"max_per_hour"`
+	Notifiers   []*NotifierConfig `yaml:"notifiers"`
+}
+
+// DefaultWebhookRetries is the number of retries of a configured webhook that sets none.
+const DefaultWebhookRetries = 3
+
+// NotifierConfig describes one notifier: a webhook (type webhook, slack or teams) or a command (exec).
+type NotifierConfig struct {
+	Type    string            `yaml:"type"`
+	URL     string            `yaml:"url"`
+	URLEnv  string            `yaml:"url_env"` // environment variable holding the URL, for secret webhooks
+	Headers map[string]string `yaml:"headers"`
+	Body    string            `yaml:"body"`    // webhook body template (see WebhookNotifier.Body)
+	Retries *int              `yaml:"retries"` // DefaultWebhookRetries if unset
+	Backoff ConfigDuration    `yaml:"backoff"`
+	Timeout ConfigDuration    `yaml:"timeout"`
+	Command []string          `yaml:"command"` // exec: program and arguments
+}
+
+// Notifier builds the notifier.
+func (n *NotifierConfig) Notifier() (Notifier, error) {
+	if n.Type == "exec" {
+		if len(n.Command) == 0 {
+			return nil, fmt.Errorf("command is required")
+		}
+		return &ExecNotifier{Command: n.Command, Timeout: time.Duration(n.Timeout)}, nil
+	}
+	w := &WebhookNotifier{Headers: n.Headers, Retries: DefaultWebhookRetries, Backoff: time.Duration(n.Backoff), Timeout: time.Duration(n.Timeout)}
+	switch n.Type {
+	case "webhook":
+		w.Format = WebhookJSON
+	case "slack":
+		w.Format = WebhookSlack
+	case "teams":
+		w.Format = WebhookTeams
+	default:
+		return nil, fmt.Errorf("unknown notifier type %q (want webhook, slack, teams or exec)", n.Type)
+	}
+	w.URL = n.URL
+	if n.URLEnv != "" {
+		w.URL = os.Getenv(n.URLEnv)
+		if w.URL == "" {
+			return nil, fmt.Errorf("environment variable %s is not set", n.URLEnv)
+		}
+	}
+	if w.URL == "" {
+		return nil, fmt.Errorf("url or url_env is required")
+	}
+	if n.Retries != nil {
+		w.Retries = *n.Retries
+	}
+	if n.Body != "" {
+		if w.Format != WebhookJSON {
+			return nil, fmt.Errorf("body only applies to webhook notifiers")
+		}
+		body, err := ParseWebhookBody(n.Body)
+		if err != nil {
+			return nil, err
+		}
+		w.Body = body
+	}
+	return w, nil
+}
+
+// Options returns the Alerter options of the config.
+func (c *AlertConfig) Options() AlerterOptions {
+	return AlerterOptions{FailAfter: c.FailAfter, MinInterval: time.Duration(c.MinInterval), MaxPerHour: c.MaxPerHour}
+}
+
+// ConfigDuration is a duration written as a Go duration string ("500ms", "5s", "1m30s").
+type ConfigDuration time.Duration
+
+// UnmarshalYAML parses a duration string; a type error keeps the other fields decoding.
+func (d *ConfigDuration) UnmarshalYAML(value *yaml.Node) error {
+	v, err := time.ParseDuration(value.Value)
+	if value.Kind != yaml.ScalarNode || err != nil || v < 0 {
+		return &yaml.TypeError{Errors: []string{fmt.Sprintf("line %d: invalid duration %q (want e.g. 500ms, 5s, 1m)", value.Line, value.Value)}}
+	}
+	*d = ConfigDuration(v)
+	return nil
+}
+
+// ConfigError is a problem at a position of a config file.
+type ConfigError struct {
+	File   string
+	Line   int // 1-based; 0 when unknown
+	Column int // 1-based; 0 when unknown
+	Path   string
+	Msg    string
+}
+
+func (e *ConfigError) Error() string {
+	var b strings.Builder
+	b.WriteString(e.File)
+	if e.Line > 0 {
+		fmt.Fprintf(&b, ":%d", e.Line)
+		if e.Column > 0 {
+			fmt.Fprintf(&b, ":%d", e.Column)
+		}
+	}
+	b.WriteString(": ")
+	if e.Path != "" {
+		b.WriteString(e.Path + ": ")
+	}
+	b.WriteString(e.Msg)
+	return b.String()
+}
+
+// ConfigErrors lists every problem found in a config file, in file order.
+type ConfigErrors []*ConfigError
+
+func (es ConfigErrors) Error() string {
+	msgs := make([]string, len(es))
+	for i, e := range es {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// LoadConfigFile reads and validates a config file.
+func LoadConfigFile(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadConfig(f, path)
+}
+
+// yamlLineRE finds the position in yaml.v3 error messages.
+var yamlLineRE = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// LoadConfig reads a YAML config (JSON is accepted too) and validates it: unknown fields, wrong types,
+// invalid URLs, durations and transports, duplicate names and dangling profile or credential references
+// are all reported, each with its position, as ConfigErrors. file is only used in messages.
+func LoadConfig(r io.Reader, file string) (*Config, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, ConfigErrors{yamlConfigError(file, err.Error())}
+	}
+	if len(root.Content) == 0 {
+		return nil, ConfigErrors{{File: file, Msg: "empty config"}}
+	}
+
+	var cfg Config
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	var errs ConfigErrors
+	if err := dec.Decode(&cfg); err != nil {
+		var te *yaml.TypeError
+		if !errors.As(err, &te) {
+			return nil, ConfigErrors{yamlConfigError(file, err.Error())}
+		}
+		for _, msg := range te.Errors {
+			errs = append(errs, yamlConfigError(file, msg))
+		}
+	}
+	v := configValidator{file: file, root: root.Content[0], errs: errs}
+	v.validate(&cfg)
+	if len(v.errs) > 0 {
+		sort.SliceStable(v.errs, func(i, j int) bool { return v.errs[i].Line < v.errs[j].Line })
+		return nil, v.errs
+	}
+	return &cfg, nil
+}
+
+// yamlConfigError turns a yaml.v3 message into a positioned error.
+func yamlConfigError(file, msg string) *ConfigError {
+	if m := yamlLineRE.FindStringSubmatch(msg); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return &ConfigError{File: file, Line: line, Msg: m[2]}
+	}
+	return &ConfigError{File: file, Msg: strings.TrimPrefix(msg, "yaml: ")}
+}
+
+// configValidator checks the semantics of a decoded config against its node tree for positions.
+type configValidator struct {
+	file string
+	root *yaml.Node
+	errs ConfigErrors
+}
+
+// errorf records a problem at the value of path (or the closest node that exists).
+func (v *configValidator) errorf(path []any, format string, args ...any) {
+	node := v.root
+	for _, p := range path {
+		next := childNode(node, p)
+		if next == nil {
+			break
+		}
+		node = next
+	}
+	v.errs = append(v.errs, &ConfigError{
+		File: v.file, Line: node.Line, Column: node.Column,
+		Path: configPath(path), Msg: fmt.Sprintf(format, args...),
+	})
+}
+
+// childNode returns the value of a mapping key (string) or a sequence item (int).
+func childNode(n *yaml.Node, p any) *yaml.Node {
+	switch key := p.(type) {
+	case string:
+		if n.Kind != yaml.MappingNode {
+			return nil
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == key {
+				return n.Content[i+1]
+			}
+		}
+	case int:
+		if n.Kind == yaml.SequenceNode && key < len(n.Content) {
+			return n.Content[key]
+		}
+	}
+	return nil
+}
+
+// configPath renders a path like targets[3].url.
+func configPath(path []any) string {
+	var b strings.Builder
+	for _, p := range path {
+		switch key := p.(type) {
+		case int:
+			fmt.Fprintf(&b, "[%d]", key)
+		case string:
+			if b.Len() > 0 {
+				b.WriteByte('.')
+			}
+			b.WriteString(key)
+		}
+	}
+	return b.String()
+}
+
+func (v *configValidator) validate(cfg *Config) {
+	if cfg.Alerts != nil {
+		v.alerts(cfg.Alerts)
+	}
+	if cfg.Defaults.Profile != "" && cfg.Profiles[cfg.Defaults.Profile] == nil {
+		v.errorf([]any{"defaults", "profile"}, "unknown profile %q", cfg.Defaults.Profile)
+	}
+	if cfg.Defaults.Credentials != "" && cfg.Credentials[cfg.Defaults.Credentials] == nil {
+		v.errorf([]any{"defaults", "credentials"}, "unknown credentials %q", cfg.Defaults.Credentials)
+	}
+	for name, p := range cfg.Profiles {
+		if p == nil {
+			v.errorf([]any{"profiles", name}, "empty profile")
+			continue
+		}
+		if _, err := parseTransport(p.Transport); err != nil {
+			v.errorf([]any{"profiles", name, "transport"}, "%v", err)
+		}
+		v.expectations([]any{"profiles", name, "expect"}, p.Expect)
+	}
+	for name, c := range cfg.Credentials {
+		if c == nil || c.User == "" {
+			v.errorf([]any{"credentials", name}, "user is required")
+			continue
+		}
+		sources := 0
+		for _, s := range []string{c.Password, c.PasswordEnv, c.PasswordFile} {
+			if s != "" {
+				sources++
+			}
+		}
+		if sources != 1 {
+			v.errorf([]any{"credentials", name}, "set exactly one of password, password_env and password_file")
+		}
+	}
+
+	if len(cfg.Targets) == 0 {
+		v.errorf([]any{"targets"}, "no targets")
+	}
+	names := make(map[string]int)
+	for i, t := range cfg.Targets {
+		if t == nil {
+			v.errorf([]any{"targets", i}, "empty target")
+			continue
+		}
+		if t.Name == "" {
+			v.errorf([]any{"targets", i}, "name is required")
+		} else if first, ok := names[t.Name]; ok {
+			v.errorf([]any{"targets", i, "name"}, "duplicate name %q (first used by targets[%d])", t.Name, first)
+		} else {
+			names[t.Name] = i
+		}
+		if t.URL == "" {
+			v.errorf([]any{"targets", i}, "url is required")
+		} else if u, err := parseRTSPURL(t.URL); err != nil {
+			v.errorf([]any{"targets", i, "url"}, "%v", err)
+		} else if u.User != nil && v.credentials(cfg, t) != "" {
+			v.errorf([]any{"targets", i, "url"}, "url has credentials and credentials are referenced too")
+		}
+		if t.Profile != "" && cfg.Profiles[t.Profile] == nil {
+			v.errorf([]any{"targets", i, "profile"}, "unknown profile %q", t.Profile)
+		}
+		if t.Credentials != "" && cfg.Credentials[t.Credentials] == nil {
+			v.errorf([]any{"targets", i, "credentials"}, "unknown credentials %q", t.Credentials)
+		}
+		v.expectations([]any{"targets", i, "expect"}, t.Expect)
+		if t.Profile == "" || cfg.Profiles[t.Profile] != nil {
+			if cfg.ExpectationsFor(t).MaxGOP > 0 && cfg.ProfileFor(t).LiveProbe == 0 {
+				v.errorf([]any{"targets", i}, "max_gop is expected but the profile has no live_probe")
+			}
+		}
+	}
+}
+
+// alerts checks the alerts block.
+func (v *configValidator) alerts(a *AlertConfig) {
+	if a.FailAfter < 0 {
+		v.errorf([]any{"alerts", "fail_after"}, "must not be negative")
+	}
+	if a.MaxPerHour < 0 {
+		v.errorf([]any{"alerts", "max_per_hour"}, "must not be negative")
+	}
+	for i, n := range a.Notifiers {
+		path := []any{"alerts", "notifiers", i}
+		if n == nil {
+			v.errorf(path, "empty notifier")
+			continue
+		}
+		// Check everything but the environment, which may only be set where watch runs
+		check := *n
+		if check.URLEnv != "" {
+			check.URLEnv, check.URL = "", "https://env.invalid"
+		}
+		if _, err := check.Notifier(); err != nil {
+			v.errorf(path, "%v", err)
+		}
+		if n.Retries != nil && *n.Retries < 0 {
+			v.errorf(append(path, "retries"), "must not be negative")
+		}
+	}
+}
+
+// expectations checks an expect block.
+func (v *configValidator) expectations(path []any, e *Expectations) {
+	if e == nil {
+		return
+	}
+	for _, p := range e.problems() {
+		v.errorf(append(path[:len(path):len(path)], p.field), "%s", p.msg)
+	}
+}
+
+func (v *configValidator) credentials(cfg *Config, t *ConfigTarget) string {
+	if t.Credentials != "" {
+		return t.Credentials
+	}
+	if u, _ := url.Parse(t.URL); u != nil && u.User != nil {
+		return "" // inline credentials win over the default
+	}
+	return cfg.Defaults.Credentials
+}
+
+// ProfileFor returns the profile of a target: its own, the default one, or the built-in defaults.
+func (c *Config) ProfileFor(t *ConfigTarget) ProbeProfile {
+	name := t.Profile
+	if name == "" {
+		name = c.Defaults.Profile
+	}
+	var p ProbeProfile
+	if named := c.Profiles[name]; named != nil {
+		p = *named
+	}
+	if p.Timeout == 0 {
+		p.Timeout = ConfigDuration(DefaultProfileTimeout)
+	}
+	return p
+}
+
+// ExpectationsFor returns the expectations of a target: those of its profile, overridden by its own.
+func (c *Config) ExpectationsFor(t *ConfigTarget) Expectations {
+	var e Expectations
+	if p := c.ProfileFor(t); p.Expect != nil {
+		e = *p.Expect
+	}
+	if t.Expect != nil {
+		e = e.Merge(*t.Expect)
+	}
+	return e
+}
+
+// TargetURL returns the URL of a target with its credentials filled in from their source.
+func (c *Config) TargetURL(t *ConfigTarget) (string, error) {
+	u, err := url.Parse(t.URL)
+	if err != nil {
+		return "", err
+	}
+	name := t.Credentials
+	if name == "" && u.User == nil {
+		name = c.Defaults.Credentials
+	}
+	cred := c.Credentials[name]
+	if cred == nil {
+		return t.URL, nil
+	}
+	pass, err := cred.password()
+	if err != nil {
+		return "", fmt.Errorf("credentials %s: %w", name, err)
+	}
+	u.User = url.UserPassword(cred.User, pass)
+	return u.String(), nil
+}
+
+// password reads the password from its source.
+func (c *CredentialRef) password() (string, error) {
+	switch {
+	case c.PasswordEnv != "":
+		p, ok := os.LookupEnv(c.PasswordEnv)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", c.PasswordEnv)
+		}
+		return p, nil
+	case c.PasswordFile != "":
+		data, err := os.ReadFile(c.PasswordFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+	return c.Password, nil
+}
+
+// Context returns ctx with the options of the profile applied.
+func (p ProbeProfile) Context(ctx context.Context) context.Context {
+	if p.Backchannel {
+		ctx = WithBackchannel(ctx)
+	}
+	if p.RawSDP {
+		ctx = WithRawSDP(ctx)
+	}
+	if p.LiveProbe > 0 {
+		ctx = WithLiveProbe(ctx, LiveProbeOptions{
+			Duration:      time.Duration(p.LiveProbe),
+			Transport:     p.Transport,
+			BitrateSeries: p.BitrateSeries,
+		})
+	}
+	return ctx
+}
+
+// TargetFilter selects targets by name, site and labels; empty fields match everything.
+type TargetFilter struct {
+	Names  []string
+	Site   string
+	Labels map[string]string
+}
+
+// Select returns the targets matching f, in config order.
+func (c *Config) Select(f TargetFilter) []*ConfigTarget {
+	var out []*ConfigTarget
+	for _, t := range c.Targets {
+		if len(f.Names) > 0 && !containsString(f.Names, t.Name) {
+			continue
+		}
+		if f.Site != "" && t.Site != f.Site {
+			continue
+		}
+		match := true
+		for k, v := range f.Labels {
+			match = match && t.Labels[k] == v
+		}
+		if match {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// TargetResult is the outcome of probing one configured target.
+type TargetResult struct {
+	Target *ConfigTarget
+	URL    string // without credentials
+	Start  time.Time
+	Info   StreamInfo
+	Err    error
+	Expect *ExpectationReport // nil when the target has no expectations
+}
+
+// ProbeTargets describes each target with its profile and credentials, at most concurrency at once (1 if
+// lower), and returns the results in the order of targets. onResult, if set, is called as each finishes
+// (from several goroutines, one at a time).
+func ProbeTargets(ctx context.Context, cfg *Config, targets []*ConfigTarget, concurrency int, onResult func(TargetResult)) []TargetResult {
+	results := make([]TargetResult, len(targets))
+	sem := make(chan struct{}, max(concurrency, 1))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			res := TargetResult{Target: t, URL: uriWithoutUser(t.URL), Start: time.Now()}
+			if ctx.Err() != nil {
+				res.Err = ctx.Err()
+			} else if u, err := cfg.TargetURL(t); err != nil {
+				res.Err = err
+			} else {
+				p := cfg.ProfileFor(t)
+				res.Info, res.Err = DescribeStream(p.Context(ctx), u, time.Duration(p.Timeout))
+			}
+			if e := cfg.ExpectationsFor(t); !e.IsZero() {
+				res.Expect = e.Check(res.Info)
+			}
+			results[i] = res
+			if onResult != nil {
+				mu.Lock()
+				onResult(res)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
@@ -1,74 +1,63 @@
-//go:build integration
-
 package rtspeek
 
 import (
 	"context"
-	"net"
 	"testing"
 	"time"
 
-	"github.com/bluenviron/gortsplib/v4"
+	"github.com/0x524A/rtspeek/pkg/rtspeektest"
 	"github.com/bluenviron/gortsplib/v4/pkg/base"
 	"github.com/bluenviron/gortsplib/v4/pkg/description"
 	"github.com/bluenviron/gortsplib/v4/pkg/format"
 )
 
-// startTestServer spins a minimal RTSP server that serves a static SDP.
-type testServerHandler struct {
-	stream *gortsplib.ServerStream
-}
-
-func (h *testServerHandler) OnDescribe(ctx *gortsplib.ServerHandlerOnDescribeCtx) (*base.Response, *gortsplib.ServerStream, error) {
-	return &base.Response{StatusCode: base.StatusOK}, h.stream, nil
-}
-
-func startTestServer(t *testing.T) (*gortsplib.Server, string) {
-	t.Helper()
-
-	medias := []*description.Media{{
-		Type: description.MediaTypeVideo,
-		Formats: []format.Format{
-			&format.H264{PayloadTyp: 96, SPS: []byte{0x67, 0x42, 0x00, 0x1f}, PPS: []byte{0x68, 0xce, 0x06, 0xe2}},
-		},
-	}}
-
-	// pick a free port
-	l, err := net.Listen("tcp", "127.0.0.1:0")
+// TestDescribeStreamIntegration describes a static SDP served by the in-process test server.
+func TestDescribeStreamIntegration(t *testing.T) {
+	srv := rtspeektest.Start(t, rtspeektest.Config{
+		Description: &description.Session{Medias: []*description.Media{{
+			Type: description.MediaTypeVideo,
+			Formats: []format.Format{
+				&format.H264{PayloadTyp: 96, SPS: []byte{0x67, 0x42, 0x00, 0x1f}, PPS: []byte{0x68, 0xce, 0x06, 0xe2}},
+			},
+		}}},
+		FrameInterval: -1,
+	})
+
+	info, err := DescribeStream(context.Background(), srv.URL, time.Second)
 	if err != nil {
-		t.Fatalf("listen: %v", err)
+		t.Fatalf("describe: %v", err)
 	}
-	addr := l.Addr().String()
-	l.Close()
-
-	s := &gortsplib.Server{RTSPAddress: addr}
-	if err := s.Start(); err != nil {
-		t.Fatalf("server start: %v", err)
+	if !info.IsReachable() || !info.IsDescribeSucceeded() {
+		t.Fatalf("expected reachable & describe ok: %+v", info)
+	}
+	if info.GetMediaCount() == 0 {
+		t.Fatalf("expected at least one media")
 	}
-
-	stream := gortsplib.NewServerStream(s, &description.Session{Medias: medias})
-	s.Handler = &testServerHandler{stream: stream}
-
-	return s, "rtsp://" + addr + "/test"
 }
 
-// TestDescribeStreamIntegration requires networking and gortsplib server internals; run with: go test -tags=integration
-func TestDescribeStreamIntegration(t *testing.T) {
-	s, url := startTestServer(t)
-	defer s.Close()
-
-	// Wait briefly to ensure server running
-	time.Sleep(100 * time.Millisecond)
-
-	ctx := context.Background()
-	info, err := DescribeStream(ctx, url, 1*time.Second)
+// TestPerformDescribeLeavesSessionOpen checks that the connection survives DESCRIBE until Close.
+func TestPerformDescribeLeavesSessionOpen(t *testing.T) {
+	srv := rtspeektest.Start(t, rtspeektest.Config{FrameInterval: -1})
+	u, err := base.ParseURL(srv.URL)
 	if err != nil {
-		t.Skipf("integration skipped (DescribeStream error: %v)", err)
+		t.Fatal(err)
 	}
-	if !info.Reachable || !info.DescribeOK {
-		t.Fatalf("expected reachable & describe ok: %+v", info)
+	session := NewRTSPSession(time.Second, nil)
+	desc, _, err := session.PerformDescribe(context.Background(), u)
+	if err != nil {
+		t.Fatalf("describe: %v", err)
 	}
-	if info.MediaCount == 0 {
-		t.Fatalf("expected at least one media")
+	if _, err := session.SetupAndPlay(desc, desc.Medias, nil, nil); err != nil {
+		t.Fatalf("expected SETUP and PLAY on the described connection: %v", err)
+	}
+	session.Close()
+
+	// A session that never started closes without panicking
+	failed := NewRTSPSession(time.Second, nil)
+	bad, _ := base.ParseURL("rtsp://127.0.0.1:1/stream")
+	if _, _, err := failed.PerformDescribe(context.Background(), bad); err == nil {
+		t.Fatal("expected a describe error")
 	}
+	failed.Close()
+	NewRTSPSession(time.Second, nil).Close()
 }
@@ -34,12 +34,11 @@ func startDynamicServer(t *testing.T, onDescribe func(*gortsplib.ServerHandlerOn
 	addr := l.Addr().String()
 	l.Close()
 
-	srv = &gortsplib.Server{RTSPAddress: addr}
+	// The handler must be set before Start: the server reads it from its own goroutines
+	srv = &gortsplib.Server{Handler: &dynamicHandler{onDescribe: onDescribe}, RTSPAddress: addr}
 	if err := srv.Start(); err != nil {
 		t.Fatalf("start: %v", err)
 	}
-
-	srv.Handler = &dynamicHandler{onDescribe: onDescribe}
 	return srv, "rtsp://" + addr + "/test"
 }
 
@@ -0,0 +1,276 @@
+package rtspeek
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/headers"
+)
+
+// DefaultDiscoverPorts are the ports probed when DiscoverOptions.Ports is empty: the standard RTSP ports
+// and the alternatives common on cameras and NVRs.
+var DefaultDiscoverPorts = []int{554, 8554, 10554, 88, 5554, 7447}
+
+// Discovery limits.
+const (
+	// DefaultDiscoverConcurrency is the number of targets probed at once.
+	DefaultDiscoverConcurrency = 64
+	// DefaultDiscoverRate is the number of connection attempts started per second.
+	DefaultDiscoverRate = 200
+	// MaxDiscoverHosts bounds the number of addresses a single scan expands to.
+	MaxDiscoverHosts = 1 << 16
+)
+
+// DiscoverOptions configures Discover.
+type DiscoverOptions struct {
+	// Ports to probe on every host (DefaultDiscoverPorts if empty).
+	Ports []int
+	// Concurrency bounds the targets probed at once (DefaultDiscoverConcurrency if 0).
+	Concurrency int
+	// Rate bounds the connection attempts started per second (DefaultDiscoverRate if 0, negative for no limit).
+	// Rates above one attempt per nanosecond are not limited either.
+	Rate float64
+	// Path is the path of the OPTIONS request URL (default "/").
+	Path string
+	// OnEndpoint, if set, is called as each RTSP endpoint is found (from several goroutines, one at a time).
+	OnEndpoint func(DiscoveredEndpoint)
+}
+
+// DiscoveredEndpoint is a host and port that answered OPTIONS in RTSP.
+type DiscoveredEndpoint struct {
+	Address      string   `json:"address"` // host:port
+	URL          string   `json:"url"`
+	Status       int      `json:"status"`
+	Server       string   `json:"server,omitempty"`
+	Public       []string `json:"public,omitempty"` // methods from the Public header
+	AuthRequired bool     `json:"auth_required"`
+	AuthMethods  []string `json:"auth_methods,omitempty"` // schemes offered in WWW-Authenticate
+	Latency      float64  `json:"latency"`                // ms from connecting to the OPTIONS response
+}
+
+// DiscoverReport summarizes a scan.
+type DiscoverReport struct {
+	Hosts     int                  `json:"hosts"`
+	Probes    int                  `json:"probes"`    // host and port combinations tried
+	Open      int                  `json:"open"`      // of which accepted a TCP connection
+	NotRTSP   int                  `json:"not_rtsp"`  // open ports that did not answer in RTSP
+	Duration  float64              `json:"duration"`  // seconds
+	Stopped   bool                 `json:"stopped"`   // the context ended the scan early
+	Endpoints []DiscoveredEndpoint `json:"endpoints"` // sorted by address and port
+}
+
+// ExpandTargets turns CIDR prefixes and single addresses into the list of hosts to scan. The network and
+// broadcast addresses of IPv4 prefixes shorter than /31 are left out.
+func ExpandTargets(targets []string) ([]netip.Addr, error) {
+	var hosts []netip.Addr
+	seen := make(map[netip.Addr]bool)
+	for _, t := range targets {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(t)
+		if err != nil {
+			addr, aerr := netip.ParseAddr(t)
+			if aerr != nil {
+				return nil, fmt.Errorf("invalid target %q: want a CIDR prefix or an IP address", t)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefix = prefix.Masked()
+
+		bits := prefix.Addr().BitLen() - prefix.Bits()
+		if bits > 16 {
+			return nil, fmt.Errorf("target %s is too large: scans are limited to %d hosts", t, MaxDiscoverHosts)
+		}
+		first, last := prefix.Addr(), lastAddr(prefix)
+		if prefix.Addr().Is4() && bits >= 2 {
+			first, last = first.Next(), last.Prev()
+		}
+		for a := first; a.IsValid() && a.Compare(last) <= 0; a = a.Next() {
+			if !seen[a] {
+				seen[a] = true
+				hosts = append(hosts, a)
+			}
+		}
+	}
+	if len(hosts) > MaxDiscoverHosts {
+		return nil, fmt.Errorf("targets expand to %d hosts: scans are limited to %d", len(hosts), MaxDiscoverHosts)
+	}
+	return hosts, nil
+}
+
+// lastAddr returns the highest address of a masked prefix.
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Addr().AsSlice()
+	for i := p.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 1 << (7 - i%8)
+	}
+	a, _ := netip.AddrFromSlice(b)
+	return a
+}
+
+// Discover scans every port of every target host and reports those answering OPTIONS in RTSP. Each
+// target gets a TCP connectivity check first; open ports then get an OPTIONS request. The timeout applies
+// to each of the two steps. Cancelling ctx ends the scan early and returns what was found so far.
+func Discover(ctx context.Context, targets []string, timeout time.Duration, opts DiscoverOptions) (*DiscoverReport, error) {
+	hosts, err := ExpandTargets(targets)
+	if err != nil {
+		return nil, err
+	}
+	if len(hosts) == 0 {
+		return nil, errors.New("no targets to scan")
+	}
+	ports := opts.Ports
+	if len(ports) == 0 {
+		ports = DefaultDiscoverPorts
+	}
+	for _, p := range ports {
+		if p <= 0 || p > 65535 {
+			return nil, fmt.Errorf("invalid port %d", p)
+		}
+	}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultDiscoverConcurrency
+	}
+	rate := opts.Rate
+	if rate == 0 {
+		rate = DefaultDiscoverRate
+	}
+	path := opts.Path
+	if path == "" {
+		path = "/"
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	start := time.Now()
+	report := &DiscoverReport{Hosts: len(hosts), Endpoints: []DiscoveredEndpoint{}}
+	var mu sync.Mutex
+
+	targetsCh := make(chan netip.AddrPort)
+	var wg sync.WaitGroup
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for target := range targetsCh {
+				ep, open := probeRTSPEndpoint(ctx, target, path, timeout)
+				mu.Lock()
+				report.Probes++
+				if open {
+					report.Open++
+				}
+				if ep != nil {
+					report.Endpoints = append(report.Endpoints, *ep)
+					if opts.OnEndpoint != nil {
+						opts.OnEndpoint(*ep)
+					}
+				} else if open {
+					report.NotRTSP++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	var tick <-chan time.Time
+	if interval := time.Duration(float64(time.Second) / rate); rate > 0 && interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+feed:
+	for _, h := range hosts {
+		for _, p := range ports {
+			if tick != nil {
+				select {
+				case <-ctx.Done():
+					break feed
+				case <-tick:
+				}
+			}
+			select {
+			case <-ctx.Done():
+				break feed
+			case targetsCh <- netip.AddrPortFrom(h, uint16(p)):
+			}
+		}
+	}
+	close(targetsCh)
+	wg.Wait()
+
+	report.Stopped = ctx.Err() != nil
+	report.Duration = time.Since(start).Seconds()
+	sort.Slice(report.Endpoints, func(i, j int) bool {
+		a := netip.MustParseAddrPort(report.Endpoints[i].Address)
+		b := netip.MustParseAddrPort(report.Endpoints[j].Address)
+		return a.Compare(b) < 0
+	})
+	return report, nil
+}
+
+// probeRTSPEndpoint checks that target accepts TCP and answers OPTIONS in RTSP. It returns nil when the
+// port is closed or speaks something else.
+func probeRTSPEndpoint(ctx context.Context, target netip.AddrPort, path string, timeout time.Duration) (*DiscoveredEndpoint, bool) {
+	u, err := base.ParseURL("rtsp://" + target.String() + path)
+	if err != nil {
+		return nil, false
+	}
+
+	start := time.Now()
+	if err := NewNetworkDialer(timeout).PreflightDial(ctx, u); err != nil {
+		return nil, false
+	}
+
+	session := NewRTSPSession(timeout, nil)
+	defer session.Close()
+	res, _ := session.PerformOptions(u)
+	if res == nil {
+		return nil, true
+	}
+
+	ep := &DiscoveredEndpoint{
+		Address: target.String(),
+		URL:     u.String(),
+		Status:  int(res.StatusCode),
+		Latency: float64(time.Since(start)) / float64(time.Millisecond),
+	}
+	if v, ok := res.Header["Server"]; ok && len(v) > 0 {
+		ep.Server = v[0]
+	}
+	if v, ok := res.Header["Public"]; ok && len(v) > 0 {
+		for _, m := range strings.Split(strings.Join(v, ","), ",") {
+			if m = strings.TrimSpace(m); m != "" {
+				ep.Public = append(ep.Public, m)
+			}
+		}
+	}
+	if res.StatusCode == base.StatusUnauthorized {
+		ep.AuthRequired = true
+		for _, v := range res.Header["WWW-Authenticate"] {
+			var auth headers.Authenticate
+			if err := auth.Unmarshal(base.HeaderValue{v}); err == nil {
+				ep.AuthMethods = append(ep.AuthMethods, authMethodName(auth.Method))
+			}
+		}
+	}
+	return ep, true
+}
+
+// authMethodName names a WWW-Authenticate scheme.
+func authMethodName(m headers.AuthMethod) string {
+	if m == headers.AuthMethodBasic {
+		return "Basic"
+	}
+	return "Digest"
+}
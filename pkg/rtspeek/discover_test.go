@@ -0,0 +1,147 @@
+package rtspeek
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0x524A/rtspeek/pkg/rtspeektest"
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+)
+
+func TestExpandTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets []string
+		want    []string
+		wantErr bool
+	}{
+		{name: "single address", targets: []string{"10.0.0.5"}, want: []string{"10.0.0.5"}},
+		{name: "slash 30 skips network and broadcast", targets: []string{"10.0.0.0/30"}, want: []string{"10.0.0.1", "10.0.0.2"}},
+		{name: "unmasked prefix", targets: []string{"10.0.0.6/30"}, want: []string{"10.0.0.5", "10.0.0.6"}},
+		{name: "slash 31 keeps both", targets: []string{"10.0.0.4/31"}, want: []string{"10.0.0.4", "10.0.0.5"}},
+		{name: "duplicates removed", targets: []string{"10.0.0.1", "10.0.0.0/30"}, want: []string{"10.0.0.1", "10.0.0.2"}},
+		{name: "ipv6", targets: []string{"fd00::/127"}, want: []string{"fd00::", "fd00::1"}},
+		{name: "too large", targets: []string{"10.0.0.0/8"}, wantErr: true},
+		{name: "garbage", targets: []string{"camera.local"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hosts, err := ExpandTargets(tt.targets)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			var got []string
+			for _, h := range hosts {
+				got = append(got, h.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	open := rtspeektest.Start(t, rtspeektest.Config{FrameInterval: -1})
+	locked := rtspeektest.Start(t, rtspeektest.Config{
+		User: "admin", Pass: "secret", FrameInterval: -1,
+		Responses: map[base.Method][]rtspeektest.Response{
+			base.Options: {{Status: base.StatusUnauthorized, Header: base.Header{
+				"WWW-Authenticate": base.HeaderValue{`Basic realm="cam"`, `Digest realm="cam", nonce="abc"`},
+			}}},
+		},
+	})
+
+	// An HTTP server is open but does not speak RTSP
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = c.Write([]byte("HTTP/1.1 400 Bad Request\r\nContent-Length: 0\r\n\r\n"))
+			_ = c.Close()
+		}
+	}()
+
+	// A closed port
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	port := func(u string) int {
+		return int(netip.MustParseAddrPort(strings.Split(strings.TrimPrefix(u, "rtsp://"), "/")[0]).Port())
+	}
+	ports := []int{port(open.URL), port(locked.URL), ln.Addr().(*net.TCPAddr).Port, closedPort}
+
+	var streamed []string
+	report, err := Discover(context.Background(), []string{"127.0.0.1/32"}, time.Second, DiscoverOptions{
+		Ports:      ports,
+		Rate:       -1,
+		OnEndpoint: func(ep DiscoveredEndpoint) { streamed = append(streamed, ep.Address) },
+	})
+	if err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+	if report.Hosts != 1 || report.Probes != 4 || report.Open != 3 || report.NotRTSP != 1 {
+		t.Fatalf("unexpected counts %+v", report)
+	}
+	if len(report.Endpoints) != 2 || len(streamed) != 2 {
+		t.Fatalf("got %d endpoints (%d streamed), want 2", len(report.Endpoints), len(streamed))
+	}
+
+	byPort := map[int]DiscoveredEndpoint{}
+	for _, ep := range report.Endpoints {
+		byPort[int(netip.MustParseAddrPort(ep.Address).Port())] = ep
+	}
+	plain := byPort[port(open.URL)]
+	if plain.Status != 200 || plain.AuthRequired || plain.Server == "" || len(plain.Public) == 0 {
+		t.Fatalf("unexpected open endpoint %+v", plain)
+	}
+	auth := byPort[port(locked.URL)]
+	if !auth.AuthRequired || auth.Status != 401 || !reflect.DeepEqual(auth.AuthMethods, []string{"Basic", "Digest"}) {
+		t.Fatalf("unexpected locked endpoint %+v", auth)
+	}
+}
+
+func TestDiscoverStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	report, err := Discover(ctx, []string{"127.0.0.1"}, time.Second, DiscoverOptions{Ports: []int{1, 2, 3}})
+	if err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+	if !report.Stopped || report.Probes != 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
+
+func TestDiscoverRateBelowTickerResolution(t *testing.T) {
+	// One attempt per picosecond rounds to a zero interval: no limit rather than a ticker panic
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+	report, err := Discover(context.Background(), []string{"127.0.0.1"}, time.Second, DiscoverOptions{Ports: []int{port}, Rate: 1e12})
+	if err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+	if report.Probes != 1 || report.Open != 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
@@ -35,7 +35,7 @@ func (ec *ErrorClassifier) Classify(err error) string {
 
 	if strings.Contains(lowerMsg, "i/o timeout") ||
 		strings.Contains(lowerMsg, "deadline exceeded") ||
-		strings.Contains(lowerMsg, "request timed out") {
+		strings.Contains(lowerMsg, "timed out") {
 		return "timeout"
 	}
 
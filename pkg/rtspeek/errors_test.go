@@ -18,6 +18,7 @@ func TestErrorClassifier_Classify(t *testing.T) {
 		{"connection_refused", errors.New("connect: connection refused"), "connection_refused"},
 		{"timeout_io", errors.New("i/o timeout"), "timeout"},
 		{"timeout_deadline", errors.New("context deadline exceeded"), "timeout"},
+		{"timeout_operation", errors.New("operation timed out after 2s"), "timeout"},
 		{"dns_error", errors.New("no such host"), "dns_error"},
 		{"auth_required", errors.New("401 Unauthorized"), "auth_required"},
 		{"not_found", errors.New("404 not found"), "not_found"},
@@ -0,0 +1,256 @@
+package rtspeek
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Expectations declare what a stream must look like; zero fields are not checked. Frame rate uses the
+// live probe measurement when there is one, else the SPS VUI or SDP a=framerate. MaxGOP needs a live probe.
+type Expectations struct {
+	Codec         string         `yaml:"codec"`          // video codec, e.g. H264 (case-insensitive)
+	MinResolution string         `yaml:"min_resolution"` // WxH; some video track must be at least this large
+	Audio         *bool          `yaml:"audio"`          // an audio track must be present (true) or absent (false)
+	MinFPS        float64        `yaml:"min_fps"`
+	MaxFPS        float64        `yaml:"max_fps"`
+	MaxGOP        ConfigDuration `yaml:"max_gop"`     // longest keyframe interval
+	MaxLatency    ConfigDuration `yaml:"max_latency"` // connect and DESCRIBE time
+}
+
+// Assertion is the outcome of one expectation.
+type Assertion struct {
+	Name     string `json:"name"` // codec, min_resolution, audio, fps, max_gop or max_latency
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+	Pass     bool   `json:"pass"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// ExpectationReport is the outcome of Expectations.Check.
+type ExpectationReport struct {
+	Pass       bool        `json:"pass"`
+	Passed     int         `json:"passed"`
+	Failed     int         `json:"failed"`
+	Assertions []Assertion `json:"assertions"`
+}
+
+// IsZero reports whether no expectation is set.
+func (e Expectations) IsZero() bool {
+	return e.Codec == "" && e.MinResolution == "" && e.Audio == nil && e.MinFPS == 0 && e.MaxFPS == 0 &&
+		e.MaxGOP == 0 && e.MaxLatency == 0
+}
+
+// Merge returns e with the fields set in o replacing its own.
+func (e Expectations) Merge(o Expectations) Expectations {
+	if o.Codec != "" {
+		e.Codec = o.Codec
+	}
+	if o.MinResolution != "" {
+		e.MinResolution = o.MinResolution
+	}
+	if o.Audio != nil {
+		e.Audio = o.Audio
+	}
+	if o.MinFPS != 0 {
+		e.MinFPS = o.MinFPS
+	}
+	if o.MaxFPS != 0 {
+		e.MaxFPS = o.MaxFPS
+	}
+	if o.MaxGOP != 0 {
+		e.MaxGOP = o.MaxGOP
+	}
+	if o.MaxLatency != 0 {
+		e.MaxLatency = o.MaxLatency
+	}
+	return e
+}
+
+// Validate checks the expectation values.
+func (e Expectations) Validate() error {
+	if p := e.problems(); len(p) > 0 {
+		return fmt.Errorf("%s: %s", p[0].field, p[0].msg)
+	}
+	return nil
+}
+
+// expectationProblem is an invalid expectation field, named by its config key.
+type expectationProblem struct {
+	field, msg string
+}
+
+func (e Expectations) problems() []expectationProblem {
+	var out []expectationProblem
+	if e.MinResolution != "" {
+		if _, err := ParseResolution(e.MinResolution); err != nil {
+			out = append(out, expectationProblem{"min_resolution", err.Error()})
+		}
+	}
+	if e.MinFPS < 0 {
+		out = append(out, expectationProblem{"min_fps", "must not be negative"})
+	}
+	if e.MaxFPS < 0 {
+		out = append(out, expectationProblem{"max_fps", "must not be negative"})
+	} else if e.MaxFPS > 0 && e.MinFPS > e.MaxFPS {
+		out = append(out, expectationProblem{"max_fps", fmt.Sprintf("is below min_fps %g", e.MinFPS)})
+	}
+	return out
+}
+
+// ParseResolution parses "WIDTHxHEIGHT".
+func ParseResolution(s string) (Resolution, error) {
+	w, h, ok := strings.Cut(strings.ToLower(strings.TrimSpace(s)), "x")
+	wi, werr := strconv.Atoi(w)
+	hi, herr := strconv.Atoi(h)
+	if !ok || werr != nil || herr != nil || wi <= 0 || hi <= 0 {
+		return Resolution{}, fmt.Errorf("invalid resolution %q (want WIDTHxHEIGHT, e.g. 1920x1080)", s)
+	}
+	return Resolution{Width: wi, Height: hi}, nil
+}
+
+// Check evaluates the expectations against a describe result; info may be nil or a failed describe, in
+// which case every expectation fails.
+func (e Expectations) Check(info StreamInfo) *ExpectationReport {
+	r := &ExpectationReport{Assertions: []Assertion{}}
+	ok := info != nil && info.IsDescribeSucceeded()
+	add := func(a Assertion) {
+		if !ok {
+			a.Actual, a.Pass, a.Detail = "unknown", false, "describe failed"
+		}
+		r.Assertions = append(r.Assertions, a)
+	}
+	var video *MediaInfo
+	if ok {
+		video = info.GetFirstVideoMedia()
+	}
+
+	if e.Codec != "" {
+		a := Assertion{Name: "codec", Expected: e.Codec, Actual: "none"}
+		if video != nil {
+			a.Actual = video.Format
+			a.Pass = normalizeCodec(video.Format) == normalizeCodec(e.Codec)
+		}
+		add(a)
+	}
+	if e.MinResolution != "" {
+		a := Assertion{Name: "min_resolution", Expected: "at least " + e.MinResolution, Actual: "none"}
+		if want, err := ParseResolution(e.MinResolution); err != nil {
+			a.Detail = err.Error()
+		} else if ok {
+			best := -1
+			for _, res := range info.GetVideoResolutions() {
+				if res.Width*res.Height > best {
+					best = res.Width * res.Height
+					a.Actual = res.String()
+				}
+				if res.Width >= want.Width && res.Height >= want.Height {
+					a.Actual, a.Pass = res.String(), true
+					break
+				}
+			}
+		}
+		add(a)
+	}
+	if e.Audio != nil {
+		a := Assertion{Name: "audio", Expected: presence(*e.Audio)}
+		if ok {
+			has := len(info.GetAudioMedias()) > 0
+			a.Actual, a.Pass = presence(has), has == *e.Audio
+		}
+		add(a)
+	}
+	if e.MinFPS > 0 || e.MaxFPS > 0 {
+		a := Assertion{Name: "fps", Expected: fpsRange(e.MinFPS, e.MaxFPS), Actual: "unknown"}
+		if fps, source := videoFPS(video); source == "" {
+			a.Detail = "frame rate not known; enable the live probe"
+		} else {
+			a.Actual, a.Detail = strconv.FormatFloat(fps, 'f', -1, 64), "from "+source
+			a.Pass = fps >= e.MinFPS && (e.MaxFPS == 0 || fps <= e.MaxFPS)
+		}
+		add(a)
+	}
+	if e.MaxGOP > 0 {
+		limit := time.Duration(e.MaxGOP)
+		a := Assertion{Name: "max_gop", Expected: "at most " + limit.String(), Actual: "unknown"}
+		switch {
+		case video == nil:
+			a.Actual = "no video"
+		case video.GOP == nil:
+			a.Detail = "needs the live probe"
+		default:
+			gop := video.GOP.MaxIntervalSeconds
+			if video.GOP.Keyframes < 2 {
+				gop = video.GOP.LongestWithoutKeyframe
+			}
+			a.Actual = fmt.Sprintf("%.2fs", gop)
+			a.Pass = gop <= limit.Seconds() && video.GOP.Keyframes >= 2
+			if video.GOP.Keyframes < 2 {
+				a.Detail = "fewer than two keyframes seen; the interval is at least this long"
+			}
+		}
+		add(a)
+	}
+	if e.MaxLatency > 0 {
+		limit := time.Duration(e.MaxLatency)
+		a := Assertion{Name: "max_latency", Expected: "at most " + limit.String()}
+		if info != nil {
+			ms := info.LatencyMs()
+			a.Actual = fmt.Sprintf("%.1fms", ms)
+			a.Pass = ms <= float64(limit)/float64(time.Millisecond)
+		}
+		add(a)
+	}
+
+	for _, a := range r.Assertions {
+		if a.Pass {
+			r.Passed++
+		} else {
+			r.Failed++
+		}
+	}
+	r.Pass = r.Failed == 0
+	return r
+}
+
+// normalizeCodec folds spellings such as "H.264" and "h264" together.
+func normalizeCodec(s string) string {
+	return strings.ToUpper(strings.NewReplacer(".", "", "-", "", " ", "").Replace(s))
+}
+
+func presence(b bool) string {
+	if b {
+		return "present"
+	}
+	return "absent"
+}
+
+func fpsRange(lo, hi float64) string {
+	switch {
+	case hi == 0:
+		return fmt.Sprintf("at least %g", lo)
+	case lo == 0:
+		return fmt.Sprintf("at most %g", hi)
+	}
+	return fmt.Sprintf("%g-%g", lo, hi)
+}
+
+// videoFPS picks the most trustworthy frame rate of a video track and names its source ("" if none).
+func videoFPS(video *MediaInfo) (float64, string) {
+	if video == nil {
+		return 0, ""
+	}
+	if t := video.Timing; t != nil {
+		if t.MeasuredFPS > 0 {
+			return t.MeasuredFPS, "live probe"
+		}
+		if t.VUIFPS != nil {
+			return *t.VUIFPS, "sps vui"
+		}
+	}
+	if video.Framerate != nil {
+		return *video.Framerate, "sdp"
+	}
+	return 0, ""
+}
@@ -0,0 +1,107 @@
+package rtspeek
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/0x524A/rtspeek/pkg/rtspeektest"
+)
+
+func TestExpectationsCheck(t *testing.T) {
+	srv := rtspeektest.Start(t, rtspeektest.Config{FrameInterval: -1})
+	info, err := DescribeStream(context.Background(), srv.URL, 5*time.Second)
+	if err != nil {
+		t.Fatalf("DescribeStream: %v", err)
+	}
+	audio := true
+	e := Expectations{
+		Codec:         "h.264",
+		MinResolution: "1920x1080",
+		Audio:         &audio,
+		MinFPS:        20,
+		MaxFPS:        30,
+		MaxLatency:    ConfigDuration(5 * time.Second),
+	}
+	r := e.Check(info)
+
+	want := []struct {
+		name, actual string
+		pass         bool
+	}{
+		{"codec", "H264", true},
+		{"min_resolution", "1280x720", false},
+		{"audio", "absent", false},
+		{"fps", "unknown", false},
+		{"max_latency", "", true},
+	}
+	if len(r.Assertions) != len(want) {
+		t.Fatalf("got %d assertions, want %d: %+v", len(r.Assertions), len(want), r.Assertions)
+	}
+	for i, w := range want {
+		a := r.Assertions[i]
+		if a.Name != w.name || a.Pass != w.pass || (w.actual != "" && a.Actual != w.actual) {
+			t.Fatalf("assertion %d = %+v, want %s %q pass=%v", i, a, w.name, w.actual, w.pass)
+		}
+	}
+	if r.Pass || r.Passed != 2 || r.Failed != 3 {
+		t.Fatalf("unexpected summary: pass=%v passed=%d failed=%d", r.Pass, r.Passed, r.Failed)
+	}
+}
+
+func TestExpectationsCheckLiveProbe(t *testing.T) {
+	// A GOP of 250ms needs a live probe longer than the latency limit; the probe window must not count
+	srv := rtspeektest.Start(t, rtspeektest.Config{FrameInterval: 10 * time.Millisecond})
+	ctx := WithLiveProbe(context.Background(), LiveProbeOptions{Duration: 600 * time.Millisecond, Transport: "tcp"})
+	info, err := DescribeStream(ctx, srv.URL, 5*time.Second)
+	if err != nil {
+		t.Fatalf("DescribeStream: %v", err)
+	}
+	e := Expectations{MaxGOP: ConfigDuration(time.Second), MaxLatency: ConfigDuration(500 * time.Millisecond)}
+	if r := e.Check(info); !r.Pass {
+		t.Fatalf("expected both expectations to pass, got %+v", r.Assertions)
+	}
+}
+
+func TestExpectationsCheckFailedDescribe(t *testing.T) {
+	r := Expectations{Codec: "H264", MaxGOP: ConfigDuration(2 * time.Second)}.Check(nil)
+	if r.Pass || r.Failed != 2 {
+		t.Fatalf("expected every assertion to fail, got %+v", r)
+	}
+	for _, a := range r.Assertions {
+		if a.Actual != "unknown" || a.Detail != "describe failed" {
+			t.Fatalf("unexpected assertion %+v", a)
+		}
+	}
+}
+
+func TestExpectationsMerge(t *testing.T) {
+	base := Expectations{Codec: "H264", MinResolution: "1920x1080", MaxFPS: 30}
+	got := base.Merge(Expectations{MinResolution: "1280x720", MinFPS: 10})
+	if got.Codec != "H264" || got.MinResolution != "1280x720" || got.MinFPS != 10 || got.MaxFPS != 30 {
+		t.Fatalf("unexpected merge: %+v", got)
+	}
+	if !(Expectations{}).IsZero() || got.IsZero() {
+		t.Fatal("IsZero is wrong")
+	}
+}
+
+func TestParseResolution(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Resolution
+		ok   bool
+	}{
+		{"1920x1080", Resolution{1920, 1080}, true},
+		{" 640X480 ", Resolution{640, 480}, true},
+		{"1920", Resolution{}, false},
+		{"0x10", Resolution{}, false},
+		{"wide x tall", Resolution{}, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseResolution(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Fatalf("ParseResolution(%q) = %v, %v", tt.in, got, err)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package rtspeek
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/jpeg"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/bluenviron/gortsplib/v4/pkg/format/rtph264"
+	"github.com/bluenviron/gortsplib/v4/pkg/format/rtph265"
+	"github.com/bluenviron/gortsplib/v4/pkg/format/rtpmjpeg"
+	h264conf "github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
+	h265conf "github.com/bluenviron/mediacommon/v2/pkg/codecs/h265"
+	"github.com/pion/rtp"
+)
+
+// accessUnit is a complete video frame reassembled from RTP packets.
+type accessUnit struct {
+	nalus     [][]byte // H264 / H265
+	image     []byte   // MJPEG
+	timestamp uint32
+	received  time.Time
+	random    bool // IDR / IRAP / JPEG
+	size      int
+}
+
+// frameDecoder depacketizes H264, H265 and MJPEG RTP streams into access units
+// and tracks the most recent parameter sets.
+type frameDecoder struct {
+	codec string
+	h264  *rtph264.Decoder
+	h265  *rtph265.Decoder
+	mjpeg *rtpmjpeg.Decoder
+
+	lastTS        uint32
+	vps, sps, pps []byte
+}
+
+// newFrameDecoder creates a decoder for a supported video format.
+func newFrameDecoder(f format.Format) (*frameDecoder, error) {
+	fd := &frameDecoder{}
+	var err error
+	switch ct := f.(type) {
+	case *format.H264:
+		fd.codec = "H264"
+		fd.sps, fd.pps = ct.SafeParams()
+		fd.h264, err = ct.CreateDecoder()
+	case *format.H265:
+		fd.codec = "H265"
+		fd.vps, fd.sps, fd.pps = ct.SafeParams()
+		fd.h265, err = ct.CreateDecoder()
+	case *format.MJPEG:
+		fd.codec = "MJPEG"
+		fd.mjpeg, err = ct.CreateDecoder()
+	default:
+		return nil, fmt.Errorf("unsupported video format: %s", extractFormatName(f))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create %s decoder: %w", fd.codec, err)
+	}
+	return fd, nil
+}
+
+// decode feeds one packet. It returns nil without error while a frame is incomplete.
+func (fd *frameDecoder) decode(pkt *rtp.Packet, received time.Time) (*accessUnit, error) {
+	// Decoders may emit the previous frame when the timestamp changes without a marker
+	ts := pkt.Timestamp
+	if !pkt.Marker {
+		ts = fd.lastTS
+	}
+	fd.lastTS = pkt.Timestamp
+
+	switch {
+	case fd.h264 != nil:
+		nalus, err := fd.h264.Decode(pkt)
+		if err != nil {
+			return nil, ignoreIncomplete(err)
+		}
+		fd.trackH264Params(nalus)
+		return &accessUnit{nalus: nalus, timestamp: ts, received: received, random: h264conf.IsRandomAccess(nalus), size: nalusSize(nalus)}, nil
+
+	case fd.h265 != nil:
+		nalus, err := fd.h265.Decode(pkt)
+		if err != nil {
+			return nil, ignoreIncomplete(err)
+		}
+		fd.trackH265Params(nalus)
+		return &accessUnit{nalus: nalus, timestamp: ts, received: received, random: h265conf.IsRandomAccess(nalus), size: nalusSize(nalus)}, nil
+
+	default:
+		img, err := fd.mjpeg.Decode(pkt)
+		if err != nil {
+			return nil, ignoreIncomplete(err)
+		}
+		return &accessUnit{image: img, timestamp: pkt.Timestamp, received: received, random: true, size: len(img)}, nil
+	}
+}
+
+// ignoreIncomplete hides the "need more packets" family of depacketizer errors.
+func ignoreIncomplete(err error) error {
+	switch {
+	case errors.Is(err, rtph264.ErrMorePacketsNeeded), errors.Is(err, rtph264.ErrNonStartingPacketAndNoPrevious),
+		errors.Is(err, rtph265.ErrMorePacketsNeeded), errors.Is(err, rtph265.ErrNonStartingPacketAndNoPrevious),
+		errors.Is(err, rtpmjpeg.ErrMorePacketsNeeded), errors.Is(err, rtpmjpeg.ErrNonStartingPacketAndNoPrevious):
+		return nil
+	}
+	return err
+}
+
+func (fd *frameDecoder) trackH264Params(nalus [][]byte) {
+	for _, n := range nalus {
+		switch h264conf.NALUType(n[0] & 0x1f) {
+		case h264conf.NALUTypeSPS:
+			fd.sps = n
+		case h264conf.NALUTypePPS:
+			fd.pps = n
+		}
+	}
+}
+
+func (fd *frameDecoder) trackH265Params(nalus [][]byte) {
+	for _, n := range nalus {
+		switch h265conf.NALUType((n[0] >> 1) & 0b111111) {
+		case h265conf.NALUType_VPS_NUT:
+			fd.vps = n
+		case h265conf.NALUType_SPS_NUT:
+			fd.sps = n
+		case h265conf.NALUType_PPS_NUT:
+			fd.pps = n
+		}
+	}
+}
+
+// resolution returns the resolution encoded in the latest SPS, if any.
+func (fd *frameDecoder) resolution() *Resolution {
+	switch fd.codec {
+	case "H264":
+		return bestResolution(parseH264SPS, [][]byte{fd.sps})
+	case "H265":
+		return bestResolution(parseH265SPS, [][]byte{fd.sps})
+	}
+	return nil
+}
+
+// jpegResolution reads the frame size from a JPEG header.
+func jpegResolution(image []byte) *Resolution {
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(image))
+	if err != nil {
+		return nil
+	}
+	return &Resolution{Width: cfg.Width, Height: cfg.Height}
+}
+
+// annexB serializes an access unit as an Annex-B elementary stream,
+// prepending the known parameter sets so the output decodes on its own.
+func (fd *frameDecoder) annexB(au *accessUnit) ([]byte, error) {
+	var nalus [][]byte
+	for _, ps := range [][]byte{fd.vps, fd.sps, fd.pps} {
+		if len(ps) > 0 {
+			nalus = append(nalus, ps)
+		}
+	}
+	for _, n := range au.nalus {
+		if !fd.isParameterSet(n) {
+			nalus = append(nalus, n)
+		}
+	}
+	return h264conf.AnnexB(nalus).Marshal()
+}
+
+func (fd *frameDecoder) isParameterSet(n []byte) bool {
+	if fd.codec == "H265" {
+		switch h265conf.NALUType((n[0] >> 1) & 0b111111) {
+		case h265conf.NALUType_VPS_NUT, h265conf.NALUType_SPS_NUT, h265conf.NALUType_PPS_NUT:
+			return true
+		}
+		return false
+	}
+	switch h264conf.NALUType(n[0] & 0x1f) {
+	case h264conf.NALUTypeSPS, h264conf.NALUTypePPS:
+		return true
+	}
+	return false
+}
+
+func nalusSize(nalus [][]byte) int {
+	n := 0
+	for _, nalu := range nalus {
+		n += len(nalu)
+	}
+	return n
+}
@@ -0,0 +1,86 @@
+package rtspeek
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/0x524A/rtspeek/pkg/rtspeektest"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	h264conf "github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
+	"github.com/pion/rtp"
+)
+
+// h264FrameTicks is the RTP timestamp increment of h264Source frames (DefaultFrameInterval at 90kHz).
+const h264FrameTicks = 3600
+
+// h264Source is rtspeektest's synthetic H264 track with an IDR every gop frames and 3000-byte slices,
+// which forces FU-A fragmentation.
+type h264Source struct {
+	*rtspeektest.Synthesizer
+	media *description.Media
+}
+
+func newH264Source(gop int) *h264Source {
+	m := h264Media()
+	sy := rtspeektest.NewSynthesizer(&description.Session{Medias: []*description.Media{m}}, rtspeektest.DefaultFrameInterval)
+	sy.GOP, sy.SliceSize = gop, 3000
+	return &h264Source{Synthesizer: sy, media: m}
+}
+
+// frame returns the RTP packets of frame n.
+func (s *h264Source) frame(n int) []*rtp.Packet {
+	return s.Packets(n)[s.media]
+}
+
+func TestFrameDecoderH264(t *testing.T) {
+	src := newH264Source(3)
+	fd, err := newFrameDecoder(&format.H264{PayloadTyp: 96, PacketizationMode: 1})
+	if err != nil {
+		t.Fatalf("new decoder: %v", err)
+	}
+
+	var units []*accessUnit
+	for n := 0; n < 6; n++ {
+		for _, pkt := range src.frame(n) {
+			au, err := fd.decode(pkt, time.Now())
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if au != nil {
+				units = append(units, au)
+			}
+		}
+	}
+	if len(units) != 6 {
+		t.Fatalf("expected 6 access units, got %d", len(units))
+	}
+	if !units[0].random || units[1].random || !units[3].random {
+		t.Fatal("unexpected random access flags")
+	}
+	if units[1].timestamp != h264FrameTicks {
+		t.Fatalf("unexpected timestamp %d", units[1].timestamp)
+	}
+	if r := fd.resolution(); r == nil || r.Width != 1280 || r.Height != 720 {
+		t.Fatalf("unexpected resolution %+v", r)
+	}
+
+	data, err := fd.annexB(units[3])
+	if err != nil {
+		t.Fatalf("annexB: %v", err)
+	}
+	var nalus h264conf.AnnexB
+	if err := nalus.Unmarshal(data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(nalus) != 3 || !bytes.Equal(nalus[0], rtspeektest.H264SPS) || !bytes.Equal(nalus[1], rtspeektest.H264PPS) {
+		t.Fatalf("expected SPS, PPS, IDR once each, got %d NALUs", len(nalus))
+	}
+}
+
+func TestNewFrameDecoderUnsupported(t *testing.T) {
+	if _, err := newFrameDecoder(&format.G711{PayloadTyp: 0, MULaw: true, SampleRate: 8000, ChannelCount: 1}); err == nil {
+		t.Fatal("expected error for audio format")
+	}
+}
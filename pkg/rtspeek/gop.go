@@ -0,0 +1,366 @@
+package rtspeek
+
+import (
+	"sort"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/bluenviron/mediacommon/v2/pkg/bits"
+	h264conf "github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
+	h265conf "github.com/bluenviron/mediacommon/v2/pkg/codecs/h265"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+// GOP structure values.
+const (
+	GOPClosed = "closed"
+	GOPOpen   = "open"
+	GOPMixed  = "mixed"
+)
+
+// seiRecoveryPoint is the SEI payload type that marks H264 open-GOP entry points.
+const seiRecoveryPoint = 6
+
+// sliceHeaderPrefix bounds how much of a slice NALU is unescaped to read its first fields.
+const sliceHeaderPrefix = 32
+
+// GOPInfo describes the coded video structure observed during a live probe.
+type GOPInfo struct {
+	Frames    int `json:"frames"`
+	Keyframes int `json:"keyframes"` // IDR, CRA/BLA and recovery-point I frames
+	// Keyframe intervals, present once two keyframes were seen.
+	IntervalFrames     float64 `json:"interval_frames,omitempty"` // mean
+	MinIntervalFrames  int     `json:"min_interval_frames,omitempty"`
+	MaxIntervalFrames  int     `json:"max_interval_frames,omitempty"`
+	IntervalSeconds    float64 `json:"interval_seconds,omitempty"` // mean
+	MaxIntervalSeconds float64 `json:"max_interval_seconds,omitempty"`
+	// LongestWithoutKeyframe is the longest stretch (seconds) without a keyframe, including before the first
+	// and after the last one. With fewer than two keyframes it is a lower bound on the real interval.
+	LongestWithoutKeyframe float64        `json:"longest_without_keyframe"`
+	Structure              string         `json:"structure,omitempty"` // closed, open or mixed
+	BFrames                bool           `json:"b_frames"`
+	FrameTypes             map[string]int `json:"frame_types,omitempty"` // I, P, B
+	SlicesPerFrame         float64        `json:"slices_per_frame"`
+	MaxSlicesPerFrame      int            `json:"max_slices_per_frame"`
+	SEITypes               []int          `json:"sei_types,omitempty"` // SEI payload types seen
+}
+
+// gopAnalyzer inspects NAL unit and slice headers of H264/H265 access units.
+type gopAnalyzer struct {
+	decoder   *frameDecoder
+	clockRate int
+	unwrap    tsUnwrapper
+
+	frames     int
+	firstTS    int64
+	lastTS     int64
+	keyFrames  []int   // frame index of each keyframe
+	keyTimes   []int64 // unwrapped RTP timestamp of each keyframe
+	closed     int
+	open       int
+	frameTypes map[string]int
+	slices     int
+	maxSlices  int
+	seiTypes   map[int]bool
+
+	ppsRaw []byte
+	pps    *h265conf.PPS
+}
+
+// newGOPAnalyzer returns nil without a decoder, i.e. for formats other than H264 and H265. fd is the track's
+// shared decoder; the analyzer reads its parameter sets and gets its access units through onFrame.
+func newGOPAnalyzer(f format.Format, fd *frameDecoder) *gopAnalyzer {
+	if fd == nil {
+		return nil
+	}
+	return &gopAnalyzer{
+		decoder:    fd,
+		clockRate:  f.ClockRate(),
+		frameTypes: make(map[string]int),
+		seiTypes:   make(map[int]bool),
+	}
+}
+
+func (ga *gopAnalyzer) onRTP(*rtp.Packet, time.Time) {}
+
+func (ga *gopAnalyzer) onRTCP(rtcp.Packet, time.Time) {}
+
+// onFrame classifies one access unit.
+func (ga *gopAnalyzer) onFrame(au *accessUnit) {
+	ts := ga.unwrap.unwrap(au.timestamp)
+	if ga.frames == 0 {
+		ga.firstTS = ts
+	}
+	ga.lastTS = ts
+
+	var f auFacts
+	if ga.decoder.codec == "H265" {
+		f = ga.inspectH265(au.nalus)
+	} else {
+		f = ga.inspectH264(au.nalus)
+	}
+
+	frameType := "I"
+	switch {
+	case f.b:
+		frameType = "B"
+	case f.p:
+		frameType = "P"
+	case !f.i:
+		frameType = ""
+	}
+	if frameType != "" {
+		ga.frameTypes[frameType]++
+	}
+	ga.slices += f.slices
+	if f.slices > ga.maxSlices {
+		ga.maxSlices = f.slices
+	}
+
+	// H264 open-GOP entry points are non-IDR I frames announced by a recovery point SEI
+	if !f.closedRAP && !f.openRAP && f.recovery && frameType == "I" {
+		f.openRAP = true
+	}
+	if f.closedRAP || f.openRAP {
+		if f.closedRAP {
+			ga.closed++
+		} else {
+			ga.open++
+		}
+		ga.keyFrames = append(ga.keyFrames, ga.frames)
+		ga.keyTimes = append(ga.keyTimes, ts)
+	}
+	ga.frames++
+}
+
+// auFacts summarizes the NAL units of one access unit.
+type auFacts struct {
+	slices             int
+	i, p, b            bool
+	closedRAP, openRAP bool
+	recovery           bool
+}
+
+func (ga *gopAnalyzer) inspectH264(nalus [][]byte) auFacts {
+	var f auFacts
+	for _, n := range nalus {
+		if len(n) < 2 {
+			continue
+		}
+		switch typ := h264conf.NALUType(n[0] & 0x1f); {
+		case typ >= h264conf.NALUTypeNonIDR && typ <= h264conf.NALUTypeIDR:
+			f.slices++
+			if typ == h264conf.NALUTypeIDR {
+				f.closedRAP = true
+			}
+			f.addSliceType(h264SliceType(n))
+		case typ == h264conf.NALUTypeSEI:
+			for _, t := range seiPayloadTypes(n[1:]) {
+				ga.seiTypes[t] = true
+				if t == seiRecoveryPoint {
+					f.recovery = true
+				}
+			}
+		}
+	}
+	return f
+}
+
+func (ga *gopAnalyzer) inspectH265(nalus [][]byte) auFacts {
+	var f auFacts
+	for _, n := range nalus {
+		if len(n) < 3 {
+			continue
+		}
+		typ := h265conf.NALUType((n[0] >> 1) & 0b111111)
+		switch {
+		case typ < h265conf.NALUType_VPS_NUT:
+			f.slices++
+			switch {
+			case typ == h265conf.NALUType_CRA_NUT:
+				f.openRAP = true
+			case typ >= h265conf.NALUType_BLA_W_LP && typ <= h265conf.NALUType_IDR_N_LP:
+				f.closedRAP = true
+			}
+			f.addSliceType(ga.h265SliceType(n, typ))
+		case typ == h265conf.NALUType_PPS_NUT:
+			ga.trackPPS(n)
+		case typ == h265conf.NALUType_PREFIX_SEI_NUT || typ == h265conf.NALUType_SUFFIX_SEI_NUT:
+			for _, t := range seiPayloadTypes(n[2:]) {
+				ga.seiTypes[t] = true
+			}
+		}
+	}
+	return f
+}
+
+func (f *auFacts) addSliceType(t string) {
+	switch t {
+	case "I":
+		f.i = true
+	case "P":
+		f.p = true
+	case "B":
+		f.b = true
+	}
+}
+
+func (ga *gopAnalyzer) trackPPS(n []byte) {
+	if string(n) == string(ga.ppsRaw) {
+		return
+	}
+	var pps h265conf.PPS
+	if err := pps.Unmarshal(n); err == nil {
+		ga.ppsRaw, ga.pps = n, &pps
+	}
+}
+
+// h264SliceType reads first_mb_in_slice and slice_type (ITU-T H.264 7.3.3).
+func h264SliceType(n []byte) string {
+	buf := h264conf.EmulationPreventionRemove(n[1:min(len(n), sliceHeaderPrefix)])
+	pos := 0
+	if _, err := bits.ReadGolombUnsigned(buf, &pos); err != nil {
+		return ""
+	}
+	st, err := bits.ReadGolombUnsigned(buf, &pos)
+	if err != nil {
+		return ""
+	}
+	switch st % 5 {
+	case 0, 3: // P, SP
+		return "P"
+	case 1:
+		return "B"
+	default: // I, SI
+		return "I"
+	}
+}
+
+// h265SliceType reads the slice_type of the first slice segment of a picture (ITU-T H.265 7.3.6.1).
+func (ga *gopAnalyzer) h265SliceType(n []byte, typ h265conf.NALUType) string {
+	if ga.pps == nil && ga.decoder.pps != nil {
+		ga.trackPPS(ga.decoder.pps)
+	}
+	buf := h264conf.EmulationPreventionRemove(n[2:min(len(n), sliceHeaderPrefix)])
+	pos := 0
+	first, err := bits.ReadFlag(buf, &pos)
+	if err != nil || !first {
+		return ""
+	}
+	if typ >= h265conf.NALUType_BLA_W_LP && typ <= 23 { // IRAP range
+		pos++ // no_output_of_prior_pics_flag
+	}
+	if _, err := bits.ReadGolombUnsigned(buf, &pos); err != nil { // slice_pic_parameter_set_id
+		return ""
+	}
+	if ga.pps != nil {
+		pos += int(ga.pps.NumExtraSliceHeaderBits)
+	}
+	st, err := bits.ReadGolombUnsigned(buf, &pos)
+	if err != nil {
+		return ""
+	}
+	switch st {
+	case 0:
+		return "B"
+	case 1:
+		return "P"
+	case 2:
+		return "I"
+	}
+	return ""
+}
+
+// seiPayloadTypes lists the payload types of the SEI messages in an SEI RBSP (header already stripped).
+func seiPayloadTypes(payload []byte) []int {
+	rbsp := h264conf.EmulationPreventionRemove(payload)
+	var types []int
+	for i := 0; i < len(rbsp) && rbsp[i] != 0x80; {
+		t := 0
+		for i < len(rbsp) && rbsp[i] == 0xff {
+			t += 255
+			i++
+		}
+		if i >= len(rbsp) {
+			break
+		}
+		t += int(rbsp[i])
+		i++
+
+		size := 0
+		for i < len(rbsp) && rbsp[i] == 0xff {
+			size += 255
+			i++
+		}
+		if i >= len(rbsp) {
+			break
+		}
+		size += int(rbsp[i])
+		i++
+
+		types = append(types, t)
+		i += size
+	}
+	return types
+}
+
+func (ga *gopAnalyzer) finish(mi *MediaInfo, _ time.Duration) {
+	if ga.frames == 0 {
+		return
+	}
+	info := &GOPInfo{
+		Frames:            ga.frames,
+		Keyframes:         len(ga.keyFrames),
+		BFrames:           ga.frameTypes["B"] > 0,
+		SlicesPerFrame:    float64(ga.slices) / float64(ga.frames),
+		MaxSlicesPerFrame: ga.maxSlices,
+	}
+	if len(ga.frameTypes) > 0 {
+		info.FrameTypes = ga.frameTypes
+	}
+	switch {
+	case ga.closed > 0 && ga.open > 0:
+		info.Structure = GOPMixed
+	case ga.closed > 0:
+		info.Structure = GOPClosed
+	case ga.open > 0:
+		info.Structure = GOPOpen
+	}
+	for t := range ga.seiTypes {
+		info.SEITypes = append(info.SEITypes, t)
+	}
+	sort.Ints(info.SEITypes)
+
+	seconds := func(ticks int64) float64 { return float64(ticks) / float64(ga.clockRate) }
+
+	if n := len(ga.keyFrames); n >= 2 {
+		totalFrames := 0
+		for i := 1; i < n; i++ {
+			frames := ga.keyFrames[i] - ga.keyFrames[i-1]
+			totalFrames += frames
+			if info.MinIntervalFrames == 0 || frames < info.MinIntervalFrames {
+				info.MinIntervalFrames = frames
+			}
+			if frames > info.MaxIntervalFrames {
+				info.MaxIntervalFrames = frames
+			}
+			if s := seconds(ga.keyTimes[i] - ga.keyTimes[i-1]); s > info.MaxIntervalSeconds {
+				info.MaxIntervalSeconds = s
+			}
+		}
+		info.IntervalFrames = float64(totalFrames) / float64(n-1)
+		info.IntervalSeconds = float64(ga.keyTimes[n-1]-ga.keyTimes[0]) / float64(int64(n-1)*int64(ga.clockRate))
+	}
+
+	longest := ga.lastTS - ga.firstTS
+	if n := len(ga.keyTimes); n > 0 {
+		longest = max(ga.keyTimes[0]-ga.firstTS, ga.lastTS-ga.keyTimes[n-1])
+		for i := 1; i < n; i++ {
+			longest = max(longest, ga.keyTimes[i]-ga.keyTimes[i-1])
+		}
+	}
+	info.LongestWithoutKeyframe = seconds(longest)
+
+	mi.GOP = info
+}
@@ -0,0 +1,128 @@
+package rtspeek
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/0x524A/rtspeek/pkg/rtspeektest"
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+)
+
+// feedGOP runs access units through a fresh analyzer, one per 40ms frame.
+func feedGOP(t *testing.T, f format.Format, aus [][][]byte) *GOPInfo {
+	t.Helper()
+	ga := newGOPAnalyzer(f, newTrackDecoder(f))
+	if ga == nil {
+		t.Fatal("expected analyzer")
+	}
+	for i, au := range aus {
+		ga.onFrame(&accessUnit{nalus: au, timestamp: uint32(i * 3600)})
+	}
+	mi := &MediaInfo{}
+	ga.finish(mi, time.Second)
+	if mi.GOP == nil {
+		t.Fatal("expected GOP info")
+	}
+	return mi.GOP
+}
+
+func TestGOPAnalyzerH264(t *testing.T) {
+	idr := []byte{0x65, 0x88, 0x84}
+	p := []byte{0x41, 0x9a, 0x02}
+	b := []byte{0x01, 0x9c, 0x02}
+	recovery := []byte{0x06, 0x06, 0x01, 0x84, 0x80}
+	userData := []byte{0x06, 0x05, 0x02, 0xaa, 0xbb, 0x80}
+	nonIDRI := []byte{0x41, 0x88, 0x84} // slice_type I in a non-IDR NALU
+
+	var aus [][][]byte
+	for gop := 0; gop < 3; gop++ {
+		aus = append(aus, [][]byte{rtspeektest.H264SPS, rtspeektest.H264PPS, userData, idr, idr})
+		for i := 0; i < 4; i++ {
+			aus = append(aus, [][]byte{p}, [][]byte{b})
+		}
+	}
+	aus = append(aus, [][]byte{recovery, nonIDRI})
+
+	g := feedGOP(t, &format.H264{PayloadTyp: 96, PacketizationMode: 1}, aus)
+	if g.Frames != 28 || g.Keyframes != 4 {
+		t.Fatalf("unexpected counts: %+v", g)
+	}
+	if g.IntervalFrames != 9 || g.MinIntervalFrames != 9 || g.MaxIntervalFrames != 9 {
+		t.Fatalf("unexpected interval: %+v", g)
+	}
+	if g.IntervalSeconds != 0.36 || g.LongestWithoutKeyframe != 0.36 {
+		t.Fatalf("unexpected seconds: %+v", g)
+	}
+	if g.Structure != GOPMixed || !g.BFrames || g.FrameTypes["B"] != 12 || g.FrameTypes["I"] != 4 {
+		t.Fatalf("unexpected structure: %+v", g)
+	}
+	if g.MaxSlicesPerFrame != 2 {
+		t.Fatalf("expected two slices in IDR frames, got %+v", g)
+	}
+	if len(g.SEITypes) != 2 || g.SEITypes[0] != 5 || g.SEITypes[1] != 6 {
+		t.Fatalf("unexpected SEI types: %v", g.SEITypes)
+	}
+}
+
+func TestGOPAnalyzerH265(t *testing.T) {
+	idr := []byte{0x26, 0x01, 0xac}                   // IDR_W_RADL, slice_type I
+	cra := []byte{0x2a, 0x01, 0xac}                   // CRA, slice_type I
+	p := []byte{0x02, 0x01, 0xd0}                     // TRAIL_R, slice_type P
+	sei := []byte{0x4e, 0x01, 0x89, 0x01, 0x00, 0x80} // prefix SEI, payload type 137
+
+	aus := [][][]byte{{sei, idr}, {p}, {p}, {cra}, {p}, {p}}
+	g := feedGOP(t, &format.H265{PayloadTyp: 96}, aus)
+	if g.Keyframes != 2 || g.Structure != GOPMixed || g.IntervalFrames != 3 {
+		t.Fatalf("unexpected GOP: %+v", g)
+	}
+	if g.BFrames || g.FrameTypes["P"] != 4 || g.FrameTypes["I"] != 2 {
+		t.Fatalf("unexpected frame types: %+v", g.FrameTypes)
+	}
+	if len(g.SEITypes) != 1 || g.SEITypes[0] != 137 {
+		t.Fatalf("unexpected SEI types: %v", g.SEITypes)
+	}
+}
+
+func TestGOPAnalyzerSingleKeyframeLowerBound(t *testing.T) {
+	idr := []byte{0x65, 0x88, 0x84}
+	p := []byte{0x41, 0x9a, 0x02}
+	aus := [][][]byte{{p}, {p}, {idr}}
+	for i := 0; i < 50; i++ {
+		aus = append(aus, [][]byte{p})
+	}
+	g := feedGOP(t, &format.H264{PayloadTyp: 96, PacketizationMode: 1}, aus)
+	if g.IntervalFrames != 0 || g.Structure != GOPClosed {
+		t.Fatalf("interval needs two keyframes: %+v", g)
+	}
+	if g.LongestWithoutKeyframe != 2 {
+		t.Fatalf("expected a 2s lower bound, got %v", g.LongestWithoutKeyframe)
+	}
+}
+
+func TestDescribeStreamLiveProbeGOP(t *testing.T) {
+	video := h264Media()
+	desc := &description.Session{Medias: []*description.Media{video}}
+	src := newH264Source(5)
+	src.SliceSize = 100
+	url := startPlayServer(t, desc, 5*time.Millisecond, func(stream *gortsplib.ServerStream, n int) {
+		for _, pkt := range src.frame(n) {
+			_ = stream.WritePacketRTP(video, pkt)
+		}
+	})
+
+	ctx := WithLiveProbe(context.Background(), LiveProbeOptions{Duration: 300 * time.Millisecond, Transport: "tcp"})
+	info, err := DescribeStream(ctx, url, 2*time.Second)
+	if err != nil {
+		t.Fatalf("describe: %v", err)
+	}
+	g := info.GetVideoMedias()[0].GOP
+	if g == nil || g.Keyframes < 2 {
+		t.Fatalf("expected GOP analysis, got %+v", g)
+	}
+	if g.IntervalFrames != 5 || g.IntervalSeconds != 0.2 || g.Structure != GOPClosed || g.BFrames {
+		t.Fatalf("unexpected GOP: %+v", g)
+	}
+}
@@ -0,0 +1,323 @@
+package rtspeek
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultHistoryRetention is how long a HistoryStore keeps records when no retention is given.
+const DefaultHistoryRetention = 30 * 24 * time.Hour
+
+// historySegmentLayout names segment files, one per UTC day.
+const historySegmentLayout = "2006-01-02"
+
+// HistoryRecord is one probe of one target.
+type HistoryRecord struct {
+	Time    time.Time `json:"time"`
+	Target  string    `json:"target"`
+	URL     string    `json:"url,omitempty"` // without credentials
+	OK      bool      `json:"ok"`
+	Failure string    `json:"failure,omitempty"` // error classification when OK is false
+	Latency float64   `json:"latency"`           // ms
+}
+
+// NewHistoryRecord turns a ProbeTargets result into a record. A target is up when DESCRIBE succeeded and
+// its expectations, if any, passed.
+func NewHistoryRecord(r TargetResult) HistoryRecord {
+	rec := HistoryRecord{Time: r.Start.UTC(), Target: r.Target.Name, URL: r.URL}
+	if r.Info != nil {
+		rec.Latency = r.Info.LatencyMs()
+	}
+	switch {
+	case r.Err != nil:
+		rec.Failure = classifyError(r.Err)
+	case r.Info == nil || !r.Info.IsDescribeSucceeded():
+		rec.Failure = "other"
+	case r.Expect != nil && !r.Expect.Pass:
+		rec.Failure = "expectations"
+	default:
+		rec.OK = true
+	}
+	return rec
+}
+
+// HistoryStore keeps probe records in a directory of append-only segment files, one JSON line per record
+// and one file per UTC day (2006-01-02.ndjson). Segments older than the retention are deleted. A line cut
+// short by a crash is skipped when reading. The store is safe for concurrent use within one process.
+type HistoryStore struct {
+	dir       string
+	retention time.Duration
+
+	mu     sync.Mutex
+	seg    *os.File
+	segDay string
+}
+
+// OpenHistoryStore opens (creating if needed) the store in dir and deletes expired segments. A retention
+// of 0 means DefaultHistoryRetention; a negative one keeps everything.
+func OpenHistoryStore(dir string, retention time.Duration) (*HistoryStore, error) {
+	if retention == 0 {
+		retention = DefaultHistoryRetention
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create history directory: %w", err)
+	}
+	s := &HistoryStore{dir: dir, retention: retention}
+	if err := s.Prune(time.Now()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Append writes records to the segments of their days.
+func (s *HistoryStore) Append(records ...HistoryRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range records {
+		day := r.Time.UTC().Format(historySegmentLayout)
+		if day != s.segDay {
+			if err := s.openSegment(day); err != nil {
+				return err
+			}
+		}
+		line, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		if _, err := s.seg.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("write history: %w", err)
+		}
+	}
+	return nil
+}
+
+// openSegment switches appends to the segment of day, pruning when a new day starts.
+func (s *HistoryStore) openSegment(day string) error {
+	if s.seg != nil {
+		_ = s.seg.Close()
+		s.seg, s.segDay = nil, ""
+	}
+	if err := s.prune(time.Now()); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(s.dir, day+".ndjson"), os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open history segment: %w", err)
+	}
+	// End a line torn by a crash so the next record starts on its own line
+	if st, err := f.Stat(); err == nil && st.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, st.Size()-1); err == nil && last[0] != '\n' {
+			_, _ = f.Write([]byte{'\n'})
+		}
+	}
+	s.seg, s.segDay = f, day
+	return nil
+}
+
+// Prune deletes the segments whose whole day ended before now minus the retention.
+func (s *HistoryStore) Prune(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.prune(now)
+}
+
+func (s *HistoryStore) prune(now time.Time) error {
+	if s.retention < 0 {
+		return nil
+	}
+	days, err := s.segments()
+	if err != nil {
+		return err
+	}
+	cutoff := now.Add(-s.retention)
+	for _, day := range days {
+		if day.Add(24*time.Hour).After(cutoff) || day.Format(historySegmentLayout) == s.segDay {
+			continue
+		}
+		if err := os.Remove(s.segmentPath(day)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("delete expired history: %w", err)
+		}
+	}
+	return nil
+}
+
+// segments returns the days that have a segment, oldest first.
+func (s *HistoryStore) segments() ([]time.Time, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("read history directory: %w", err)
+	}
+	var days []time.Time
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".ndjson")
+		if !ok || e.IsDir() {
+			continue
+		}
+		if day, err := time.Parse(historySegmentLayout, name); err == nil {
+			days = append(days, day)
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	return days, nil
+}
+
+func (s *HistoryStore) segmentPath(day time.Time) string {
+	return filepath.Join(s.dir, day.Format(historySegmentLayout)+".ndjson")
+}
+
+// Scan calls fn with the records whose time is in [from, to), in file order (oldest segment first).
+// A zero from or to leaves that side open.
+func (s *HistoryStore) Scan(from, to time.Time, fn func(HistoryRecord) error) error {
+	days, err := s.segments()
+	if err != nil {
+		return err
+	}
+	for _, day := range days {
+		if !from.IsZero() && !day.Add(24*time.Hour).After(from) || !to.IsZero() && !day.Before(to) {
+			continue
+		}
+		if err := s.scanSegment(day, from, to, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *HistoryStore) scanSegment(day, from, to time.Time, fn func(HistoryRecord) error) error {
+	f, err := os.Open(s.segmentPath(day))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil // pruned meanwhile
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		var r HistoryRecord
+		if json.Unmarshal(sc.Bytes(), &r) != nil {
+			continue
+		}
+		if !from.IsZero() && r.Time.Before(from) || !to.IsZero() && !r.Time.Before(to) {
+			continue
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+// Close closes the current segment.
+func (s *HistoryStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.seg == nil {
+		return nil
+	}
+	err := s.seg.Close()
+	s.seg, s.segDay = nil, ""
+	return err
+}
+
+// TargetHistory summarizes the records of one target over a window.
+type TargetHistory struct {
+	Target   string         `json:"target"`
+	URL      string         `json:"url,omitempty"`
+	Probes   int            `json:"probes"`
+	Up       int            `json:"up"`
+	Uptime   float64        `json:"uptime"`   // percent of probes that were up
+	Failures map[string]int `json:"failures"` // probes per failure class
+	// Latency percentiles (ms) of the probes that were up; omitted without any.
+	LatencyP50 *float64 `json:"latency_p50,omitempty"`
+	LatencyP90 *float64 `json:"latency_p90,omitempty"`
+	LatencyP99 *float64 `json:"latency_p99,omitempty"`
+	// State is "up" or "down" as of the last probe in the window; LastChange is when it last flipped,
+	// looking back over the whole store, and is omitted if it never did.
+	State      string     `json:"state"`
+	LastProbe  time.Time  `json:"last_probe"`
+	LastChange *time.Time `json:"last_change,omitempty"`
+}
+
+// Summary summarizes each target with records in [from, to), sorted by target; targets, if set, limits
+// it to those names. Records before from are read too, to find when the state last changed.
+func (s *HistoryStore) Summary(from, to time.Time, targets []string) ([]TargetHistory, error) {
+	type acc struct {
+		h         TargetHistory
+		latencies []float64
+		state     string // as of the latest record read so far
+		change    time.Time
+	}
+	byTarget := make(map[string]*acc)
+	err := s.Scan(time.Time{}, to, func(r HistoryRecord) error {
+		if len(targets) > 0 && !containsString(targets, r.Target) {
+			return nil
+		}
+		a := byTarget[r.Target]
+		if a == nil {
+			a = &acc{h: TargetHistory{Target: r.Target, Failures: map[string]int{}}}
+			byTarget[r.Target] = a
+		}
+		state := "down"
+		if r.OK {
+			state = "up"
+		}
+		if a.state != "" && a.state != state {
+			a.change = r.Time
+		}
+		a.state = state
+		if r.Time.Before(from) {
+			return nil
+		}
+		a.h.Probes++
+		a.h.URL, a.h.State, a.h.LastProbe = r.URL, state, r.Time
+		if r.OK {
+			a.h.Up++
+			a.latencies = append(a.latencies, r.Latency)
+		} else {
+			a.h.Failures[r.Failure]++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := []TargetHistory{}
+	for _, a := range byTarget {
+		if a.h.Probes == 0 {
+			continue // only seen before the window
+		}
+		h := a.h
+		h.Uptime = math.Round(float64(h.Up)/float64(h.Probes)*10000) / 100
+		if !a.change.IsZero() {
+			h.LastChange = &a.change
+		}
+		if len(a.latencies) > 0 {
+			sort.Float64s(a.latencies)
+			h.LatencyP50 = percentile(a.latencies, 50)
+			h.LatencyP90 = percentile(a.latencies, 90)
+			h.LatencyP99 = percentile(a.latencies, 99)
+		}
+		out = append(out, h)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Target < out[j].Target })
+	return out, nil
+}
+
+// percentile returns the nearest-rank percentile of sorted values.
+func percentile(sorted []float64, p float64) *float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	v := sorted[max(rank, 1)-1]
+	return &v
+}
@@ -0,0 +1,107 @@
+package rtspeek
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHistoryStoreSummary(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenHistoryStore(dir, 0)
+	if err != nil {
+		t.Fatalf("OpenHistoryStore: %v", err)
+	}
+	defer s.Close()
+
+	now := time.Now().UTC().Truncate(time.Minute)
+	at := func(ago time.Duration) time.Time { return now.Add(-ago) }
+	records := []HistoryRecord{
+		{Time: at(48 * time.Hour), Target: "lobby", OK: false, Failure: "timeout"},
+		{Time: at(47 * time.Hour), Target: "lobby", OK: true, Latency: 100},
+		{Time: at(4 * time.Hour), Target: "lobby", OK: true, Latency: 40},
+		{Time: at(3 * time.Hour), Target: "lobby", OK: false, Failure: "timeout"},
+		{Time: at(2 * time.Hour), Target: "lobby", OK: false, Failure: "auth_required"},
+		{Time: at(1 * time.Hour), Target: "lobby", OK: true, Latency: 20},
+		{Time: at(30 * time.Minute), Target: "lobby", OK: true, Latency: 30},
+		{Time: at(10 * time.Minute), Target: "dock", OK: true, Latency: 5},
+		{Time: at(72 * time.Hour), Target: "gone", OK: true, Latency: 5},
+	}
+	if err := s.Append(records...); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	// A torn line left by a crash is skipped
+	f, err := os.OpenFile(filepath.Join(dir, now.Format(historySegmentLayout)+".ndjson"), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"time":"` + now.Format(time.RFC3339) + `","target":"lob`)
+	f.Close()
+
+	s.Close() // the next append reopens the segment after the torn line
+	if err := s.Append(HistoryRecord{Time: now, Target: "dock", OK: true, Latency: 7}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Summary(now.Add(-24*time.Hour), time.Time{}, nil)
+	if err != nil {
+		t.Fatalf("Summary: %v", err)
+	}
+	if len(got) != 2 || got[0].Target != "dock" || got[1].Target != "lobby" {
+		t.Fatalf("unexpected targets: %+v", got)
+	}
+	lobby := got[1]
+	if lobby.Probes != 5 || lobby.Up != 3 || lobby.Uptime != 60 || lobby.State != "up" {
+		t.Fatalf("unexpected lobby summary: %+v", lobby)
+	}
+	if want := map[string]int{"timeout": 1, "auth_required": 1}; !reflect.DeepEqual(lobby.Failures, want) {
+		t.Fatalf("failures = %v, want %v", lobby.Failures, want)
+	}
+	if *lobby.LatencyP50 != 30 || *lobby.LatencyP99 != 40 {
+		t.Fatalf("unexpected percentiles: p50=%v p99=%v", *lobby.LatencyP50, *lobby.LatencyP99)
+	}
+	if lobby.LastChange == nil || !lobby.LastChange.Equal(at(time.Hour)) {
+		t.Fatalf("last change = %v, want %v", lobby.LastChange, at(time.Hour))
+	}
+	if got[0].Probes != 2 || got[0].LastChange != nil {
+		t.Fatalf("unexpected dock summary: %+v", got[0])
+	}
+
+	only, err := s.Summary(time.Time{}, time.Time{}, []string{"gone"})
+	if err != nil || len(only) != 1 || only[0].Probes != 1 {
+		t.Fatalf("unexpected filtered summary: %+v, %v", only, err)
+	}
+}
+
+func TestHistoryStoreRetention(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now().UTC()
+	s, err := OpenHistoryStore(dir, 48*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Append(
+		HistoryRecord{Time: now.Add(-5 * 24 * time.Hour), Target: "a", OK: true},
+		HistoryRecord{Time: now, Target: "a", OK: true},
+	); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	// Reopening prunes the segment that expired
+	s, err = OpenHistoryStore(dir, 48*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var n int
+	if err := s.Scan(time.Time{}, time.Time{}, func(HistoryRecord) error { n++; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if n != 1 || len(entries) != 1 {
+		t.Fatalf("got %d records in %d segments after pruning, want 1 in 1", n, len(entries))
+	}
+}
@@ -0,0 +1,407 @@
+package rtspeek
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/sdp"
+	psdp "github.com/pion/sdp/v3"
+)
+
+// Severity ranks lint findings.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+)
+
+// Finding is a single issue reported by the SDP linter.
+type Finding struct {
+	Code     string   `json:"code"`
+	Severity Severity `json:"severity"`
+	Media    *int     `json:"media,omitempty"`
+	Message  string   `json:"message"`
+}
+
+// ErrNoRawSDP is returned when linting a StreamInfo that was described without WithRawSDP.
+var ErrNoRawSDP = errors.New("raw SDP not captured (describe with WithRawSDP)")
+
+// SDPLinter checks SDP documents for spec violations and interop hazards.
+type SDPLinter struct{}
+
+// NewSDPLinter creates a new SDP linter.
+func NewSDPLinter() *SDPLinter {
+	return &SDPLinter{}
+}
+
+// staticPayloadTypes maps RFC 3551 static payload types to their encoding and clock rate.
+var staticPayloadTypes = map[uint8]struct {
+	encoding  string
+	clockRate int
+}{
+	0: {"PCMU", 8000}, 3: {"GSM", 8000}, 4: {"G723", 8000}, 5: {"DVI4", 8000},
+	6: {"DVI4", 16000}, 7: {"LPC", 8000}, 8: {"PCMA", 8000}, 9: {"G722", 8000},
+	10: {"L16", 44100}, 11: {"L16", 44100}, 12: {"QCELP", 8000}, 13: {"CN", 8000},
+	14: {"MPA", 90000}, 15: {"G728", 8000}, 16: {"DVI4", 11025}, 17: {"DVI4", 22050},
+	18: {"G729", 8000}, 25: {"CelB", 90000}, 26: {"JPEG", 90000}, 28: {"nv", 90000},
+	31: {"H261", 90000}, 32: {"MPV", 90000}, 33: {"MP2T", 90000}, 34: {"H263", 90000},
+}
+
+// commonAudioClockRates lists sample rates that audio RTP payloads normally use.
+var commonAudioClockRates = map[int]bool{
+	8000: true, 11025: true, 12000: true, 16000: true, 22050: true, 24000: true,
+	32000: true, 44100: true, 48000: true, 64000: true, 88200: true, 96000: true,
+}
+
+// Lint checks a raw SDP document. baseURL is the Content-Base or request URL used to
+// resolve relative control attributes; it may be empty for offline use.
+func (l *SDPLinter) Lint(raw []byte, baseURL string) []Finding {
+	var findings []Finding
+	add := func(code string, sev Severity, media *int, format string, args ...any) {
+		findings = append(findings, Finding{Code: code, Severity: sev, Media: media, Message: fmt.Sprintf(format, args...)})
+	}
+
+	ssd, err := parseSDP(raw)
+	if err != nil {
+		add("sdp_invalid", SeverityError, nil, "%v", err)
+		return findings
+	}
+	if len(ssd.MediaDescriptions) == 0 {
+		add("no_media", SeverityError, nil, "SDP contains no m= lines")
+		return findings
+	}
+
+	var desc description.Session
+	if err := desc.Unmarshal(ssd); err != nil {
+		add("sdp_unsupported", SeverityError, nil, "SDP rejected by RTSP client: %v", err)
+	}
+
+	l.lintRange(ssd, add)
+	l.lintControls(ssd, baseURL, add)
+
+	for i, md := range ssd.MediaDescriptions {
+		idx := i
+		l.lintPayloadTypes(&idx, md, add)
+	}
+
+	return findings
+}
+
+// LintStreamInfo lints the SDP captured in a StreamInfo (requires WithRawSDP).
+func (l *SDPLinter) LintStreamInfo(si StreamInfo) ([]Finding, error) {
+	raw := si.GetRawSDP()
+	if raw == "" {
+		return nil, ErrNoRawSDP
+	}
+	baseURL := si.GetURLString()
+	if sd := si.GetSessionDetails(); sd != nil {
+		if sd.ContentBase != "" {
+			baseURL = sd.ContentBase
+		} else if sd.BaseURL != "" {
+			baseURL = sd.BaseURL
+		}
+	}
+	return l.Lint([]byte(raw), baseURL), nil
+}
+
+// LintSDP is a convenience wrapper around SDPLinter.Lint.
+func LintSDP(raw []byte, baseURL string) []Finding {
+	return NewSDPLinter().Lint(raw, baseURL)
+}
+
+// HasErrors reports whether any finding has error severity.
+func HasErrors(findings []Finding) bool {
+	for _, f := range findings {
+		if f.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+type addFinding func(code string, sev Severity, media *int, format string, args ...any)
+
+func (l *SDPLinter) lintRange(ssd *sdp.SessionDescription, add addFinding) {
+	if sdpAttribute(ssd.Attributes, "range") != "" {
+		return
+	}
+	for _, md := range ssd.MediaDescriptions {
+		if sdpAttribute(md.Attributes, "range") != "" {
+			return
+		}
+	}
+	add("missing_range", SeverityWarning, nil, "no a=range attribute; clients cannot tell live from recorded content")
+}
+
+func (l *SDPLinter) lintControls(ssd *sdp.SessionDescription, baseURL string, add addFinding) {
+	sessionControl := sdpAttribute(ssd.Attributes, "control")
+	base := baseURL
+	if isAbsoluteControl(sessionControl) {
+		base = sessionControl
+	}
+
+	var absolute, relative int
+	for i, md := range ssd.MediaDescriptions {
+		idx := i
+		ctrl := sdpAttribute(md.Attributes, "control")
+		switch {
+		case ctrl == "":
+			if len(ssd.MediaDescriptions) > 1 {
+				add("missing_control", SeverityError, &idx, "media has no a=control but the session has %d medias", len(ssd.MediaDescriptions))
+			}
+		case ctrl == "*":
+		case isAbsoluteControl(ctrl):
+			absolute++
+			if base != "" && !sameHost(ctrl, base) {
+				add("control_host_mismatch", SeverityWarning, &idx, "absolute control %q points to a different host than base %q", ctrl, base)
+			}
+		default:
+			relative++
+			if base == "" {
+				add("control_relative_without_base", SeverityInfo, &idx, "relative control %q cannot be resolved without Content-Base", ctrl)
+			} else if !strings.HasSuffix(base, "/") && !strings.Contains(base, "?") {
+				add("control_base_without_slash", SeverityWarning, &idx,
+					"relative control %q against base %q without trailing slash; clients disagree on whether to append or replace the last segment", ctrl, base)
+			}
+		}
+	}
+	if absolute > 0 && relative > 0 {
+		add("control_mixed", SeverityWarning, nil, "medias mix absolute and relative a=control URLs")
+	}
+}
+
+func (l *SDPLinter) lintPayloadTypes(idx *int, md *psdp.MediaDescription, add addFinding) {
+	seen := make(map[string]bool)
+	for _, f := range md.MediaName.Formats {
+		if seen[f] {
+			add("duplicate_payload_type", SeverityError, idx, "payload type %s listed more than once on the m= line", f)
+		}
+		seen[f] = true
+	}
+
+	rtpmaps := make(map[uint8]string)
+	for _, a := range md.Attributes {
+		if a.Key != "rtpmap" {
+			continue
+		}
+		pt, rest, ok := splitPayloadAttr(a.Value)
+		if !ok {
+			add("rtpmap_malformed", SeverityError, idx, "malformed a=rtpmap:%s", a.Value)
+			continue
+		}
+		if _, dup := rtpmaps[pt]; dup {
+			add("duplicate_payload_type", SeverityError, idx, "payload type %d has more than one a=rtpmap", pt)
+		}
+		rtpmaps[pt] = rest
+	}
+
+	fmtps := make(map[uint8]map[string]string)
+	for _, a := range md.Attributes {
+		if a.Key != "fmtp" {
+			continue
+		}
+		if pt, rest, ok := splitPayloadAttr(a.Value); ok {
+			fmtps[pt] = parseFmtpParams(rest)
+		}
+	}
+
+	if md.MediaName.Protos == nil || !strings.Contains(strings.Join(md.MediaName.Protos, "/"), "RTP") {
+		return
+	}
+
+	for _, f := range md.MediaName.Formats {
+		ptv, err := strconv.ParseUint(f, 10, 8)
+		if err != nil || ptv > 127 {
+			add("payload_type_invalid", SeverityError, idx, "payload type %q is not a valid RTP payload type", f)
+			continue
+		}
+		pt := uint8(ptv)
+		rtpmap, hasMap := rtpmaps[pt]
+
+		if pt >= 96 && !hasMap {
+			add("missing_rtpmap", SeverityError, idx, "dynamic payload type %d has no a=rtpmap", pt)
+			continue
+		}
+
+		encoding, clockRate := parseRtpmap(rtpmap)
+		if !hasMap {
+			if st, ok := staticPayloadTypes[pt]; ok {
+				encoding, clockRate = st.encoding, st.clockRate
+			}
+		} else if st, ok := staticPayloadTypes[pt]; ok && clockRate != 0 && clockRate != st.clockRate {
+			add("static_payload_mismatch", SeverityWarning, idx, "static payload type %d declares %s but RFC 3551 defines %s/%d", pt, rtpmap, st.encoding, st.clockRate)
+		}
+
+		l.lintClockRate(idx, md.MediaName.Media, encoding, clockRate, add)
+		l.lintParameterSets(idx, encoding, fmtps[pt], sdpAttribute(md.Attributes, "x-dimensions"), add)
+	}
+}
+
+func (l *SDPLinter) lintClockRate(idx *int, mediaType, encoding string, clockRate int, add addFinding) {
+	if clockRate == 0 {
+		return
+	}
+	switch mediaType {
+	case "video":
+		if clockRate != 90000 {
+			add("odd_clock_rate", SeverityWarning, idx, "video %s uses clock rate %d instead of 90000", encoding, clockRate)
+		}
+	case "audio":
+		switch strings.ToUpper(encoding) {
+		case "PCMU", "PCMA", "G722", "G726-16", "G726-24", "G726-32", "G726-40":
+			if clockRate != 8000 {
+				add("odd_clock_rate", SeverityWarning, idx, "%s must use clock rate 8000, got %d", encoding, clockRate)
+			}
+			return
+		case "OPUS":
+			if clockRate != 48000 {
+				add("odd_clock_rate", SeverityWarning, idx, "opus must use clock rate 48000, got %d", clockRate)
+			}
+			return
+		}
+		if !commonAudioClockRates[clockRate] {
+			add("odd_clock_rate", SeverityWarning, idx, "audio %s uses unusual clock rate %d", encoding, clockRate)
+		}
+	}
+}
+
+func (l *SDPLinter) lintParameterSets(idx *int, encoding string, fmtp map[string]string, xdims string, add addFinding) {
+	var spsRes *Resolution
+	switch strings.ToUpper(encoding) {
+	case "H264":
+		sprop, ok := fmtp["sprop-parameter-sets"]
+		if !ok || sprop == "" {
+			add("missing_sprop_parameter_sets", SeverityWarning, idx, "H264 media has no sprop-parameter-sets; decoders must wait for in-band SPS/PPS")
+			return
+		}
+		units, err := decodeSpropList(sprop)
+		if err != nil {
+			add("malformed_sprop_parameter_sets", SeverityError, idx, "sprop-parameter-sets: %v", err)
+			return
+		}
+		var sps, pps []byte
+		for _, u := range units {
+			switch u[0] & 0x1f {
+			case 7:
+				sps = u
+			case 8:
+				pps = u
+			}
+		}
+		if sps == nil || pps == nil {
+			add("malformed_sprop_parameter_sets", SeverityError, idx, "sprop-parameter-sets must contain both an SPS and a PPS")
+		}
+		if sps != nil {
+			if w, h, err := parseH264SPS(sps); err != nil {
+				add("malformed_sprop_parameter_sets", SeverityError, idx, "SPS does not parse: %v", err)
+			} else {
+				spsRes = &Resolution{Width: w, Height: h}
+			}
+		}
+
+	case "H265":
+		for _, key := range []string{"sprop-vps", "sprop-sps", "sprop-pps"} {
+			if v, ok := fmtp[key]; !ok || v == "" {
+				add("missing_sprop_parameter_sets", SeverityWarning, idx, "H265 media has no %s; decoders must wait for in-band parameter sets", key)
+				return
+			}
+		}
+		units, err := decodeSpropList(fmtp["sprop-sps"])
+		if err != nil {
+			add("malformed_sprop_parameter_sets", SeverityError, idx, "sprop-sps: %v", err)
+			return
+		}
+		if w, h, err := parseH265SPS(units[0]); err != nil {
+			add("malformed_sprop_parameter_sets", SeverityError, idx, "SPS does not parse: %v", err)
+		} else {
+			spsRes = &Resolution{Width: w, Height: h}
+		}
+
+	default:
+		return
+	}
+
+	if spsRes == nil || xdims == "" {
+		return
+	}
+	if declared := parseXDimensions(xdims); declared != nil && *declared != *spsRes {
+		add("resolution_mismatch", SeverityWarning, idx, "a=x-dimensions declares %s but SPS encodes %s", declared, spsRes)
+	}
+}
+
+// isAbsoluteControl reports whether a control attribute is an absolute URL.
+func isAbsoluteControl(ctrl string) bool {
+	lower := strings.ToLower(ctrl)
+	return strings.HasPrefix(lower, "rtsp://") || strings.HasPrefix(lower, "rtsps://")
+}
+
+func sameHost(a, b string) bool {
+	ua, errA := url.Parse(a)
+	ub, errB := url.Parse(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return strings.EqualFold(ua.Hostname(), ub.Hostname())
+}
+
+// splitPayloadAttr splits "96 rest" attribute values (rtpmap, fmtp).
+func splitPayloadAttr(v string) (uint8, string, bool) {
+	ptStr, rest, _ := strings.Cut(strings.TrimSpace(v), " ")
+	pt, err := strconv.ParseUint(ptStr, 10, 8)
+	if err != nil {
+		return 0, "", false
+	}
+	return uint8(pt), strings.TrimSpace(rest), true
+}
+
+// parseRtpmap splits "H264/90000[/channels]" into encoding and clock rate.
+func parseRtpmap(v string) (string, int) {
+	parts := strings.Split(v, "/")
+	if len(parts) < 2 {
+		return v, 0
+	}
+	cr, _ := strconv.Atoi(strings.TrimSpace(parts[1]))
+	return parts[0], cr
+}
+
+func parseFmtpParams(v string) map[string]string {
+	params := make(map[string]string)
+	for _, kv := range strings.Split(v, ";") {
+		k, val, ok := strings.Cut(strings.TrimSpace(kv), "=")
+		if !ok {
+			continue
+		}
+		params[strings.ToLower(strings.TrimSpace(k))] = strings.TrimSpace(val)
+	}
+	return params
+}
+
+// decodeSpropList decodes a comma-separated list of base64 NAL units.
+func decodeSpropList(v string) ([][]byte, error) {
+	var units [][]byte
+	for _, part := range strings.Split(v, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		b, err := base64.StdEncoding.DecodeString(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 %q", part)
+		}
+		if len(b) == 0 {
+			return nil, fmt.Errorf("empty NAL unit")
+		}
+		units = append(units, b)
+	}
+	if len(units) == 0 {
+		return nil, fmt.Errorf("no NAL units")
+	}
+	return units, nil
+}
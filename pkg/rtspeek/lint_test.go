@@ -0,0 +1,144 @@
+package rtspeek
+
+import (
+	"strings"
+	"testing"
+)
+
+// lintCodes returns the set of finding codes for quick assertions.
+func lintCodes(findings []Finding) map[string]int {
+	codes := make(map[string]int)
+	for _, f := range findings {
+		codes[f.Code]++
+	}
+	return codes
+}
+
+func TestLintSDPClean(t *testing.T) {
+	findings := LintSDP([]byte(sampleSDP), "rtsp://192.168.1.10/live/")
+	for _, f := range findings {
+		if f.Severity == SeverityError {
+			t.Fatalf("unexpected error finding: %#v", f)
+		}
+	}
+	// sampleSDP omits sprop-parameter-sets on purpose
+	if lintCodes(findings)["missing_sprop_parameter_sets"] != 1 {
+		t.Fatalf("expected missing sprop warning, got %#v", findings)
+	}
+}
+
+func TestLintSDPFindings(t *testing.T) {
+	header := "v=0\r\no=- 1 1 IN IP4 10.0.0.1\r\ns=test\r\nt=0 0\r\n"
+	cases := []struct {
+		name    string
+		sdp     string
+		baseURL string
+		want    string
+		sev     Severity
+	}{
+		{
+			name: "missing_rtpmap",
+			sdp:  header + "a=range:npt=0-\r\nm=video 0 RTP/AVP 97\r\na=control:trackID=1\r\n",
+			want: "missing_rtpmap", sev: SeverityError,
+		},
+		{
+			name: "duplicate_payload_type",
+			sdp:  header + "a=range:npt=0-\r\nm=audio 0 RTP/AVP 0 0\r\na=control:trackID=1\r\n",
+			want: "duplicate_payload_type", sev: SeverityError,
+		},
+		{
+			name: "missing_range",
+			sdp:  header + "m=audio 0 RTP/AVP 0\r\na=control:trackID=1\r\n",
+			want: "missing_range", sev: SeverityWarning,
+		},
+		{
+			name: "odd_video_clock",
+			sdp:  header + "a=range:npt=0-\r\nm=video 0 RTP/AVP 96\r\na=rtpmap:96 H264/1000\r\na=fmtp:96 sprop-parameter-sets=Z0LAH5WoFAFumwQEBKA=,aM48gA==\r\na=control:trackID=1\r\n",
+			want: "odd_clock_rate", sev: SeverityWarning,
+		},
+		{
+			name: "odd_pcmu_clock",
+			sdp:  header + "a=range:npt=0-\r\nm=audio 0 RTP/AVP 96\r\na=rtpmap:96 PCMU/16000\r\na=control:trackID=1\r\n",
+			want: "odd_clock_rate", sev: SeverityWarning,
+		},
+		{
+			name: "malformed_sprop",
+			sdp:  header + "a=range:npt=0-\r\nm=video 0 RTP/AVP 96\r\na=rtpmap:96 H264/90000\r\na=fmtp:96 sprop-parameter-sets=!!!,aM48gA==\r\na=control:trackID=1\r\n",
+			want: "malformed_sprop_parameter_sets", sev: SeverityError,
+		},
+		{
+			name: "resolution_mismatch",
+			sdp:  header + "a=range:npt=0-\r\nm=video 0 RTP/AVP 96\r\na=rtpmap:96 H264/90000\r\na=fmtp:96 sprop-parameter-sets=Z0LAH5WoFAFumwQEBKA=,aM48gA==\r\na=x-dimensions:1920,1080\r\na=control:trackID=1\r\n",
+			want: "resolution_mismatch", sev: SeverityWarning,
+		},
+		{
+			name:    "control_host_mismatch",
+			sdp:     header + "a=range:npt=0-\r\nm=audio 0 RTP/AVP 0\r\na=control:rtsp://10.9.9.9/track1\r\n",
+			baseURL: "rtsp://10.0.0.1/live/",
+			want:    "control_host_mismatch", sev: SeverityWarning,
+		},
+		{
+			name:    "control_base_without_slash",
+			sdp:     header + "a=range:npt=0-\r\nm=audio 0 RTP/AVP 0\r\na=control:trackID=1\r\n",
+			baseURL: "rtsp://10.0.0.1/live",
+			want:    "control_base_without_slash", sev: SeverityWarning,
+		},
+		{
+			name: "control_mixed",
+			sdp:  header + "a=range:npt=0-\r\nm=audio 0 RTP/AVP 0\r\na=control:rtsp://10.0.0.1/live/a\r\nm=audio 0 RTP/AVP 8\r\na=control:trackID=2\r\n",
+			want: "control_mixed", sev: SeverityWarning,
+		},
+		{
+			name: "missing_control",
+			sdp:  header + "a=range:npt=0-\r\nm=audio 0 RTP/AVP 0\r\nm=audio 0 RTP/AVP 8\r\n",
+			want: "missing_control", sev: SeverityError,
+		},
+		{
+			name: "invalid",
+			sdp:  "this is not sdp",
+			want: "sdp_invalid", sev: SeverityError,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			findings := LintSDP([]byte(tc.sdp), tc.baseURL)
+			var found *Finding
+			for i := range findings {
+				if findings[i].Code == tc.want {
+					found = &findings[i]
+					break
+				}
+			}
+			if found == nil {
+				t.Fatalf("expected finding %s, got %#v", tc.want, findings)
+			}
+			if found.Severity != tc.sev {
+				t.Fatalf("expected severity %s, got %s", tc.sev, found.Severity)
+			}
+			if found.Message == "" {
+				t.Fatal("expected a message")
+			}
+		})
+	}
+}
+
+func TestLintStreamInfoRequiresRawSDP(t *testing.T) {
+	if _, err := NewSDPLinter().LintStreamInfo(&streamInfo{}); err != ErrNoRawSDP {
+		t.Fatalf("expected ErrNoRawSDP, got %v", err)
+	}
+
+	info := &streamInfo{URL: "rtsp://192.168.1.10/live", Session: &SessionDetails{RawSDP: sampleSDP, ContentBase: "rtsp://192.168.1.10/live/"}}
+	findings, err := NewSDPLinter().LintStreamInfo(info)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if HasErrors(findings) {
+		t.Fatalf("unexpected errors: %#v", findings)
+	}
+	for _, f := range findings {
+		if strings.HasPrefix(f.Code, "control_") {
+			t.Fatalf("content base should resolve controls cleanly: %#v", f)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package rtspeek
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+// LiveProbeOptions configures the optional SETUP/PLAY phase that follows DESCRIBE.
+type LiveProbeOptions struct {
+	// Duration of the PLAY window.
+	Duration time.Duration
+	// Transport forces "udp", "tcp" or "multicast"; empty lets the client choose.
+	Transport string
+	// BitrateSeries adds the per-second bitrate series to each track's bitrate profile.
+	BitrateSeries bool
+}
+
+// LiveProbeInfo summarizes the PLAY window of a live probe.
+type LiveProbeInfo struct {
+	Duration  float64 `json:"duration"` // seconds actually spent receiving
+	Transport string  `json:"transport,omitempty"`
+	Packets   uint64  `json:"packets"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// live probe context key and helpers
+type liveProbeCtxKey struct{}
+
+var liveProbeKey = liveProbeCtxKey{}
+
+// WithLiveProbe makes DescribeStream SETUP and PLAY the stream for opts.Duration after DESCRIBE
+// and attach per-track analysis to the returned StreamInfo.
+func WithLiveProbe(ctx context.Context, opts LiveProbeOptions) context.Context {
+	return context.WithValue(ctx, liveProbeKey, opts)
+}
+
+func liveProbeOptions(ctx context.Context) (LiveProbeOptions, bool) {
+	opts, ok := ctx.Value(liveProbeKey).(LiveProbeOptions)
+	return opts, ok && opts.Duration > 0
+}
+
+// parseTransport maps a transport name to the gortsplib value (nil for automatic).
+func parseTransport(name string) (*gortsplib.Transport, error) {
+	var t gortsplib.Transport
+	switch strings.ToLower(name) {
+	case "", "auto":
+		return nil, nil
+	case "udp":
+		t = gortsplib.TransportUDP
+	case "tcp":
+		t = gortsplib.TransportTCP
+	case "multicast", "udp-multicast":
+		t = gortsplib.TransportUDPMulticast
+	default:
+		return nil, fmt.Errorf("unknown transport %q (want udp, tcp or multicast)", name)
+	}
+	return &t, nil
+}
+
+// trackAnalyzer consumes the packets of a single media during a live probe.
+type trackAnalyzer interface {
+	onRTP(pkt *rtp.Packet, received time.Time)
+	onRTCP(pkt rtcp.Packet, received time.Time)
+	finish(mi *MediaInfo, window time.Duration)
+}
+
+// frameAnalyzer consumes the access units that a track's shared frameDecoder reassembles.
+type frameAnalyzer interface {
+	onFrame(au *accessUnit)
+}
+
+// liveTrack holds the analyzers attached to one media.
+type liveTrack struct {
+	index     int
+	analyzers []trackAnalyzer
+	rtp       *rtpStatsAnalyzer     // also in analyzers; fed client-side statistics
+	sr        *senderReportAnalyzer // also in analyzers; used for cross-track sync
+	// decoder depacketizes H264/H265 once for every frame analyzer (nil for other formats)
+	decoder *frameDecoder
+	frames  []frameAnalyzer
+}
+
+// liveProbe dispatches received packets to per-track analyzers.
+type liveProbe struct {
+	mu        sync.Mutex
+	tracks    map[*description.Media]*liveTrack
+	packets   uint64
+	started   time.Time
+	stopped   time.Time
+	transport string
+	err       error
+	stats     *gortsplib.ClientStats // client counters at the end of the window
+	// wireOrder is set when packets are fed in arrival order without the client's reorder buffer (captures)
+	wireOrder bool
+}
+
+// newLiveProbe prepares analyzers for every media in the description.
+func newLiveProbe(desc *description.Session, opts LiveProbeOptions) *liveProbe {
+	lp := &liveProbe{tracks: make(map[*description.Media]*liveTrack)}
+	for i, m := range desc.Medias {
+		lp.tracks[m] = newLiveTrack(i, m, opts)
+	}
+	return lp
+}
+
+// newLiveTrack selects analyzers based on the media role and codec.
+func newLiveTrack(index int, m *description.Media, opts LiveProbeOptions) *liveTrack {
+	t := &liveTrack{index: index}
+	if detectMediaRole(m) == MediaRoleONVIFMetadata {
+		t.analyzers = append(t.analyzers, newMetadataAnalyzer())
+	}
+	if m.IsBackChannel || len(m.Formats) == 0 {
+		return t
+	}
+	f := m.Formats[0]
+	t.decoder = newTrackDecoder(f)
+	t.rtp = newRTPStatsAnalyzer(f.ClockRate())
+	t.sr = newSenderReportAnalyzer(f.ClockRate())
+	ba := newBitrateAnalyzer(opts.BitrateSeries)
+	t.analyzers = append(t.analyzers, t.rtp, t.sr, newTimingAnalyzer(m, t.decoder), ba)
+	if ga := newGOPAnalyzer(f, t.decoder); ga != nil {
+		t.analyzers = append(t.analyzers, ga)
+		t.frames = append(t.frames, ga)
+	}
+	if t.decoder != nil {
+		t.frames = append(t.frames, ba)
+	}
+	return t
+}
+
+// newTrackDecoder returns the decoder shared by the frame analyzers of an H264 or H265 track, or nil.
+func newTrackDecoder(f format.Format) *frameDecoder {
+	switch f.(type) {
+	case *format.H264, *format.H265:
+		fd, _ := newFrameDecoder(f)
+		return fd
+	}
+	return nil
+}
+
+// receive feeds a packet to the analyzers and the access unit it completes, if any, to the frame analyzers.
+func (t *liveTrack) receive(pkt *rtp.Packet, now time.Time) {
+	for _, a := range t.analyzers {
+		a.onRTP(pkt, now)
+	}
+	if t.decoder == nil {
+		return
+	}
+	if au, err := t.decoder.decode(pkt, now); err == nil && au != nil {
+		for _, fa := range t.frames {
+			fa.onFrame(au)
+		}
+	}
+}
+
+// playableMedias returns the medias that can be received (back channels are send-only).
+func playableMedias(desc *description.Session) []*description.Media {
+	var medias []*description.Media
+	for _, m := range desc.Medias {
+		if !m.IsBackChannel {
+			medias = append(medias, m)
+		}
+	}
+	return medias
+}
+
+func (lp *liveProbe) handleRTP(m *description.Media, _ format.Format, pkt *rtp.Packet) {
+	lp.receiveRTP(m, pkt, time.Now())
+}
+
+func (lp *liveProbe) handleRTCP(m *description.Media, pkt rtcp.Packet) {
+	lp.receiveRTCP(m, pkt, time.Now())
+}
+
+// receiveRTP dispatches a packet received at the given time.
+func (lp *liveProbe) receiveRTP(m *description.Media, pkt *rtp.Packet, now time.Time) {
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+	lp.packets++
+	if t, ok := lp.tracks[m]; ok {
+		t.receive(pkt, now)
+	}
+}
+
+// receiveRTCP dispatches a packet received at the given time.
+func (lp *liveProbe) receiveRTCP(m *description.Media, pkt rtcp.Packet, now time.Time) {
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+	if t, ok := lp.tracks[m]; ok {
+		for _, a := range t.analyzers {
+			a.onRTCP(pkt, now)
+		}
+	}
+}
+
+// handleDecodeError attributes packets rejected for a foreign SSRC to the track that owns the expected SSRC.
+func (lp *liveProbe) handleDecodeError(err error) {
+	got, expected, ok := parseWrongSSRC(err)
+	if !ok {
+		return
+	}
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+	for _, t := range lp.tracks {
+		if t.rtp != nil && t.rtp.initialized && t.rtp.ssrc == expected {
+			t.rtp.noteSSRC(got)
+		}
+	}
+}
+
+// apply writes the probe summary and per-track analysis into info.
+func (lp *liveProbe) apply(info *streamInfo) {
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+
+	var window time.Duration
+	if !lp.started.IsZero() {
+		end := lp.stopped
+		if end.IsZero() {
+			end = time.Now()
+		}
+		window = end.Sub(lp.started)
+	}
+
+	info.LiveProbe = &LiveProbeInfo{
+		Duration:  window.Seconds(),
+		Transport: lp.transport,
+		Packets:   lp.packets,
+	}
+	if lp.err != nil {
+		info.LiveProbe.Error = lp.err.Error()
+	}
+
+	for m, t := range lp.tracks {
+		mi := info.mediaByIndex(t.index)
+		if mi == nil {
+			continue
+		}
+		if t.rtp != nil {
+			t.rtp.sorted = lp.transport != "tcp" && !lp.wireOrder
+			if lp.stats != nil {
+				t.rtp.inError = lp.stats.Session.Medias[m].RTPPacketsInError
+			}
+		}
+		for _, a := range t.analyzers {
+			a.finish(mi, window)
+		}
+	}
+	lp.applySync(info)
+}
+
+// applySync compares the capture-to-arrival latency of each track with sender reports against a reference
+// track. Tracks stamped from the same clock arrive with similar latency; a difference is an A/V offset.
+func (lp *liveProbe) applySync(info *streamInfo) {
+	type synced struct {
+		index   int
+		video   bool
+		latency float64
+		info    *SenderReportInfo
+	}
+	var list []synced
+	for _, t := range lp.tracks {
+		mi := info.mediaByIndex(t.index)
+		if t.sr == nil || mi == nil || mi.RTCP == nil {
+			continue
+		}
+		if lat, ok := t.sr.latency(); ok {
+			list = append(list, synced{t.index, mi.Type == string(description.MediaTypeVideo), lat, mi.RTCP})
+		}
+	}
+	if len(list) < 2 {
+		return
+	}
+	// The reference is the first video track, or the first track when there is no video
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].video != list[j].video {
+			return list[i].video
+		}
+		return list[i].index < list[j].index
+	})
+	ref := list[0]
+	for _, s := range list[1:] {
+		index, offset := ref.index, (ref.latency-s.latency)*1000
+		s.info.SyncReference, s.info.SyncOffset = &index, &offset
+	}
+}
@@ -0,0 +1,167 @@
+package rtspeek
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/pion/rtp"
+)
+
+// playHandler serves a single stream for DESCRIBE, SETUP and PLAY.
+type playHandler struct {
+	stream *gortsplib.ServerStream
+
+	mu       sync.Mutex
+	sessions []*gortsplib.ServerSession
+}
+
+func (h *playHandler) OnDescribe(*gortsplib.ServerHandlerOnDescribeCtx) (*base.Response, *gortsplib.ServerStream, error) {
+	return &base.Response{StatusCode: base.StatusOK}, h.stream, nil
+}
+
+func (h *playHandler) OnSetup(*gortsplib.ServerHandlerOnSetupCtx) (*base.Response, *gortsplib.ServerStream, error) {
+	return &base.Response{StatusCode: base.StatusOK}, h.stream, nil
+}
+
+func (h *playHandler) OnPlay(ctx *gortsplib.ServerHandlerOnPlayCtx) (*base.Response, error) {
+	h.mu.Lock()
+	h.sessions = append(h.sessions, ctx.Session)
+	h.mu.Unlock()
+	return &base.Response{StatusCode: base.StatusOK}, nil
+}
+
+// closeSessions drops every playing client.
+func (h *playHandler) closeSessions() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, s := range h.sessions {
+		s.Close()
+	}
+	h.sessions = nil
+}
+
+// startPlayServer serves desc and calls produce every interval until the test ends.
+func startPlayServer(t *testing.T, desc *description.Session, interval time.Duration, produce func(stream *gortsplib.ServerStream, n int)) string {
+	t.Helper()
+	return startPlayServerWith(t, &playHandler{}, desc, interval, produce)
+}
+
+// startPlayServerWith is startPlayServer with a handler the test keeps hold of.
+func startPlayServerWith(t *testing.T, h *playHandler, desc *description.Session, interval time.Duration, produce func(stream *gortsplib.ServerStream, n int)) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	srv := &gortsplib.Server{Handler: h, RTSPAddress: addr}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	h.stream = gortsplib.NewServerStream(srv, desc)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for n := 0; ; n++ {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				produce(h.stream, n)
+			}
+		}
+	}()
+
+	t.Cleanup(func() {
+		close(done)
+		wg.Wait()
+		h.stream.Close()
+		srv.Close()
+	})
+	return "rtsp://" + addr + "/live"
+}
+
+func TestDescribeStreamLiveProbeMetadata(t *testing.T) {
+	desc := onvifSession()
+	metadataMedia := desc.Medias[1]
+	doc := []byte(sampleMetadataDoc)
+
+	url := startPlayServer(t, desc, 20*time.Millisecond, func(stream *gortsplib.ServerStream, n int) {
+		_ = stream.WritePacketRTP(metadataMedia, &rtp.Packet{
+			Header:  rtp.Header{Version: 2, PayloadType: 107, SequenceNumber: uint16(n), Timestamp: uint32(n * 1800), Marker: true},
+			Payload: doc,
+		})
+	})
+
+	ctx := WithLiveProbe(context.Background(), LiveProbeOptions{Duration: 500 * time.Millisecond, Transport: "tcp"})
+	info, err := DescribeStream(ctx, url, 2*time.Second)
+	if err != nil {
+		t.Fatalf("describe: %v", err)
+	}
+
+	live := info.GetLiveProbe()
+	if live == nil || live.Error != "" {
+		t.Fatalf("unexpected live probe result: %+v", live)
+	}
+	if live.Transport != "tcp" || live.Packets == 0 {
+		t.Fatalf("expected packets over tcp, got %+v", live)
+	}
+	if info.LatencyMs() >= 500 {
+		t.Fatalf("latency %.1fms includes the probe window", info.LatencyMs())
+	}
+
+	md := info.GetMediasByRole(MediaRoleONVIFMetadata)
+	if len(md) != 1 || md[0].Metadata == nil {
+		t.Fatalf("expected metadata summary, got %#v", md)
+	}
+	s := md[0].Metadata
+	if s.Documents == 0 || s.DocumentRate <= 0 {
+		t.Fatalf("expected documents, got %+v", s)
+	}
+	assertStrings(t, "classes", s.ObjectClasses, []string{"Human", "Vehicle"})
+}
+
+func TestLiveTrackSharedDecoder(t *testing.T) {
+	track := newLiveTrack(0, h264Media(), LiveProbeOptions{})
+	if track.decoder == nil || len(track.frames) != 2 {
+		t.Fatalf("expected one decoder feeding GOP and bitrate analysis, got %d frame analyzers", len(track.frames))
+	}
+	src := newH264Source(5)
+	start := time.Now()
+	for n := 0; n < 60; n++ {
+		for _, pkt := range src.frame(n) {
+			track.receive(pkt, start.Add(time.Duration(n)*40*time.Millisecond))
+		}
+	}
+	mi := &MediaInfo{}
+	for _, a := range track.analyzers {
+		a.finish(mi, 2400*time.Millisecond)
+	}
+	if mi.GOP == nil || mi.GOP.Frames != 60 || mi.GOP.Keyframes != 12 {
+		t.Fatalf("unexpected GOP: %+v", mi.GOP)
+	}
+	if mi.Bitrate == nil || mi.Bitrate.AvgFrameSize == 0 || mi.Bitrate.KeyframeRatio <= 1 {
+		t.Fatalf("expected frame sizes in the bitrate profile, got %+v", mi.Bitrate)
+	}
+}
+
+func TestDescribeStreamLiveProbeInvalidTransport(t *testing.T) {
+	ctx := WithLiveProbe(context.Background(), LiveProbeOptions{Duration: time.Second, Transport: "carrier-pigeon"})
+	if _, err := DescribeStream(ctx, "rtsp://127.0.0.1:1/x", time.Second); err == nil {
+		t.Fatal("expected transport validation error")
+	}
+}
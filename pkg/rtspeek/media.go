@@ -12,6 +12,7 @@ import (
 // classifyMedia extracts simplified media info.
 func classifyMedia(idx int, m *description.Media) (MediaInfo, error) {
 	mi := MediaInfo{Index: idx, Type: string(m.Type)}
+	mi.Role = detectMediaRole(m)
 	if len(m.Formats) > 0 {
 		f := m.Formats[0]
 		pt := f.PayloadType()
@@ -44,8 +45,42 @@ func classifyMedia(idx int, m *description.Media) (MediaInfo, error) {
 	return mi, nil
 }
 
+// detectMediaRole labels ONVIF backchannel, ONVIF metadata and KLV data tracks.
+func detectMediaRole(m *description.Media) string {
+	if m.IsBackChannel {
+		return MediaRoleBackchannel
+	}
+	for _, f := range m.Formats {
+		switch ct := f.(type) {
+		case *format.KLV:
+			return MediaRoleKLV
+		case *format.Generic:
+			switch strings.ToLower(rtpmapEncoding(ct.RTPMa)) {
+			case "vnd.onvif.metadata":
+				return MediaRoleONVIFMetadata
+			case "smpte336m":
+				return MediaRoleKLV
+			}
+		}
+	}
+	return ""
+}
+
+// rtpmapEncoding returns the encoding name of an rtpmap value ("vnd.onvif.metadata/90000").
+func rtpmapEncoding(rtpmap string) string {
+	enc, _, _ := strings.Cut(rtpmap, "/")
+	return strings.TrimSpace(enc)
+}
+
 // extractFormatName extracts a clean format name from the format interface.
+// Generic formats report their rtpmap encoding name since the type name says nothing.
 func extractFormatName(f format.Format) string {
+	if g, ok := f.(*format.Generic); ok {
+		if enc := rtpmapEncoding(g.RTPMa); enc != "" {
+			return enc
+		}
+	}
+
 	typeName := fmt.Sprintf("%T", f)
 
 	// Remove package prefix and pointer indicator
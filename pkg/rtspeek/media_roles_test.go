@@ -0,0 +1,119 @@
+package rtspeek
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+)
+
+func TestDetectMediaRole(t *testing.T) {
+	cases := []struct {
+		name  string
+		media *description.Media
+		want  string
+	}{
+		{
+			name:  "backchannel",
+			media: &description.Media{Type: description.MediaTypeAudio, IsBackChannel: true, Formats: []format.Format{&format.G711{PayloadTyp: 0, MULaw: true, SampleRate: 8000, ChannelCount: 1}}},
+			want:  MediaRoleBackchannel,
+		},
+		{
+			name:  "onvif_metadata",
+			media: &description.Media{Type: description.MediaTypeApplication, Formats: []format.Format{&format.Generic{PayloadTyp: 107, RTPMa: "vnd.onvif.metadata/90000"}}},
+			want:  MediaRoleONVIFMetadata,
+		},
+		{
+			name:  "klv",
+			media: &description.Media{Type: description.MediaTypeApplication, Formats: []format.Format{&format.KLV{PayloadTyp: 97}}},
+			want:  MediaRoleKLV,
+		},
+		{
+			name:  "plain_audio",
+			media: &description.Media{Type: description.MediaTypeAudio, Formats: []format.Format{&format.G711{PayloadTyp: 8, SampleRate: 8000, ChannelCount: 1}}},
+			want:  "",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			mi, err := classifyMedia(0, tc.media)
+			if err != nil {
+				t.Fatalf("classify: %v", err)
+			}
+			if mi.Role != tc.want {
+				t.Fatalf("expected role %q, got %q", tc.want, mi.Role)
+			}
+		})
+	}
+}
+
+func TestGenericFormatNameUsesRtpmap(t *testing.T) {
+	f := &format.Generic{PayloadTyp: 107, RTPMa: "vnd.onvif.metadata/90000"}
+	if got := extractFormatName(f); got != "vnd.onvif.metadata" {
+		t.Fatalf("expected rtpmap encoding, got %q", got)
+	}
+}
+
+func onvifSession() *description.Session {
+	metadata := &format.Generic{PayloadTyp: 107, RTPMa: "vnd.onvif.metadata/90000"}
+	_ = metadata.Init()
+	return &description.Session{Medias: []*description.Media{
+		{Type: description.MediaTypeVideo, Formats: []format.Format{&format.H264{PayloadTyp: 96, SPS: h264SPS360, PacketizationMode: 1}}},
+		{Type: description.MediaTypeApplication, Formats: []format.Format{metadata}},
+		{Type: description.MediaTypeAudio, IsBackChannel: true, Formats: []format.Format{&format.G711{PayloadTyp: 0, MULaw: true, SampleRate: 8000, ChannelCount: 1}}},
+	}}
+}
+
+func TestDescribeStreamBackchannel(t *testing.T) {
+	var server *gortsplib.Server
+	server, url := startDynamicServer(t, func(ctx *gortsplib.ServerHandlerOnDescribeCtx) (*base.Response, *gortsplib.ServerStream, error) {
+		return &base.Response{StatusCode: base.StatusOK}, gortsplib.NewServerStream(server, onvifSession()), nil
+	})
+	defer server.Close()
+
+	info, err := DescribeStream(context.Background(), url, 1500*time.Millisecond)
+	if err != nil {
+		t.Fatalf("describe: %v", err)
+	}
+	if info.HasBackchannel() {
+		t.Fatal("backchannel must not be listed unless requested")
+	}
+	if got := info.GetMediasByRole(MediaRoleONVIFMetadata); len(got) != 1 || got[0].Format != "vnd.onvif.metadata" {
+		t.Fatalf("expected one ONVIF metadata media, got %#v", got)
+	}
+
+	info, err = DescribeStream(WithBackchannel(context.Background()), url, 1500*time.Millisecond)
+	if err != nil {
+		t.Fatalf("describe with backchannel: %v", err)
+	}
+	if !HasBackchannel(info) {
+		t.Fatalf("expected backchannel media, got %#v", info.GetMedias())
+	}
+	bc := info.GetMediasByRole(MediaRoleBackchannel)[0]
+	if bc.Type != "audio" || bc.Direction != "sendonly" {
+		t.Fatalf("unexpected backchannel media: %#v", bc)
+	}
+}
+
+func TestDescribeStreamBackchannelFallback(t *testing.T) {
+	var server *gortsplib.Server
+	server, url := startDynamicServer(t, func(ctx *gortsplib.ServerHandlerOnDescribeCtx) (*base.Response, *gortsplib.ServerStream, error) {
+		if _, ok := ctx.Request.Header["Require"]; ok {
+			return &base.Response{StatusCode: base.StatusOptionNotSupported}, nil, nil
+		}
+		return &base.Response{StatusCode: base.StatusOK}, gortsplib.NewServerStream(server, onvifSession()), nil
+	})
+	defer server.Close()
+
+	info, err := DescribeStream(WithBackchannel(context.Background()), url, 1500*time.Millisecond)
+	if err != nil {
+		t.Fatalf("expected fallback describe to succeed, got %v", err)
+	}
+	if info.HasBackchannel() {
+		t.Fatal("server without backchannel support must not report one")
+	}
+}
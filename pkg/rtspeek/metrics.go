@@ -0,0 +1,230 @@
+package rtspeek
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Metric is a single labelled gauge sample derived from a probe result.
+type Metric struct {
+	Name   string
+	Help   string
+	Labels map[string]string
+	Value  float64
+}
+
+// CollectMetrics flattens a probe result into gauges named rtpeek_*. Every sample carries a url label;
+// per-track samples add media (SDP index) and format.
+func CollectMetrics(info StreamInfo) []Metric {
+	if info == nil {
+		return nil
+	}
+	base := map[string]string{"url": info.GetURLString()}
+	metrics := []Metric{
+		{Name: "rtpeek_reachable", Help: "Whether the RTSP port accepted a connection.", Labels: base, Value: boolValue(info.IsReachable())},
+		{Name: "rtpeek_describe_ok", Help: "Whether DESCRIBE succeeded.", Labels: base, Value: boolValue(info.IsDescribeSucceeded())},
+		{Name: "rtpeek_describe_latency_seconds", Help: "DESCRIBE round-trip time.", Labels: base, Value: info.LatencyMs() / 1000},
+	}
+
+	if live := info.GetLiveProbe(); live != nil {
+		metrics = append(metrics,
+			Metric{Name: "rtpeek_live_probe_seconds", Help: "Time spent receiving during the live probe.", Labels: base, Value: live.Duration},
+			Metric{Name: "rtpeek_live_probe_packets", Help: "RTP packets received during the live probe.", Labels: base, Value: float64(live.Packets)},
+		)
+	}
+
+	for _, mi := range info.GetMedias() {
+		labels := map[string]string{"url": info.GetURLString(), "media": strconv.Itoa(mi.Index), "format": mi.Format}
+		if mi.RTP != nil {
+			metrics = append(metrics, rtpMetrics(mi.RTP, labels)...)
+		}
+		if mi.RTCP != nil {
+			metrics = append(metrics, rtcpMetrics(mi.RTCP, labels)...)
+		}
+		if mi.Timing != nil {
+			metrics = append(metrics, timingMetrics(mi.Timing, labels)...)
+		}
+		if mi.Bitrate != nil {
+			metrics = append(metrics, bitrateMetrics(mi.Bitrate, labels)...)
+		}
+	}
+	return metrics
+}
+
+// CollectTargetMetrics is CollectMetrics for a configured target. Every sample also carries the target
+// label (and site, if set), and url is stripped of credentials. rtpeek_target_up is 1 when the target is up
+// as history and alerts count it: DESCRIBE succeeded and its expectations, if any, passed.
+func CollectTargetMetrics(r TargetResult) []Metric {
+	extra := map[string]string{"target": r.Target.Name, "url": r.URL}
+	if r.Target.Site != "" {
+		extra["site"] = r.Target.Site
+	}
+	metrics := []Metric{{Name: "rtpeek_target_up", Help: "Whether the target was up at its last probe.", Value: boolValue(NewHistoryRecord(r).OK)}}
+	if r.Expect != nil {
+		metrics = append(metrics, Metric{Name: "rtpeek_expectations_failed", Help: "Expectations the last probe failed.", Value: float64(r.Expect.Failed)})
+	}
+	metrics = append(metrics, CollectMetrics(r.Info)...)
+	for i := range metrics {
+		labels := maps.Clone(metrics[i].Labels)
+		if labels == nil {
+			labels = make(map[string]string, len(extra))
+		}
+		maps.Copy(labels, extra)
+		metrics[i].Labels = labels
+	}
+	return metrics
+}
+
+// rtpMetrics converts the RTP statistics of one track.
+func rtpMetrics(st *RTPStats, labels map[string]string) []Metric {
+	m := func(name, help string, v float64) Metric {
+		return Metric{Name: name, Help: help, Labels: labels, Value: v}
+	}
+	list := []Metric{
+		m("rtpeek_rtp_packets", "RTP packets received.", float64(st.Packets)),
+		m("rtpeek_rtp_expected_packets", "RTP packets expected from sequence numbers.", float64(st.Expected)),
+		m("rtpeek_rtp_lost_packets", "RTP packets missing from the sequence.", float64(st.Lost)),
+		m("rtpeek_rtp_loss_ratio", "Lost packets divided by expected packets.", st.LossRate),
+		m("rtpeek_rtp_gaps", "Sequence discontinuities (loss bursts).", float64(st.Gaps)),
+		m("rtpeek_rtp_max_gap_packets", "Largest loss burst.", float64(st.MaxGap)),
+		m("rtpeek_rtp_in_error_packets", "RTP packets rejected by the client.", float64(st.InError)),
+		m("rtpeek_rtp_ssrc_changes", "Distinct SSRCs seen after the first one.", float64(st.SSRCChanges)),
+		m("rtpeek_rtp_jitter_seconds", "RFC 3550 interarrival jitter at the end of the probe.", st.Jitter/1000),
+		m("rtpeek_rtp_max_jitter_seconds", "Highest interarrival jitter during the probe.", st.MaxJitter/1000),
+		m("rtpeek_rtp_marker_rate", "Marker-bit packets per second.", st.MarkerRate),
+		m("rtpeek_rtp_marker_interval_stddev_seconds", "Standard deviation of the time between marker-bit packets.", st.MarkerIntervalStdDev/1000),
+	}
+	if st.Reordered != nil {
+		list = append(list, m("rtpeek_rtp_reordered_packets", "RTP packets received out of order.", float64(*st.Reordered)))
+	}
+	if st.Duplicates != nil {
+		list = append(list, m("rtpeek_rtp_duplicate_packets", "Duplicate RTP packets received.", float64(*st.Duplicates)))
+	}
+	return list
+}
+
+// rtcpMetrics converts the sender report analysis of one track.
+func rtcpMetrics(sr *SenderReportInfo, labels map[string]string) []Metric {
+	m := func(name, help string, v float64) Metric {
+		return Metric{Name: name, Help: help, Labels: labels, Value: v}
+	}
+	list := []Metric{
+		m("rtpeek_rtcp_sender_reports", "RTCP sender reports received.", float64(sr.SenderReports)),
+		m("rtpeek_rtcp_ntp_invalid", "Whether the sender report wall clock predates 2000.", boolValue(sr.NTPInvalid)),
+		m("rtpeek_rtcp_clock_offset_seconds", "Camera wall clock minus probe host clock.", sr.ClockOffset/1000),
+	}
+	if sr.ClockDrift != nil {
+		list = append(list, m("rtpeek_rtcp_clock_drift_ppm", "Camera wall clock drift against the host clock.", *sr.ClockDrift))
+	}
+	if sr.RTPDrift != nil {
+		list = append(list, m("rtpeek_rtcp_rtp_drift_ppm", "RTP clock drift against the camera wall clock.", *sr.RTPDrift))
+	}
+	if sr.SyncOffset != nil {
+		list = append(list, m("rtpeek_rtcp_sync_offset_seconds", "Timestamp offset against the reference track.", *sr.SyncOffset/1000))
+	}
+	return list
+}
+
+// timingMetrics converts the timestamp sanity checks of one track.
+func timingMetrics(ti *TimingInfo, labels map[string]string) []Metric {
+	m := func(name, help string, v float64) Metric {
+		return Metric{Name: name, Help: help, Labels: labels, Value: v}
+	}
+	list := []Metric{
+		m("rtpeek_timing_backwards", "RTP timestamp backward steps beyond B-frame reordering.", float64(ti.Backwards)),
+		m("rtpeek_timing_jumps", "RTP timestamp jumps against arrival time.", float64(ti.Jumps)),
+		m("rtpeek_timing_findings", "Timestamp sanity findings.", float64(len(ti.Findings))),
+	}
+	if ti.MeasuredFPS > 0 {
+		list = append(list, m("rtpeek_timing_measured_fps", "Frame rate measured from RTP timestamps.", ti.MeasuredFPS))
+	}
+	return list
+}
+
+// bitrateMetrics converts the bitrate profile of one track.
+func bitrateMetrics(br *BitrateInfo, labels map[string]string) []Metric {
+	m := func(name, help string, v float64) Metric {
+		return Metric{Name: name, Help: help, Labels: labels, Value: v}
+	}
+	list := []Metric{
+		m("rtpeek_bitrate_min_bps", "Lowest one-second bitrate.", br.Min),
+		m("rtpeek_bitrate_avg_bps", "Average bitrate.", br.Avg),
+		m("rtpeek_bitrate_max_bps", "Highest one-second bitrate.", br.Max),
+		m("rtpeek_bitrate_p95_bps", "95th percentile of the one-second bitrates.", br.P95),
+		m("rtpeek_bitrate_peak_to_average", "Highest one-second bitrate divided by the average.", br.PeakToAverage),
+	}
+	if br.KeyframeRatio > 0 {
+		list = append(list, m("rtpeek_bitrate_keyframe_ratio", "Average keyframe size divided by average frame size.", br.KeyframeRatio))
+	}
+	return list
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// WritePrometheus writes metrics in the Prometheus text exposition format. Samples sharing a name are
+// grouped under one HELP/TYPE header in order of first appearance.
+func WritePrometheus(w io.Writer, metrics []Metric) error {
+	var names []string
+	groups := make(map[string][]Metric)
+	for _, m := range metrics {
+		if _, ok := groups[m.Name]; !ok {
+			names = append(names, m.Name)
+		}
+		groups[m.Name] = append(groups[m.Name], m)
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		group := groups[name]
+		if help := group[0].Help; help != "" {
+			fmt.Fprintf(bw, "# HELP %s %s\n", name, help)
+		}
+		fmt.Fprintf(bw, "# TYPE %s gauge\n", name)
+		for _, m := range group {
+			fmt.Fprintf(bw, "%s%s %s\n", name, formatLabels(m.Labels), formatValue(m.Value))
+		}
+	}
+	return bw.Flush()
+}
+
+// formatLabels renders {k="v",...} with sorted keys and escaped values.
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf(`%s="%s"`, k, escaper.Replace(labels[k]))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,202 @@
+package rtspeek
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Notifier delivery defaults.
+const (
+	// DefaultNotifyTimeout bounds one delivery attempt.
+	DefaultNotifyTimeout = 10 * time.Second
+	// DefaultWebhookBackoff is the wait before the first retry of a webhook; it doubles on each retry.
+	DefaultWebhookBackoff = time.Second
+)
+
+// Notifier delivers alert events.
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, ev AlertEvent) error
+}
+
+// Webhook payload formats.
+const (
+	WebhookJSON  = "json"  // the event itself, or the rendered Body template
+	WebhookSlack = "slack" // Slack incoming webhook ({"text": ...}); also accepted by Mattermost and Rocket.Chat
+	WebhookTeams = "teams" // Microsoft Teams connector MessageCard
+)
+
+// WebhookNotifier POSTs events to a URL. Failed deliveries (network errors, 429 and 5xx answers) are
+// retried Retries times with exponential backoff.
+type WebhookNotifier struct {
+	URL    string
+	Format string // WebhookJSON (default), WebhookSlack or WebhookTeams
+	// Body, for WebhookJSON, renders the payload instead of the event JSON. It is executed with the
+	// AlertEvent; the json function quotes a value, e.g. {"camera": {{json .Target}}}.
+	Body    *template.Template
+	Headers map[string]string
+	Retries int
+	Backoff time.Duration // DefaultWebhookBackoff if 0
+	Timeout time.Duration // per attempt, DefaultNotifyTimeout if 0
+	Client  *http.Client  // http.DefaultClient if nil
+}
+
+// ParseWebhookBody parses a Body template, providing the json function.
+func ParseWebhookBody(text string) (*template.Template, error) {
+	return template.New("body").Funcs(template.FuncMap{
+		"json": func(v any) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(text)
+}
+
+func (w *WebhookNotifier) Name() string {
+	if w.Format == "" {
+		return "webhook"
+	}
+	return w.Format
+}
+
+// Notify delivers ev, retrying as configured.
+func (w *WebhookNotifier) Notify(ctx context.Context, ev AlertEvent) error {
+	payload, err := w.payload(ev)
+	if err != nil {
+		return err
+	}
+	backoff := w.Backoff
+	if backoff <= 0 {
+		backoff = DefaultWebhookBackoff
+	}
+	for attempt := 0; ; attempt++ {
+		retry, err := w.post(ctx, payload)
+		if err == nil || !retry || attempt >= w.Retries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff << attempt):
+		}
+	}
+}
+
+// post makes one attempt and tells whether a failure is worth retrying.
+func (w *WebhookNotifier) post(ctx context.Context, payload []byte) (bool, error) {
+	timeout := w.Timeout
+	if timeout <= 0 {
+		timeout = DefaultNotifyTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(payload))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.Headers {
+		req.Header.Set(k, v)
+	}
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	if res.StatusCode/100 == 2 {
+		return false, nil
+	}
+	return res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500,
+		fmt.Errorf("webhook answered %s", res.Status)
+}
+
+func (w *WebhookNotifier) payload(ev AlertEvent) ([]byte, error) {
+	switch w.Format {
+	case WebhookSlack:
+		return json.Marshal(map[string]any{"text": alertEmoji(ev) + " " + ev.Summary()})
+	case WebhookTeams:
+		color := "D93F0B"
+		if ev.State == AlertStateUp {
+			color = "2EB67D"
+		}
+		facts := []map[string]string{{"name": "URL", "value": ev.URL}}
+		if ev.Site != "" {
+			facts = append(facts, map[string]string{"name": "Site", "value": ev.Site})
+		}
+		if ev.Error != "" {
+			facts = append(facts, map[string]string{"name": "Error", "value": ev.Error})
+		}
+		return json.Marshal(map[string]any{
+			"@type":      "MessageCard",
+			"@context":   "https://schema.org/extensions",
+			"summary":    ev.Summary(),
+			"themeColor": color,
+			"title":      ev.Summary(),
+			"sections":   []map[string]any{{"facts": facts}},
+		})
+	}
+	if w.Body == nil {
+		return json.Marshal(ev)
+	}
+	var b bytes.Buffer
+	if err := w.Body.Execute(&b, ev); err != nil {
+		return nil, fmt.Errorf("render webhook body: %w", err)
+	}
+	return b.Bytes(), nil
+}
+
+func alertEmoji(ev AlertEvent) string {
+	if ev.State == AlertStateUp {
+		return ":white_check_mark:"
+	}
+	return ":red_circle:"
+}
+
+// ExecNotifier runs a local command per event, with the event JSON on stdin and RTSPEEK_TARGET,
+// RTSPEEK_STATE and RTSPEEK_SUMMARY in its environment. A non-zero exit status is a failed delivery.
+type ExecNotifier struct {
+	Command []string
+	Timeout time.Duration // DefaultNotifyTimeout if 0
+}
+
+func (x *ExecNotifier) Name() string { return "exec" }
+
+// Notify runs the command and waits for it.
+func (x *ExecNotifier) Notify(ctx context.Context, ev AlertEvent) error {
+	if len(x.Command) == 0 {
+		return fmt.Errorf("exec notifier has no command")
+	}
+	timeout := x.Timeout
+	if timeout <= 0 {
+		timeout = DefaultNotifyTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, x.Command[0], x.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Env = append(os.Environ(), "RTSPEEK_TARGET="+ev.Target, "RTSPEEK_STATE="+ev.State, "RTSPEEK_SUMMARY="+ev.Summary())
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%s: %w: %s", x.Command[0], err, msg)
+		}
+		return fmt.Errorf("%s: %w", x.Command[0], err)
+	}
+	return nil
+}
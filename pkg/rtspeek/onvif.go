@@ -0,0 +1,461 @@
+package rtspeek
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxONVIFResponse bounds the size of a SOAP response.
+const maxONVIFResponse = 4 << 20
+
+// ONVIF namespaces used in requests.
+const (
+	onvifNSSoap   = "http://www.w3.org/2003/05/soap-envelope"
+	onvifNSDevice = "http://www.onvif.org/ver10/device/wsdl"
+	onvifNSMedia  = "http://www.onvif.org/ver10/media/wsdl"
+	onvifNSSchema = "http://www.onvif.org/ver10/schema"
+	onvifNSWSSE   = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd"
+	onvifNSWSU    = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd"
+	onvifDigest   = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#PasswordDigest"
+	onvifBase64   = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-soap-message-security-1.0#Base64Binary"
+)
+
+// ONVIFClient calls the device and media services of an ONVIF device, authenticating with a WS-Security
+// UsernameToken. Tokens are dated on the device clock, which is read once with GetSystemDateAndTime.
+type ONVIFClient struct {
+	// DeviceURL is the device service endpoint, e.g. http://192.168.1.20/onvif/device_service.
+	DeviceURL string
+
+	user, pass string
+	http       *http.Client
+
+	clockOnce sync.Once
+	offset    time.Duration // device clock minus local clock
+}
+
+// NewONVIFClient creates a client for address: a device service URL, or a host[:port] whose device service
+// is at the standard /onvif/device_service path.
+func NewONVIFClient(address, user, pass string, timeout time.Duration) (*ONVIFClient, error) {
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	u, err := url.Parse(address)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid ONVIF device address %q", address)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/onvif/device_service"
+	}
+	if u.User != nil && user == "" {
+		user = u.User.Username()
+		pass, _ = u.User.Password()
+	}
+	u.User = nil
+	return &ONVIFClient{DeviceURL: u.String(), user: user, pass: pass, http: &http.Client{Timeout: timeout}}, nil
+}
+
+// ONVIFCapabilities are the service addresses and streaming capabilities reported by GetCapabilities.
+type ONVIFCapabilities struct {
+	MediaURL     string `json:"media_url"`
+	EventsURL    string `json:"events_url,omitempty"`
+	PTZURL       string `json:"ptz_url,omitempty"`
+	RTPMulticast bool   `json:"rtp_multicast"`
+	RTPTCP       bool   `json:"rtp_tcp"`
+	RTPRTSPTCP   bool   `json:"rtp_rtsp_tcp"`
+}
+
+// ONVIFProfile is a media profile from GetProfiles.
+type ONVIFProfile struct {
+	Token string             `json:"token"`
+	Name  string             `json:"name"`
+	Video *ONVIFVideoEncoder `json:"video,omitempty"`
+}
+
+// ONVIFVideoEncoder is the video encoder configuration of a profile.
+type ONVIFVideoEncoder struct {
+	Encoding   string `json:"encoding"` // H264, H265, JPEG or MPEG4
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+	FrameRate  int    `json:"frame_rate,omitempty"`   // FrameRateLimit
+	Bitrate    int    `json:"bitrate_kbps,omitempty"` // BitrateLimit
+	GovLength  int    `json:"gov_length,omitempty"`
+	CodecLevel string `json:"profile,omitempty"` // H264Profile or Mpeg4Profile
+}
+
+// GetCapabilities returns the service addresses of the device. Addresses pointing at another host than
+// DeviceURL (devices behind NAT often report their private address) are rewritten to the DeviceURL host.
+func (c *ONVIFClient) GetCapabilities(ctx context.Context) (*ONVIFCapabilities, error) {
+	var res struct {
+		Media struct {
+			XAddr     string `xml:"XAddr"`
+			Streaming struct {
+				RTPMulticast bool `xml:"RTPMulticast"`
+				RTPTCP       bool `xml:"RTP_TCP"`
+				RTPRTSPTCP   bool `xml:"RTP_RTSP_TCP"`
+			} `xml:"StreamingCapabilities"`
+		} `xml:"Body>GetCapabilitiesResponse>Capabilities>Media"`
+		Events string `xml:"Body>GetCapabilitiesResponse>Capabilities>Events>XAddr"`
+		PTZ    string `xml:"Body>GetCapabilitiesResponse>Capabilities>PTZ>XAddr"`
+	}
+	body := `<tds:GetCapabilities><tds:Category>All</tds:Category></tds:GetCapabilities>`
+	if err := c.call(ctx, c.DeviceURL, "GetCapabilities", body, &res); err != nil {
+		return nil, err
+	}
+	if res.Media.XAddr == "" {
+		return nil, errors.New("onvif GetCapabilities: device has no media service")
+	}
+	return &ONVIFCapabilities{
+		MediaURL:     c.localXAddr(res.Media.XAddr),
+		EventsURL:    c.localXAddr(res.Events),
+		PTZURL:       c.localXAddr(res.PTZ),
+		RTPMulticast: res.Media.Streaming.RTPMulticast,
+		RTPTCP:       res.Media.Streaming.RTPTCP,
+		RTPRTSPTCP:   res.Media.Streaming.RTPRTSPTCP,
+	}, nil
+}
+
+// GetProfiles returns the media profiles served by the media service at mediaURL.
+func (c *ONVIFClient) GetProfiles(ctx context.Context, mediaURL string) ([]ONVIFProfile, error) {
+	var res struct {
+		Profiles []struct {
+			Token string `xml:"token,attr"`
+			Name  string `xml:"Name"`
+			Video *struct {
+				Encoding   string `xml:"Encoding"`
+				Width      int    `xml:"Resolution>Width"`
+				Height     int    `xml:"Resolution>Height"`
+				FrameRate  int    `xml:"RateControl>FrameRateLimit"`
+				Bitrate    int    `xml:"RateControl>BitrateLimit"`
+				H264Gov    int    `xml:"H264>GovLength"`
+				H264Level  string `xml:"H264>H264Profile"`
+				MPEG4Gov   int    `xml:"MPEG4>GovLength"`
+				MPEG4Level string `xml:"MPEG4>Mpeg4Profile"`
+			} `xml:"VideoEncoderConfiguration"`
+		} `xml:"Body>GetProfilesResponse>Profiles"`
+	}
+	if err := c.call(ctx, mediaURL, "GetProfiles", `<trt:GetProfiles/>`, &res); err != nil {
+		return nil, err
+	}
+	profiles := make([]ONVIFProfile, 0, len(res.Profiles))
+	for _, p := range res.Profiles {
+		profile := ONVIFProfile{Token: p.Token, Name: p.Name}
+		if v := p.Video; v != nil && v.Encoding != "" {
+			profile.Video = &ONVIFVideoEncoder{
+				Encoding:   v.Encoding,
+				Width:      v.Width,
+				Height:     v.Height,
+				FrameRate:  v.FrameRate,
+				Bitrate:    v.Bitrate,
+				GovLength:  max(v.H264Gov, v.MPEG4Gov),
+				CodecLevel: v.H264Level + v.MPEG4Level,
+			}
+		}
+		profiles = append(profiles, profile)
+	}
+	return profiles, nil
+}
+
+// GetStreamURI returns the RTSP URI of a profile for unicast RTP over RTSP.
+func (c *ONVIFClient) GetStreamURI(ctx context.Context, mediaURL, profileToken string) (string, error) {
+	var res struct {
+		URI string `xml:"Body>GetStreamUriResponse>MediaUri>Uri"`
+	}
+	body := `<trt:GetStreamUri><trt:StreamSetup><tt:Stream>RTP-Unicast</tt:Stream><tt:Transport><tt:Protocol>RTSP</tt:Protocol>` +
+		`</tt:Transport></trt:StreamSetup><trt:ProfileToken>` + xmlEscape(profileToken) + `</trt:ProfileToken></trt:GetStreamUri>`
+	if err := c.call(ctx, mediaURL, "GetStreamUri", body, &res); err != nil {
+		return "", err
+	}
+	if res.URI == "" {
+		return "", errors.New("onvif GetStreamUri: empty URI")
+	}
+	return strings.TrimSpace(res.URI), nil
+}
+
+// localXAddr points a service address on another host at the host of DeviceURL.
+func (c *ONVIFClient) localXAddr(xaddr string) string {
+	fields := strings.Fields(xaddr) // several addresses may be listed
+	if len(fields) == 0 {
+		return ""
+	}
+	u, err := url.Parse(fields[0])
+	if err != nil {
+		return fields[0]
+	}
+	dev, _ := url.Parse(c.DeviceURL)
+	if u.Hostname() != dev.Hostname() {
+		u.Scheme, u.Host = dev.Scheme, dev.Host
+	}
+	return u.String()
+}
+
+// syncClock reads the device clock so that tokens are not rejected as stale by devices with a wrong time.
+// Failures leave the local clock in use.
+func (c *ONVIFClient) syncClock(ctx context.Context) {
+	c.clockOnce.Do(func() {
+		var res struct {
+			Time struct {
+				Hour   int `xml:"Time>Hour"`
+				Minute int `xml:"Time>Minute"`
+				Second int `xml:"Time>Second"`
+				Year   int `xml:"Date>Year"`
+				Month  int `xml:"Date>Month"`
+				Day    int `xml:"Date>Day"`
+			} `xml:"Body>GetSystemDateAndTimeResponse>SystemDateAndTime>UTCDateTime"`
+		}
+		if err := c.post(ctx, c.DeviceURL, "GetSystemDateAndTime", "", `<tds:GetSystemDateAndTime/>`, &res); err != nil {
+			return
+		}
+		t := res.Time
+		if t.Year == 0 {
+			return
+		}
+		device := time.Date(t.Year, time.Month(t.Month), t.Day, t.Hour, t.Minute, t.Second, 0, time.UTC)
+		if off := time.Until(device); math.Abs(off.Seconds()) > 2 {
+			c.offset = off
+		}
+	})
+}
+
+// call performs an operation, authenticated when the client has credentials.
+func (c *ONVIFClient) call(ctx context.Context, endpoint, op, body string, out any) error {
+	header := ""
+	if c.user != "" {
+		c.syncClock(ctx)
+		header = c.usernameToken()
+	}
+	return c.post(ctx, endpoint, op, header, body, out)
+}
+
+// usernameToken builds the WS-Security header: the password digest is Base64(SHA1(nonce + created + password)).
+func (c *ONVIFClient) usernameToken() string {
+	nonce := make([]byte, 16)
+	_, _ = rand.Read(nonce)
+	created := time.Now().Add(c.offset).UTC().Format("2006-01-02T15:04:05.000Z")
+	h := sha1.New()
+	h.Write(nonce)
+	h.Write([]byte(created))
+	h.Write([]byte(c.pass))
+	return `<wsse:Security s:mustUnderstand="1" xmlns:wsse="` + onvifNSWSSE + `" xmlns:wsu="` + onvifNSWSU + `">` +
+		`<wsse:UsernameToken><wsse:Username>` + xmlEscape(c.user) + `</wsse:Username>` +
+		`<wsse:Password Type="` + onvifDigest + `">` + base64.StdEncoding.EncodeToString(h.Sum(nil)) + `</wsse:Password>` +
+		`<wsse:Nonce EncodingType="` + onvifBase64 + `">` + base64.StdEncoding.EncodeToString(nonce) + `</wsse:Nonce>` +
+		`<wsu:Created>` + created + `</wsu:Created></wsse:UsernameToken></wsse:Security>`
+}
+
+// soapFault is the part of a SOAP 1.2 fault reported in errors.
+type soapFault struct {
+	Code    string `xml:"Code>Value"`
+	Subcode string `xml:"Code>Subcode>Value"`
+	Reason  string `xml:"Reason>Text"`
+}
+
+// post sends a SOAP envelope and decodes the response envelope into out.
+func (c *ONVIFClient) post(ctx context.Context, endpoint, op, header, body string, out any) error {
+	envelope := `<?xml version="1.0" encoding="UTF-8"?><s:Envelope xmlns:s="` + onvifNSSoap + `" xmlns:tds="` + onvifNSDevice +
+		`" xmlns:trt="` + onvifNSMedia + `" xmlns:tt="` + onvifNSSchema + `"><s:Header>` + header + `</s:Header><s:Body>` +
+		body + `</s:Body></s:Envelope>`
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(envelope))
+	if err != nil {
+		return fmt.Errorf("onvif %s: %w", op, err)
+	}
+	req.Header.Set("Content-Type", `application/soap+xml; charset=utf-8; action="`+onvifAction(op)+`"`)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("onvif %s: %w", op, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxONVIFResponse))
+	if err != nil {
+		return fmt.Errorf("onvif %s: %w", op, err)
+	}
+
+	var fault struct {
+		Fault *soapFault `xml:"Body>Fault"`
+	}
+	if xml.Unmarshal(data, &fault) == nil && fault.Fault != nil {
+		f := fault.Fault
+		if strings.Contains(f.Subcode, "NotAuthorized") {
+			return fmt.Errorf("onvif %s: unauthorized: %s", op, strings.TrimSpace(f.Reason))
+		}
+		return fmt.Errorf("onvif %s: fault %s %s: %s", op, f.Code, f.Subcode, strings.TrimSpace(f.Reason))
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("onvif %s: unauthorized (HTTP 401)", op)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("onvif %s: HTTP %d", op, resp.StatusCode)
+	}
+	if err := xml.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("onvif %s: invalid response: %w", op, err)
+	}
+	return nil
+}
+
+// onvifAction returns the SOAP action of an operation.
+func onvifAction(op string) string {
+	switch op {
+	case "GetProfiles", "GetStreamUri":
+		return onvifNSMedia + "/" + op
+	}
+	return onvifNSDevice + "/" + op
+}
+
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// ONVIFReport is the result of ProbeONVIF.
+type ONVIFReport struct {
+	Device       string              `json:"device"`
+	Capabilities *ONVIFCapabilities  `json:"capabilities"`
+	Profiles     []ONVIFProfileCheck `json:"profiles"`
+	Mismatches   int                 `json:"mismatches"` // profiles whose stream differs from its configuration
+	Failures     int                 `json:"failures"`   // profiles whose stream could not be described
+}
+
+// ONVIFProfileCheck compares what a profile declares with what its stream actually carries.
+type ONVIFProfileCheck struct {
+	ONVIFProfile
+	URI        string         `json:"uri,omitempty"` // without credentials
+	DescribeOK bool           `json:"describe_ok"`
+	Failure    string         `json:"failure,omitempty"` // error classification
+	Error      string         `json:"error,omitempty"`
+	Actual     *ONVIFObserved `json:"actual,omitempty"`
+	Match      bool           `json:"match"`
+	Mismatches []string       `json:"mismatches,omitempty"`
+	Stream     StreamInfo     `json:"-"`
+}
+
+// ONVIFObserved is the video a stream carries according to its SDP and SPS.
+type ONVIFObserved struct {
+	Codec      string   `json:"codec,omitempty"`
+	Resolution string   `json:"resolution,omitempty"`
+	FrameRate  *float64 `json:"frame_rate,omitempty"` // from the SDP, when declared
+}
+
+// ProbeONVIF resolves the RTSP URI of every media profile of an ONVIF device, describes each with
+// DescribeStream (so ctx options such as WithLiveProbe apply) and compares the video encoder configuration
+// declared by ONVIF with the codec and resolution found in the SDP and SPS. The credentials are used for
+// both the ONVIF calls and the RTSP URIs. Only device-level failures are returned as errors; a profile
+// that cannot be resolved or described is reported in its ONVIFProfileCheck.
+func ProbeONVIF(ctx context.Context, address, user, pass string, timeout time.Duration) (*ONVIFReport, error) {
+	client, err := NewONVIFClient(address, user, pass, timeout)
+	if err != nil {
+		return nil, err
+	}
+	caps, err := client.GetCapabilities(ctx)
+	if err != nil {
+		return nil, err
+	}
+	profiles, err := client.GetProfiles(ctx, caps.MediaURL)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ONVIFReport{Device: client.DeviceURL, Capabilities: caps, Profiles: []ONVIFProfileCheck{}}
+	for _, p := range profiles {
+		check := ONVIFProfileCheck{ONVIFProfile: p}
+		uri, err := client.GetStreamURI(ctx, caps.MediaURL, p.Token)
+		if err == nil {
+			check.URI = uriWithoutUser(uri)
+			var info StreamInfo
+			info, err = DescribeStream(ctx, uriWithUser(uri, client.user, client.pass), timeout)
+			check.Stream = info
+			if err == nil && info != nil && info.IsDescribeSucceeded() {
+				check.DescribeOK = true
+				check.Actual = observeVideo(info)
+				check.Mismatches = compareONVIFVideo(p.Video, check.Actual)
+				check.Match = len(check.Mismatches) == 0
+			} else if err == nil {
+				err = errors.New("describe failed")
+			}
+		}
+		if err != nil {
+			check.Failure = classifyError(err)
+			check.Error = err.Error()
+			report.Failures++
+		} else if !check.Match {
+			report.Mismatches++
+		}
+		report.Profiles = append(report.Profiles, check)
+	}
+	return report, nil
+}
+
+// uriWithUser adds credentials to a stream URI that has none.
+func uriWithUser(uri, user, pass string) string {
+	u, err := url.Parse(uri)
+	if err != nil || user == "" || u.User != nil {
+		return uri
+	}
+	u.User = url.UserPassword(user, pass)
+	return u.String()
+}
+
+// uriWithoutUser strips credentials from a stream URI.
+func uriWithoutUser(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	u.User = nil
+	return u.String()
+}
+
+// observeVideo summarizes the first video track of a described stream.
+func observeVideo(info StreamInfo) *ONVIFObserved {
+	v := info.GetFirstVideoMedia()
+	if v == nil {
+		return &ONVIFObserved{}
+	}
+	obs := &ONVIFObserved{Codec: v.Format, FrameRate: v.Framerate}
+	if v.Resolution != nil {
+		obs.Resolution = v.Resolution.String()
+	} else if v.Dimensions != nil {
+		obs.Resolution = v.Dimensions.String()
+	}
+	return obs
+}
+
+// onvifEncodings maps ONVIF encodings to the format names of MediaInfo.
+var onvifEncodings = map[string]string{"H264": "H264", "H265": "H265", "JPEG": "MJPEG", "MPEG4": "MPEG4Video"}
+
+// compareONVIFVideo lists the differences between a declared encoder configuration and the observed video.
+func compareONVIFVideo(declared *ONVIFVideoEncoder, actual *ONVIFObserved) []string {
+	if declared == nil {
+		return nil
+	}
+	if actual.Codec == "" {
+		return []string{fmt.Sprintf("video: onvif declares %s, stream has no video track", declared.Encoding)}
+	}
+	var out []string
+	want, ok := onvifEncodings[strings.ToUpper(declared.Encoding)]
+	if !ok {
+		want = declared.Encoding
+	}
+	if !strings.EqualFold(want, actual.Codec) {
+		out = append(out, fmt.Sprintf("encoding: onvif %s, stream %s", declared.Encoding, actual.Codec))
+	}
+	if res := (Resolution{Width: declared.Width, Height: declared.Height}).String(); declared.Width > 0 && actual.Resolution != "" && res != actual.Resolution {
+		out = append(out, fmt.Sprintf("resolution: onvif %s, stream %s", res, actual.Resolution))
+	}
+	if declared.FrameRate > 0 && actual.FrameRate != nil && math.Abs(*actual.FrameRate-float64(declared.FrameRate)) > 0.5 {
+		out = append(out, fmt.Sprintf("frame rate: onvif %d, sdp %g", declared.FrameRate, *actual.FrameRate))
+	}
+	return out
+}
@@ -0,0 +1,209 @@
+package rtspeek
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+// maxMetadataDocument bounds reassembly of a single XML document.
+const maxMetadataDocument = 1 << 20
+
+// MetadataSummary describes ONVIF tt:MetadataStream documents received during a live probe.
+type MetadataSummary struct {
+	Documents        int      `json:"documents"`
+	DocumentRate     float64  `json:"document_rate"` // documents per second
+	Events           int      `json:"events"`
+	EventRate        float64  `json:"event_rate"` // notification messages per second
+	Frames           int      `json:"frames"`     // tt:VideoAnalytics/tt:Frame elements
+	Sections         []string `json:"sections,omitempty"`
+	AnalyticsModules []string `json:"analytics_modules,omitempty"`
+	Rules            []string `json:"rules,omitempty"`
+	EventTopics      []string `json:"event_topics,omitempty"`
+	ObjectClasses    []string `json:"object_classes,omitempty"`
+	ParseErrors      int      `json:"parse_errors,omitempty"`
+}
+
+// metadataAnalyzer reassembles RTP payloads into XML documents and summarizes them.
+type metadataAnalyzer struct {
+	buf      bytes.Buffer
+	summary  MetadataSummary
+	sections map[string]bool
+	modules  map[string]bool
+	rules    map[string]bool
+	topics   map[string]bool
+	classes  map[string]bool
+}
+
+func newMetadataAnalyzer() *metadataAnalyzer {
+	return &metadataAnalyzer{
+		sections: make(map[string]bool),
+		modules:  make(map[string]bool),
+		rules:    make(map[string]bool),
+		topics:   make(map[string]bool),
+		classes:  make(map[string]bool),
+	}
+}
+
+func (ma *metadataAnalyzer) onRTP(pkt *rtp.Packet, _ time.Time) {
+	if ma.buf.Len()+len(pkt.Payload) > maxMetadataDocument {
+		ma.summary.ParseErrors++
+		ma.buf.Reset()
+		return
+	}
+	ma.buf.Write(pkt.Payload)
+	// ONVIF sets the marker bit on the last packet of each XML document
+	if pkt.Marker {
+		ma.flush()
+	}
+}
+
+func (ma *metadataAnalyzer) onRTCP(rtcp.Packet, time.Time) {}
+
+func (ma *metadataAnalyzer) finish(mi *MediaInfo, window time.Duration) {
+	ma.flush()
+	s := ma.summary
+	if secs := window.Seconds(); secs > 0 {
+		s.DocumentRate = float64(s.Documents) / secs
+		s.EventRate = float64(s.Events) / secs
+	}
+	s.Sections = sortedSet(ma.sections)
+	s.AnalyticsModules = sortedSet(ma.modules)
+	s.Rules = sortedSet(ma.rules)
+	s.EventTopics = sortedSet(ma.topics)
+	s.ObjectClasses = sortedSet(ma.classes)
+	mi.Metadata = &s
+}
+
+// flush parses whatever has been buffered as one or more XML documents.
+func (ma *metadataAnalyzer) flush() {
+	if ma.buf.Len() == 0 {
+		return
+	}
+	if err := ma.parse(ma.buf.Bytes()); err != nil {
+		ma.summary.ParseErrors++
+	}
+	ma.buf.Reset()
+}
+
+// parse walks the XML tokens by local name so namespace prefixes do not matter.
+func (ma *metadataAnalyzer) parse(doc []byte) error {
+	dec := xml.NewDecoder(bytes.NewReader(doc))
+	dec.Strict = false
+
+	var stack []string
+	var text strings.Builder
+	inside := func(name string) bool {
+		for _, s := range stack {
+			if s == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			name := t.Name.Local
+			parent := ""
+			if len(stack) > 0 {
+				parent = stack[len(stack)-1]
+			}
+			stack = append(stack, name)
+			text.Reset()
+
+			switch {
+			case name == "MetadataStream":
+				ma.summary.Documents++
+			case parent == "MetadataStream":
+				ma.sections[name] = true
+			}
+			if name == "Frame" && inside("VideoAnalytics") {
+				ma.summary.Frames++
+				ma.modules["VideoAnalytics"] = true
+			}
+			if name == "NotificationMessage" {
+				ma.summary.Events++
+			}
+			if name == "SimpleItem" && inside("Source") {
+				var itemName, itemValue string
+				for _, a := range t.Attr {
+					switch a.Name.Local {
+					case "Name":
+						itemName = a.Value
+					case "Value":
+						itemValue = a.Value
+					}
+				}
+				if strings.EqualFold(itemName, "Rule") && itemValue != "" {
+					ma.rules[itemValue] = true
+				}
+			}
+
+		case xml.CharData:
+			text.Write(t)
+
+		case xml.EndElement:
+			if len(stack) == 0 {
+				continue
+			}
+			name := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			value := strings.TrimSpace(text.String())
+			text.Reset()
+
+			switch {
+			case name == "Topic" && value != "":
+				ma.topics[value] = true
+				if module := topicModule(value); module != "" {
+					ma.modules[module] = true
+				}
+			case name == "Type" && inside("Class") && value != "":
+				ma.classes[value] = true
+			}
+		}
+	}
+}
+
+// topicModule extracts the analytics module from a topic such as
+// "tns1:RuleEngine/CellMotionDetector/Motion" (-> "CellMotionDetector").
+func topicModule(topic string) string {
+	segments := strings.Split(topic, "/")
+	for i := range segments {
+		if _, local, ok := strings.Cut(segments[i], ":"); ok {
+			segments[i] = local
+		}
+	}
+	if len(segments) >= 2 && segments[0] == "RuleEngine" {
+		return segments[1]
+	}
+	return ""
+}
+
+func sortedSet(set map[string]bool) []string {
+	if len(set) == 0 {
+		return nil
+	}
+	out := make([]string, 0, len(set))
+	for k := range set {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
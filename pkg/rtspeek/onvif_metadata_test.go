@@ -0,0 +1,108 @@
+package rtspeek
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+const sampleMetadataDoc = `<?xml version="1.0" encoding="UTF-8"?>
+<tt:MetadataStream xmlns:tt="http://www.onvif.org/ver10/schema" xmlns:wsnt="http://docs.oasis-open.org/wsn/b-2" xmlns:tns1="http://www.onvif.org/ver10/topics">
+  <tt:VideoAnalytics>
+    <tt:Frame UtcTime="2024-01-01T00:00:00Z">
+      <tt:Object ObjectId="1">
+        <tt:Appearance>
+          <tt:Class><tt:Type Likelihood="0.9">Human</tt:Type></tt:Class>
+        </tt:Appearance>
+      </tt:Object>
+      <tt:Object ObjectId="2">
+        <tt:Appearance>
+          <tt:Class><tt:ClassCandidate><tt:Type>Vehicle</tt:Type><tt:Likelihood>0.7</tt:Likelihood></tt:ClassCandidate></tt:Class>
+        </tt:Appearance>
+      </tt:Object>
+    </tt:Frame>
+  </tt:VideoAnalytics>
+  <tt:Event>
+    <wsnt:NotificationMessage>
+      <wsnt:Topic Dialect="http://www.onvif.org/ver10/tev/topicExpression/ConcreteSet">tns1:RuleEngine/CellMotionDetector/Motion</wsnt:Topic>
+      <wsnt:Message>
+        <tt:Message UtcTime="2024-01-01T00:00:00Z" PropertyOperation="Changed">
+          <tt:Source>
+            <tt:SimpleItem Name="VideoSourceConfigurationToken" Value="VideoSource_1"/>
+            <tt:SimpleItem Name="Rule" Value="MyMotionDetectorRule"/>
+          </tt:Source>
+          <tt:Data><tt:SimpleItem Name="IsMotion" Value="true"/></tt:Data>
+        </tt:Message>
+      </wsnt:Message>
+    </wsnt:NotificationMessage>
+  </tt:Event>
+</tt:MetadataStream>`
+
+func TestMetadataAnalyzerSummary(t *testing.T) {
+	ma := newMetadataAnalyzer()
+	doc := []byte(sampleMetadataDoc)
+
+	// Split each document over two RTP packets, marker on the last one
+	for i := 0; i < 4; i++ {
+		half := len(doc) / 2
+		ma.onRTP(&rtp.Packet{Payload: doc[:half]}, time.Now())
+		ma.onRTP(&rtp.Packet{Header: rtp.Header{Marker: true}, Payload: doc[half:]}, time.Now())
+	}
+
+	var mi MediaInfo
+	ma.finish(&mi, 2*time.Second)
+	s := mi.Metadata
+	if s == nil {
+		t.Fatal("expected metadata summary")
+	}
+	if s.Documents != 4 || s.Events != 4 || s.Frames != 4 {
+		t.Fatalf("unexpected counts: %+v", s)
+	}
+	if s.DocumentRate != 2 || s.EventRate != 2 {
+		t.Fatalf("unexpected rates: %v / %v", s.DocumentRate, s.EventRate)
+	}
+	if s.ParseErrors != 0 {
+		t.Fatalf("unexpected parse errors: %d", s.ParseErrors)
+	}
+	assertStrings(t, "sections", s.Sections, []string{"Event", "VideoAnalytics"})
+	assertStrings(t, "modules", s.AnalyticsModules, []string{"CellMotionDetector", "VideoAnalytics"})
+	assertStrings(t, "rules", s.Rules, []string{"MyMotionDetectorRule"})
+	assertStrings(t, "topics", s.EventTopics, []string{"tns1:RuleEngine/CellMotionDetector/Motion"})
+	assertStrings(t, "classes", s.ObjectClasses, []string{"Human", "Vehicle"})
+}
+
+func TestMetadataAnalyzerParseError(t *testing.T) {
+	ma := newMetadataAnalyzer()
+	ma.onRTP(&rtp.Packet{Header: rtp.Header{Marker: true}, Payload: []byte("<tt:MetadataStream><broken")}, time.Now())
+	var mi MediaInfo
+	ma.finish(&mi, time.Second)
+	if mi.Metadata.ParseErrors != 1 {
+		t.Fatalf("expected one parse error, got %+v", mi.Metadata)
+	}
+}
+
+func TestTopicModule(t *testing.T) {
+	cases := map[string]string{
+		"tns1:RuleEngine/FieldDetector/ObjectsInside": "FieldDetector",
+		"tns1:VideoSource/MotionAlarm":                "",
+		"RuleEngine":                                  "",
+	}
+	for in, want := range cases {
+		if got := topicModule(in); got != want {
+			t.Fatalf("topicModule(%q)=%q want %q", in, got, want)
+		}
+	}
+}
+
+func assertStrings(t *testing.T, what string, got, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s: expected %v, got %v", what, want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("%s: expected %v, got %v", what, want, got)
+		}
+	}
+}
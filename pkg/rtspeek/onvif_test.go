@@ -0,0 +1,86 @@
+package rtspeek
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0x524A/rtspeek/pkg/rtspeektest"
+)
+
+func TestProbeONVIFComparesProfiles(t *testing.T) {
+	// The synthetic stream is H264 1280x720 whatever the profile claims
+	rtsp := rtspeektest.Start(t, rtspeektest.Config{User: "admin", Pass: "secret", FrameInterval: -1})
+	device := rtspeektest.StartONVIF(t, rtspeektest.ONVIFConfig{
+		User: "admin", Pass: "secret",
+		ClockOffset: -time.Hour, // tokens dated on the local clock would be rejected
+		Profiles: []rtspeektest.ONVIFProfile{
+			{Token: "main", Name: "MainStream", StreamURI: rtsp.URL, Encoding: "H264", Width: 1280, Height: 720, FrameRate: 25, GovLength: 50},
+			{Token: "sub", Name: "SubStream", StreamURI: rtsp.URL, Encoding: "H264", Width: 640, Height: 360, FrameRate: 15},
+			{Token: "h265", Name: "Mislabeled", StreamURI: rtsp.URL, Encoding: "H265", Width: 1280, Height: 720},
+			{Token: "gone", Name: "Broken", StreamURI: "rtsp://127.0.0.1:1/x"},
+		},
+	})
+
+	report, err := ProbeONVIF(context.Background(), strings.TrimPrefix(device.URL, "http://"), "admin", "secret", 2*time.Second)
+	if err != nil {
+		t.Fatalf("ProbeONVIF: %v", err)
+	}
+	if report.Device != device.URL || report.Capabilities == nil || !report.Capabilities.RTPRTSPTCP {
+		t.Fatalf("unexpected device info %+v", report)
+	}
+	if len(report.Profiles) != 4 || report.Mismatches != 2 || report.Failures != 1 {
+		t.Fatalf("unexpected counts: %d profiles, %d mismatches, %d failures", len(report.Profiles), report.Mismatches, report.Failures)
+	}
+
+	main := report.Profiles[0]
+	if main.Name != "MainStream" || !main.DescribeOK || !main.Match || main.Video.GovLength != 50 || main.URI != rtsp.URL {
+		t.Fatalf("unexpected main profile %+v", main)
+	}
+	if main.Actual.Codec != "H264" || main.Actual.Resolution != "1280x720" {
+		t.Fatalf("unexpected observed video %+v", main.Actual)
+	}
+	if sub := report.Profiles[1]; sub.Match || len(sub.Mismatches) != 1 || !strings.HasPrefix(sub.Mismatches[0], "resolution: onvif 640x360") {
+		t.Fatalf("unexpected sub profile mismatches %v", sub.Mismatches)
+	}
+	if h265 := report.Profiles[2]; len(h265.Mismatches) != 1 || !strings.HasPrefix(h265.Mismatches[0], "encoding: onvif H265") {
+		t.Fatalf("unexpected h265 profile mismatches %v", h265.Mismatches)
+	}
+	if gone := report.Profiles[3]; gone.DescribeOK || gone.Failure != "connection_refused" {
+		t.Fatalf("unexpected broken profile %+v", gone)
+	}
+	if calls := device.Calls(); calls[0] != "GetSystemDateAndTime" || calls[1] != "GetCapabilities" {
+		t.Fatalf("unexpected call order %v", calls)
+	}
+}
+
+func TestProbeONVIFWrongPassword(t *testing.T) {
+	device := rtspeektest.StartONVIF(t, rtspeektest.ONVIFConfig{User: "admin", Pass: "secret"})
+	_, err := ProbeONVIF(context.Background(), device.URL, "admin", "wrong", 2*time.Second)
+	if err == nil || classifyError(err) != "auth_required" {
+		t.Fatalf("expected auth_required, got %v", err)
+	}
+}
+
+func TestNewONVIFClientAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		want    string
+		wantErr bool
+	}{
+		{address: "192.168.1.20", want: "http://192.168.1.20/onvif/device_service"},
+		{address: "cam.local:8080", want: "http://cam.local:8080/onvif/device_service"},
+		{address: "https://admin:pw@cam.local/onvif/device", want: "https://cam.local/onvif/device"},
+		{address: "rtsp://cam.local", wantErr: true},
+	}
+	for _, tt := range tests {
+		c, err := NewONVIFClient(tt.address, "", "", time.Second)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%s: err = %v", tt.address, err)
+		}
+		if err == nil && c.DeviceURL != tt.want {
+			t.Fatalf("%s: DeviceURL = %s, want %s", tt.address, c.DeviceURL, tt.want)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package rtspeek
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PathTemplate is a stream path a camera vendor is known to serve. Path may contain the placeholders
+// {channel}, {user} and {password}; the last two are for firmwares that take credentials in the path.
+// Since such a request puts the password on the wire in the clear, ProbePaths only tries these templates
+// when their vendor is selected in PathProbeOptions.Vendors.
+type PathTemplate struct {
+	Vendor string `json:"vendor"`
+	Path   string `json:"path"`
+	Stream string `json:"stream,omitempty"` // "main" or "sub"; guessed from the resolution when empty
+}
+
+// DefaultPathTemplates is the curated table ProbePaths tries when PathProbeOptions.Templates is empty.
+var DefaultPathTemplates = []PathTemplate{
+	{Vendor: "hikvision", Path: "/Streaming/Channels/{channel}01", Stream: "main"},
+	{Vendor: "hikvision", Path: "/Streaming/Channels/{channel}02", Stream: "sub"},
+	{Vendor: "hikvision", Path: "/ISAPI/Streaming/channels/{channel}01", Stream: "main"},
+	{Vendor: "dahua", Path: "/cam/realmonitor?channel={channel}&subtype=0", Stream: "main"},
+	{Vendor: "dahua", Path: "/cam/realmonitor?channel={channel}&subtype=1", Stream: "sub"},
+	{Vendor: "axis", Path: "/axis-media/media.amp", Stream: "main"},
+	{Vendor: "axis", Path: "/axis-media/media.amp?videocodec=h264&resolution=640x360", Stream: "sub"},
+	{Vendor: "reolink", Path: "/h264Preview_0{channel}_main", Stream: "main"},
+	{Vendor: "reolink", Path: "/h264Preview_0{channel}_sub", Stream: "sub"},
+	{Vendor: "reolink", Path: "/Preview_0{channel}_main", Stream: "main"},
+	{Vendor: "uniview", Path: "/unicast/c{channel}/s0/live", Stream: "main"},
+	{Vendor: "uniview", Path: "/unicast/c{channel}/s1/live", Stream: "sub"},
+	{Vendor: "hanwha", Path: "/profile2/media.smp", Stream: "main"},
+	{Vendor: "hanwha", Path: "/profile3/media.smp", Stream: "sub"},
+	{Vendor: "bosch", Path: "/?inst=1", Stream: "main"},
+	{Vendor: "bosch", Path: "/?inst=2", Stream: "sub"},
+	{Vendor: "vivotek", Path: "/live1s1.sdp", Stream: "main"},
+	{Vendor: "vivotek", Path: "/live1s2.sdp", Stream: "sub"},
+	{Vendor: "sony", Path: "/media/video1", Stream: "main"},
+	{Vendor: "sony", Path: "/media/video2", Stream: "sub"},
+	{Vendor: "panasonic", Path: "/MediaInput/h264", Stream: "main"},
+	{Vendor: "panasonic", Path: "/MediaInput/h264/stream_2", Stream: "sub"},
+	{Vendor: "foscam", Path: "/videoMain", Stream: "main"},
+	{Vendor: "foscam", Path: "/videoSub", Stream: "sub"},
+	{Vendor: "tp-link", Path: "/stream1", Stream: "main"},
+	{Vendor: "tp-link", Path: "/stream2", Stream: "sub"},
+	{Vendor: "xiongmai", Path: "/user={user}&password={password}&channel={channel}&stream=0.sdp", Stream: "main"},
+	{Vendor: "xiongmai", Path: "/user={user}&password={password}&channel={channel}&stream=1.sdp", Stream: "sub"},
+	{Vendor: "generic", Path: "/11", Stream: "main"},
+	{Vendor: "generic", Path: "/12", Stream: "sub"},
+	{Vendor: "generic", Path: "/live"},
+	{Vendor: "generic", Path: "/live.sdp"},
+	{Vendor: "generic", Path: "/stream"},
+	{Vendor: "generic", Path: "/h264"},
+}
+
+// Path probing limits.
+const (
+	// DefaultPathInterval is the pause between two DESCRIBE attempts on the same host.
+	DefaultPathInterval = 500 * time.Millisecond
+	// DefaultMaxAuthFailures is the number of rejected credentials after which probing stops, well below
+	// the lockout thresholds of common firmwares.
+	DefaultMaxAuthFailures = 3
+)
+
+// PathProbeOptions configures ProbePaths.
+type PathProbeOptions struct {
+	// Templates to try in order (DefaultPathTemplates if empty).
+	Templates []PathTemplate
+	// Vendors, if set, limits the templates to these vendors. Templates with {user} or {password} are
+	// only tried when their vendor is listed here.
+	Vendors []string
+	// Channel replaces {channel} (default 1).
+	Channel int
+	// Interval is the pause between attempts (DefaultPathInterval if 0).
+	Interval time.Duration
+	// MaxAuthFailures stops probing once this many attempts were refused with 401 (DefaultMaxAuthFailures
+	// if 0, negative for no limit).
+	MaxAuthFailures int
+	// OnResult, if set, is called after each attempt.
+	OnResult func(PathResult)
+}
+
+// PathResult is the outcome of one template.
+type PathResult struct {
+	Vendor      string   `json:"vendor"`
+	Path        string   `json:"path"` // {user} and {password} stay as placeholders
+	URL         string   `json:"url"`  // without credentials
+	Stream      string   `json:"stream,omitempty"`
+	OK          bool     `json:"ok"`
+	Failure     string   `json:"failure,omitempty"` // error classification
+	Error       string   `json:"error,omitempty"`
+	Resolutions []string `json:"resolutions,omitempty"`
+	Codecs      []string `json:"codecs,omitempty"`
+	Latency     float64  `json:"latency"` // ms
+}
+
+// PathProbeReport summarizes a path probe.
+type PathProbeReport struct {
+	Target       string       `json:"target"`
+	Attempts     int          `json:"attempts"`
+	AuthFailures int          `json:"auth_failures"`
+	Duration     float64      `json:"duration"` // seconds
+	Stopped      bool         `json:"stopped"`
+	StopReason   string       `json:"stop_reason,omitempty"` // auth_failures, unreachable or interrupted
+	Found        []PathResult `json:"found"`
+	Results      []PathResult `json:"results"`
+}
+
+// LoadPathTemplates reads a JSON array of templates, e.g. to extend DefaultPathTemplates for a site.
+func LoadPathTemplates(r io.Reader) ([]PathTemplate, error) {
+	var list []PathTemplate
+	if err := json.NewDecoder(r).Decode(&list); err != nil {
+		return nil, fmt.Errorf("invalid path templates: %w", err)
+	}
+	for i, t := range list {
+		if !strings.HasPrefix(t.Path, "/") {
+			return nil, fmt.Errorf("path template %d: path %q must start with /", i, t.Path)
+		}
+		if t.Stream != "" && t.Stream != "main" && t.Stream != "sub" {
+			return nil, fmt.Errorf("path template %d: stream must be main or sub, got %q", i, t.Stream)
+		}
+	}
+	return list, nil
+}
+
+// ProbePaths tries the path templates against the host of target (an rtsp:// URL whose user info holds
+// the operator's credentials; its path is ignored) and reports which of them DESCRIBE successfully.
+// Attempts run one at a time, Interval apart. Probing stops early when MaxAuthFailures attempts were
+// refused, so a wrong password cannot lock the account, and when the host stops accepting connections.
+func ProbePaths(ctx context.Context, target string, timeout time.Duration, opts PathProbeOptions) (*PathProbeReport, error) {
+	if !strings.Contains(target, "://") {
+		target = "rtsp://" + target
+	}
+	parsed, err := parseRTSPURL(target)
+	if err != nil {
+		return nil, err
+	}
+	base := (*url.URL)(parsed)
+	templates := opts.Templates
+	if len(templates) == 0 {
+		templates = DefaultPathTemplates
+	}
+	if len(opts.Vendors) > 0 {
+		templates = filterPathTemplates(templates, opts.Vendors)
+		if len(templates) == 0 {
+			return nil, fmt.Errorf("no path templates for vendors %s", strings.Join(opts.Vendors, ", "))
+		}
+	}
+	channel := opts.Channel
+	if channel <= 0 {
+		channel = 1
+	}
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = DefaultPathInterval
+	}
+	maxAuth := opts.MaxAuthFailures
+	if maxAuth == 0 {
+		maxAuth = DefaultMaxAuthFailures
+	}
+
+	var user, pass string
+	if base.User != nil {
+		user = base.User.Username()
+		pass, _ = base.User.Password()
+	}
+	host := &url.URL{Scheme: base.Scheme, Host: base.Host}
+
+	start := time.Now()
+	report := &PathProbeReport{Target: host.String(), Found: []PathResult{}, Results: []PathResult{}}
+	seen := make(map[string]bool)
+	for _, t := range templates {
+		if t.hasCredentials() && len(opts.Vendors) == 0 {
+			continue // not sending the password to a host that may not be this vendor's
+		}
+		path := strings.ReplaceAll(t.Path, "{channel}", strconv.Itoa(channel))
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		if report.Attempts > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(interval):
+			}
+		}
+		if ctx.Err() != nil {
+			report.Stopped, report.StopReason = true, "interrupted"
+			break
+		}
+
+		res := probePath(ctx, base, host, t, path, user, pass, timeout)
+		report.Attempts++
+		report.Results = append(report.Results, res)
+		if opts.OnResult != nil {
+			opts.OnResult(res)
+		}
+		if res.OK {
+			report.Found = append(report.Found, res)
+			continue
+		}
+		switch res.Failure {
+		case "auth_required":
+			report.AuthFailures++
+			if maxAuth > 0 && report.AuthFailures >= maxAuth {
+				report.Stopped, report.StopReason = true, "auth_failures"
+			}
+		case "connection_refused", "dns_error":
+			report.Stopped, report.StopReason = true, "unreachable"
+		}
+		if report.Stopped {
+			break
+		}
+	}
+	labelStreams(report.Found)
+	report.Duration = time.Since(start).Seconds()
+	return report, nil
+}
+
+// hasCredentials reports whether the template puts the user or password in the path.
+func (t PathTemplate) hasCredentials() bool {
+	return strings.Contains(t.Path, "{user}") || strings.Contains(t.Path, "{password}")
+}
+
+// filterPathTemplates keeps the templates of the given vendors.
+func filterPathTemplates(templates []PathTemplate, vendors []string) []PathTemplate {
+	var out []PathTemplate
+	for _, t := range templates {
+		for _, v := range vendors {
+			if strings.EqualFold(t.Vendor, v) {
+				out = append(out, t)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// probePath describes one expanded template.
+func probePath(ctx context.Context, base, host *url.URL, t PathTemplate, path, user, pass string, timeout time.Duration) PathResult {
+	res := PathResult{Vendor: t.Vendor, Path: path, Stream: t.Stream, URL: host.String() + path}
+
+	filled := strings.NewReplacer("{user}", url.QueryEscape(user), "{password}", url.QueryEscape(pass)).Replace(path)
+	u := *base
+	u.Path, u.RawPath, u.RawQuery = "", "", ""
+	target := u.String() + filled
+
+	start := time.Now()
+	info, err := DescribeStream(ctx, target, timeout)
+	res.Latency = float64(time.Since(start)) / float64(time.Millisecond)
+	if err == nil && info != nil && info.IsDescribeSucceeded() {
+		res.OK = true
+		res.Resolutions = info.GetVideoResolutionStrings()
+		for _, m := range info.GetMedias() {
+			if m.Format != "" {
+				res.Codecs = append(res.Codecs, m.Format)
+			}
+		}
+		return res
+	}
+	if err == nil {
+		err = errors.New("describe failed")
+	}
+	res.Failure = classifyError(err)
+	res.Error = redactPassword(strings.ReplaceAll(err.Error(), filled, path), pass)
+	return res
+}
+
+// redactPassword replaces pass in s, as written or in its URL escaped forms, with {password}.
+func redactPassword(s, pass string) string {
+	if pass == "" {
+		return s
+	}
+	userinfo := strings.TrimPrefix(url.UserPassword("", pass).String(), ":")
+	for _, form := range []string{url.QueryEscape(pass), url.PathEscape(pass), userinfo, pass} {
+		s = strings.ReplaceAll(s, form, "{password}")
+	}
+	return s
+}
+
+// labelStreams names found streams that have no template label: the largest video is main, the rest sub.
+func labelStreams(found []PathResult) {
+	best, bestPixels := -1, -1
+	for i, r := range found {
+		if p := maxPixels(r.Resolutions); p > bestPixels {
+			best, bestPixels = i, p
+		}
+	}
+	for i := range found {
+		if found[i].Stream != "" {
+			continue
+		}
+		if i == best || maxPixels(found[i].Resolutions) == bestPixels {
+			found[i].Stream = "main"
+		} else {
+			found[i].Stream = "sub"
+		}
+	}
+}
+
+// maxPixels returns the largest area among "WxH" resolutions (0 if none parse).
+func maxPixels(resolutions []string) int {
+	best := 0
+	for _, s := range resolutions {
+		w, h, ok := strings.Cut(s, "x")
+		if !ok {
+			continue
+		}
+		wi, _ := strconv.Atoi(w)
+		hi, _ := strconv.Atoi(h)
+		best = max(best, wi*hi)
+	}
+	return best
+}
@@ -0,0 +1,464 @@
+package rtspeek
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// Capture file magic numbers.
+const (
+	pcapMagicMicros = 0xa1b2c3d4
+	pcapMagicNanos  = 0xa1b23c4d
+	pcapngSHB       = 0x0a0d0d0a
+	pcapngByteOrder = 0x1a2b3c4d
+)
+
+// pcapng block types.
+const (
+	pcapngBlockIDB = 1 // interface description
+	pcapngBlockSPB = 3 // simple packet
+	pcapngBlockEPB = 6 // enhanced packet
+)
+
+// Link-layer header types (LINKTYPE_*).
+const (
+	linkNull     = 0
+	linkEthernet = 1
+	linkRaw      = 101
+	linkLoop     = 108
+	linkLinuxSLL = 113
+	linkIPv4     = 228
+	linkIPv6     = 229
+	linkSLL2     = 276
+)
+
+// maxCaptureBlock bounds a single pcap record or pcapng block.
+const maxCaptureBlock = 16 << 20
+
+// Transport protocols of captured segments.
+const (
+	ipProtoTCP = 6
+	ipProtoUDP = 17
+)
+
+// TCP flags.
+const (
+	tcpFlagFIN = 0x01
+	tcpFlagSYN = 0x02
+	tcpFlagRST = 0x04
+)
+
+// capturedPacket is a TCP segment or UDP datagram taken from a capture.
+type capturedPacket struct {
+	ts      time.Time
+	proto   int // ipProtoTCP or ipProtoUDP
+	src     netip.AddrPort
+	dst     netip.AddrPort
+	seq     uint32 // TCP only
+	flags   uint8  // TCP only
+	payload []byte
+}
+
+// captureStats counts what readCapture could not use.
+type captureStats struct {
+	frames      int
+	skipped     int // unsupported link types, non-IP, other protocols
+	fragments   int // IPv4 fragments (not reassembled)
+	unsupported int // packets from interfaces with unsupported link types
+}
+
+// CaptureSummary counts the frames of a capture and those AnalyzeCapture could not use.
+type CaptureSummary struct {
+	Frames      int `json:"frames"`
+	Skipped     int `json:"skipped"`     // truncated, non-IP or neither TCP nor UDP
+	Fragments   int `json:"fragments"`   // IPv4 fragments, not reassembled
+	Unsupported int `json:"unsupported"` // frames of interfaces with unsupported link types
+}
+
+func (st captureStats) summary() *CaptureSummary {
+	return &CaptureSummary{Frames: st.frames, Skipped: st.skipped, Fragments: st.fragments, Unsupported: st.unsupported}
+}
+
+// unused describes the frames that could not be used, or returns "" if all were decoded.
+func (st captureStats) unused() string {
+	var parts []string
+	if st.fragments > 0 {
+		parts = append(parts, fmt.Sprintf("%d IPv4 fragments not reassembled", st.fragments))
+	}
+	if st.unsupported > 0 {
+		parts = append(parts, fmt.Sprintf("%d frames with unsupported link types", st.unsupported))
+	}
+	if st.skipped > 0 {
+		parts = append(parts, fmt.Sprintf("%d frames skipped", st.skipped))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// readCapture decodes every TCP and UDP packet of a pcap or pcapng file.
+func readCapture(r io.Reader) ([]capturedPacket, captureStats, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(4)
+	if err != nil {
+		return nil, captureStats{}, fmt.Errorf("read capture header: %w", err)
+	}
+	if binary.LittleEndian.Uint32(head) == pcapngSHB {
+		return readPcapng(br)
+	}
+	return readPcap(br)
+}
+
+// readPcap decodes a classic libpcap file in either byte order and timestamp resolution.
+func readPcap(r io.Reader) ([]capturedPacket, captureStats, error) {
+	var st captureStats
+	hdr := make([]byte, 24)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, st, fmt.Errorf("read pcap header: %w", err)
+	}
+
+	var order binary.ByteOrder
+	var nanos bool
+	switch {
+	case binary.LittleEndian.Uint32(hdr) == pcapMagicMicros:
+		order = binary.LittleEndian
+	case binary.BigEndian.Uint32(hdr) == pcapMagicMicros:
+		order = binary.BigEndian
+	case binary.LittleEndian.Uint32(hdr) == pcapMagicNanos:
+		order, nanos = binary.LittleEndian, true
+	case binary.BigEndian.Uint32(hdr) == pcapMagicNanos:
+		order, nanos = binary.BigEndian, true
+	default:
+		return nil, st, errors.New("not a pcap or pcapng file")
+	}
+	link := int(order.Uint32(hdr[20:]) & 0x0fffffff)
+
+	var pkts []capturedPacket
+	rec := make([]byte, 16)
+	for {
+		if _, err := io.ReadFull(r, rec); err != nil {
+			if errors.Is(err, io.EOF) {
+				return pkts, st, nil
+			}
+			return pkts, st, fmt.Errorf("read pcap record: %w", err)
+		}
+		sec, frac := int64(order.Uint32(rec)), int64(order.Uint32(rec[4:]))
+		incl := order.Uint32(rec[8:])
+		if incl > maxCaptureBlock {
+			return pkts, st, fmt.Errorf("pcap record of %d bytes", incl)
+		}
+		data := make([]byte, incl)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return pkts, st, fmt.Errorf("read pcap record: %w", err)
+		}
+		if !nanos {
+			frac *= 1000
+		}
+		st.frames++
+		if p, ok := decodeFrame(link, data, &st); ok {
+			p.ts = time.Unix(sec, frac)
+			pkts = append(pkts, p)
+		}
+	}
+}
+
+// pcapngInterface is what an interface description block tells about its packets.
+type pcapngInterface struct {
+	link int
+	// tsUnit is the duration of one timestamp tick.
+	tsUnit time.Duration
+	tsDiv  int64 // divisor when ticks are finer than a nanosecond
+}
+
+// readPcapng decodes the packet blocks of a pcapng file, following section byte order and
+// per-interface link types and timestamp resolutions.
+func readPcapng(r io.Reader) ([]capturedPacket, captureStats, error) {
+	var st captureStats
+	var pkts []capturedPacket
+	var order binary.ByteOrder = binary.LittleEndian
+	var ifaces []pcapngInterface
+
+	head := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, head); err != nil {
+			if errors.Is(err, io.EOF) {
+				return pkts, st, nil
+			}
+			return pkts, st, fmt.Errorf("read pcapng block: %w", err)
+		}
+		blockType := order.Uint32(head)
+		if binary.LittleEndian.Uint32(head) == pcapngSHB {
+			blockType = pcapngSHB
+		}
+
+		// The section header decides the byte order of its own length field
+		var magic []byte
+		if blockType == pcapngSHB {
+			magic = make([]byte, 4)
+			if _, err := io.ReadFull(r, magic); err != nil {
+				return pkts, st, fmt.Errorf("read pcapng section: %w", err)
+			}
+			switch {
+			case binary.LittleEndian.Uint32(magic) == pcapngByteOrder:
+				order = binary.LittleEndian
+			case binary.BigEndian.Uint32(magic) == pcapngByteOrder:
+				order = binary.BigEndian
+			default:
+				return pkts, st, errors.New("invalid pcapng byte-order magic")
+			}
+			ifaces = nil
+		}
+		total := order.Uint32(head[4:])
+		if total < 12 || total > maxCaptureBlock || total%4 != 0 {
+			return pkts, st, fmt.Errorf("invalid pcapng block length %d", total)
+		}
+		body := make([]byte, int(total)-12-len(magic))
+		if _, err := io.ReadFull(r, body); err != nil {
+			return pkts, st, fmt.Errorf("read pcapng block: %w", err)
+		}
+		if _, err := io.ReadFull(r, head[:4]); err != nil { // trailing length
+			return pkts, st, fmt.Errorf("read pcapng block: %w", err)
+		}
+
+		switch blockType {
+		case pcapngBlockIDB:
+			if len(body) < 8 {
+				return pkts, st, errors.New("short pcapng interface block")
+			}
+			iface, err := parsePcapngInterface(order, body)
+			if err != nil {
+				return pkts, st, err
+			}
+			ifaces = append(ifaces, iface)
+
+		case pcapngBlockEPB:
+			if len(body) < 20 {
+				return pkts, st, errors.New("short pcapng packet block")
+			}
+			id := int(order.Uint32(body))
+			if id >= len(ifaces) {
+				return pkts, st, fmt.Errorf("packet on undeclared interface %d", id)
+			}
+			ticks := int64(order.Uint32(body[4:]))<<32 | int64(order.Uint32(body[8:]))
+			incl := int(order.Uint32(body[12:]))
+			if incl > len(body)-20 {
+				return pkts, st, errors.New("truncated pcapng packet block")
+			}
+			st.frames++
+			if p, ok := decodeFrame(ifaces[id].link, body[20:20+incl], &st); ok {
+				p.ts = ifaces[id].time(ticks)
+				pkts = append(pkts, p)
+			}
+
+		case pcapngBlockSPB:
+			// Simple packets carry no timestamp; they belong to the first interface
+			if len(ifaces) == 0 || len(body) < 4 {
+				continue
+			}
+			st.frames++
+			incl := min(int(order.Uint32(body)), len(body)-4)
+			if p, ok := decodeFrame(ifaces[0].link, body[4:4+incl], &st); ok {
+				pkts = append(pkts, p)
+			}
+		}
+	}
+}
+
+// Largest if_tsresol exponents whose tick count per second fits in an int64.
+const (
+	maxTsresolDecimal = 18
+	maxTsresolBinary  = 62
+)
+
+// parsePcapngInterface reads the link type and the if_tsresol option (default microseconds).
+func parsePcapngInterface(order binary.ByteOrder, body []byte) (pcapngInterface, error) {
+	iface := pcapngInterface{link: int(order.Uint16(body)), tsUnit: time.Microsecond}
+	opts := body[8:]
+	for len(opts) >= 4 {
+		code, length := order.Uint16(opts), int(order.Uint16(opts[2:]))
+		if code == 0 || 4+length > len(opts) {
+			break
+		}
+		if code == 9 && length >= 1 { // if_tsresol
+			res := opts[4]
+			if exp := res & 0x7f; (res&0x80 != 0 && exp > maxTsresolBinary) || (res&0x80 == 0 && exp > maxTsresolDecimal) {
+				return iface, fmt.Errorf("invalid pcapng if_tsresol %#x", res)
+			}
+			if res&0x80 != 0 {
+				iface.tsUnit, iface.tsDiv = 0, int64(1)<<(res&0x7f)
+			} else {
+				iface.tsUnit = 0
+				iface.tsDiv = 1
+				for range res {
+					iface.tsDiv *= 10
+				}
+			}
+		}
+		opts = opts[4+(length+3)&^3:]
+	}
+	return iface, nil
+}
+
+// time converts interface ticks to a wall-clock time.
+func (i pcapngInterface) time(ticks int64) time.Time {
+	if i.tsUnit > 0 {
+		return time.Unix(0, 0).Add(time.Duration(ticks) * i.tsUnit)
+	}
+	// The timestamp is unsigned; frac*1e9 needs 128 bits for resolutions finer than ~10 GHz
+	t, div := uint64(ticks), uint64(i.tsDiv)
+	hi, lo := bits.Mul64(t%div, uint64(time.Second))
+	ns, _ := bits.Div64(hi, lo, div)
+	return time.Unix(int64(t/div), int64(ns))
+}
+
+// decodeFrame strips the link layer and decodes IPv4/IPv6 carrying TCP or UDP.
+func decodeFrame(link int, data []byte, st *captureStats) (capturedPacket, bool) {
+	var ethType uint16
+	switch link {
+	case linkEthernet:
+		if len(data) < 14 {
+			st.skipped++
+			return capturedPacket{}, false
+		}
+		ethType, data = binary.BigEndian.Uint16(data[12:]), data[14:]
+		// 802.1Q / 802.1ad tags
+		for (ethType == 0x8100 || ethType == 0x88a8) && len(data) >= 4 {
+			ethType, data = binary.BigEndian.Uint16(data[2:]), data[4:]
+		}
+	case linkLinuxSLL:
+		if len(data) < 16 {
+			st.skipped++
+			return capturedPacket{}, false
+		}
+		ethType, data = binary.BigEndian.Uint16(data[14:]), data[16:]
+	case linkSLL2:
+		if len(data) < 20 {
+			st.skipped++
+			return capturedPacket{}, false
+		}
+		ethType, data = binary.BigEndian.Uint16(data), data[20:]
+	case linkNull, linkLoop:
+		// 4-byte address family in host (null) or network (loop) byte order; the IP version is enough
+		if len(data) < 4 {
+			st.skipped++
+			return capturedPacket{}, false
+		}
+		data = data[4:]
+	case linkRaw, linkIPv4, linkIPv6:
+	default:
+		st.unsupported++
+		return capturedPacket{}, false
+	}
+
+	if ethType != 0 && ethType != 0x0800 && ethType != 0x86dd {
+		st.skipped++
+		return capturedPacket{}, false
+	}
+	if len(data) == 0 {
+		st.skipped++
+		return capturedPacket{}, false
+	}
+	switch data[0] >> 4 {
+	case 4:
+		return decodeIPv4(data, st)
+	case 6:
+		return decodeIPv6(data, st)
+	}
+	st.skipped++
+	return capturedPacket{}, false
+}
+
+func decodeIPv4(data []byte, st *captureStats) (capturedPacket, bool) {
+	if len(data) < 20 {
+		st.skipped++
+		return capturedPacket{}, false
+	}
+	ihl := int(data[0]&0x0f) * 4
+	total := int(binary.BigEndian.Uint16(data[2:]))
+	if ihl < 20 || total < ihl || len(data) < ihl {
+		st.skipped++
+		return capturedPacket{}, false
+	}
+	if frag := binary.BigEndian.Uint16(data[6:]); frag&0x3fff != 0 { // MF set or non-zero offset
+		st.fragments++
+		return capturedPacket{}, false
+	}
+	if total < len(data) {
+		data = data[:total] // Ethernet padding
+	}
+	src := netip.AddrFrom4([4]byte(data[12:16]))
+	dst := netip.AddrFrom4([4]byte(data[16:20]))
+	return decodeTransport(int(data[9]), src, dst, data[ihl:], st)
+}
+
+func decodeIPv6(data []byte, st *captureStats) (capturedPacket, bool) {
+	if len(data) < 40 {
+		st.skipped++
+		return capturedPacket{}, false
+	}
+	src := netip.AddrFrom16([16]byte(data[8:24]))
+	dst := netip.AddrFrom16([16]byte(data[24:40]))
+	if plen := int(binary.BigEndian.Uint16(data[4:])); 40+plen < len(data) {
+		data = data[:40+plen]
+	}
+	next, payload := int(data[6]), data[40:]
+	// Skip hop-by-hop, routing and destination options headers
+	for next == 0 || next == 43 || next == 60 {
+		if len(payload) < 8 {
+			st.skipped++
+			return capturedPacket{}, false
+		}
+		n := 8 + int(payload[1])*8
+		if n > len(payload) {
+			st.skipped++
+			return capturedPacket{}, false
+		}
+		next, payload = int(payload[0]), payload[n:]
+	}
+	if next == 44 { // fragment header
+		st.fragments++
+		return capturedPacket{}, false
+	}
+	return decodeTransport(next, src, dst, payload, st)
+}
+
+func decodeTransport(proto int, src, dst netip.Addr, data []byte, st *captureStats) (capturedPacket, bool) {
+	switch proto {
+	case ipProtoTCP:
+		if len(data) < 20 {
+			break
+		}
+		off := int(data[12]>>4) * 4
+		if off < 20 || off > len(data) {
+			break
+		}
+		return capturedPacket{
+			proto:   ipProtoTCP,
+			src:     netip.AddrPortFrom(src, binary.BigEndian.Uint16(data)),
+			dst:     netip.AddrPortFrom(dst, binary.BigEndian.Uint16(data[2:])),
+			seq:     binary.BigEndian.Uint32(data[4:]),
+			flags:   data[13],
+			payload: data[off:],
+		}, true
+	case ipProtoUDP:
+		if len(data) < 8 {
+			break
+		}
+		if n := int(binary.BigEndian.Uint16(data[4:])); n >= 8 && n < len(data) {
+			data = data[:n]
+		}
+		return capturedPacket{
+			proto:   ipProtoUDP,
+			src:     netip.AddrPortFrom(src, binary.BigEndian.Uint16(data)),
+			dst:     netip.AddrPortFrom(dst, binary.BigEndian.Uint16(data[2:])),
+			payload: data[8:],
+		}, true
+	}
+	st.skipped++
+	return capturedPacket{}, false
+}
@@ -0,0 +1,288 @@
+package rtspeek
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCapture builds captures of Ethernet/IPv4 frames for the offline analysis tests.
+type testCapture struct {
+	t0     time.Time
+	frames []testFrame
+	seq    map[netip.AddrPort]uint32
+}
+
+type testFrame struct {
+	ts   time.Time
+	data []byte // Ethernet frame
+}
+
+func newTestCapture() *testCapture {
+	return &testCapture{t0: time.Unix(1700000000, 0), seq: make(map[netip.AddrPort]uint32)}
+}
+
+// tcp appends a segment continuing the sender's sequence space.
+func (c *testCapture) tcp(at time.Duration, src, dst netip.AddrPort, flags uint8, payload []byte) {
+	seq, ok := c.seq[src]
+	if !ok {
+		seq = 0xfffffff0 // close to wrapping
+	}
+	c.tcpSeq(at, src, dst, seq, flags, payload)
+	if flags&tcpFlagSYN != 0 {
+		seq++
+	}
+	c.seq[src] = seq + uint32(len(payload))
+}
+
+// tcpSeq appends a segment with an explicit sequence number.
+func (c *testCapture) tcpSeq(at time.Duration, src, dst netip.AddrPort, seq uint32, flags uint8, payload []byte) {
+	seg := make([]byte, 20, 20+len(payload))
+	binary.BigEndian.PutUint16(seg, src.Port())
+	binary.BigEndian.PutUint16(seg[2:], dst.Port())
+	binary.BigEndian.PutUint32(seg[4:], seq)
+	seg[12] = 5 << 4
+	seg[13] = flags | 0x10 // ACK
+	binary.BigEndian.PutUint16(seg[14:], 65535)
+	c.ip(at, ipProtoTCP, src, dst, append(seg, payload...))
+}
+
+func (c *testCapture) udp(at time.Duration, src, dst netip.AddrPort, payload []byte) {
+	dgram := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint16(dgram, src.Port())
+	binary.BigEndian.PutUint16(dgram[2:], dst.Port())
+	binary.BigEndian.PutUint16(dgram[4:], uint16(8+len(payload)))
+	c.ip(at, ipProtoUDP, src, dst, append(dgram, payload...))
+}
+
+func (c *testCapture) ip(at time.Duration, proto int, src, dst netip.AddrPort, payload []byte) {
+	frame := make([]byte, 34, 34+len(payload))
+	copy(frame, []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 0x08, 0x00})
+	ip := frame[14:]
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:], uint16(20+len(payload)))
+	ip[6] = 0x40 // don't fragment
+	ip[8] = 64
+	ip[9] = byte(proto)
+	s, d := src.Addr().As4(), dst.Addr().As4()
+	copy(ip[12:], s[:])
+	copy(ip[16:], d[:])
+	c.frames = append(c.frames, testFrame{ts: c.t0.Add(at), data: append(frame, payload...)})
+}
+
+// pcap renders a classic capture; raw strips the Ethernet header and declares raw IP.
+func (c *testCapture) pcap(order binary.ByteOrder, nanos, raw bool) []byte {
+	var buf bytes.Buffer
+	magic := uint32(pcapMagicMicros)
+	if nanos {
+		magic = pcapMagicNanos
+	}
+	link := uint32(linkEthernet)
+	if raw {
+		link = linkRaw
+	}
+	hdr := make([]byte, 24)
+	order.PutUint32(hdr, magic)
+	order.PutUint16(hdr[4:], 2)
+	order.PutUint16(hdr[6:], 4)
+	order.PutUint32(hdr[16:], 65535)
+	order.PutUint32(hdr[20:], link)
+	buf.Write(hdr)
+	for _, f := range c.frames {
+		data := f.data
+		if raw {
+			data = data[14:]
+		}
+		frac := uint32(f.ts.Nanosecond() / 1000)
+		if nanos {
+			frac = uint32(f.ts.Nanosecond())
+		}
+		rec := make([]byte, 16)
+		order.PutUint32(rec, uint32(f.ts.Unix()))
+		order.PutUint32(rec[4:], frac)
+		order.PutUint32(rec[8:], uint32(len(data)))
+		order.PutUint32(rec[12:], uint32(len(data)))
+		buf.Write(rec)
+		buf.Write(data)
+	}
+	return buf.Bytes()
+}
+
+// pcapng renders a little-endian pcapng capture with one interface at nanosecond resolution.
+func (c *testCapture) pcapng() []byte {
+	return c.pcapngTsresol(9)
+}
+
+// pcapngTsresol renders the capture with res as the if_tsresol option; timestamps are still written in
+// nanoseconds.
+func (c *testCapture) pcapngTsresol(res byte) []byte {
+	var buf bytes.Buffer
+	block := func(typ uint32, body []byte) {
+		for len(body)%4 != 0 {
+			body = append(body, 0)
+		}
+		total := uint32(12 + len(body))
+		_ = binary.Write(&buf, binary.LittleEndian, typ)
+		_ = binary.Write(&buf, binary.LittleEndian, total)
+		buf.Write(body)
+		_ = binary.Write(&buf, binary.LittleEndian, total)
+	}
+	le := binary.LittleEndian
+
+	shb := make([]byte, 16)
+	le.PutUint32(shb, pcapngByteOrder)
+	le.PutUint16(shb[4:], 1)
+	le.PutUint64(shb[8:], ^uint64(0))
+	block(pcapngSHB, shb)
+
+	idb := make([]byte, 8, 24)
+	le.PutUint16(idb, linkEthernet)
+	idb = le.AppendUint16(idb, 9) // if_tsresol
+	idb = le.AppendUint16(idb, 1)
+	idb = append(idb, res, 0, 0, 0)
+	idb = append(idb, 0, 0, 0, 0) // opt_endofopt
+	block(pcapngBlockIDB, idb)
+
+	for _, f := range c.frames {
+		ticks := uint64(f.ts.UnixNano())
+		epb := make([]byte, 20, 20+len(f.data))
+		le.PutUint32(epb[4:], uint32(ticks>>32))
+		le.PutUint32(epb[8:], uint32(ticks))
+		le.PutUint32(epb[12:], uint32(len(f.data)))
+		le.PutUint32(epb[16:], uint32(len(f.data)))
+		block(pcapngBlockEPB, append(epb, f.data...))
+	}
+	return buf.Bytes()
+}
+
+var (
+	testClient = netip.MustParseAddrPort("192.168.1.10:50000")
+	testServer = netip.MustParseAddrPort("192.168.1.20:554")
+)
+
+func TestReadCaptureFormats(t *testing.T) {
+	c := newTestCapture()
+	c.tcp(0, testClient, testServer, tcpFlagSYN, nil)
+	c.tcp(1500*time.Microsecond, testClient, testServer, 0, []byte("hello"))
+	c.udp(2*time.Second+123456789, testServer, netip.MustParseAddrPort("192.168.1.10:5000"), []byte{1, 2, 3})
+
+	tests := []struct {
+		name  string
+		data  []byte
+		nanos bool
+	}{
+		{"pcap little-endian micros", c.pcap(binary.LittleEndian, false, false), false},
+		{"pcap big-endian nanos", c.pcap(binary.BigEndian, true, false), true},
+		{"pcap raw IP", c.pcap(binary.LittleEndian, false, true), false},
+		{"pcapng", c.pcapng(), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pkts, st, err := readCapture(bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("readCapture: %v", err)
+			}
+			if len(pkts) != 3 || st.frames != 3 {
+				t.Fatalf("got %d packets from %d frames, want 3", len(pkts), st.frames)
+			}
+			syn, data, dgram := pkts[0], pkts[1], pkts[2]
+			if syn.proto != ipProtoTCP || syn.flags&tcpFlagSYN == 0 || syn.seq != 0xfffffff0 {
+				t.Fatalf("unexpected SYN %+v", syn)
+			}
+			if data.src != testClient || data.dst != testServer || string(data.payload) != "hello" || data.seq != 0xfffffff1 {
+				t.Fatalf("unexpected data segment %+v", data)
+			}
+			if got := data.ts.Sub(c.t0); got != 1500*time.Microsecond {
+				t.Fatalf("segment at %v, want 1.5ms", got)
+			}
+			want := 2*time.Second + 123456*time.Microsecond
+			if tt.nanos {
+				want = 2*time.Second + 123456789
+			}
+			if got := dgram.ts.Sub(c.t0); got != want {
+				t.Fatalf("datagram at %v, want %v", got, want)
+			}
+			if dgram.proto != ipProtoUDP || dgram.dst.Port() != 5000 || !bytes.Equal(dgram.payload, []byte{1, 2, 3}) {
+				t.Fatalf("unexpected datagram %+v", dgram)
+			}
+		})
+	}
+}
+
+func TestReadPcapngTsresol(t *testing.T) {
+	// The finest resolutions that still fit: 1.5s in ticks
+	for _, tt := range []struct {
+		res   byte
+		ticks int64
+	}{{18, 1_500_000_000_000_000_000}, {0x80 | 62, 3 << 61}} {
+		idb := binary.LittleEndian.AppendUint16(make([]byte, 8), 9)
+		idb = binary.LittleEndian.AppendUint16(idb, 1)
+		idb = append(idb, tt.res, 0, 0, 0)
+		iface, err := parsePcapngInterface(binary.LittleEndian, idb)
+		if err != nil {
+			t.Fatalf("if_tsresol %#x: %v", tt.res, err)
+		}
+		if got, want := iface.time(tt.ticks), time.Unix(1, 5e8); !got.Equal(want) {
+			t.Fatalf("if_tsresol %#x: got %v, want %v", tt.res, got, want)
+		}
+	}
+
+	// Anything finer overflows the divisor; it must be an error, not a crash
+	c := newTestCapture()
+	c.tcp(0, testClient, testServer, tcpFlagSYN, nil)
+	for _, res := range []byte{19, 63, 64, 0x80 | 63, 0x80 | 64, 0xff} {
+		if _, _, err := readCapture(bytes.NewReader(c.pcapngTsresol(res))); err == nil || !strings.Contains(err.Error(), "invalid pcapng if_tsresol") {
+			t.Fatalf("if_tsresol %#x: got %v, want an invalid if_tsresol error", res, err)
+		}
+		if _, err := AnalyzeCapture(context.Background(), bytes.NewReader(c.pcapngTsresol(res))); err == nil {
+			t.Fatalf("if_tsresol %#x: AnalyzeCapture succeeded", res)
+		}
+	}
+}
+
+func TestReadCaptureRejectsOtherFiles(t *testing.T) {
+	if _, _, err := readCapture(bytes.NewReader([]byte("v=0\r\no=- 0 0 IN IP4 127.0.0.1\r\n"))); err == nil {
+		t.Fatalf("expected an error for a non-capture file")
+	}
+}
+
+func TestReassembleTCP(t *testing.T) {
+	c := newTestCapture()
+	c.tcp(0, testClient, testServer, tcpFlagSYN, nil)
+	c.tcp(1*time.Millisecond, testClient, testServer, 0, []byte("abc"))
+	c.tcp(2*time.Millisecond, testClient, testServer, 0, []byte("def"))
+	c.tcp(3*time.Millisecond, testClient, testServer, 0, []byte("ghi"))
+	c.tcp(4*time.Millisecond, testClient, testServer, 0, []byte("jkl"))
+	// Swap "def" and "ghi", retransmit "abc" and lose "jkl"
+	c.frames[2], c.frames[3] = c.frames[3], c.frames[2]
+	c.frames = append(c.frames, c.frames[1])
+	c.frames = append(c.frames[:4], c.frames[5:]...)
+	c.tcp(5*time.Millisecond, testClient, testServer, 0, []byte("mno"))
+
+	pkts, _, err := readCapture(bytes.NewReader(c.pcap(binary.LittleEndian, false, false)))
+	if err != nil {
+		t.Fatalf("readCapture: %v", err)
+	}
+	segs := make([]*capturedPacket, len(pkts))
+	for i := range pkts {
+		segs[i] = &pkts[i]
+	}
+	s := reassembleTCP(segs)
+	if string(s.data) != "abcdefghimno" {
+		t.Fatalf("reassembled %q", s.data)
+	}
+	if s.missing != 3 {
+		t.Fatalf("missing %d bytes, want 3", s.missing)
+	}
+	// "ghi" was captured before "def"; "mno" last
+	if got := s.timeAt(0).Sub(c.t0); got != time.Millisecond {
+		t.Fatalf("byte 0 at %v", got)
+	}
+	if got := s.timeAt(len(s.data) - 1).Sub(c.t0); got != 5*time.Millisecond {
+		t.Fatalf("last byte at %v", got)
+	}
+}
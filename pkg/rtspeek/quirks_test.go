@@ -0,0 +1,55 @@
+package rtspeek
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/0x524A/rtspeek/pkg/rtspeektest"
+)
+
+// TestDescribeStreamCameraQuirks pins the outcome and failure classification of DescribeStream against
+// every quirk profile of the test server, with and without credentials.
+func TestDescribeStreamCameraQuirks(t *testing.T) {
+	tests := []struct {
+		quirk string
+		want  string // classification without credentials, "" for success
+		creds string // classification with credentials
+	}{
+		{quirk: rtspeektest.QuirkNoContentBase},
+		{quirk: rtspeektest.QuirkSDPBareLF},
+		{quirk: rtspeektest.QuirkCloseAfterOptions, want: "connection_closed", creds: "connection_closed"},
+		{quirk: rtspeektest.QuirkAuthEverySecond, want: "auth_required"},
+		{quirk: rtspeektest.QuirkWrongCSeq, want: "timeout", creds: "timeout"},
+		{quirk: rtspeektest.QuirkTrickle},
+		{quirk: rtspeektest.QuirkNeverAnswers, want: "timeout", creds: "timeout"},
+	}
+	if len(tests) != len(rtspeektest.Quirks()) {
+		t.Fatalf("table covers %d of %d quirks %v", len(tests), len(rtspeektest.Quirks()), rtspeektest.Quirks())
+	}
+
+	classifier := NewErrorClassifier()
+	for _, tt := range tests {
+		t.Run(tt.quirk, func(t *testing.T) {
+			t.Parallel()
+			for _, withCreds := range []bool{false, true} {
+				srv := rtspeektest.Start(t, rtspeektest.Config{Quirks: []string{tt.quirk}, FrameInterval: -1})
+				url, want := srv.URL, tt.want
+				if withCreds {
+					url, want = srv.URLWithCredentials("admin", "secret"), tt.creds
+				}
+
+				info, err := DescribeStream(context.Background(), url, 1500*time.Millisecond)
+				if got := classifier.Classify(err); got != want {
+					t.Fatalf("credentials=%v: classified %q, want %q (err: %v)", withCreds, got, want, err)
+				}
+				if !info.IsReachable() || info.IsDescribeSucceeded() != (want == "") {
+					t.Fatalf("credentials=%v: reachable=%v describe_ok=%v", withCreds, info.IsReachable(), info.IsDescribeSucceeded())
+				}
+				if want == "" && info.GetVideoResolutionString() != "1280x720" {
+					t.Fatalf("credentials=%v: expected the 1280x720 track, got %q", withCreds, info.GetVideoResolutionString())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,507 @@
+package rtspeek
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/bluenviron/gortsplib/v4/pkg/format/rtpmpeg4audio"
+	"github.com/bluenviron/gortsplib/v4/pkg/format/rtpsimpleaudio"
+	h264conf "github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
+	h265conf "github.com/bluenviron/mediacommon/v2/pkg/codecs/h265"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/mpeg4audio"
+	"github.com/pion/rtp"
+)
+
+// Supported clip container formats.
+const (
+	RecordFormatFMP4   = "fmp4"
+	RecordFormatMPEGTS = "mpegts"
+)
+
+// aacSamplesPerAU is the number of PCM samples carried by one AAC access unit.
+const aacSamplesPerAU = 1024
+
+// RecordOptions configures Record.
+type RecordOptions struct {
+	// Format is RecordFormatFMP4 (default) or RecordFormatMPEGTS.
+	Format string
+	// Duration of media to capture; it also caps keyframe-bounded recordings.
+	Duration time.Duration
+	// Keyframes stops the recording before the (N+1)th keyframe of the leading video track (0 disables).
+	Keyframes int
+	// Transport forces "udp", "tcp" or "multicast"; empty lets the client choose.
+	Transport string
+}
+
+// RecordReport describes a written clip.
+type RecordReport struct {
+	URL       string          `json:"url"`
+	Format    string          `json:"format"`
+	Duration  float64         `json:"duration"` // seconds, longest track
+	Bytes     int64           `json:"bytes"`
+	Transport string          `json:"transport,omitempty"`
+	Stopped   string          `json:"stopped"` // duration, keyframes, timeout or session_closed
+	Tracks    []RecordedTrack `json:"tracks"`
+	Skipped   []SkippedTrack  `json:"skipped,omitempty"`
+}
+
+// RecordedTrack describes one track of a written clip.
+type RecordedTrack struct {
+	MediaIndex int         `json:"media_index"`
+	Codec      string      `json:"codec"`
+	Samples    int         `json:"samples"`
+	Duration   float64     `json:"duration"` // seconds
+	Bytes      int         `json:"bytes"`    // payload bytes before container overhead
+	Resolution *Resolution `json:"resolution,omitempty"`
+	// Keyframes lists keyframe presentation offsets in seconds from the start of the clip.
+	Keyframes []float64 `json:"keyframe_offsets,omitempty"`
+}
+
+// SkippedTrack is a media that was not written to the clip.
+type SkippedTrack struct {
+	MediaIndex int    `json:"media_index"`
+	Codec      string `json:"codec"`
+	Reason     string `json:"reason"`
+}
+
+// Record captures every supported track of a stream into w as fragmented MP4 or MPEG-TS.
+// Samples are held in memory until the recording stops, so it is meant for short clips.
+// The timeout covers connecting and waiting for the first keyframe on top of opts.Duration.
+func Record(ctx context.Context, url string, timeout time.Duration, w io.Writer, opts RecordOptions) (*RecordReport, error) {
+	if opts.Format == "" {
+		opts.Format = RecordFormatFMP4
+	}
+	if opts.Format != RecordFormatFMP4 && opts.Format != RecordFormatMPEGTS {
+		return nil, fmt.Errorf("unknown record format %q (want %s or %s)", opts.Format, RecordFormatFMP4, RecordFormatMPEGTS)
+	}
+	if opts.Duration <= 0 {
+		return nil, errors.New("record duration must be positive")
+	}
+	parsedURL, err := parseRTSPURL(url)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parseTransport(opts.Transport); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout+opts.Duration)
+	defer cancel()
+
+	dialer := NewNetworkDialer(timeout)
+	if err := dialer.PreflightDial(ctx, parsedURL); err != nil {
+		return nil, fmt.Errorf("connection failed: %w", err)
+	}
+
+	session := NewRTSPSession(timeout, nil)
+	defer session.Close()
+	_ = session.SetTransport(opts.Transport) // validated above
+
+	desc, _, err := session.PerformDescribe(ctx, parsedURL)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RecordReport{URL: url, Format: opts.Format}
+	rec := newRecorder(opts)
+	var medias []*description.Media
+	for _, m := range playableMedias(desc) {
+		idx := mediaIndex(desc, m)
+		t, reason := newRecordTrack(idx, m, opts.Format)
+		if t == nil {
+			report.Skipped = append(report.Skipped, SkippedTrack{MediaIndex: idx, Codec: extractFormatName(m.Formats[0]), Reason: reason})
+			continue
+		}
+		rec.add(t)
+		medias = append(medias, m)
+	}
+	if len(medias) == 0 {
+		return nil, errors.New("no recordable tracks (H264, H265, MJPEG, AAC or Opus)")
+	}
+
+	transport, err := session.SetupAndPlay(desc, medias, rec.handleRTP, nil)
+	if err != nil {
+		return nil, err
+	}
+	report.Transport = transport
+
+	waitCh := make(chan error, 1)
+	go func() { waitCh <- session.Wait() }()
+
+	select {
+	case <-rec.done:
+	case <-ctx.Done():
+		rec.stop("timeout")
+	case <-waitCh:
+		rec.stop("session_closed")
+	}
+	if session.transportSwitched.Load() {
+		report.Transport = "tcp"
+	}
+	session.Close()
+
+	return rec.write(w, report)
+}
+
+// mediaIndex returns the position of m in the description.
+func mediaIndex(desc *description.Session, m *description.Media) int {
+	for i, dm := range desc.Medias {
+		if dm == m {
+			return i
+		}
+	}
+	return -1
+}
+
+// recordSample is one access unit with timestamps in the track clock.
+type recordSample struct {
+	pts, dts int64
+	random   bool
+	nalus    [][]byte // H264 / H265
+	data     []byte   // MJPEG / audio
+}
+
+// recordTrack depacketizes one media and accumulates its samples.
+type recordTrack struct {
+	index     int
+	media     *description.Media
+	codec     string
+	clockRate int
+	isVideo   bool
+
+	video     *frameDecoder
+	aac       *rtpmpeg4audio.Decoder
+	aacConfig *mpeg4audio.Config
+	opus      *rtpsimpleaudio.Decoder
+	channels  int
+	h264DTS   *h264conf.DTSExtractor
+	h265DTS   *h265conf.DTSExtractor
+
+	unwrap    tsUnwrapper
+	started   bool
+	offset    int64
+	keyframes int
+	samples   []recordSample
+}
+
+// newRecordTrack returns nil and a reason when the media cannot be written in the given format.
+func newRecordTrack(index int, m *description.Media, containerFormat string) (*recordTrack, string) {
+	f := m.Formats[0]
+	t := &recordTrack{index: index, media: m, codec: extractFormatName(f), clockRate: f.ClockRate()}
+
+	switch ct := f.(type) {
+	case *format.H264, *format.H265, *format.MJPEG:
+		if _, ok := f.(*format.MJPEG); ok && containerFormat == RecordFormatMPEGTS {
+			return nil, "MJPEG is not supported in MPEG-TS"
+		}
+		fd, err := newFrameDecoder(f)
+		if err != nil {
+			return nil, err.Error()
+		}
+		t.video, t.isVideo = fd, true
+		t.codec = fd.codec
+		switch f.(type) {
+		case *format.H264:
+			t.h264DTS = &h264conf.DTSExtractor{}
+			t.h264DTS.Initialize()
+		case *format.H265:
+			t.h265DTS = &h265conf.DTSExtractor{}
+			t.h265DTS.Initialize()
+		}
+
+	case *format.MPEG4Audio:
+		if ct.Config == nil {
+			return nil, "missing AAC config"
+		}
+		dec, err := ct.CreateDecoder()
+		if err != nil {
+			return nil, err.Error()
+		}
+		t.aac, t.aacConfig, t.codec = dec, ct.Config, "AAC"
+
+	case *format.Opus:
+		dec, err := ct.CreateDecoder()
+		if err != nil {
+			return nil, err.Error()
+		}
+		t.opus, t.channels = dec, ct.ChannelCount
+		if t.channels == 0 {
+			t.channels = 2
+		}
+
+	default:
+		return nil, "codec not supported by the muxer"
+	}
+	return t, ""
+}
+
+// decode turns a packet into zero or more samples with unwrapped RTP timestamps.
+func (t *recordTrack) decode(pkt *rtp.Packet, received time.Time) ([]recordSample, error) {
+	switch {
+	case t.video != nil:
+		au, err := t.video.decode(pkt, received)
+		if err != nil || au == nil {
+			return nil, err
+		}
+		ts := t.unwrap.unwrap(au.timestamp)
+		return []recordSample{{pts: ts, random: au.random, nalus: au.nalus, data: au.image}}, nil
+
+	case t.aac != nil:
+		aus, err := t.aac.Decode(pkt)
+		if err != nil {
+			if errors.Is(err, rtpmpeg4audio.ErrMorePacketsNeeded) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		ts := t.unwrap.unwrap(pkt.Timestamp)
+		out := make([]recordSample, len(aus))
+		for i, au := range aus {
+			out[i] = recordSample{pts: ts + int64(i*aacSamplesPerAU), random: true, data: au}
+		}
+		return out, nil
+
+	default:
+		data, err := t.opus.Decode(pkt)
+		if err != nil {
+			return nil, err
+		}
+		return []recordSample{{pts: t.unwrap.unwrap(pkt.Timestamp), random: true, data: data}}, nil
+	}
+}
+
+// extractDTS computes the decode timestamp, keeping it strictly increasing.
+func (t *recordTrack) extractDTS(s *recordSample) {
+	s.dts = s.pts
+	var err error
+	switch {
+	case t.h264DTS != nil:
+		s.dts, err = t.h264DTS.Extract(s.nalus, s.pts)
+	case t.h265DTS != nil:
+		s.dts, err = t.h265DTS.Extract(s.nalus, s.pts)
+	}
+	if err != nil {
+		s.dts = s.pts
+	}
+	if n := len(t.samples); n > 0 && s.dts <= t.samples[n-1].dts {
+		s.dts = t.samples[n-1].dts + 1
+	}
+}
+
+// tsUnwrapper extends 32-bit RTP timestamps to a monotonic-ish 64-bit timeline.
+type tsUnwrapper struct {
+	init bool
+	prev uint32
+	cur  int64
+}
+
+func (u *tsUnwrapper) unwrap(ts uint32) int64 {
+	if !u.init {
+		u.init, u.prev = true, ts
+		return 0
+	}
+	u.cur += int64(int32(ts - u.prev))
+	u.prev = ts
+	return u.cur
+}
+
+// recorder gates all tracks on the first keyframe of the leading track and enforces stop conditions.
+type recorder struct {
+	opts    RecordOptions
+	mu      sync.Mutex
+	tracks  map[*description.Media]*recordTrack
+	order   []*recordTrack
+	leading *recordTrack
+	begun   bool
+	start   time.Time
+	stopped string
+	done    chan struct{}
+}
+
+func newRecorder(opts RecordOptions) *recorder {
+	return &recorder{opts: opts, tracks: make(map[*description.Media]*recordTrack), done: make(chan struct{})}
+}
+
+func (r *recorder) add(t *recordTrack) {
+	r.tracks[t.media] = t
+	r.order = append(r.order, t)
+	// The first video track leads; audio-only clips are led by their first track
+	if r.leading == nil || (!r.leading.isVideo && t.isVideo) {
+		r.leading = t
+	}
+}
+
+func (r *recorder) stop(reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopLocked(reason)
+}
+
+func (r *recorder) stopLocked(reason string) {
+	if r.stopped == "" {
+		r.stopped = reason
+		close(r.done)
+	}
+}
+
+func (r *recorder) handleRTP(m *description.Media, _ format.Format, pkt *rtp.Packet) {
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t := r.tracks[m]
+	if t == nil || r.stopped != "" {
+		return
+	}
+	samples, err := t.decode(pkt, now)
+	if err != nil {
+		return
+	}
+
+	for _, s := range samples {
+		if !r.begun {
+			if t != r.leading || !s.random {
+				continue
+			}
+			r.begun, r.start = true, now
+		}
+		if !t.started {
+			// Align each track to the leading track by arrival time of its first sample
+			t.started = true
+			t.offset = int64(now.Sub(r.start).Seconds()*float64(t.clockRate)) - s.pts
+		}
+		s.pts += t.offset
+
+		if t == r.leading {
+			if s.pts >= int64(r.opts.Duration.Seconds()*float64(t.clockRate)) {
+				r.stopLocked("duration")
+				return
+			}
+			if s.random && t.isVideo {
+				if r.opts.Keyframes > 0 && t.keyframes == r.opts.Keyframes {
+					r.stopLocked("keyframes")
+					return
+				}
+				t.keyframes++
+			}
+		}
+		t.extractDTS(&s)
+		t.samples = append(t.samples, s)
+	}
+}
+
+// write normalizes timestamps, muxes the recorded tracks into w and fills the report.
+func (r *recorder) write(w io.Writer, report *RecordReport) (*RecordReport, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	report.Stopped = r.stopped
+
+	var tracks []*recordTrack
+	for _, t := range r.order {
+		if len(t.samples) == 0 {
+			report.Skipped = append(report.Skipped, SkippedTrack{MediaIndex: t.index, Codec: t.codec, Reason: "no samples received"})
+			continue
+		}
+		tracks = append(tracks, t)
+	}
+	if len(tracks) == 0 {
+		return nil, fmt.Errorf("nothing recorded (stopped: %s)", r.stopped)
+	}
+	shiftToZero(tracks)
+
+	cw := &countingWriter{w: w}
+	var err error
+	if report.Format == RecordFormatMPEGTS {
+		err = writeMPEGTS(cw, tracks)
+	} else {
+		err = writeFMP4(cw, tracks)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("write %s: %w", report.Format, err)
+	}
+	report.Bytes = cw.n
+
+	for _, t := range tracks {
+		rt := t.summary()
+		if rt.Duration > report.Duration {
+			report.Duration = rt.Duration
+		}
+		report.Tracks = append(report.Tracks, rt)
+	}
+	return report, nil
+}
+
+// shiftToZero moves all tracks by the same wall-clock amount so no DTS is negative.
+func shiftToZero(tracks []*recordTrack) {
+	minSec := 0.0
+	for _, t := range tracks {
+		if sec := float64(t.samples[0].dts) / float64(t.clockRate); sec < minSec {
+			minSec = sec
+		}
+	}
+	if minSec == 0 {
+		return
+	}
+	for _, t := range tracks {
+		shift := int64(-minSec*float64(t.clockRate) + 0.5)
+		for i := range t.samples {
+			t.samples[i].pts += shift
+			t.samples[i].dts += shift
+		}
+	}
+}
+
+// durations returns the per-sample durations; the last sample repeats the previous one.
+func (t *recordTrack) durations() []int64 {
+	out := make([]int64, len(t.samples))
+	for i := range t.samples {
+		switch {
+		case i+1 < len(t.samples):
+			out[i] = t.samples[i+1].dts - t.samples[i].dts
+		case i > 0:
+			out[i] = out[i-1]
+		case t.aac != nil:
+			out[i] = aacSamplesPerAU
+		default:
+			out[i] = int64(t.clockRate / 25)
+		}
+	}
+	return out
+}
+
+func (t *recordTrack) summary() RecordedTrack {
+	rt := RecordedTrack{MediaIndex: t.index, Codec: t.codec, Samples: len(t.samples)}
+	durs := t.durations()
+	first, last := t.samples[0], t.samples[len(t.samples)-1]
+	rt.Duration = float64(last.dts-first.dts+durs[len(durs)-1]) / float64(t.clockRate)
+	for _, s := range t.samples {
+		rt.Bytes += len(s.data) + nalusSize(s.nalus)
+		if t.isVideo && s.random {
+			rt.Keyframes = append(rt.Keyframes, float64(s.pts)/float64(t.clockRate))
+		}
+	}
+	if t.video != nil {
+		rt.Resolution = t.video.resolution()
+		if rt.Resolution == nil && t.codec == "MJPEG" {
+			rt.Resolution = jpegResolution(first.data)
+		}
+	}
+	return rt
+}
+
+// countingWriter counts bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,181 @@
+package rtspeek
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	h264conf "github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/fmp4"
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/fmp4/seekablebuffer"
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/mpegts"
+)
+
+// mpegtsClockRate is the MPEG-TS presentation clock.
+const mpegtsClockRate = 90000
+
+// writeFMP4 writes an init segment followed by one fragment per second of media.
+func writeFMP4(w io.Writer, tracks []*recordTrack) error {
+	var buf seekablebuffer.Buffer
+
+	init := fmp4.Init{}
+	for i, t := range tracks {
+		codec, err := t.fmp4Codec()
+		if err != nil {
+			return err
+		}
+		init.Tracks = append(init.Tracks, &fmp4.InitTrack{ID: i + 1, TimeScale: uint32(t.clockRate), Codec: codec})
+	}
+	if err := init.Marshal(&buf); err != nil {
+		return err
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+
+	durations := make([][]int64, len(tracks))
+	next := make([]int, len(tracks))
+	for i, t := range tracks {
+		durations[i] = t.durations()
+	}
+
+	for seq, second := uint32(1), int64(1); ; second++ {
+		part := fmp4.Part{SequenceNumber: seq}
+		remaining := false
+		for i, t := range tracks {
+			end := second * int64(t.clockRate)
+			var pt *fmp4.PartTrack
+			for ; next[i] < len(t.samples) && t.samples[next[i]].dts < end; next[i]++ {
+				s := t.samples[next[i]]
+				if pt == nil {
+					pt = &fmp4.PartTrack{ID: i + 1, BaseTime: uint64(s.dts)}
+				}
+				payload, err := t.fmp4Payload(s)
+				if err != nil {
+					return err
+				}
+				pt.Samples = append(pt.Samples, &fmp4.Sample{
+					Duration:        uint32(durations[i][next[i]]),
+					PTSOffset:       int32(s.pts - s.dts),
+					IsNonSyncSample: !s.random,
+					Payload:         payload,
+				})
+			}
+			if pt != nil {
+				part.Tracks = append(part.Tracks, pt)
+			}
+			if next[i] < len(t.samples) {
+				remaining = true
+			}
+		}
+
+		if len(part.Tracks) > 0 {
+			buf.Reset()
+			if err := part.Marshal(&buf); err != nil {
+				return err
+			}
+			if _, err := w.Write(buf.Bytes()); err != nil {
+				return err
+			}
+			seq++
+		}
+		if !remaining {
+			return nil
+		}
+	}
+}
+
+func (t *recordTrack) fmp4Codec() (fmp4.Codec, error) {
+	switch t.codec {
+	case "H264":
+		if t.video.sps == nil || t.video.pps == nil {
+			return nil, fmt.Errorf("media %d: H264 SPS/PPS not received", t.index)
+		}
+		return &fmp4.CodecH264{SPS: t.video.sps, PPS: t.video.pps}, nil
+	case "H265":
+		if t.video.vps == nil || t.video.sps == nil || t.video.pps == nil {
+			return nil, fmt.Errorf("media %d: H265 VPS/SPS/PPS not received", t.index)
+		}
+		return &fmp4.CodecH265{VPS: t.video.vps, SPS: t.video.sps, PPS: t.video.pps}, nil
+	case "MJPEG":
+		r := jpegResolution(t.samples[0].data)
+		if r == nil {
+			return nil, fmt.Errorf("media %d: unreadable JPEG header", t.index)
+		}
+		return &fmp4.CodecMJPEG{Width: r.Width, Height: r.Height}, nil
+	case "AAC":
+		return &fmp4.CodecMPEG4Audio{Config: *t.aacConfig}, nil
+	default:
+		return &fmp4.CodecOpus{ChannelCount: t.channels}, nil
+	}
+}
+
+// fmp4Payload returns the sample in ISO BMFF form (length-prefixed NAL units for H264/H265).
+func (t *recordTrack) fmp4Payload(s recordSample) ([]byte, error) {
+	if s.nalus != nil {
+		return h264conf.AVCC(s.nalus).Marshal()
+	}
+	return s.data, nil
+}
+
+// writeMPEGTS interleaves all samples by decode time into a transport stream.
+func writeMPEGTS(w io.Writer, tracks []*recordTrack) error {
+	type entry struct {
+		track  *recordTrack
+		ts     *mpegts.Track
+		sample recordSample
+		dts    int64
+	}
+
+	tsTracks := make([]*mpegts.Track, len(tracks))
+	var entries []entry
+	for i, t := range tracks {
+		tsTracks[i] = &mpegts.Track{Codec: t.mpegtsCodec()}
+		for _, s := range t.samples {
+			entries = append(entries, entry{track: t, ts: tsTracks[i], sample: s, dts: rescale(s.dts, t.clockRate, mpegtsClockRate)})
+		}
+	}
+	sort.SliceStable(entries, func(a, b int) bool { return entries[a].dts < entries[b].dts })
+
+	mw := &mpegts.Writer{W: w, Tracks: tsTracks}
+	if err := mw.Initialize(); err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		pts := rescale(e.sample.pts, e.track.clockRate, mpegtsClockRate)
+		var err error
+		switch e.track.codec {
+		case "H264":
+			err = mw.WriteH264(e.ts, pts, e.dts, e.sample.nalus)
+		case "H265":
+			err = mw.WriteH265(e.ts, pts, e.dts, e.sample.nalus)
+		case "AAC":
+			err = mw.WriteMPEG4Audio(e.ts, pts, [][]byte{e.sample.data})
+		default:
+			err = mw.WriteOpus(e.ts, pts, [][]byte{e.sample.data})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *recordTrack) mpegtsCodec() mpegts.Codec {
+	switch t.codec {
+	case "H264":
+		return &mpegts.CodecH264{}
+	case "H265":
+		return &mpegts.CodecH265{}
+	case "AAC":
+		return &mpegts.CodecMPEG4Audio{Config: *t.aacConfig}
+	default:
+		return &mpegts.CodecOpus{ChannelCount: t.channels}
+	}
+}
+
+// rescale converts a timestamp between clock rates.
+func rescale(v int64, from, to int) int64 {
+	return v * int64(to) / int64(from)
+}
@@ -0,0 +1,156 @@
+package rtspeek
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/0x524A/rtspeek/pkg/rtspeektest"
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/bluenviron/mediacommon/v2/pkg/codecs/mpeg4audio"
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/fmp4"
+	"github.com/bluenviron/mediacommon/v2/pkg/formats/mpegts"
+)
+
+func h264Media() *description.Media {
+	return &description.Media{Type: description.MediaTypeVideo, Formats: []format.Format{&format.H264{PayloadTyp: 96, SPS: rtspeektest.H264SPS, PPS: rtspeektest.H264PPS, PacketizationMode: 1}}}
+}
+
+func TestRecordFMP4Keyframes(t *testing.T) {
+	video := h264Media()
+	desc := &description.Session{Medias: []*description.Media{video}}
+	src := newH264Source(5)
+	url := startPlayServer(t, desc, 5*time.Millisecond, func(stream *gortsplib.ServerStream, n int) {
+		for _, pkt := range src.frame(n) {
+			_ = stream.WritePacketRTP(video, pkt)
+		}
+	})
+
+	var buf bytes.Buffer
+	report, err := Record(context.Background(), url, 3*time.Second, &buf, RecordOptions{Duration: 10 * time.Second, Keyframes: 2, Transport: "tcp"})
+	if err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	if report.Stopped != "keyframes" || len(report.Tracks) != 1 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	tr := report.Tracks[0]
+	if tr.Codec != "H264" || tr.Samples != 10 || len(tr.Keyframes) != 2 || tr.Keyframes[1] != 0.2 {
+		t.Fatalf("unexpected track: %+v", tr)
+	}
+	if tr.Duration != 0.4 || tr.Resolution == nil || tr.Resolution.Width != 1280 {
+		t.Fatalf("unexpected duration/resolution: %+v", tr)
+	}
+	if report.Bytes != int64(buf.Len()) {
+		t.Fatalf("reported %d bytes, wrote %d", report.Bytes, buf.Len())
+	}
+
+	var init fmp4.Init
+	if err := init.Unmarshal(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	if _, ok := init.Tracks[0].Codec.(*fmp4.CodecH264); !ok {
+		t.Fatalf("unexpected codec %T", init.Tracks[0].Codec)
+	}
+	var parts fmp4.Parts
+	if err := parts.Unmarshal(buf.Bytes()); err != nil {
+		t.Fatalf("parts: %v", err)
+	}
+	samples := 0
+	for _, p := range parts {
+		for _, pt := range p.Tracks {
+			samples += len(pt.Samples)
+		}
+	}
+	if samples != 10 || parts[0].Tracks[0].Samples[0].IsNonSyncSample {
+		t.Fatalf("expected 10 samples starting with a sync sample, got %d", samples)
+	}
+}
+
+func TestRecordMPEGTSWithAudio(t *testing.T) {
+	video := h264Media()
+	aac := &format.MPEG4Audio{
+		PayloadTyp: 97,
+		Config:     &mpeg4audio.AudioSpecificConfig{Type: mpeg4audio.ObjectTypeAACLC, SampleRate: 48000, ChannelCount: 2},
+		SizeLength: 13, IndexLength: 3, IndexDeltaLength: 3,
+	}
+	audio := &description.Media{Type: description.MediaTypeAudio, Formats: []format.Format{aac}}
+	desc := &description.Session{Medias: []*description.Media{video, audio}}
+
+	src := newH264Source(5)
+	src.SliceSize = 200
+	audioEnc, err := aac.CreateEncoder()
+	if err != nil {
+		t.Fatalf("create encoder: %v", err)
+	}
+	audioTS := uint32(0)
+	url := startPlayServer(t, desc, 40*time.Millisecond, func(stream *gortsplib.ServerStream, n int) {
+		for _, pkt := range src.frame(n) {
+			_ = stream.WritePacketRTP(video, pkt)
+		}
+		for audioTS < uint32(n+1)*1920 {
+			pkts, err := audioEnc.Encode([][]byte{{0x21, 0x10, 0x04, 0x60, 0x8c, 0x1c}})
+			if err != nil {
+				return
+			}
+			for _, pkt := range pkts {
+				pkt.Timestamp = audioTS
+				_ = stream.WritePacketRTP(audio, pkt)
+			}
+			audioTS += aacSamplesPerAU
+		}
+	})
+
+	var buf bytes.Buffer
+	report, err := Record(context.Background(), url, 3*time.Second, &buf, RecordOptions{Format: RecordFormatMPEGTS, Duration: 500 * time.Millisecond, Transport: "tcp"})
+	if err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	if report.Stopped != "duration" || len(report.Tracks) != 2 || report.Tracks[1].Codec != "AAC" {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	r := &mpegts.Reader{R: bytes.NewReader(buf.Bytes())}
+	if err := r.Initialize(); err != nil {
+		t.Fatalf("reader: %v", err)
+	}
+	var videoAUs, audioAUs int
+	for _, tr := range r.Tracks() {
+		switch tr.Codec.(type) {
+		case *mpegts.CodecH264:
+			r.OnDataH264(tr, func(int64, int64, [][]byte) error { videoAUs++; return nil })
+		case *mpegts.CodecMPEG4Audio:
+			r.OnDataMPEG4Audio(tr, func(_ int64, aus [][]byte) error { audioAUs += len(aus); return nil })
+		}
+	}
+	for r.Read() == nil {
+	}
+	if videoAUs == 0 || audioAUs == 0 {
+		t.Fatalf("expected both tracks in the transport stream, got video=%d audio=%d", videoAUs, audioAUs)
+	}
+}
+
+func TestRecordOptionsValidation(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := Record(context.Background(), "rtsp://127.0.0.1:1/x", time.Second, &buf, RecordOptions{Format: "avi", Duration: time.Second}); err == nil {
+		t.Fatal("expected format error")
+	}
+	if _, err := Record(context.Background(), "rtsp://127.0.0.1:1/x", time.Second, &buf, RecordOptions{}); err == nil {
+		t.Fatal("expected duration error")
+	}
+}
+
+func TestTSUnwrapper(t *testing.T) {
+	var u tsUnwrapper
+	for _, c := range []struct {
+		in   uint32
+		want int64
+	}{{0xfffff000, 0}, {0xfffff800, 0x800}, {0x00000800, 0x1800}, {0x00000400, 0x1400}} {
+		if got := u.unwrap(c.in); got != c.want {
+			t.Fatalf("unwrap(%#x) = %#x, want %#x", c.in, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package rtspeek
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+// SessionRecordingVersion is the version of the session file format written by SessionRecorder.
+const SessionRecordingVersion = 1
+
+// DefaultRecordedPackets is the number of media packets a SessionRecorder keeps when none is given.
+const DefaultRecordedPackets = 500
+
+// SessionRecording is the wire-level RTSP exchange of one DescribeStream call, with the first media
+// packets of the live probe. Credentials are never recorded: URLs lose their user info and Authorization
+// headers are dropped.
+type SessionRecording struct {
+	Version    int                `json:"version"`
+	URL        string             `json:"url"`
+	RecordedAt time.Time          `json:"recorded_at"`
+	Options    RecordedOptions    `json:"options"`
+	Exchanges  []RecordedExchange `json:"exchanges"`
+	Packets    []RecordedPacket   `json:"packets,omitempty"`
+	// Outcome is the error classification of the original call ("" on success) and Error its message.
+	Outcome string `json:"outcome,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// RecordedOptions are the DescribeStream options that shaped the conversation.
+type RecordedOptions struct {
+	Backchannel bool    `json:"backchannel,omitempty"`
+	LiveProbe   float64 `json:"live_probe_seconds,omitempty"`
+	Transport   string  `json:"transport,omitempty"`
+}
+
+// RecordedExchange is a request and the response it got (Status 0 when none arrived).
+type RecordedExchange struct {
+	At             float64             `json:"at_ms"` // since the start of the call
+	Method         string              `json:"method"`
+	URL            string              `json:"url"`
+	Header         map[string][]string `json:"header,omitempty"`
+	Status         int                 `json:"status,omitempty"`
+	Message        string              `json:"message,omitempty"`
+	ResponseHeader map[string][]string `json:"response_header,omitempty"`
+	Body           string              `json:"body,omitempty"`
+	Latency        float64             `json:"latency_ms,omitempty"`
+}
+
+// RecordedPacket is a media packet received during the live probe.
+type RecordedPacket struct {
+	At    float64 `json:"at_ms"` // since the PLAY response
+	Media int     `json:"media"` // index in the SDP
+	RTCP  bool    `json:"rtcp,omitempty"`
+	Data  []byte  `json:"data"`
+}
+
+// SessionRecorder captures a SessionRecording from DescribeStream (see WithSessionRecorder).
+type SessionRecorder struct {
+	mu         sync.Mutex
+	maxPackets int
+	start      time.Time
+	played     time.Time
+	rec        SessionRecording
+	pending    map[string]int // CSeq to exchange index
+	sent       map[string]time.Time
+}
+
+// NewSessionRecorder creates a recorder keeping up to maxPackets media packets (DefaultRecordedPackets if 0).
+func NewSessionRecorder(maxPackets int) *SessionRecorder {
+	if maxPackets <= 0 {
+		maxPackets = DefaultRecordedPackets
+	}
+	return &SessionRecorder{
+		maxPackets: maxPackets,
+		rec:        SessionRecording{Version: SessionRecordingVersion},
+		pending:    make(map[string]int),
+		sent:       make(map[string]time.Time),
+	}
+}
+
+// session recorder context key and helpers
+type sessionRecorderCtxKey struct{}
+
+var sessionRecorderKey = sessionRecorderCtxKey{}
+
+// WithSessionRecorder makes DescribeStream record its RTSP exchange and live probe packets into rec.
+func WithSessionRecorder(ctx context.Context, rec *SessionRecorder) context.Context {
+	return context.WithValue(ctx, sessionRecorderKey, rec)
+}
+
+func sessionRecorder(ctx context.Context) *SessionRecorder {
+	rec, _ := ctx.Value(sessionRecorderKey).(*SessionRecorder)
+	return rec
+}
+
+// Recording returns a copy of what was recorded so far.
+func (sr *SessionRecorder) Recording() *SessionRecording {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	rec := sr.rec
+	rec.Exchanges = append([]RecordedExchange(nil), sr.rec.Exchanges...)
+	rec.Packets = append([]RecordedPacket(nil), sr.rec.Packets...)
+	return &rec
+}
+
+// begin starts the recording clock and notes the call options.
+func (sr *SessionRecorder) begin(url *base.URL, opts RecordedOptions) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	sr.start = time.Now()
+	sr.rec.URL = stripURLUser(url)
+	sr.rec.RecordedAt = sr.start.UTC()
+	sr.rec.Options = opts
+}
+
+// finish notes the outcome of the call.
+func (sr *SessionRecorder) finish(err error) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	if err != nil {
+		sr.rec.Outcome = classifyError(err)
+		sr.rec.Error = err.Error()
+	}
+}
+
+func (sr *SessionRecorder) onRequest(req *base.Request) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	now := time.Now()
+	ex := RecordedExchange{
+		At:     msSince(sr.start, now),
+		Method: string(req.Method),
+		Header: recordHeader(req.Header, "Authorization"),
+	}
+	if req.URL != nil {
+		ex.URL = stripURLUser(req.URL)
+	}
+	sr.rec.Exchanges = append(sr.rec.Exchanges, ex)
+	if cseq, ok := req.Header["CSeq"]; ok && len(cseq) == 1 {
+		sr.pending[cseq[0]] = len(sr.rec.Exchanges) - 1
+		sr.sent[cseq[0]] = now
+	}
+}
+
+func (sr *SessionRecorder) onResponse(res *base.Response) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	cseq, ok := res.Header["CSeq"]
+	if !ok || len(cseq) != 1 {
+		return
+	}
+	i, ok := sr.pending[cseq[0]]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	ex := &sr.rec.Exchanges[i]
+	ex.Status = int(res.StatusCode)
+	ex.Message = res.StatusMessage
+	ex.ResponseHeader = recordHeader(res.Header)
+	ex.Body = string(res.Body)
+	ex.Latency = msSince(sr.sent[cseq[0]], now)
+	delete(sr.pending, cseq[0])
+	if ex.Method == string(base.Play) && res.StatusCode == base.StatusOK && sr.played.IsZero() {
+		sr.played = now
+	}
+}
+
+// wrap returns packet callbacks that record before handing packets to onRTP and onRTCP.
+func (sr *SessionRecorder) wrap(desc *description.Session, onRTP gortsplib.OnPacketRTPAnyFunc,
+	onRTCP gortsplib.OnPacketRTCPAnyFunc,
+) (gortsplib.OnPacketRTPAnyFunc, gortsplib.OnPacketRTCPAnyFunc) {
+	index := make(map[*description.Media]int, len(desc.Medias))
+	for i, m := range desc.Medias {
+		index[m] = i
+	}
+	return func(m *description.Media, f format.Format, pkt *rtp.Packet) {
+			if data, err := pkt.Marshal(); err == nil {
+				sr.packet(index[m], false, data)
+			}
+			onRTP(m, f, pkt)
+		}, func(m *description.Media, pkt rtcp.Packet) {
+			if data, err := pkt.Marshal(); err == nil {
+				sr.packet(index[m], true, data)
+			}
+			onRTCP(m, pkt)
+		}
+}
+
+func (sr *SessionRecorder) packet(media int, isRTCP bool, data []byte) {
+	now := time.Now()
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	if len(sr.rec.Packets) >= sr.maxPackets {
+		return
+	}
+	start := sr.played
+	if start.IsZero() {
+		start = now
+	}
+	sr.rec.Packets = append(sr.rec.Packets, RecordedPacket{At: msSince(start, now), Media: media, RTCP: isRTCP, Data: data})
+}
+
+// recordHeader copies a header without the named fields.
+func recordHeader(h base.Header, omit ...string) map[string][]string {
+	out := make(map[string][]string, len(h))
+	for k, v := range h {
+		skip := false
+		for _, o := range omit {
+			skip = skip || strings.EqualFold(k, o)
+		}
+		if !skip {
+			out[k] = append([]string(nil), v...)
+		}
+	}
+	return out
+}
+
+func msSince(start, t time.Time) float64 {
+	return float64(t.Sub(start)) / float64(time.Millisecond)
+}
+
+// WriteSessionRecording writes rec as indented JSON.
+func WriteSessionRecording(w io.Writer, rec *SessionRecording) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rec)
+}
+
+// ReadSessionRecording decodes a session file written by WriteSessionRecording.
+func ReadSessionRecording(r io.Reader) (*SessionRecording, error) {
+	var rec SessionRecording
+	if err := json.NewDecoder(r).Decode(&rec); err != nil {
+		return nil, fmt.Errorf("invalid session file: %w", err)
+	}
+	if rec.Version != SessionRecordingVersion {
+		return nil, fmt.Errorf("unsupported session file version %d", rec.Version)
+	}
+	sort.SliceStable(rec.Packets, func(i, j int) bool { return rec.Packets[i].At < rec.Packets[j].At })
+	return &rec, nil
+}
@@ -0,0 +1,314 @@
+package rtspeek
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/conn"
+	"github.com/bluenviron/gortsplib/v4/pkg/headers"
+)
+
+// ReplayServer serves a SessionRecording back over RTSP so that DescribeStream against URL reproduces the
+// recorded result. Each request gets the next recorded response for its method with its recorded latency;
+// a request that was never answered is not answered again (or the connection is closed, when that is how
+// the recording ended). Authentication challenges that the original client got past are skipped, so no
+// credentials are needed. Media is replayed with its recorded timing over interleaved TCP: UDP SETUPs are
+// refused with 461 Unsupported Transport, which makes an automatic client switch to TCP.
+type ReplayServer struct {
+	// URL is the recorded URL pointed at the replay server.
+	URL string
+
+	rec       *SessionRecording
+	responses map[string][]*RecordedExchange
+	playable  []int // SDP indices of receivable medias, in SETUP order
+	ln        net.Listener
+	done      chan struct{}
+	wg        sync.WaitGroup
+	mu        sync.Mutex
+	conns     map[net.Conn]struct{}
+}
+
+// NewReplayServer starts serving rec on addr ("127.0.0.1:0" when empty).
+func NewReplayServer(rec *SessionRecording, addr string) (*ReplayServer, error) {
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+	u, err := url.Parse(rec.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recorded URL: %w", err)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	u.User, u.Host = nil, ln.Addr().String()
+
+	s := &ReplayServer{
+		URL:       u.String(),
+		rec:       rec,
+		responses: replayResponses(rec.Exchanges),
+		ln:        ln,
+		done:      make(chan struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+	s.playable = replayPlayable(rec)
+	s.wg.Add(1)
+	go s.accept()
+	return s, nil
+}
+
+// replayResponses groups exchanges by method, leaving out 401 answers followed by another request of the
+// same method (the client authenticated and retried).
+func replayResponses(exs []RecordedExchange) map[string][]*RecordedExchange {
+	out := make(map[string][]*RecordedExchange)
+	for i := range exs {
+		ex := &exs[i]
+		if ex.Status == int(base.StatusUnauthorized) {
+			retried := false
+			for _, later := range exs[i+1:] {
+				retried = retried || later.Method == ex.Method
+			}
+			if retried {
+				continue
+			}
+		}
+		out[ex.Method] = append(out[ex.Method], ex)
+	}
+	return out
+}
+
+// replayPlayable lists the receivable medias of the recorded description.
+func replayPlayable(rec *SessionRecording) []int {
+	for i := len(rec.Exchanges) - 1; i >= 0; i-- {
+		ex := rec.Exchanges[i]
+		if ex.Method != string(base.Describe) || ex.Status != int(base.StatusOK) {
+			continue
+		}
+		u, err := base.ParseURL(ex.URL)
+		if err != nil {
+			return nil
+		}
+		desc, err := descriptionFromResponse(u, &base.Response{Header: replayHeader(ex.ResponseHeader), Body: []byte(ex.Body)})
+		if err != nil {
+			return nil
+		}
+		var list []int
+		for j, m := range desc.Medias {
+			if !m.IsBackChannel {
+				list = append(list, j)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+// Close stops the server and closes open connections.
+func (s *ReplayServer) Close() error {
+	select {
+	case <-s.done:
+		return nil
+	default:
+	}
+	close(s.done)
+	err := s.ln.Close()
+	s.mu.Lock()
+	for c := range s.conns {
+		_ = c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+func (s *ReplayServer) accept() {
+	defer s.wg.Done()
+	for {
+		nc, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[nc] = struct{}{}
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serve(nc)
+			s.mu.Lock()
+			delete(s.conns, nc)
+			s.mu.Unlock()
+			_ = nc.Close()
+		}()
+	}
+}
+
+// replayConn is the state of one client connection.
+type replayConn struct {
+	s        *ReplayServer
+	c        *conn.Conn
+	wmu      sync.Mutex
+	used     map[string]int
+	channels map[int]int // SDP media index to interleaved RTP channel
+	playing  bool
+	silent   bool // a recorded request went unanswered; so do all later ones
+}
+
+func (s *ReplayServer) serve(nc net.Conn) {
+	rc := &replayConn{s: s, c: conn.NewConn(nc), used: make(map[string]int), channels: make(map[int]int)}
+	for {
+		msg, err := rc.c.Read()
+		if err != nil {
+			return
+		}
+		req, ok := msg.(*base.Request)
+		if !ok {
+			continue // receiver reports and responses to server requests
+		}
+		if !rc.answer(req) {
+			return
+		}
+	}
+}
+
+// next returns the recorded exchange for the nth request of a method; the last one repeats. Methods the
+// recording never reached are unanswered when the original call failed, and get a bare 200 otherwise.
+func (rc *replayConn) next(method string) *RecordedExchange {
+	list := rc.s.responses[method]
+	if len(list) == 0 {
+		if rc.s.rec.Outcome != "" {
+			return &RecordedExchange{Method: method}
+		}
+		return nil
+	}
+	i := min(rc.used[method], len(list)-1)
+	rc.used[method]++
+	return list[i]
+}
+
+// answer replies to req and reports whether the connection stays open.
+func (rc *replayConn) answer(req *base.Request) bool {
+	if rc.silent {
+		return true
+	}
+
+	var th headers.Transport
+	if req.Method == base.Setup {
+		if err := th.Unmarshal(req.Header["Transport"]); err != nil || th.Protocol != headers.TransportProtocolTCP {
+			return rc.write(&base.Response{
+				StatusCode:    base.StatusUnsupportedTransport,
+				StatusMessage: "Unsupported Transport",
+				Header:        base.Header{"CSeq": req.Header["CSeq"]},
+			})
+		}
+	}
+
+	ex := rc.next(string(req.Method))
+	res := &base.Response{StatusCode: base.StatusOK, StatusMessage: "OK", Header: base.Header{}}
+	if ex != nil {
+		if ex.Status == 0 {
+			// Never answered: reproduce a dropped connection or a silent server
+			rc.silent = true
+			return rc.s.rec.Outcome != "connection_closed"
+		}
+		res.StatusCode, res.StatusMessage = base.StatusCode(ex.Status), ex.Message
+		res.Header = replayHeader(ex.ResponseHeader)
+		res.Body = []byte(ex.Body)
+	}
+	if cseq, ok := req.Header["CSeq"]; ok {
+		res.Header["CSeq"] = cseq
+	}
+	if req.Method == base.Setup && res.StatusCode == base.StatusOK {
+		rc.setup(&th, res)
+	}
+
+	if ex != nil && ex.Latency > 0 {
+		select {
+		case <-rc.s.done:
+			return false
+		case <-time.After(time.Duration(ex.Latency * float64(time.Millisecond))):
+		}
+	}
+	if !rc.write(res) {
+		return false
+	}
+
+	if req.Method == base.Play && res.StatusCode == base.StatusOK && !rc.playing {
+		rc.playing = true
+		rc.s.wg.Add(1)
+		go rc.stream()
+	}
+	return true
+}
+
+// write sends a response and reports whether it went out.
+func (rc *replayConn) write(res *base.Response) bool {
+	rc.wmu.Lock()
+	defer rc.wmu.Unlock()
+	return rc.c.WriteResponse(res) == nil
+}
+
+// setup binds the next receivable media to the interleaved channels requested by the client and rewrites
+// the recorded Transport header to match.
+func (rc *replayConn) setup(th *headers.Transport, res *base.Response) {
+	ids := [2]int{0, 1}
+	if th.InterleavedIDs != nil {
+		ids = *th.InterleavedIDs
+	}
+	n := len(rc.channels)
+	if n < len(rc.s.playable) {
+		rc.channels[rc.s.playable[n]] = ids[0]
+	}
+
+	var recorded headers.Transport
+	_ = recorded.Unmarshal(res.Header["Transport"])
+	delivery := headers.TransportDeliveryUnicast
+	out := headers.Transport{
+		Protocol:       headers.TransportProtocolTCP,
+		Delivery:       &delivery,
+		InterleavedIDs: &ids,
+		SSRC:           recorded.SSRC,
+	}
+	res.Header["Transport"] = out.Marshal()
+}
+
+// replayHeader copies a recorded header.
+func replayHeader(h map[string][]string) base.Header {
+	out := make(base.Header, len(h))
+	for k, v := range h {
+		out[k] = append(base.HeaderValue(nil), v...)
+	}
+	return out
+}
+
+// stream writes the recorded packets with their recorded offsets from now.
+func (rc *replayConn) stream() {
+	defer rc.s.wg.Done()
+	start := time.Now()
+	for _, p := range rc.s.rec.Packets {
+		ch, ok := rc.channels[p.Media]
+		if !ok {
+			continue
+		}
+		if p.RTCP {
+			ch++
+		}
+		wait := time.Until(start.Add(time.Duration(p.At * float64(time.Millisecond))))
+		select {
+		case <-rc.s.done:
+			return
+		case <-time.After(wait):
+		}
+		fr := base.InterleavedFrame{Channel: ch, Payload: p.Data}
+		rc.wmu.Lock()
+		err := rc.c.WriteInterleavedFrame(&fr, make([]byte, fr.MarshalSize()))
+		rc.wmu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package rtspeek
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0x524A/rtspeek/pkg/rtspeektest"
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+)
+
+// recordAndReplay describes url with a recorder, round-trips the recording through its file format and
+// describes the replay server with the same context options.
+func recordAndReplay(t *testing.T, ctx context.Context, url string) (StreamInfo, error, StreamInfo, error, *SessionRecording) {
+	t.Helper()
+	recorder := NewSessionRecorder(0)
+	info, err := DescribeStream(WithSessionRecorder(ctx, recorder), url, 2*time.Second)
+
+	var file bytes.Buffer
+	if err := WriteSessionRecording(&file, recorder.Recording()); err != nil {
+		t.Fatalf("WriteSessionRecording: %v", err)
+	}
+	if strings.Contains(file.String(), "secret") || strings.Contains(file.String(), "Authorization") {
+		t.Fatalf("session file leaks credentials:\n%s", file.String())
+	}
+	rec, rerr := ReadSessionRecording(&file)
+	if rerr != nil {
+		t.Fatalf("ReadSessionRecording: %v", rerr)
+	}
+
+	srv, serr := NewReplayServer(rec, "")
+	if serr != nil {
+		t.Fatalf("NewReplayServer: %v", serr)
+	}
+	t.Cleanup(func() { _ = srv.Close() })
+	replayed, replayErr := DescribeStream(ctx, srv.URL, 2*time.Second)
+	return info, err, replayed, replayErr, rec
+}
+
+func TestReplayReproducesLiveProbe(t *testing.T) {
+	srv := rtspeektest.Start(t, rtspeektest.Config{User: "admin", Pass: "secret", UDP: true})
+	ctx := WithLiveProbe(context.Background(), LiveProbeOptions{Duration: 600 * time.Millisecond})
+
+	info, err, replayed, replayErr, rec := recordAndReplay(t, ctx, srv.URLWithCredentials("admin", "secret"))
+	if err != nil || replayErr != nil {
+		t.Fatalf("original err=%v, replay err=%v", err, replayErr)
+	}
+	if rec.Outcome != "" || rec.Options.LiveProbe != 0.6 || len(rec.Packets) == 0 {
+		t.Fatalf("unexpected recording: outcome=%q options=%+v packets=%d", rec.Outcome, rec.Options, len(rec.Packets))
+	}
+	if rec.URL != srv.URL {
+		t.Fatalf("recorded URL %q, want %q without credentials", rec.URL, srv.URL)
+	}
+
+	if replayed.GetVideoResolutionString() != info.GetVideoResolutionString() || replayed.GetMediaCount() != info.GetMediaCount() {
+		t.Fatalf("replay described %q/%d, original %q/%d", replayed.GetVideoResolutionString(), replayed.GetMediaCount(),
+			info.GetVideoResolutionString(), info.GetMediaCount())
+	}
+	if got, want := replayed.GetSessionDetails().Name, info.GetSessionDetails().Name; got != want {
+		t.Fatalf("session name %q, want %q", got, want)
+	}
+
+	// The replay window is as long as the original, so every recorded packet fits unless timing drifts
+	lp := replayed.GetLiveProbe()
+	recorded := 0
+	for _, p := range rec.Packets {
+		if !p.RTCP {
+			recorded++
+		}
+	}
+	if lp == nil || lp.Transport != "tcp" || lp.Error != "" {
+		t.Fatalf("unexpected replay probe %+v", lp)
+	}
+	if lp.Packets+5 < uint64(recorded) || lp.Packets > uint64(recorded) {
+		t.Fatalf("replay received %d packets, recorded %d", lp.Packets, recorded)
+	}
+	v := replayed.GetFirstVideoMedia()
+	if v.RTP == nil || v.RTP.Lost != 0 || v.GOP == nil || v.GOP.Keyframes == 0 {
+		t.Fatalf("unexpected replay analysis rtp=%+v gop=%+v", v.RTP, v.GOP)
+	}
+}
+
+func TestReplayReproducesFailures(t *testing.T) {
+	classifier := NewErrorClassifier()
+	tests := []struct {
+		name string
+		cfg  rtspeektest.Config
+		want string
+	}{
+		{
+			name: "not found",
+			cfg:  rtspeektest.Config{Responses: map[base.Method][]rtspeektest.Response{base.Describe: {{Status: base.StatusNotFound}}}},
+			want: "not_found",
+		},
+		{name: "auth without credentials", cfg: rtspeektest.Config{User: "admin", Pass: "secret"}, want: "auth_required"},
+		{name: "closed after options", cfg: rtspeektest.Config{Quirks: []string{rtspeektest.QuirkCloseAfterOptions}}, want: "connection_closed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.FrameInterval = -1
+			srv := rtspeektest.Start(t, tt.cfg)
+			_, err, replayed, replayErr, rec := recordAndReplay(t, context.Background(), srv.URL)
+			if got := classifier.Classify(err); got != tt.want || rec.Outcome != tt.want {
+				t.Fatalf("original classified %q (recorded %q), want %q: %v", got, rec.Outcome, tt.want, err)
+			}
+			if got := classifier.Classify(replayErr); got != tt.want {
+				t.Fatalf("replay classified %q, want %q: %v", got, tt.want, replayErr)
+			}
+			if replayed == nil || !replayed.IsReachable() || replayed.IsDescribeSucceeded() {
+				t.Fatalf("unexpected replay result %+v", replayed)
+			}
+		})
+	}
+}
+
+func TestReadSessionRecordingVersion(t *testing.T) {
+	if _, err := ReadSessionRecording(strings.NewReader(`{"version": 99}`)); err == nil {
+		t.Fatalf("expected an error for an unknown version")
+	}
+}
@@ -0,0 +1,251 @@
+package rtspeek
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+// RTP statistics sources.
+const (
+	// RTPSourceWire means packets were analyzed in arrival order (interleaved TCP).
+	RTPSourceWire = "wire"
+	// RTPSourceReordered means the client's UDP reorder buffer ran first: packets arrive sorted and
+	// duplicates are discarded, so reordering and duplicates cannot be counted.
+	RTPSourceReordered = "reordered"
+)
+
+// seenWindow bounds the sequence numbers remembered for duplicate detection.
+const seenWindow = 1 << 12
+
+// RTPStats holds per-track RTP quality metrics gathered during a live probe.
+type RTPStats struct {
+	Source      string  `json:"source"` // wire or reordered
+	SSRC        uint32  `json:"ssrc"`
+	SSRCChanges int     `json:"ssrc_changes"`
+	Packets     uint64  `json:"packets"`
+	Bytes       uint64  `json:"bytes"` // RTP payload bytes
+	Expected    uint64  `json:"expected"`
+	Lost        uint64  `json:"lost"`
+	LossRate    float64 `json:"loss_rate"` // lost / expected
+	Gaps        int     `json:"gaps"`      // forward sequence jumps at arrival (loss bursts, or late packets)
+	MaxGap      int     `json:"max_gap"`   // largest burst in packets
+	Reordered   *int    `json:"reordered,omitempty"`
+	Duplicates  *int    `json:"duplicates,omitempty"`
+	InError     uint64  `json:"in_error"`  // packets the client rejected (e.g. foreign SSRC)
+	Jitter      float64 `json:"jitter_ms"` // RFC 3550 interarrival jitter at the end of the window
+	MaxJitter   float64 `json:"max_jitter_ms"`
+	// Marker-bit cadence (end of frame for video, talkspurt start for audio)
+	Markers              int     `json:"markers"`
+	MarkerRate           float64 `json:"marker_rate"`        // per second
+	MarkerInterval       float64 `json:"marker_interval_ms"` // mean
+	MarkerIntervalStdDev float64 `json:"marker_interval_stddev_ms"`
+}
+
+// rtpStatsAnalyzer implements RFC 3550 sequence and jitter accounting for one track.
+type rtpStatsAnalyzer struct {
+	clockRate float64
+
+	initialized bool
+	ssrc        uint32
+	foreign     map[uint32]bool
+	baseSeq     int64
+	maxSeq      int64  // extended highest sequence number
+	expected    uint64 // expected packets of previous SSRCs
+	seen        map[int64]bool
+
+	packets    uint64
+	bytes      uint64
+	gaps       int
+	maxGap     int
+	reordered  int
+	duplicates int
+
+	jitterInit  bool
+	baseTime    time.Time
+	lastTransit float64
+	jitter      float64 // in RTP timestamp units
+	maxJitter   float64
+
+	markers     int
+	lastMarker  time.Time
+	intervalSum float64 // seconds
+	intervalSq  float64
+	intervals   int
+
+	// Set by the live probe before finish
+	sorted  bool   // packets passed through the client's reorder buffer
+	inError uint64 // packets rejected by the client
+}
+
+func newRTPStatsAnalyzer(clockRate int) *rtpStatsAnalyzer {
+	if clockRate <= 0 {
+		clockRate = 90000
+	}
+	return &rtpStatsAnalyzer{
+		clockRate: float64(clockRate),
+		foreign:   make(map[uint32]bool),
+		seen:      make(map[int64]bool),
+	}
+}
+
+func (ra *rtpStatsAnalyzer) onRTP(pkt *rtp.Packet, received time.Time) {
+	if !ra.initialized {
+		ra.initialized = true
+		ra.ssrc = pkt.SSRC
+		ra.baseTime = received
+		ra.startSequence(int64(pkt.SequenceNumber))
+	} else if pkt.SSRC != ra.ssrc {
+		// Start a new sequence space; losses of the previous one are kept
+		ra.noteSSRC(pkt.SSRC)
+		ra.ssrc = pkt.SSRC
+		ra.flushSequence()
+		ra.startSequence(int64(pkt.SequenceNumber))
+		ra.jitterInit = false
+	} else if !ra.trackSequence(pkt.SequenceNumber) {
+		return
+	}
+
+	ra.packets++
+	ra.bytes += uint64(len(pkt.Payload))
+	ra.updateJitter(pkt.Timestamp, received)
+	if pkt.Marker {
+		ra.updateMarker(received)
+	}
+}
+
+func (ra *rtpStatsAnalyzer) onRTCP(rtcp.Packet, time.Time) {}
+
+func (ra *rtpStatsAnalyzer) startSequence(seq int64) {
+	ra.baseSeq, ra.maxSeq = seq, seq
+	clear(ra.seen)
+	ra.seen[seq] = true
+}
+
+// flushSequence folds the current sequence space into the expected total.
+func (ra *rtpStatsAnalyzer) flushSequence() {
+	ra.expected += uint64(ra.maxSeq - ra.baseSeq + 1)
+}
+
+// trackSequence updates gap, reorder and duplicate counters. It returns false for duplicates.
+func (ra *rtpStatsAnalyzer) trackSequence(seq uint16) bool {
+	ext := ra.maxSeq + int64(int16(seq-uint16(ra.maxSeq)))
+	if ra.seen[ext] {
+		ra.duplicates++
+		return false
+	}
+	ra.seen[ext] = true
+
+	if ext > ra.maxSeq {
+		if gap := int(ext - ra.maxSeq - 1); gap > 0 {
+			ra.gaps++
+			ra.maxGap = max(ra.maxGap, gap)
+		}
+		ra.maxSeq = ext
+		if len(ra.seen) > 2*seenWindow {
+			for s := range ra.seen {
+				if s < ra.maxSeq-seenWindow {
+					delete(ra.seen, s)
+				}
+			}
+		}
+	} else {
+		ra.reordered++
+	}
+	return true
+}
+
+// updateJitter applies the RFC 3550 section 6.4.1 estimator.
+func (ra *rtpStatsAnalyzer) updateJitter(ts uint32, received time.Time) {
+	arrival := received.Sub(ra.baseTime).Seconds() * ra.clockRate
+	transit := arrival - float64(ts)
+	if !ra.jitterInit {
+		ra.jitterInit = true
+		ra.lastTransit = transit
+		return
+	}
+	d := transit - ra.lastTransit
+	ra.lastTransit = transit
+	// Timestamps are 32-bit; fold the difference back into range after a wrap
+	if d > math.MaxUint32/2 {
+		d -= math.MaxUint32 + 1
+	} else if d < -math.MaxUint32/2 {
+		d += math.MaxUint32 + 1
+	}
+	ra.jitter += (math.Abs(d) - ra.jitter) / 16
+	ra.maxJitter = max(ra.maxJitter, ra.jitter)
+}
+
+func (ra *rtpStatsAnalyzer) updateMarker(received time.Time) {
+	ra.markers++
+	if !ra.lastMarker.IsZero() {
+		iv := received.Sub(ra.lastMarker).Seconds()
+		ra.intervalSum += iv
+		ra.intervalSq += iv * iv
+		ra.intervals++
+	}
+	ra.lastMarker = received
+}
+
+// noteSSRC records a sender SSRC that differs from the current one.
+func (ra *rtpStatsAnalyzer) noteSSRC(ssrc uint32) {
+	if ssrc != ra.ssrc {
+		ra.foreign[ssrc] = true
+	}
+}
+
+func (ra *rtpStatsAnalyzer) finish(mi *MediaInfo, window time.Duration) {
+	if !ra.initialized {
+		return
+	}
+	expected := ra.expected + uint64(ra.maxSeq-ra.baseSeq+1)
+	reordered, duplicates := ra.reordered, ra.duplicates
+	st := &RTPStats{
+		Source:      RTPSourceWire,
+		SSRC:        ra.ssrc,
+		SSRCChanges: len(ra.foreign),
+		Packets:     ra.packets,
+		Bytes:       ra.bytes,
+		Expected:    expected,
+		Gaps:        ra.gaps,
+		MaxGap:      ra.maxGap,
+		Reordered:   &reordered,
+		Duplicates:  &duplicates,
+		Jitter:      ra.jitter / ra.clockRate * 1000,
+		MaxJitter:   ra.maxJitter / ra.clockRate * 1000,
+		InError:     ra.inError,
+		Markers:     ra.markers,
+	}
+	if ra.sorted {
+		st.Source = RTPSourceReordered
+		st.Reordered, st.Duplicates = nil, nil
+	}
+	if expected > ra.packets {
+		st.Lost = expected - ra.packets
+		st.LossRate = float64(st.Lost) / float64(expected)
+	}
+	if secs := window.Seconds(); secs > 0 {
+		st.MarkerRate = float64(ra.markers) / secs
+	}
+	if ra.intervals > 0 {
+		n := float64(ra.intervals)
+		mean := ra.intervalSum / n
+		st.MarkerInterval = mean * 1000
+		st.MarkerIntervalStdDev = math.Sqrt(math.Max(0, ra.intervalSq/n-mean*mean)) * 1000
+	}
+	mi.RTP = st
+}
+
+// parseWrongSSRC extracts the SSRCs from gortsplib's "wrong SSRC" decode error. gortsplib has no error type
+// for it, so this parses the message text, pinned by TestParseWrongSSRCGortsplib. Should the text change,
+// parsing fails: the packets still count in InError, but SSRCChanges stays 0, which then means unknown.
+func parseWrongSSRC(err error) (got, expected uint32, ok bool) {
+	if err == nil {
+		return 0, 0, false
+	}
+	_, scanErr := fmt.Sscanf(err.Error(), "received packet with wrong SSRC %d, expected %d", &got, &expected)
+	return got, expected, scanErr == nil
+}
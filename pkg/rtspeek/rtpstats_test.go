@@ -0,0 +1,200 @@
+package rtspeek
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/bluenviron/gortsplib/v4/pkg/rtcpreceiver"
+	"github.com/pion/rtp"
+)
+
+// g711Media is an 8 kHz audio track whose packets carry 20 ms (160 samples) each.
+func g711Media() *description.Media {
+	return &description.Media{
+		Type:    description.MediaTypeAudio,
+		Control: "trackID=0",
+		Formats: []format.Format{&format.G711{PayloadTyp: 0, MULaw: true, SampleRate: 8000, ChannelCount: 1}},
+	}
+}
+
+// feedRTP sends sequence numbers to a fresh analyzer, spacing arrivals 20 ms apart in step with the timestamps.
+func feedRTP(t *testing.T, seqs []uint16, sorted bool) *RTPStats {
+	t.Helper()
+	ra := newRTPStatsAnalyzer(8000)
+	start := time.Now()
+	for i, seq := range seqs {
+		pkt := &rtp.Packet{
+			Header:  rtp.Header{Version: 2, SSRC: 1, SequenceNumber: seq, Timestamp: uint32(seq) * 160, Marker: true},
+			Payload: make([]byte, 160),
+		}
+		ra.onRTP(pkt, start.Add(time.Duration(i)*20*time.Millisecond))
+	}
+	ra.sorted = sorted
+	var mi MediaInfo
+	ra.finish(&mi, time.Duration(len(seqs))*20*time.Millisecond)
+	if mi.RTP == nil {
+		t.Fatalf("expected RTP stats")
+	}
+	return mi.RTP
+}
+
+func TestRTPStatsAnalyzerSequence(t *testing.T) {
+	tests := []struct {
+		name                  string
+		seqs                  []uint16
+		expected, lost        uint64
+		gaps, maxGap          int
+		reordered, duplicates int
+	}{
+		{name: "clean", seqs: []uint16{10, 11, 12, 13}, expected: 4},
+		{name: "burst loss", seqs: []uint16{0, 1, 2, 6, 7, 9}, expected: 10, lost: 4, gaps: 2, maxGap: 3},
+		{name: "duplicate", seqs: []uint16{0, 1, 1, 2}, expected: 3, duplicates: 1},
+		{name: "reordered", seqs: []uint16{0, 2, 1, 3}, expected: 4, gaps: 1, maxGap: 1, reordered: 1},
+		{name: "wraparound", seqs: []uint16{65534, 65535, 0, 1}, expected: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := feedRTP(t, tt.seqs, false)
+			if st.Source != RTPSourceWire || st.Expected != tt.expected || st.Lost != tt.lost ||
+				st.Gaps != tt.gaps || st.MaxGap != tt.maxGap {
+				t.Fatalf("unexpected sequence stats: %+v", st)
+			}
+			if st.Reordered == nil || *st.Reordered != tt.reordered || st.Duplicates == nil || *st.Duplicates != tt.duplicates {
+				t.Fatalf("unexpected reordered/duplicates: %v/%v", st.Reordered, st.Duplicates)
+			}
+		})
+	}
+}
+
+func TestRTPStatsAnalyzerSortedHidesReordering(t *testing.T) {
+	st := feedRTP(t, []uint16{0, 1, 3}, true)
+	if st.Source != RTPSourceReordered || st.Reordered != nil || st.Duplicates != nil {
+		t.Fatalf("expected reordering to be unreported, got %+v", st)
+	}
+	if st.Lost != 1 || st.LossRate != 0.25 {
+		t.Fatalf("loss should still be measured, got %+v", st)
+	}
+}
+
+func TestRTPStatsAnalyzerJitterAndMarkers(t *testing.T) {
+	st := feedRTP(t, []uint16{0, 1, 2, 3, 4}, false)
+	if st.Jitter != 0 || st.MaxJitter != 0 {
+		t.Fatalf("paced arrivals should have no jitter, got %+v", st)
+	}
+	if st.Markers != 5 || math.Abs(st.MarkerInterval-20) > 1e-6 || st.MarkerIntervalStdDev > 1e-6 || st.MarkerRate != 50 {
+		t.Fatalf("unexpected marker cadence: %+v", st)
+	}
+
+	// One packet 16 ms late: |D| = 128 ticks, jitter = 128/16 = 8 ticks = 1 ms
+	ra := newRTPStatsAnalyzer(8000)
+	start := time.Now()
+	ra.onRTP(&rtp.Packet{Header: rtp.Header{SSRC: 1, SequenceNumber: 0, Timestamp: 0}}, start)
+	ra.onRTP(&rtp.Packet{Header: rtp.Header{SSRC: 1, SequenceNumber: 1, Timestamp: 160}}, start.Add(36*time.Millisecond))
+	var mi MediaInfo
+	ra.finish(&mi, time.Second)
+	if math.Abs(mi.RTP.Jitter-1) > 1e-6 {
+		t.Fatalf("expected 1 ms jitter, got %v", mi.RTP.Jitter)
+	}
+}
+
+func TestLiveProbeSSRCChangeAttribution(t *testing.T) {
+	desc := &description.Session{Medias: []*description.Media{h264Media(), g711Media()}}
+	lp := newLiveProbe(desc, LiveProbeOptions{})
+	now := time.Now()
+	lp.handleRTP(desc.Medias[0], nil, &rtp.Packet{Header: rtp.Header{SSRC: 100}})
+	lp.handleRTP(desc.Medias[1], nil, &rtp.Packet{Header: rtp.Header{SSRC: 200}})
+
+	lp.handleDecodeError(errors.New("received packet with wrong SSRC 300, expected 200"))
+	lp.handleDecodeError(errors.New("received packet with wrong SSRC 300, expected 200"))
+	lp.handleDecodeError(errors.New("unrelated error"))
+
+	lp.started, lp.stopped = now, now.Add(time.Second)
+	lp.transport = "tcp"
+	info := &streamInfo{VideoMedias: []MediaInfo{{Index: 0}}, AudioMedias: []MediaInfo{{Index: 1}}}
+	lp.apply(info)
+
+	if st := info.VideoMedias[0].RTP; st == nil || st.SSRCChanges != 0 || st.SSRC != 100 {
+		t.Fatalf("video track should be untouched, got %+v", st)
+	}
+	if st := info.AudioMedias[0].RTP; st == nil || st.SSRCChanges != 1 {
+		t.Fatalf("expected one SSRC change on audio, got %+v", st)
+	}
+}
+
+// TestParseWrongSSRCGortsplib pins the text of the error the gortsplib client reports for a foreign SSRC,
+// which parseWrongSSRC depends on.
+func TestParseWrongSSRCGortsplib(t *testing.T) {
+	local := uint32(1)
+	rr := &rtcpreceiver.RTCPReceiver{ClockRate: 90000, LocalSSRC: &local, Period: time.Hour}
+	if err := rr.Initialize(); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+	defer rr.Close()
+
+	now := time.Now()
+	if err := rr.ProcessPacket(&rtp.Packet{Header: rtp.Header{SSRC: 200, SequenceNumber: 1}}, now, true); err != nil {
+		t.Fatalf("first packet: %v", err)
+	}
+	err := rr.ProcessPacket(&rtp.Packet{Header: rtp.Header{SSRC: 300, SequenceNumber: 2}}, now, true)
+	got, expected, ok := parseWrongSSRC(err)
+	if !ok || got != 300 || expected != 200 {
+		t.Fatalf("parseWrongSSRC(%v) = %d, %d, %v", err, got, expected, ok)
+	}
+}
+
+func TestDescribeStreamLiveProbeRTPStats(t *testing.T) {
+	audio := g711Media()
+	desc := &description.Session{Medias: []*description.Media{audio}}
+
+	// Each cycle of 10 sequence numbers: 3 and 4 lost, 6 duplicated, 8 and 9 swapped
+	order := []uint16{0, 1, 2, 5, 6, 6, 7, 9, 8}
+	url := startPlayServer(t, desc, 5*time.Millisecond, func(stream *gortsplib.ServerStream, n int) {
+		for _, s := range order {
+			seq := uint16(n*10) + s
+			_ = stream.WritePacketRTP(audio, &rtp.Packet{
+				Header:  rtp.Header{Version: 2, PayloadType: 0, SequenceNumber: seq, Timestamp: uint32(seq) * 160, Marker: s == 0},
+				Payload: make([]byte, 160),
+			})
+		}
+	})
+
+	ctx := WithLiveProbe(context.Background(), LiveProbeOptions{Duration: 300 * time.Millisecond, Transport: "tcp"})
+	info, err := DescribeStream(ctx, url, 2*time.Second)
+	if err != nil {
+		t.Fatalf("describe: %v", err)
+	}
+	st := info.GetAudioMedias()[0].RTP
+	if st == nil || st.Packets < 14 {
+		t.Fatalf("expected RTP stats, got %+v", st)
+	}
+	if st.Source != RTPSourceWire || st.Lost == 0 || st.MaxGap != 2 || st.LossRate <= 0 {
+		t.Fatalf("unexpected loss stats: %+v", st)
+	}
+	if st.Reordered == nil || *st.Reordered == 0 || st.Duplicates == nil || *st.Duplicates == 0 {
+		t.Fatalf("expected reordering and duplicates, got %+v", st)
+	}
+	if st.Markers == 0 {
+		t.Fatalf("expected marker cadence, got %+v", st)
+	}
+
+	var sb strings.Builder
+	if err := WritePrometheus(&sb, CollectMetrics(info)); err != nil {
+		t.Fatalf("write metrics: %v", err)
+	}
+	for _, want := range []string{
+		"# TYPE rtpeek_rtp_lost_packets gauge",
+		`rtpeek_rtp_duplicate_packets{format="G711",media="0",url="` + url + `"}`,
+		"rtpeek_describe_ok{url=",
+	} {
+		if !strings.Contains(sb.String(), want) {
+			t.Fatalf("metrics missing %q:\n%s", want, sb.String())
+		}
+	}
+}
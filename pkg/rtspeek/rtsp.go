@@ -2,19 +2,41 @@ package rtspeek
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/bluenviron/gortsplib/v4"
 	"github.com/bluenviron/gortsplib/v4/pkg/base"
 	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/headers"
+	"github.com/bluenviron/gortsplib/v4/pkg/liberrors"
+	"github.com/pion/rtp"
 )
 
-// RTSPSession handles RTSP protocol operations (OPTIONS, DESCRIBE).
+// RTSPSession handles RTSP protocol operations (OPTIONS, DESCRIBE, and the optional SETUP/PLAY probe).
 type RTSPSession struct {
-	client  *gortsplib.Client
-	logger  *Logger
-	timeout time.Duration
+	client            *gortsplib.Client
+	logger            *Logger
+	timeout           time.Duration
+	response          *base.Response
+	transportSwitched atomic.Bool
+	// onDecodeError, when set before PLAY, receives packets the client could not process
+	onDecodeError func(error)
+	// onRequest, when set before PLAY, observes every request sent (including keepalives)
+	onRequest func(*base.Request)
+	// onResponse, when set, observes every response received
+	onResponse func(*base.Response)
+	// server and authMethods are the Server header and the auth schemes seen in responses
+	server      string
+	authMethods []string
+	// recorder, when set, also receives the packets of the live probe
+	recorder *SessionRecorder
+	// sessionTimeout is the timeout advertised in the SETUP response Session header (0 if absent)
+	sessionTimeout time.Duration
+	// started is set once the client started; gortsplib cannot close a client that never did
+	started bool
 }
 
 // NewRTSPSession creates a new RTSP session with the specified timeout and logger.
@@ -23,18 +45,53 @@ func NewRTSPSession(timeout time.Duration, logger *Logger) *RTSPSession {
 		ReadTimeout:  timeout,
 		WriteTimeout: timeout,
 	}
+	rs := &RTSPSession{
+		client:  client,
+		logger:  logger,
+		timeout: timeout,
+	}
+
+	// Replace gortsplib's default callbacks, which print to the standard logger
+	client.OnTransportSwitch = func(err error) {
+		rs.transportSwitched.Store(true)
+		if logger != nil {
+			logger.Debug("Transport switched", map[string]interface{}{"reason": err.Error()})
+		}
+	}
+	client.OnPacketsLost = func(lost uint64) {
+		if logger != nil {
+			logger.Debug("RTP packets lost", map[string]interface{}{"lost": lost})
+		}
+	}
+	client.OnDecodeError = func(err error) {
+		if rs.onDecodeError != nil {
+			rs.onDecodeError(err)
+		}
+		if logger != nil {
+			logger.Debug("Decode error", map[string]interface{}{"error": err.Error()})
+		}
+	}
 
 	// Set up logging callbacks if logger is provided and debug level is enabled
-	if logger != nil && logger.level >= LogLevelDebug {
-		client.OnRequest = func(req *base.Request) {
+	debug := logger != nil && logger.level >= LogLevelDebug
+	client.OnRequest = func(req *base.Request) {
+		if rs.onRequest != nil {
+			rs.onRequest(req)
+		}
+		if debug {
 			headers := make(map[string][]string)
 			for k, v := range req.Header {
 				headers[k] = []string(v)
 			}
 			logger.RTSPRequest(string(req.Method), req.URL.String(), headers)
 		}
-
-		client.OnResponse = func(res *base.Response) {
+	}
+	client.OnResponse = func(res *base.Response) {
+		rs.observeResponse(res)
+		if rs.onResponse != nil {
+			rs.onResponse(res)
+		}
+		if debug {
 			headers := make(map[string][]string)
 			for k, v := range res.Header {
 				headers[k] = []string(v)
@@ -43,14 +100,56 @@ func NewRTSPSession(timeout time.Duration, logger *Logger) *RTSPSession {
 		}
 	}
 
-	return &RTSPSession{
-		client:  client,
-		logger:  logger,
-		timeout: timeout,
+	return rs
+}
+
+// observeResponse keeps the Server header and the auth schemes a server challenges with.
+func (rs *RTSPSession) observeResponse(res *base.Response) {
+	if v, ok := res.Header["Server"]; ok && len(v) > 0 && v[0] != "" {
+		rs.server = v[0]
+	}
+	if res.StatusCode != base.StatusUnauthorized {
+		return
+	}
+	for _, v := range res.Header["WWW-Authenticate"] {
+		var auth headers.Authenticate
+		if auth.Unmarshal(base.HeaderValue{v}) != nil {
+			continue
+		}
+		if name := authMethodName(auth.Method); !containsString(rs.authMethods, name) {
+			rs.authMethods = append(rs.authMethods, name)
+		}
+	}
+}
+
+// SetTransport forces the transport used by a later live probe ("udp", "tcp", "multicast").
+// It must be called before PerformDescribe.
+func (rs *RTSPSession) SetTransport(name string) error {
+	t, err := parseTransport(name)
+	if err != nil {
+		return err
 	}
+	rs.client.Transport = t
+	return nil
+}
+
+// record makes the session report its requests, responses and live probe packets to rec.
+// It must be called before PerformDescribe.
+func (rs *RTSPSession) record(rec *SessionRecorder) {
+	rs.onRequest = rec.onRequest
+	rs.onResponse = rec.onResponse
+	rs.recorder = rec
+}
+
+// RequestBackChannels makes DESCRIBE send "Require: www.onvif.org/ver20/backchannel"
+// so that ONVIF cameras include their audio backchannel in the SDP.
+func (rs *RTSPSession) RequestBackChannels() {
+	rs.client.RequestBackChannels = true
 }
 
 // PerformDescribe executes the RTSP handshake (START, OPTIONS, DESCRIBE) with auth retry.
+// The connection stays open afterwards so that a live probe can SETUP and PLAY on it: callers must
+// call Close when done, whether or not DESCRIBE succeeded.
 func (rs *RTSPSession) PerformDescribe(ctx context.Context, parsedURL *base.URL) (*description.Session, []string, error) {
 	if rs.logger != nil {
 		rs.logger.Stage("start")
@@ -63,16 +162,12 @@ func (rs *RTSPSession) PerformDescribe(ctx context.Context, parsedURL *base.URL)
 		}
 		return nil, rs.getTrace(), fmt.Errorf("RTSP start failed: %w", err)
 	}
+	rs.started = true
 
 	if rs.logger != nil {
 		rs.logger.NetworkOperation("rtsp_start", parsedURL.Host, time.Since(start), nil)
 	}
 
-	// Ensure client is closed when we're done
-	defer func() {
-		go rs.client.Close() // Non-blocking close
-	}()
-
 	if rs.logger != nil {
 		rs.logger.Stage("options")
 	}
@@ -94,7 +189,15 @@ func (rs *RTSPSession) PerformDescribe(ctx context.Context, parsedURL *base.URL)
 	}
 
 	describeStart := time.Now()
-	desc, _, describeErr := rs.client.Describe(parsedURL)
+	desc, res, describeErr := rs.client.Describe(parsedURL)
+	if describeErr != nil && rs.client.RequestBackChannels && isOptionNotSupported(describeErr) {
+		// Server rejected the backchannel Require header: it has no backchannel, describe normally
+		if rs.logger != nil {
+			rs.logger.Stage("backchannel-fallback")
+		}
+		rs.client.RequestBackChannels = false
+		desc, res, describeErr = rs.client.Describe(parsedURL)
+	}
 	if describeErr != nil && isAuthChallenge(describeErr) && parsedURL.User != nil {
 		// Retry with authentication
 		if rs.logger != nil {
@@ -102,8 +205,9 @@ func (rs *RTSPSession) PerformDescribe(ctx context.Context, parsedURL *base.URL)
 		}
 
 		retryStart := time.Now()
-		desc2, _, retryErr := rs.client.Describe(parsedURL)
+		desc2, res2, retryErr := rs.client.Describe(parsedURL)
 		if retryErr == nil {
+			rs.response = res2
 			if rs.logger != nil {
 				rs.logger.NetworkOperation("rtsp_describe_retry", parsedURL.Host, time.Since(retryStart), nil)
 			}
@@ -123,9 +227,180 @@ func (rs *RTSPSession) PerformDescribe(ctx context.Context, parsedURL *base.URL)
 		return nil, rs.getTrace(), fmt.Errorf("RTSP describe failed: %w", describeErr)
 	}
 
+	rs.response = res
 	return desc, rs.getTrace(), nil
 }
 
+// PerformOptions connects and sends a single OPTIONS request. The response is returned whenever the server
+// answered in RTSP, together with the error for statuses the client rejects (e.g. 401).
+func (rs *RTSPSession) PerformOptions(parsedURL *base.URL) (*base.Response, error) {
+	var last *base.Response
+	prev := rs.onResponse
+	rs.onResponse = func(res *base.Response) {
+		last = res
+		if prev != nil {
+			prev(res)
+		}
+	}
+
+	if err := rs.client.Start(parsedURL.Scheme, parsedURL.Host); err != nil {
+		return nil, fmt.Errorf("RTSP start failed: %w", err)
+	}
+	rs.started = true
+	res, err := rs.client.Options(parsedURL)
+	if res == nil {
+		res = last
+	}
+	if err != nil {
+		return res, fmt.Errorf("RTSP options failed: %w", err)
+	}
+	return res, nil
+}
+
+// DescribeResponse returns the successful DESCRIBE response (nil before PerformDescribe succeeds).
+func (rs *RTSPSession) DescribeResponse() *base.Response {
+	return rs.response
+}
+
+// PerformLiveProbe sets up every receivable media of desc, plays the stream for opts.Duration
+// and feeds received packets to the probe's analyzers. Failures are recorded on the probe.
+func (rs *RTSPSession) PerformLiveProbe(ctx context.Context, desc *description.Session, opts LiveProbeOptions) *liveProbe {
+	probe := newLiveProbe(desc, opts)
+
+	medias := playableMedias(desc)
+	if len(medias) == 0 {
+		probe.err = errors.New("no receivable medias")
+		return probe
+	}
+
+	rs.onDecodeError = probe.handleDecodeError
+	onRTP, onRTCP := gortsplib.OnPacketRTPAnyFunc(probe.handleRTP), gortsplib.OnPacketRTCPAnyFunc(probe.handleRTCP)
+	if rs.recorder != nil {
+		onRTP, onRTCP = rs.recorder.wrap(desc, onRTP, onRTCP)
+	}
+	transport, err := rs.SetupAndPlay(desc, medias, onRTP, onRTCP)
+	probe.mu.Lock()
+	probe.transport = transport
+	probe.err = err
+	probe.started = time.Now()
+	probe.mu.Unlock()
+	if err != nil {
+		return probe
+	}
+
+	waitCh := make(chan error, 1)
+	go func() { waitCh <- rs.Wait() }()
+
+	timer := time.NewTimer(opts.Duration)
+	defer timer.Stop()
+
+	var stopErr error
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		stopErr = fmt.Errorf("live probe interrupted: %w", ctx.Err())
+	case err := <-waitCh:
+		stopErr = fmt.Errorf("session ended during live probe: %w", err)
+	}
+
+	probe.mu.Lock()
+	probe.stopped = time.Now()
+	probe.err = stopErr
+	probe.stats = rs.client.Stats()
+	if rs.transportSwitched.Load() {
+		probe.transport = "tcp"
+	}
+	probe.mu.Unlock()
+
+	return probe
+}
+
+// SetupAndPlay SETUPs the given medias, registers the packet callbacks (either may be nil)
+// and sends PLAY. It returns the negotiated transport.
+func (rs *RTSPSession) SetupAndPlay(desc *description.Session, medias []*description.Media,
+	onRTP gortsplib.OnPacketRTPAnyFunc, onRTCP gortsplib.OnPacketRTCPAnyFunc,
+) (string, error) {
+	if rs.logger != nil {
+		rs.logger.Stage("setup")
+	}
+
+	transport := ""
+	for _, m := range medias {
+		setupStart := time.Now()
+		res, err := rs.client.Setup(desc.BaseURL, m, 0, 0)
+		if rs.logger != nil {
+			rs.logger.NetworkOperation("rtsp_setup", desc.BaseURL.Host, time.Since(setupStart), err)
+		}
+		if err != nil {
+			return transport, fmt.Errorf("RTSP setup failed: %w", err)
+		}
+		if transport == "" && res != nil {
+			transport = transportFromResponse(res)
+			rs.sessionTimeout = sessionTimeoutFromResponse(res)
+		}
+	}
+
+	if onRTP != nil {
+		rs.client.OnPacketRTPAny(onRTP)
+	}
+	if onRTCP != nil {
+		rs.client.OnPacketRTCPAny(onRTCP)
+	}
+
+	if rs.logger != nil {
+		rs.logger.Stage("play")
+	}
+	playStart := time.Now()
+	_, err := rs.client.Play(nil)
+	if rs.logger != nil {
+		rs.logger.NetworkOperation("rtsp_play", desc.BaseURL.Host, time.Since(playStart), err)
+	}
+	if err != nil {
+		return transport, fmt.Errorf("RTSP play failed: %w", err)
+	}
+	return transport, nil
+}
+
+// Wait blocks until the underlying client terminates and returns the reason.
+func (rs *RTSPSession) Wait() error {
+	return rs.client.Wait()
+}
+
+// PacketNTP returns the wall-clock time of a received packet, derived from RTCP sender reports.
+func (rs *RTSPSession) PacketNTP(m *description.Media, pkt *rtp.Packet) (time.Time, bool) {
+	return rs.client.PacketNTP(m, pkt)
+}
+
+// transportFromResponse reports the negotiated transport of a SETUP response.
+func transportFromResponse(res *base.Response) string {
+	var th headers.Transport
+	if err := th.Unmarshal(res.Header["Transport"]); err != nil {
+		return ""
+	}
+	if th.Protocol == headers.TransportProtocolTCP {
+		return "tcp"
+	}
+	if th.Delivery != nil && *th.Delivery == headers.TransportDeliveryMulticast {
+		return "multicast"
+	}
+	return "udp"
+}
+
+// sessionTimeoutFromResponse reads the timeout parameter of the Session header.
+func sessionTimeoutFromResponse(res *base.Response) time.Duration {
+	var sh headers.Session
+	if err := sh.Unmarshal(res.Header["Session"]); err != nil || sh.Timeout == nil {
+		return 0
+	}
+	return time.Duration(*sh.Timeout) * time.Second
+}
+
+// isOptionNotSupported detects a 551 Option Not Supported response.
+func isOptionNotSupported(err error) bool {
+	var bad liberrors.ErrClientBadStatusCode
+	return errors.As(err, &bad) && bad.Code == base.StatusOptionNotSupported
+}
+
 // getTrace returns the debug trace if logging is enabled (for backward compatibility).
 func (rs *RTSPSession) getTrace() []string {
 	if rs.logger != nil {
@@ -134,9 +409,10 @@ func (rs *RTSPSession) getTrace() []string {
 	return nil
 }
 
-// Close closes the RTSP client connection.
+// Close closes the RTSP client connection and stops its goroutines. It is safe to call after a failed
+// PerformDescribe.
 func (rs *RTSPSession) Close() {
-	if rs.client != nil {
+	if rs.client != nil && rs.started {
 		rs.client.Close()
 	}
 }
@@ -0,0 +1,186 @@
+package rtspeek
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/headers"
+	"github.com/bluenviron/gortsplib/v4/pkg/sdp"
+	psdp "github.com/pion/sdp/v3"
+)
+
+// SessionDetails holds session-level SDP information returned by DESCRIBE.
+type SessionDetails struct {
+	Name        string      `json:"name,omitempty"`
+	Range       *SDPRange   `json:"range,omitempty"`
+	Control     string      `json:"control,omitempty"`
+	ContentBase string      `json:"content_base,omitempty"`
+	BaseURL     string      `json:"base_url,omitempty"`
+	Bandwidths  []Bandwidth `json:"bandwidths,omitempty"`
+	RawSDP      string      `json:"raw_sdp,omitempty"`
+	// Server header of the responses and the WWW-Authenticate schemes offered before DESCRIBE succeeded
+	Server      string   `json:"server,omitempty"`
+	AuthMethods []string `json:"auth_methods,omitempty"`
+}
+
+// SDPRange describes the a=range attribute (live vs recorded content).
+type SDPRange struct {
+	Raw      string   `json:"raw"`
+	Live     bool     `json:"live"`
+	Duration *float64 `json:"duration_seconds,omitempty"`
+}
+
+// Bandwidth is a single b= line (e.g. AS in kbps, TIAS in bps).
+type Bandwidth struct {
+	Type  string `json:"type"`
+	Value uint64 `json:"value"`
+}
+
+// parseSDP decodes raw SDP bytes into the gortsplib SDP model.
+func parseSDP(raw []byte) (*sdp.SessionDescription, error) {
+	var ssd sdp.SessionDescription
+	if err := ssd.Unmarshal(raw); err != nil {
+		return nil, fmt.Errorf("invalid SDP: %w", err)
+	}
+	return &ssd, nil
+}
+
+// extractSessionDetails builds SessionDetails from a parsed SDP and the DESCRIBE response.
+func extractSessionDetails(ssd *sdp.SessionDescription, res *base.Response, baseURL *base.URL) *SessionDetails {
+	sd := &SessionDetails{}
+	if ssd != nil {
+		sd.Name = strings.TrimSpace(string(ssd.SessionName))
+		sd.Control = sdpAttribute(ssd.Attributes, "control")
+		if v := sdpAttribute(ssd.Attributes, "range"); v != "" {
+			sd.Range = parseSDPRange(v)
+		}
+		sd.Bandwidths = convertBandwidths(ssd.Bandwidth)
+	}
+	if res != nil {
+		if cb, ok := res.Header["Content-Base"]; ok && len(cb) > 0 {
+			sd.ContentBase = cb[0]
+		}
+	}
+	if baseURL != nil {
+		sd.BaseURL = baseURL.String()
+	}
+	return sd
+}
+
+// applyMediaSDPDetails enriches a MediaInfo with attributes from its SDP media description.
+func applyMediaSDPDetails(mi *MediaInfo, md *psdp.MediaDescription) {
+	if md == nil {
+		return
+	}
+	mi.Control = sdpAttribute(md.Attributes, "control")
+	mi.Direction = sdpDirection(md.Attributes)
+	mi.Bandwidths = convertBandwidths(md.Bandwidth)
+
+	rate := sdpAttribute(md.Attributes, "framerate")
+	if rate == "" {
+		rate = sdpAttribute(md.Attributes, "x-framerate")
+	}
+	if rate != "" {
+		if f, err := strconv.ParseFloat(strings.TrimSpace(rate), 64); err == nil && f > 0 {
+			mi.Framerate = &f
+		}
+	}
+
+	if dims := sdpAttribute(md.Attributes, "x-dimensions"); dims != "" {
+		mi.Dimensions = parseXDimensions(dims)
+	}
+}
+
+// sdpAttribute returns the value of the first attribute with the given key.
+func sdpAttribute(attrs []psdp.Attribute, key string) string {
+	for _, a := range attrs {
+		if a.Key == key {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// sdpDirection returns the declared direction attribute, if any.
+func sdpDirection(attrs []psdp.Attribute) string {
+	for _, a := range attrs {
+		switch a.Key {
+		case "sendonly", "recvonly", "sendrecv", "inactive":
+			return a.Key
+		}
+	}
+	return ""
+}
+
+func convertBandwidths(list []psdp.Bandwidth) []Bandwidth {
+	if len(list) == 0 {
+		return nil
+	}
+	out := make([]Bandwidth, 0, len(list))
+	for _, b := range list {
+		typ := b.Type
+		if b.Experimental {
+			typ = "X-" + typ
+		}
+		out = append(out, Bandwidth{Type: typ, Value: b.Bandwidth})
+	}
+	return out
+}
+
+// parseSDPRange interprets an a=range value. Open-ended or "now-" ranges are live.
+func parseSDPRange(v string) *SDPRange {
+	r := &SDPRange{Raw: v}
+	lower := strings.ToLower(strings.TrimSpace(v))
+	if strings.HasPrefix(lower, "npt=now") {
+		r.Live = true
+		return r
+	}
+
+	var h headers.Range
+	if err := h.Unmarshal(base.HeaderValue{v}); err != nil {
+		// Unparseable ranges are reported verbatim; treat a missing end as live.
+		r.Live = strings.HasSuffix(lower, "-")
+		return r
+	}
+
+	switch rv := h.Value.(type) {
+	case *headers.RangeNPT:
+		if rv.End == nil {
+			r.Live = true
+		} else {
+			d := (*rv.End - rv.Start).Seconds()
+			r.Duration = &d
+		}
+	case *headers.RangeUTC:
+		if rv.End == nil {
+			r.Live = true
+		} else {
+			d := rv.End.Sub(rv.Start).Seconds()
+			r.Duration = &d
+		}
+	case *headers.RangeSMPTE:
+		if rv.End == nil {
+			r.Live = true
+		} else {
+			d := (rv.End.Time - rv.Start.Time).Seconds()
+			r.Duration = &d
+		}
+	}
+	return r
+}
+
+// parseXDimensions parses the "WIDTH,HEIGHT" form used by a=x-dimensions.
+func parseXDimensions(v string) *Resolution {
+	parts := strings.Split(v, ",")
+	if len(parts) != 2 {
+		return nil
+	}
+	w, err1 := strconv.Atoi(strings.TrimSpace(parts[0]))
+	h, err2 := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err1 != nil || err2 != nil || w <= 0 || h <= 0 {
+		return nil
+	}
+	return &Resolution{Width: w, Height: h}
+}
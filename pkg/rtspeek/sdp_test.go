@@ -0,0 +1,141 @@
+package rtspeek
+
+import (
+	"testing"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+)
+
+const sampleSDP = "v=0\r\n" +
+	"o=- 1 1 IN IP4 192.168.1.10\r\n" +
+	"s=Media Presentation\r\n" +
+	"c=IN IP4 0.0.0.0\r\n" +
+	"b=AS:5100\r\n" +
+	"t=0 0\r\n" +
+	"a=control:rtsp://192.168.1.10/live/\r\n" +
+	"a=range:npt=now-\r\n" +
+	"m=video 0 RTP/AVP 96\r\n" +
+	"b=AS:5000\r\n" +
+	"a=rtpmap:96 H264/90000\r\n" +
+	"a=fmtp:96 packetization-mode=1\r\n" +
+	"a=control:trackID=1\r\n" +
+	"a=recvonly\r\n" +
+	"a=framerate:25.0\r\n" +
+	"a=x-dimensions:1920,1080\r\n" +
+	"m=audio 0 RTP/AVP 0\r\n" +
+	"b=TIAS:64000\r\n" +
+	"a=rtpmap:0 PCMU/8000\r\n" +
+	"a=control:trackID=2\r\n" +
+	"a=sendonly\r\n"
+
+func TestParseSDPRange(t *testing.T) {
+	cases := []struct {
+		in       string
+		live     bool
+		duration float64
+	}{
+		{"npt=now-", true, 0},
+		{"npt=0-", true, 0},
+		{"npt=0-30.5", false, 30.5},
+		{"npt=10-70", false, 60},
+		{"clock=20240101T000000Z-20240101T000100Z", false, 60},
+	}
+	for _, c := range cases {
+		t.Run(c.in, func(t *testing.T) {
+			r := parseSDPRange(c.in)
+			if r.Raw != c.in {
+				t.Fatalf("expected raw %q, got %q", c.in, r.Raw)
+			}
+			if r.Live != c.live {
+				t.Fatalf("expected live=%v, got %v", c.live, r.Live)
+			}
+			if !c.live {
+				if r.Duration == nil || *r.Duration != c.duration {
+					t.Fatalf("expected duration %v, got %v", c.duration, r.Duration)
+				}
+			}
+		})
+	}
+}
+
+func TestParseXDimensions(t *testing.T) {
+	if r := parseXDimensions("1280, 720"); r == nil || r.Width != 1280 || r.Height != 720 {
+		t.Fatalf("unexpected dimensions: %#v", r)
+	}
+	for _, bad := range []string{"", "1280", "a,b", "0,720"} {
+		if r := parseXDimensions(bad); r != nil {
+			t.Fatalf("expected nil for %q, got %#v", bad, r)
+		}
+	}
+}
+
+func TestApplySDPDetails(t *testing.T) {
+	desc := &description.Session{Medias: []*description.Media{
+		{Type: description.MediaTypeVideo, Formats: []format.Format{&format.H264{PayloadTyp: 96, PacketizationMode: 1}}},
+		{Type: description.MediaTypeAudio, Formats: []format.Format{&format.G711{PayloadTyp: 0, MULaw: true, SampleRate: 8000, ChannelCount: 1}}},
+	}}
+	info := &streamInfo{}
+	if err := NewMediaProcessor().ProcessMedias(desc, info); err != nil {
+		t.Fatalf("process: %v", err)
+	}
+
+	res := &base.Response{
+		StatusCode: base.StatusOK,
+		Header:     base.Header{"Content-Base": base.HeaderValue{"rtsp://192.168.1.10/live/"}},
+		Body:       []byte(sampleSDP),
+	}
+	applySDPDetails(info, res, desc, true)
+
+	sd := info.GetSessionDetails()
+	if sd == nil {
+		t.Fatal("expected session details")
+	}
+	if sd.Name != "Media Presentation" {
+		t.Fatalf("unexpected session name %q", sd.Name)
+	}
+	if sd.Control != "rtsp://192.168.1.10/live/" || sd.ContentBase != "rtsp://192.168.1.10/live/" {
+		t.Fatalf("unexpected control/content-base: %q / %q", sd.Control, sd.ContentBase)
+	}
+	if sd.Range == nil || !sd.Range.Live {
+		t.Fatalf("expected live range, got %#v", sd.Range)
+	}
+	if len(sd.Bandwidths) != 1 || sd.Bandwidths[0] != (Bandwidth{Type: "AS", Value: 5100}) {
+		t.Fatalf("unexpected session bandwidths: %#v", sd.Bandwidths)
+	}
+	if info.GetRawSDP() != sampleSDP {
+		t.Fatal("expected raw SDP to be preserved")
+	}
+
+	video := info.GetFirstVideoMedia()
+	if video.Control != "trackID=1" || video.Direction != "recvonly" {
+		t.Fatalf("unexpected video control/direction: %q / %q", video.Control, video.Direction)
+	}
+	if video.Framerate == nil || *video.Framerate != 25 {
+		t.Fatalf("unexpected framerate: %v", video.Framerate)
+	}
+	if video.Dimensions == nil || video.Dimensions.String() != "1920x1080" {
+		t.Fatalf("unexpected dimensions: %#v", video.Dimensions)
+	}
+
+	audio := info.GetAudioMedias()[0]
+	if audio.Direction != "sendonly" {
+		t.Fatalf("unexpected audio direction %q", audio.Direction)
+	}
+	if len(audio.Bandwidths) != 1 || audio.Bandwidths[0] != (Bandwidth{Type: "TIAS", Value: 64000}) {
+		t.Fatalf("unexpected audio bandwidths: %#v", audio.Bandwidths)
+	}
+}
+
+func TestApplySDPDetailsWithoutRaw(t *testing.T) {
+	info := &streamInfo{}
+	res := &base.Response{StatusCode: base.StatusOK, Body: []byte(sampleSDP)}
+	applySDPDetails(info, res, nil, false)
+	if info.GetRawSDP() != "" {
+		t.Fatal("raw SDP must be opt-in")
+	}
+	if info.GetSessionDetails().Name != "Media Presentation" {
+		t.Fatalf("unexpected session details: %#v", info.GetSessionDetails())
+	}
+}
@@ -0,0 +1,186 @@
+package rtspeek
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+// ntpEpochOffset is the number of seconds between 1900-01-01 (NTP epoch) and 1970-01-01.
+const ntpEpochOffset = 2208988800
+
+// minDriftSpan is the shortest sender report span over which drift is estimated.
+const minDriftSpan = time.Second
+
+// ntpValidAfter marks sender report times older than this as an unset camera clock.
+var ntpValidAfter = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// SenderReportInfo summarizes the RTCP sender reports of one track received during a live probe.
+type SenderReportInfo struct {
+	SenderReports int     `json:"sender_reports"`
+	SSRC          uint32  `json:"ssrc"`
+	Interval      float64 `json:"interval_seconds,omitempty"` // mean time between reports
+	// NTP to RTP timestamp mapping of the last report
+	NTP          time.Time `json:"ntp"`
+	RTPTimestamp uint32    `json:"rtp_timestamp"`
+	// NTPInvalid is set when the camera reports a wall clock before 2000 (NTP never synchronized).
+	NTPInvalid bool `json:"ntp_invalid,omitempty"`
+	// ClockOffset is camera time minus probe host time in milliseconds, taken from the least delayed
+	// report; positive means the camera clock is ahead. It includes the one-way network delay.
+	ClockOffset float64 `json:"clock_offset_ms"`
+	// ClockDrift is how fast the camera wall clock runs against the host clock (parts per million).
+	ClockDrift *float64 `json:"clock_drift_ppm,omitempty"`
+	// RTPDrift is how fast the RTP clock runs against the camera wall clock (parts per million).
+	RTPDrift          *float64 `json:"rtp_drift_ppm,omitempty"`
+	MeasuredClockRate float64  `json:"measured_clock_rate,omitempty"`
+	// Cross-track alignment against the reference track (the first video track with reports):
+	// positive means this track's timestamps run ahead, i.e. it would be presented early.
+	SyncReference *int     `json:"sync_reference,omitempty"`
+	SyncOffset    *float64 `json:"sync_offset_ms,omitempty"`
+}
+
+// srSample is one received sender report.
+type srSample struct {
+	ntp      time.Time
+	rtp      uint32
+	received time.Time
+}
+
+// senderReportAnalyzer records sender reports and the capture-to-arrival latency of frames.
+type senderReportAnalyzer struct {
+	clockRate int
+	ssrc      uint32
+	hasSSRC   bool
+	reports   []srSample
+
+	lastTS    uint32
+	hasLastTS bool
+	latencies []float64 // arrival minus capture time (seconds) of each frame's first packet
+}
+
+func newSenderReportAnalyzer(clockRate int) *senderReportAnalyzer {
+	if clockRate <= 0 {
+		clockRate = 90000
+	}
+	return &senderReportAnalyzer{clockRate: clockRate}
+}
+
+func (sa *senderReportAnalyzer) onRTP(pkt *rtp.Packet, received time.Time) {
+	if !sa.hasSSRC {
+		sa.ssrc, sa.hasSSRC = pkt.SSRC, true
+	}
+	if sa.hasLastTS && pkt.Timestamp == sa.lastTS {
+		return
+	}
+	sa.lastTS, sa.hasLastTS = pkt.Timestamp, true
+	if capture, ok := sa.captureTime(pkt.Timestamp); ok {
+		sa.latencies = append(sa.latencies, received.Sub(capture).Seconds())
+	}
+}
+
+func (sa *senderReportAnalyzer) onRTCP(pkt rtcp.Packet, received time.Time) {
+	sr, ok := pkt.(*rtcp.SenderReport)
+	if !ok {
+		return
+	}
+	if sa.hasSSRC && sr.SSRC != sa.ssrc {
+		return
+	}
+	sa.ssrc, sa.hasSSRC = sr.SSRC, true
+	sa.reports = append(sa.reports, srSample{ntp: ntpToTime(sr.NTPTime), rtp: sr.RTPTime, received: received})
+}
+
+// captureTime maps an RTP timestamp to the camera wall clock through the latest report.
+func (sa *senderReportAnalyzer) captureTime(ts uint32) (time.Time, bool) {
+	if len(sa.reports) == 0 {
+		return time.Time{}, false
+	}
+	last := sa.reports[len(sa.reports)-1]
+	ticks := int64(int32(ts - last.rtp))
+	return last.ntp.Add(time.Duration(ticks * int64(time.Second) / int64(sa.clockRate))), true
+}
+
+func (sa *senderReportAnalyzer) finish(mi *MediaInfo, _ time.Duration) {
+	n := len(sa.reports)
+	if n == 0 {
+		return
+	}
+	first, last := sa.reports[0], sa.reports[n-1]
+	info := &SenderReportInfo{
+		SenderReports: n,
+		SSRC:          sa.ssrc,
+		NTP:           last.ntp,
+		RTPTimestamp:  last.rtp,
+		NTPInvalid:    last.ntp.Before(ntpValidAfter),
+		ClockOffset:   math.Inf(-1),
+	}
+	for _, r := range sa.reports {
+		info.ClockOffset = max(info.ClockOffset, r.ntp.Sub(r.received).Seconds()*1000)
+	}
+
+	if n >= 2 {
+		info.Interval = last.received.Sub(first.received).Seconds() / float64(n-1)
+	}
+	if last.received.Sub(first.received) >= minDriftSpan {
+		// Camera clock against host clock
+		xs, ys := make([]float64, n), make([]float64, n)
+		for i, r := range sa.reports {
+			xs[i] = r.received.Sub(first.received).Seconds()
+			ys[i] = r.ntp.Sub(first.ntp).Seconds()
+		}
+		if slope, ok := linearSlope(xs, ys); ok {
+			drift := (slope - 1) * 1e6
+			info.ClockDrift = &drift
+		}
+
+		// RTP clock against camera clock
+		var unwrap tsUnwrapper
+		for i, r := range sa.reports {
+			xs[i] = r.ntp.Sub(first.ntp).Seconds()
+			ys[i] = float64(unwrap.unwrap(r.rtp)) / float64(sa.clockRate)
+		}
+		if slope, ok := linearSlope(xs, ys); ok {
+			drift := (slope - 1) * 1e6
+			info.RTPDrift = &drift
+			info.MeasuredClockRate = slope * float64(sa.clockRate)
+		}
+	}
+	mi.RTCP = info
+}
+
+// latency returns the median arrival-minus-capture time of frames mapped through sender reports.
+func (sa *senderReportAnalyzer) latency() (float64, bool) {
+	if len(sa.latencies) == 0 {
+		return 0, false
+	}
+	sorted := append([]float64(nil), sa.latencies...)
+	sort.Float64s(sorted)
+	return sorted[len(sorted)/2], true
+}
+
+// linearSlope fits y = a + b*x by least squares and returns b.
+func linearSlope(xs, ys []float64) (float64, bool) {
+	n := float64(len(xs))
+	var sx, sy, sxx, sxy float64
+	for i := range xs {
+		sx += xs[i]
+		sy += ys[i]
+		sxx += xs[i] * xs[i]
+		sxy += xs[i] * ys[i]
+	}
+	den := n*sxx - sx*sx
+	if den == 0 {
+		return 0, false
+	}
+	return (n*sxy - sx*sy) / den, true
+}
+
+// ntpToTime converts a 64-bit NTP timestamp (RFC 3550 section 4) to time.Time.
+func ntpToTime(v uint64) time.Time {
+	secs := int64(v>>32) - ntpEpochOffset
+	nanos := int64((v & 0xffffffff) * 1e9 >> 32)
+	return time.Unix(secs, nanos).UTC()
+}
@@ -0,0 +1,157 @@
+package rtspeek
+
+import (
+	"context"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+// timeToNTP is the inverse of ntpToTime.
+func timeToNTP(t time.Time) uint64 {
+	secs := uint64(t.Unix() + ntpEpochOffset)
+	frac := (uint64(t.Nanosecond()) << 32) / 1e9
+	return secs<<32 | frac
+}
+
+func TestNTPConversion(t *testing.T) {
+	if got := ntpToTime(uint64(ntpEpochOffset) << 32); !got.Equal(time.Unix(0, 0)) {
+		t.Fatalf("NTP of the Unix epoch: got %v", got)
+	}
+	if got := ntpToTime(uint64(ntpEpochOffset)<<32 | 1<<31); got != time.Unix(0, 5e8).UTC() {
+		t.Fatalf("half-second fraction: got %v", got)
+	}
+	now := time.Now()
+	if d := ntpToTime(timeToNTP(now)).Sub(now); d < -time.Nanosecond || d > time.Nanosecond {
+		t.Fatalf("round trip off by %v", d)
+	}
+}
+
+func TestSenderReportAnalyzerOffsetAndDrift(t *testing.T) {
+	const (
+		offset   = 2 * time.Second
+		clockPPM = 100.0 // camera wall clock runs fast
+		rtpRate  = 90009 // RTP clock 100 ppm fast against the camera clock
+	)
+	sa := newSenderReportAnalyzer(90000)
+	host := time.Now()
+	ntp0 := host.Add(offset)
+	for i := 0; i <= 8; i++ {
+		elapsed := time.Duration(i) * 500 * time.Millisecond
+		camera := ntp0.Add(elapsed + time.Duration(float64(elapsed)*clockPPM/1e6))
+		rtpTS := uint32(1000 + camera.Sub(ntp0).Seconds()*rtpRate)
+		sa.onRTCP(&rtcp.SenderReport{SSRC: 7, NTPTime: timeToNTP(camera), RTPTime: rtpTS}, host.Add(elapsed))
+	}
+
+	var mi MediaInfo
+	sa.finish(&mi, 4*time.Second)
+	sr := mi.RTCP
+	if sr == nil || sr.SenderReports != 9 || sr.SSRC != 7 || sr.NTPInvalid {
+		t.Fatalf("unexpected report summary: %+v", sr)
+	}
+	if math.Abs(sr.ClockOffset-2000) > 1 || math.Abs(sr.Interval-0.5) > 1e-9 {
+		t.Fatalf("unexpected offset/interval: %+v", sr)
+	}
+	if sr.ClockDrift == nil || math.Abs(*sr.ClockDrift-clockPPM) > 1 {
+		t.Fatalf("expected ~%v ppm clock drift, got %v", clockPPM, sr.ClockDrift)
+	}
+	if sr.RTPDrift == nil || math.Abs(*sr.RTPDrift-100) > 1 || math.Abs(sr.MeasuredClockRate-rtpRate) > 0.1 {
+		t.Fatalf("expected ~100 ppm RTP drift, got %v (%v Hz)", sr.RTPDrift, sr.MeasuredClockRate)
+	}
+}
+
+func TestSenderReportAnalyzerUnsetClock(t *testing.T) {
+	sa := newSenderReportAnalyzer(8000)
+	sa.onRTCP(&rtcp.SenderReport{NTPTime: 3600 << 32}, time.Now()) // one hour after 1900
+	var mi MediaInfo
+	sa.finish(&mi, time.Second)
+	if mi.RTCP == nil || !mi.RTCP.NTPInvalid || mi.RTCP.ClockDrift != nil {
+		t.Fatalf("expected an invalid NTP clock without drift, got %+v", mi.RTCP)
+	}
+}
+
+func TestDescribeStreamLiveProbeSenderReports(t *testing.T) {
+	const (
+		cameraOffset = 5 * time.Second
+		audioAhead   = 300 * time.Millisecond // audio sender reports claim a later wall clock
+	)
+	video, audio := h264Media(), g711Media()
+	audio.Control = "trackID=1"
+	desc := &description.Session{Medias: []*description.Media{video, audio}}
+
+	var once sync.Once
+	var start time.Time
+	var ssrcs map[*description.Media]uint32
+	url := startPlayServer(t, desc, 10*time.Millisecond, func(stream *gortsplib.ServerStream, n int) {
+		once.Do(func() {
+			start = time.Now()
+			ssrcs = make(map[*description.Media]uint32)
+			for m, ms := range stream.Stats().Medias {
+				for _, fs := range ms.Formats {
+					ssrcs[m] = fs.LocalSSRC
+				}
+			}
+		})
+		now := time.Now()
+		for _, tr := range []struct {
+			media *description.Media
+			rate  float64
+			ahead time.Duration
+		}{{video, 90000, 0}, {audio, 8000, audioAhead}} {
+			ts := uint32(now.Sub(start).Seconds() * tr.rate)
+			_ = stream.WritePacketRTP(tr.media, &rtp.Packet{
+				Header:  rtp.Header{Version: 2, PayloadType: tr.media.Formats[0].PayloadType(), SequenceNumber: uint16(n), Timestamp: ts, Marker: true},
+				Payload: []byte{0x01, 0x02},
+			})
+			if n%5 == 0 {
+				_ = stream.WritePacketRTCP(tr.media, &rtcp.SenderReport{
+					SSRC: ssrcs[tr.media], NTPTime: timeToNTP(now.Add(cameraOffset + tr.ahead)), RTPTime: ts,
+				})
+			}
+		}
+	})
+
+	ctx := WithLiveProbe(context.Background(), LiveProbeOptions{Duration: 1500 * time.Millisecond, Transport: "tcp"})
+	info, err := DescribeStream(ctx, url, 3*time.Second)
+	if err != nil {
+		t.Fatalf("describe: %v", err)
+	}
+
+	v := info.GetVideoMedias()[0].RTCP
+	if v == nil || v.SenderReports < 2 || v.SyncOffset != nil {
+		t.Fatalf("expected video sender reports as sync reference, got %+v", v)
+	}
+	if math.Abs(v.ClockOffset-float64(cameraOffset/time.Millisecond)) > 100 {
+		t.Fatalf("expected ~5s camera clock offset, got %v ms", v.ClockOffset)
+	}
+	if v.ClockDrift == nil || math.Abs(*v.ClockDrift) > 20000 {
+		t.Fatalf("expected near-zero clock drift, got %v", v.ClockDrift)
+	}
+
+	if ti := info.GetVideoMedias()[0].Timing; ti == nil || len(ti.Findings) > 0 || ti.MeasuredClockRate == 0 {
+		t.Fatalf("expected clean timestamps, got %+v", ti)
+	}
+
+	a := info.GetAudioMedias()[0].RTCP
+	if a == nil || a.SyncReference == nil || *a.SyncReference != 0 || a.SyncOffset == nil {
+		t.Fatalf("expected audio sync against video, got %+v", a)
+	}
+	if math.Abs(*a.SyncOffset-float64(audioAhead/time.Millisecond)) > 50 {
+		t.Fatalf("expected ~300 ms audio lead, got %v ms", *a.SyncOffset)
+	}
+
+	var sb strings.Builder
+	if err := WritePrometheus(&sb, CollectMetrics(info)); err != nil {
+		t.Fatalf("write metrics: %v", err)
+	}
+	if !strings.Contains(sb.String(), "rtpeek_rtcp_sync_offset_seconds{") {
+		t.Fatalf("missing sync metric:\n%s", sb.String())
+	}
+}
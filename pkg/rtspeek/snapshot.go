@@ -0,0 +1,172 @@
+package rtspeek
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/pion/rtp"
+)
+
+// ErrNoSnapshotTrack is returned when the stream has no H264, H265 or MJPEG video track.
+var ErrNoSnapshotTrack = errors.New("no H264, H265 or MJPEG video track")
+
+// SnapshotOptions configures CaptureSnapshot.
+type SnapshotOptions struct {
+	// Transport forces "udp", "tcp" or "multicast"; empty lets the client choose.
+	Transport string
+	// MediaIndex selects the SDP media to capture; negative picks the first supported video track.
+	MediaIndex int
+}
+
+// Snapshot is the first keyframe received from a stream.
+type Snapshot struct {
+	URL          string      `json:"url"`
+	MediaIndex   int         `json:"media_index"`
+	Codec        string      `json:"codec"`
+	Extension    string      `json:"extension"` // ".jpg", ".h264" or ".h265"
+	Size         int         `json:"size"`
+	Resolution   *Resolution `json:"resolution,omitempty"`
+	RTPTimestamp uint32      `json:"rtp_timestamp"`
+	WallClock    time.Time   `json:"wall_clock"`    // local receive time of the frame
+	NTP          *time.Time  `json:"ntp,omitempty"` // sender time from RTCP SR, when available
+	Wait         float64     `json:"wait_ms"`       // PLAY to keyframe
+	Transport    string      `json:"transport,omitempty"`
+	// Data is a JPEG image, or an Annex-B access unit with parameter sets prepended.
+	Data []byte `json:"-"`
+}
+
+// snapshotExtensions maps codecs to the file extension of their snapshot data.
+var snapshotExtensions = map[string]string{
+	"H264":  ".h264",
+	"H265":  ".h265",
+	"MJPEG": ".jpg",
+}
+
+// CaptureSnapshot DESCRIBEs, SETUPs and PLAYs a single video track and returns its first keyframe.
+// The timeout bounds the whole capture, including the wait for a keyframe.
+func CaptureSnapshot(ctx context.Context, url string, timeout time.Duration, opts SnapshotOptions) (*Snapshot, error) {
+	parsedURL, err := parseRTSPURL(url)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parseTransport(opts.Transport); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	dialer := NewNetworkDialer(timeout)
+	if err := dialer.PreflightDial(ctx, parsedURL); err != nil {
+		return nil, fmt.Errorf("connection failed: %w", err)
+	}
+
+	session := NewRTSPSession(timeout, nil)
+	defer session.Close()
+	_ = session.SetTransport(opts.Transport) // validated above
+
+	desc, _, err := session.PerformDescribe(ctx, parsedURL)
+	if err != nil {
+		return nil, err
+	}
+
+	index, media, decoder, err := selectSnapshotMedia(desc, opts.MediaIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	snap := &Snapshot{URL: url, MediaIndex: index, Codec: decoder.codec, Extension: snapshotExtensions[decoder.codec]}
+	frameCh := make(chan error, 1)
+	var once sync.Once
+	var playStart time.Time
+
+	onRTP := func(m *description.Media, _ format.Format, pkt *rtp.Packet) {
+		if m != media {
+			return
+		}
+		received := time.Now()
+		au, err := decoder.decode(pkt, received)
+		if err != nil || au == nil || !au.random {
+			return
+		}
+		once.Do(func() {
+			frameCh <- snap.fill(decoder, au, session, m, pkt, playStart)
+		})
+	}
+
+	playStart = time.Now()
+	transport, err := session.SetupAndPlay(desc, []*description.Media{media}, onRTP, nil)
+	if err != nil {
+		return nil, err
+	}
+	snap.Transport = transport
+
+	waitCh := make(chan error, 1)
+	go func() { waitCh <- session.Wait() }()
+
+	select {
+	case err := <-frameCh:
+		if err != nil {
+			return nil, err
+		}
+	case <-ctx.Done():
+		return nil, fmt.Errorf("no keyframe received within %v", timeout)
+	case err := <-waitCh:
+		return nil, fmt.Errorf("session ended before a keyframe: %w", err)
+	}
+
+	if session.transportSwitched.Load() {
+		snap.Transport = "tcp"
+	}
+	return snap, nil
+}
+
+// selectSnapshotMedia picks the requested media, or the first one with a supported video format.
+func selectSnapshotMedia(desc *description.Session, want int) (int, *description.Media, *frameDecoder, error) {
+	if want >= len(desc.Medias) {
+		return 0, nil, nil, fmt.Errorf("media index %d out of range (%d medias)", want, len(desc.Medias))
+	}
+	for i, m := range desc.Medias {
+		if (want >= 0 && i != want) || m.IsBackChannel {
+			continue
+		}
+		for _, f := range m.Formats {
+			if fd, err := newFrameDecoder(f); err == nil {
+				return i, m, fd, nil
+			} else if want >= 0 {
+				return 0, nil, nil, err
+			}
+		}
+	}
+	return 0, nil, nil, ErrNoSnapshotTrack
+}
+
+// fill copies the keyframe and its timing into the snapshot.
+func (s *Snapshot) fill(fd *frameDecoder, au *accessUnit, session *RTSPSession,
+	m *description.Media, pkt *rtp.Packet, playStart time.Time,
+) error {
+	if au.image != nil {
+		s.Data = au.image
+		s.Resolution = jpegResolution(au.image)
+	} else {
+		data, err := fd.annexB(au)
+		if err != nil {
+			return fmt.Errorf("encode Annex-B: %w", err)
+		}
+		s.Data = data
+		s.Resolution = fd.resolution()
+	}
+	s.Size = len(s.Data)
+	s.RTPTimestamp = au.timestamp
+	s.WallClock = au.received
+	s.Wait = float64(au.received.Sub(playStart)) / float64(time.Millisecond)
+	if ntp, ok := session.PacketNTP(m, pkt); ok {
+		s.NTP = &ntp
+	}
+	return nil
+}
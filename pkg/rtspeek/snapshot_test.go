@@ -0,0 +1,109 @@
+package rtspeek
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/jpeg"
+	"testing"
+	"time"
+
+	"github.com/0x524A/rtspeek/pkg/rtspeektest"
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	h264conf "github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
+)
+
+func TestCaptureSnapshotH264(t *testing.T) {
+	video := &description.Media{Type: description.MediaTypeVideo, Formats: []format.Format{&format.H264{PayloadTyp: 96, SPS: rtspeektest.H264SPS, PPS: rtspeektest.H264PPS, PacketizationMode: 1}}}
+	desc := &description.Session{Medias: []*description.Media{video}}
+	src := newH264Source(5)
+
+	url := startPlayServer(t, desc, 10*time.Millisecond, func(stream *gortsplib.ServerStream, n int) {
+		for _, pkt := range src.frame(n) {
+			_ = stream.WritePacketRTP(video, pkt)
+		}
+	})
+
+	snap, err := CaptureSnapshot(context.Background(), url, 3*time.Second, SnapshotOptions{Transport: "tcp", MediaIndex: -1})
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	if snap.Codec != "H264" || snap.Extension != ".h264" || snap.Transport != "tcp" {
+		t.Fatalf("unexpected snapshot: %+v", snap)
+	}
+	if snap.Resolution == nil || snap.Resolution.Width != 1280 {
+		t.Fatalf("unexpected resolution: %+v", snap.Resolution)
+	}
+	if snap.RTPTimestamp%(5*h264FrameTicks) != 0 || snap.WallClock.IsZero() || snap.Size != len(snap.Data) {
+		t.Fatalf("unexpected timing: %+v", snap)
+	}
+
+	var nalus h264conf.AnnexB
+	if err := nalus.Unmarshal(snap.Data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if !h264conf.IsRandomAccess(nalus) || !bytes.Equal(nalus[0], rtspeektest.H264SPS) {
+		t.Fatal("expected a self-contained IDR access unit")
+	}
+}
+
+func TestCaptureSnapshotMJPEG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewYCbCr(image.Rect(0, 0, 64, 48), image.YCbCrSubsampleRatio420), nil); err != nil {
+		t.Fatalf("encode jpeg: %v", err)
+	}
+	f := &format.MJPEG{}
+	enc, err := f.CreateEncoder()
+	if err != nil {
+		t.Fatalf("create encoder: %v", err)
+	}
+	video := &description.Media{Type: description.MediaTypeVideo, Formats: []format.Format{f}}
+	desc := &description.Session{Medias: []*description.Media{video}}
+
+	url := startPlayServer(t, desc, 20*time.Millisecond, func(stream *gortsplib.ServerStream, n int) {
+		pkts, err := enc.Encode(buf.Bytes())
+		if err != nil {
+			return
+		}
+		for _, pkt := range pkts {
+			pkt.Timestamp = uint32(n * 9000)
+			_ = stream.WritePacketRTP(video, pkt)
+		}
+	})
+
+	snap, err := CaptureSnapshot(context.Background(), url, 3*time.Second, SnapshotOptions{Transport: "tcp", MediaIndex: -1})
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	if snap.Codec != "MJPEG" || snap.Extension != ".jpg" {
+		t.Fatalf("unexpected snapshot: %+v", snap)
+	}
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(snap.Data))
+	if err != nil {
+		t.Fatalf("snapshot is not a JPEG: %v", err)
+	}
+	if cfg.Width != 64 || snap.Resolution == nil || snap.Resolution.Height != 48 {
+		t.Fatalf("unexpected resolution: %+v", snap.Resolution)
+	}
+}
+
+func TestSelectSnapshotMedia(t *testing.T) {
+	desc := onvifSession()
+	idx, _, fd, err := selectSnapshotMedia(desc, -1)
+	if err != nil || idx != 0 || fd.codec != "H264" {
+		t.Fatalf("expected first video track, got %d %v", idx, err)
+	}
+	if _, _, _, err := selectSnapshotMedia(desc, 1); err == nil {
+		t.Fatal("expected error for metadata track")
+	}
+	if _, _, _, err := selectSnapshotMedia(desc, 7); err == nil {
+		t.Fatal("expected out of range error")
+	}
+	audioOnly := &description.Session{Medias: desc.Medias[2:]}
+	if _, _, _, err := selectSnapshotMedia(audioOnly, -1); !errors.Is(err, ErrNoSnapshotTrack) {
+		t.Fatalf("expected ErrNoSnapshotTrack, got %v", err)
+	}
+}
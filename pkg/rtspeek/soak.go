@@ -0,0 +1,452 @@
+package rtspeek
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/pion/rtp"
+)
+
+// Soak timeline event types.
+const (
+	SoakEventSessionStart     = "session_start"    // SETUP/PLAY succeeded (session > 1 is a reconnect)
+	SoakEventDisconnect       = "disconnect"       // the session ended before the soak did
+	SoakEventReconnectFailed  = "reconnect_failed" // a reconnect attempt failed
+	SoakEventStall            = "stall"            // a track received nothing for longer than the threshold
+	SoakEventSPSChange        = "sps_change"       // the video parameter sets changed
+	SoakEventResolutionChange = "resolution_change"
+	SoakEventEnd              = "end"
+)
+
+// Soak stop reasons.
+const (
+	SoakStoppedDuration    = "duration"
+	SoakStoppedInterrupted = "interrupted"
+)
+
+// Soak defaults.
+const (
+	DefaultSoakStallThreshold = 2 * time.Second
+	DefaultSoakReconnectDelay = 5 * time.Second
+	// defaultKeepalivePeriod is what the client uses when the server advertises no session timeout.
+	defaultKeepalivePeriod = 30 * time.Second
+)
+
+// SoakOptions configures Soak.
+type SoakOptions struct {
+	// Duration of the whole soak, reconnects included.
+	Duration time.Duration
+	// StallThreshold is the silence on a track that counts as a stall (default 2s).
+	StallThreshold time.Duration
+	// StallMetadata also applies StallThreshold to ONVIF metadata and KLV tracks, which many cameras only
+	// send when there is something to report.
+	StallMetadata bool
+	// ReconnectDelay is the pause before each reconnect attempt (default 5s).
+	ReconnectDelay time.Duration
+	// Transport forces "udp", "tcp" or "multicast"; empty lets the client choose.
+	Transport string
+	// OnEvent, if set, receives timeline events as they are recorded. It must not block. Stalls are sent
+	// as soon as they are detected, with the silence so far as their duration.
+	OnEvent func(SoakEvent)
+}
+
+// SoakEvent is one entry of the soak timeline.
+type SoakEvent struct {
+	Time    time.Time `json:"time"`
+	Offset  float64   `json:"offset"` // seconds since the soak started
+	Type    string    `json:"type"`
+	Session int       `json:"session"`
+	Media   *int      `json:"media,omitempty"`
+	// Duration is the stall length, or the session age for disconnects (seconds). The timeline entry of a
+	// stall is updated with its full length when packets resume or the session ends.
+	Duration float64 `json:"duration,omitempty"`
+	Detail   string  `json:"detail,omitempty"`
+}
+
+// SoakReport summarizes a soak run.
+type SoakReport struct {
+	URL       string  `json:"url"`
+	Transport string  `json:"transport,omitempty"`
+	Duration  float64 `json:"duration"` // requested, seconds
+	Elapsed   float64 `json:"elapsed"`
+	Stopped   string  `json:"stopped"` // duration or interrupted
+	// SessionTimeout is advertised by the server in the Session header (0 if absent); the client sends
+	// keepalives every KeepalivePeriod (80% of it, 30s by default).
+	SessionTimeout    float64     `json:"session_timeout"`
+	KeepalivePeriod   float64     `json:"keepalive_period"`
+	Keepalives        int         `json:"keepalives"`
+	Sessions          int         `json:"sessions"`
+	Disconnects       int         `json:"disconnects"`
+	Reconnects        int         `json:"reconnects"`
+	ReconnectFailures int         `json:"reconnect_failures"`
+	LongestSession    float64     `json:"longest_session"`
+	Uptime            float64     `json:"uptime"` // fraction of the elapsed time with a playing session
+	Stalls            int         `json:"stalls"`
+	StallTime         float64     `json:"stall_time"`
+	LongestStall      float64     `json:"longest_stall"`
+	SPSChanges        int         `json:"sps_changes"`
+	ResolutionChanges int         `json:"resolution_changes"`
+	Packets           uint64      `json:"packets"`
+	Timeline          []SoakEvent `json:"timeline"`
+}
+
+// soakTrack follows one media across sessions.
+type soakTrack struct {
+	index      int
+	playing    bool          // set up in the current session
+	stalls     bool          // checked for stalls
+	stall      int           // timeline index of the ongoing stall, -1 if none
+	decoder    *frameDecoder // video only
+	lastPacket time.Time
+	sps        []byte
+	resolution *Resolution
+}
+
+// soaker holds the state shared by packet callbacks and the session loop.
+type soaker struct {
+	opts  SoakOptions
+	start time.Time
+
+	mu      sync.Mutex
+	report  *SoakReport
+	session int
+	tracks  map[int]*soakTrack
+	playing bool
+	uptime  time.Duration
+}
+
+// Soak keeps a PLAY session open for opts.Duration, reconnecting whenever it drops, and records a timeline
+// of disconnects, stalls and video parameter changes. timeout bounds each connection attempt. An error is
+// returned only when the first session cannot be established.
+func Soak(ctx context.Context, url string, timeout time.Duration, opts SoakOptions) (*SoakReport, error) {
+	parsedURL, err := parseRTSPURL(url)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parseTransport(opts.Transport); err != nil {
+		return nil, err
+	}
+	if opts.Duration <= 0 {
+		return nil, errors.New("soak duration must be positive")
+	}
+	if opts.StallThreshold <= 0 {
+		opts.StallThreshold = DefaultSoakStallThreshold
+	}
+	if opts.ReconnectDelay <= 0 {
+		opts.ReconnectDelay = DefaultSoakReconnectDelay
+	}
+
+	sk := &soaker{
+		opts:   opts,
+		start:  time.Now(),
+		report: &SoakReport{URL: url, Duration: opts.Duration.Seconds(), Stopped: SoakStoppedDuration},
+		tracks: make(map[int]*soakTrack),
+	}
+	deadline := sk.start.Add(opts.Duration)
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	for {
+		err := sk.runSession(ctx, parsedURL, timeout)
+		if err != nil && sk.report.Sessions == 0 {
+			return nil, err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			sk.record(SoakEvent{Type: SoakEventReconnectFailed, Detail: err.Error()})
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(opts.ReconnectDelay):
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if !time.Now().Before(deadline) {
+		sk.report.Stopped = SoakStoppedDuration
+	} else {
+		sk.report.Stopped = SoakStoppedInterrupted
+	}
+	sk.record(SoakEvent{Type: SoakEventEnd, Detail: sk.report.Stopped})
+	return sk.summary(), nil
+}
+
+// runSession connects, plays until the session drops or ctx ends, and records what happened.
+// It returns an error when the session could not be established.
+func (sk *soaker) runSession(ctx context.Context, parsedURL *base.URL, timeout time.Duration) error {
+	connectCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	dialer := NewNetworkDialer(timeout)
+	if err := dialer.PreflightDial(connectCtx, parsedURL); err != nil {
+		return fmt.Errorf("connection failed: %w", err)
+	}
+
+	session := NewRTSPSession(timeout, nil)
+	defer session.Close()
+	_ = session.SetTransport(sk.opts.Transport) // validated by Soak
+
+	desc, _, err := session.PerformDescribe(connectCtx, parsedURL)
+	if err != nil {
+		return err
+	}
+	medias := playableMedias(desc)
+	if len(medias) == 0 {
+		return errors.New("no receivable medias")
+	}
+
+	sk.mu.Lock()
+	sk.session++
+	for _, t := range sk.tracks {
+		t.playing = false
+	}
+	for _, m := range medias {
+		sk.prepareTrack(mediaIndex(desc, m), m)
+	}
+	sk.mu.Unlock()
+
+	session.onRequest = func(req *base.Request) {
+		if req.Method == base.Options || req.Method == base.GetParameter {
+			sk.mu.Lock()
+			if sk.playing {
+				sk.report.Keepalives++
+			}
+			sk.mu.Unlock()
+		}
+	}
+	onRTP := func(m *description.Media, _ format.Format, pkt *rtp.Packet) {
+		sk.handleRTP(mediaIndex(desc, m), pkt, time.Now())
+	}
+
+	transport, err := session.SetupAndPlay(desc, medias, onRTP, nil)
+	if err != nil {
+		return err
+	}
+	playStart := time.Now()
+
+	sk.mu.Lock()
+	sk.playing = true
+	for _, t := range sk.tracks {
+		t.lastPacket = playStart
+	}
+	sk.report.Sessions++
+	if sk.report.Sessions > 1 {
+		sk.report.Reconnects++
+	}
+	sk.report.Transport = transport
+	sk.report.SessionTimeout = session.sessionTimeout.Seconds()
+	sk.report.KeepalivePeriod = defaultKeepalivePeriod.Seconds()
+	if session.sessionTimeout > 0 {
+		sk.report.KeepalivePeriod = (session.sessionTimeout * 8 / 10).Seconds()
+	}
+	sk.mu.Unlock()
+	sk.record(SoakEvent{Time: playStart, Type: SoakEventSessionStart, Detail: transport})
+
+	waitCh := make(chan error, 1)
+	go func() { waitCh <- session.Wait() }()
+
+	// Silent tracks are checked periodically so stalls are reported when they start
+	ticker := time.NewTicker(max(sk.opts.StallThreshold/2, time.Millisecond))
+	defer ticker.Stop()
+	var waitErr error
+wait:
+	for {
+		select {
+		case <-ctx.Done():
+			break wait
+		case waitErr = <-waitCh:
+			break wait
+		case now := <-ticker.C:
+			sk.checkStalls(now)
+		}
+	}
+	end := time.Now()
+
+	sk.mu.Lock()
+	sk.playing = false
+	sk.uptime += end.Sub(playStart)
+	age := end.Sub(playStart).Seconds()
+	sk.report.LongestSession = max(sk.report.LongestSession, age)
+	if session.transportSwitched.Load() {
+		sk.report.Transport = "tcp"
+	}
+	// Silence running into the end of the session is a stall too
+	for _, t := range sk.tracks {
+		if t.playing {
+			sk.endStall(t, end)
+		}
+	}
+	sk.mu.Unlock()
+
+	if waitErr != nil && ctx.Err() == nil {
+		sk.record(SoakEvent{Time: end, Type: SoakEventDisconnect, Duration: age, Detail: waitErr.Error()})
+	}
+	return nil
+}
+
+// prepareTrack registers a media set up for PLAY, keeping state from earlier sessions so changes across
+// reconnects show up. Called with mu held.
+func (sk *soaker) prepareTrack(index int, m *description.Media) {
+	t, ok := sk.tracks[index]
+	if !ok {
+		t = &soakTrack{index: index, stall: -1}
+		sk.tracks[index] = t
+	}
+	t.playing = true
+	switch detectMediaRole(m) {
+	case MediaRoleONVIFMetadata, MediaRoleKLV:
+		t.stalls = sk.opts.StallMetadata
+	default:
+		t.stalls = true
+	}
+	t.decoder = nil
+	if m.Type == description.MediaTypeVideo && len(m.Formats) > 0 && !m.IsBackChannel {
+		if fd, err := newFrameDecoder(m.Formats[0]); err == nil {
+			t.decoder = fd
+		}
+	}
+}
+
+func (sk *soaker) handleRTP(index int, pkt *rtp.Packet, received time.Time) {
+	var events []SoakEvent
+	sk.mu.Lock()
+	sk.report.Packets++
+	t, ok := sk.tracks[index]
+	if !ok || !t.playing {
+		sk.mu.Unlock()
+		return
+	}
+	sk.endStall(t, received)
+	t.lastPacket = received
+	if t.decoder != nil {
+		// Parameter sets are compared at random access points, where in-band ones have just been seen
+		if au, err := t.decoder.decode(pkt, received); err == nil && au != nil && au.random {
+			events = append(events, sk.checkParams(t, au)...)
+		}
+	}
+	sk.mu.Unlock()
+
+	for _, e := range events {
+		sk.record(e)
+	}
+}
+
+// checkStalls records a stall on every playing track silent for longer than the threshold.
+func (sk *soaker) checkStalls(now time.Time) {
+	sk.mu.Lock()
+	defer sk.mu.Unlock()
+	for _, t := range sk.tracks {
+		if t.playing {
+			sk.startStall(t, now)
+		}
+	}
+}
+
+// startStall records a stall that began at the track's last packet, unless one is already ongoing or the
+// silence is below the threshold. Called with mu held.
+func (sk *soaker) startStall(t *soakTrack, now time.Time) {
+	silence := now.Sub(t.lastPacket)
+	if !t.stalls || t.stall >= 0 || silence <= sk.opts.StallThreshold {
+		return
+	}
+	sk.report.Stalls++
+	idx := t.index
+	t.stall = sk.recordLocked(SoakEvent{Time: t.lastPacket, Type: SoakEventStall, Media: &idx, Duration: silence.Seconds()})
+}
+
+// endStall closes the track's stall at end (when packets resume or the session ends), recording it first
+// if no check caught it yet. Called with mu held.
+func (sk *soaker) endStall(t *soakTrack, end time.Time) {
+	sk.startStall(t, end)
+	if t.stall < 0 {
+		return
+	}
+	silence := end.Sub(t.lastPacket).Seconds()
+	sk.report.Timeline[t.stall].Duration = silence
+	sk.report.StallTime += silence
+	sk.report.LongestStall = max(sk.report.LongestStall, silence)
+	t.stall = -1
+}
+
+// checkParams compares the current parameter sets and picture size with the last seen. Called with mu held.
+func (sk *soaker) checkParams(t *soakTrack, au *accessUnit) []SoakEvent {
+	var res *Resolution
+	var sps []byte
+	if au.image != nil {
+		res = jpegResolution(au.image)
+	} else {
+		sps = t.decoder.sps
+		res = t.decoder.resolution()
+	}
+
+	var events []SoakEvent
+	idx := t.index
+	if sps != nil {
+		if t.sps != nil && !bytes.Equal(sps, t.sps) {
+			sk.report.SPSChanges++
+			events = append(events, SoakEvent{Time: au.received, Type: SoakEventSPSChange, Media: &idx})
+		}
+		t.sps = append([]byte(nil), sps...)
+	}
+	if res != nil {
+		if t.resolution != nil && *res != *t.resolution {
+			sk.report.ResolutionChanges++
+			events = append(events, SoakEvent{
+				Time: au.received, Type: SoakEventResolutionChange, Media: &idx,
+				Detail: t.resolution.String() + " -> " + res.String(),
+			})
+		}
+		t.resolution = res
+	}
+	return events
+}
+
+// record appends an event to the timeline and forwards it to OnEvent.
+func (sk *soaker) record(e SoakEvent) {
+	sk.mu.Lock()
+	sk.recordLocked(e)
+	sk.mu.Unlock()
+}
+
+// recordLocked is record with mu held; it returns the index of the event in the timeline.
+func (sk *soaker) recordLocked(e SoakEvent) int {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Session = sk.session
+	e.Offset = e.Time.Sub(sk.start).Seconds()
+	switch e.Type {
+	case SoakEventDisconnect:
+		sk.report.Disconnects++
+	case SoakEventReconnectFailed:
+		sk.report.ReconnectFailures++
+	}
+	sk.report.Timeline = append(sk.report.Timeline, e)
+	if sk.opts.OnEvent != nil {
+		sk.opts.OnEvent(e) // under mu so callbacks arrive in timeline order
+	}
+	return len(sk.report.Timeline) - 1
+}
+
+// summary finalizes the report.
+func (sk *soaker) summary() *SoakReport {
+	sk.mu.Lock()
+	defer sk.mu.Unlock()
+	elapsed := time.Since(sk.start)
+	sk.report.Elapsed = elapsed.Seconds()
+	if elapsed > 0 {
+		sk.report.Uptime = sk.uptime.Seconds() / elapsed.Seconds()
+	}
+	return sk.report
+}
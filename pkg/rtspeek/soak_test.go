@@ -0,0 +1,148 @@
+package rtspeek
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+)
+
+// h264SPS480 is a baseline 640x480 SPS.
+var h264SPS480 = []byte{0x67, 0x42, 0xc0, 0x1e, 0xda, 0x02, 0x80, 0xf6, 0x40}
+
+func TestSoakTimeline(t *testing.T) {
+	video := h264Media()
+	desc := &description.Session{Medias: []*description.Media{video}}
+	src := newH264Source(5)
+	src.SliceSize = 200
+	h := &playHandler{}
+	url := startPlayServerWith(t, h, desc, 20*time.Millisecond, func(stream *gortsplib.ServerStream, n int) {
+		switch {
+		case n >= 30 && n < 50: // 400 ms of silence
+			return
+		case n == 60:
+			src.SPS = h264SPS480
+		case n == 80:
+			h.closeSessions()
+		}
+		for _, pkt := range src.frame(n) {
+			_ = stream.WritePacketRTP(video, pkt)
+		}
+	})
+
+	var mu sync.Mutex
+	var streamed []string
+	report, err := Soak(context.Background(), url, 2*time.Second, SoakOptions{
+		Duration:       2500 * time.Millisecond,
+		StallThreshold: 250 * time.Millisecond,
+		ReconnectDelay: 200 * time.Millisecond,
+		Transport:      "tcp",
+		OnEvent: func(e SoakEvent) {
+			mu.Lock()
+			streamed = append(streamed, e.Type)
+			mu.Unlock()
+		},
+	})
+	if err != nil {
+		t.Fatalf("soak: %v", err)
+	}
+
+	if report.Stopped != SoakStoppedDuration || report.Transport != "tcp" {
+		t.Fatalf("unexpected stop/transport: %+v", report)
+	}
+	if report.Sessions != 2 || report.Disconnects != 1 || report.Reconnects != 1 || report.ReconnectFailures != 0 {
+		t.Fatalf("expected one disconnect and reconnect, got %+v", report)
+	}
+	if report.Stalls != 1 || report.LongestStall < 0.3 || report.LongestStall > 0.6 {
+		t.Fatalf("expected one ~400 ms stall, got %d (%v s)", report.Stalls, report.LongestStall)
+	}
+	if report.SPSChanges != 1 || report.ResolutionChanges != 1 {
+		t.Fatalf("expected one SPS and resolution change, got %+v", report)
+	}
+	if report.Uptime <= 0.5 || report.Uptime >= 1 || report.Packets == 0 {
+		t.Fatalf("unexpected uptime/packets: %+v", report)
+	}
+
+	var types []string
+	for _, e := range report.Timeline {
+		types = append(types, e.Type)
+		if e.Type == SoakEventResolutionChange && e.Detail != "1280x720 -> 640x480" {
+			t.Fatalf("unexpected resolution change detail %q", e.Detail)
+		}
+	}
+	assertStrings(t, "timeline", types, []string{
+		SoakEventSessionStart, SoakEventStall, SoakEventSPSChange, SoakEventResolutionChange,
+		SoakEventDisconnect, SoakEventSessionStart, SoakEventEnd,
+	})
+	mu.Lock()
+	assertStrings(t, "streamed events", streamed, types)
+	mu.Unlock()
+}
+
+func TestSoakMetadataStalls(t *testing.T) {
+	// A camera with no events sends nothing on its metadata track
+	desc := onvifSession()
+	desc.Medias = desc.Medias[:2]
+	video := desc.Medias[0]
+	src := newH264Source(5)
+	url := startPlayServer(t, desc, 20*time.Millisecond, func(stream *gortsplib.ServerStream, n int) {
+		for _, pkt := range src.frame(n) {
+			_ = stream.WritePacketRTP(video, pkt)
+		}
+	})
+
+	for _, tt := range []struct {
+		stallMetadata bool
+		stalls        int
+	}{{false, 0}, {true, 1}} {
+		var streamed []SoakEvent
+		var arrived []time.Time
+		report, err := Soak(context.Background(), url, 2*time.Second, SoakOptions{
+			Duration:       600 * time.Millisecond,
+			StallThreshold: 200 * time.Millisecond,
+			StallMetadata:  tt.stallMetadata,
+			Transport:      "tcp",
+			OnEvent: func(e SoakEvent) {
+				if e.Type == SoakEventStall {
+					streamed = append(streamed, e)
+					arrived = append(arrived, time.Now())
+				}
+			},
+		})
+		if err != nil {
+			t.Fatalf("soak: %v", err)
+		}
+		if report.Stalls != tt.stalls || len(streamed) != tt.stalls {
+			t.Fatalf("StallMetadata=%v: expected %d stalls, got %+v", tt.stallMetadata, tt.stalls, report.Timeline)
+		}
+		if tt.stalls == 0 {
+			continue
+		}
+		// The stall is streamed while the silence goes on, then completed in the timeline at the end
+		end := report.Timeline[len(report.Timeline)-1]
+		if end.Type != SoakEventEnd || !arrived[0].Before(end.Time.Add(-100*time.Millisecond)) {
+			t.Fatalf("stall streamed at %v, not before the session ended at %v", arrived[0], end.Time)
+		}
+		var stall SoakEvent
+		for _, e := range report.Timeline {
+			if e.Type == SoakEventStall {
+				stall = e
+			}
+		}
+		if streamed[0].Duration >= stall.Duration || stall.Duration < 0.5 || report.LongestStall != stall.Duration {
+			t.Fatalf("expected the streamed stall (%vs) to grow to the session length, got %+v", streamed[0].Duration, stall)
+		}
+	}
+}
+
+func TestSoakFirstConnectionFails(t *testing.T) {
+	if _, err := Soak(context.Background(), "rtsp://127.0.0.1:1/live", time.Second, SoakOptions{Duration: time.Second}); err == nil {
+		t.Fatalf("expected an error when the first session cannot be established")
+	}
+	if _, err := Soak(context.Background(), "rtsp://127.0.0.1:1/live", time.Second, SoakOptions{}); err == nil {
+		t.Fatalf("expected an error without a duration")
+	}
+}
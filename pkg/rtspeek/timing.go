@@ -0,0 +1,230 @@
+package rtspeek
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	h264conf "github.com/bluenviron/mediacommon/v2/pkg/codecs/h264"
+	h265conf "github.com/bluenviron/mediacommon/v2/pkg/codecs/h265"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+)
+
+// Timestamp sanity thresholds.
+const (
+	// timingJumpThreshold is how far timestamp advance may stray from arrival time before it counts as a jump.
+	timingJumpThreshold = 500 * time.Millisecond
+	// timingReorderWindow bounds backward steps accepted as B-frame presentation reordering on video.
+	timingReorderWindow = 500 * time.Millisecond
+	// clockRateTolerance is the accepted relative error between measured and declared clock rates.
+	clockRateTolerance = 0.1
+	// frameRateTolerance is the accepted relative error between measured and declared frame rates.
+	frameRateTolerance = 0.1
+	// minClockRateSpan is the shortest window over which the clock rate is measured.
+	minClockRateSpan = time.Second
+)
+
+// TimingInfo reports RTP timestamp behaviour observed during a live probe.
+type TimingInfo struct {
+	Frames int `json:"frames"` // distinct timestamps (packets for audio)
+	// MeasuredClockRate is timestamp ticks per second of arrival time; omitted after jumps or backward steps.
+	MeasuredClockRate   float64 `json:"measured_clock_rate,omitempty"`
+	FrameInterval       float64 `json:"frame_interval_ms,omitempty"` // median, from sorted timestamps
+	FrameIntervalStdDev float64 `json:"frame_interval_stddev_ms,omitempty"`
+	// Video frame rates: measured from timestamps, declared in the SPS VUI and by a=framerate
+	MeasuredFPS float64  `json:"measured_fps,omitempty"`
+	VUIFPS      *float64 `json:"vui_fps,omitempty"`
+	SDPFPS      *float64 `json:"sdp_fps,omitempty"`
+	// Discontinuities in arrival order
+	Wraps           int       `json:"wraps"`            // 32-bit rollovers (normal)
+	Jumps           int       `json:"jumps"`            // timestamp advance disagreeing with arrival time
+	MaxJump         float64   `json:"max_jump_ms"`      // largest disagreement
+	Backwards       int       `json:"backwards"`        // backward steps beyond B-frame reordering
+	ReorderedFrames int       `json:"reordered_frames"` // small backward steps on video (B-frames)
+	Findings        []Finding `json:"findings,omitempty"`
+}
+
+// timingSample is the first packet of a frame.
+type timingSample struct {
+	ts       int64 // unwrapped
+	received time.Time
+}
+
+// timingAnalyzer validates RTP timestamps against the clock rate and declared frame rates.
+type timingAnalyzer struct {
+	clockRate int
+	video     bool
+	decoder   *frameDecoder // the track's shared H264/H265 decoder, to follow in-band SPS; nil otherwise
+
+	unwrap    tsUnwrapper
+	hasLast   bool
+	lastSeq   uint16
+	lastRaw   uint32
+	last      timingSample
+	samples   []timingSample
+	wraps     int
+	jumps     int
+	maxJump   time.Duration
+	backwards int
+	reordered int
+}
+
+func newTimingAnalyzer(m *description.Media, fd *frameDecoder) *timingAnalyzer {
+	ta := &timingAnalyzer{clockRate: m.Formats[0].ClockRate(), video: m.Type == description.MediaTypeVideo, decoder: fd}
+	if ta.clockRate <= 0 {
+		ta.clockRate = 90000
+	}
+	return ta
+}
+
+func (ta *timingAnalyzer) onRTP(pkt *rtp.Packet, received time.Time) {
+	// Late and duplicate packets are network effects, reported by the RTP statistics
+	if ta.hasLast && int16(pkt.SequenceNumber-ta.lastSeq) <= 0 {
+		return
+	}
+	ta.lastSeq = pkt.SequenceNumber
+	if ta.hasLast && pkt.Timestamp == ta.lastRaw {
+		return
+	}
+
+	ts := ta.unwrap.unwrap(pkt.Timestamp)
+	cur := timingSample{ts: ts, received: received}
+	if ta.hasLast {
+		if pkt.Timestamp < ta.lastRaw && ts > ta.last.ts {
+			ta.wraps++
+		}
+		delta := ta.ticksToDuration(ts - ta.last.ts)
+		switch {
+		case delta < 0 && ta.video && -delta <= timingReorderWindow:
+			ta.reordered++
+		case delta < 0:
+			ta.backwards++
+		default:
+			if stray := (delta - received.Sub(ta.last.received)).Abs(); stray > timingJumpThreshold {
+				ta.jumps++
+				ta.maxJump = max(ta.maxJump, stray)
+			}
+		}
+	}
+	ta.hasLast, ta.lastRaw, ta.last = true, pkt.Timestamp, cur
+	ta.samples = append(ta.samples, cur)
+}
+
+func (ta *timingAnalyzer) onRTCP(rtcp.Packet, time.Time) {}
+
+func (ta *timingAnalyzer) ticksToDuration(ticks int64) time.Duration {
+	return time.Duration(ticks * int64(time.Second) / int64(ta.clockRate))
+}
+
+func (ta *timingAnalyzer) finish(mi *MediaInfo, _ time.Duration) {
+	if len(ta.samples) < 2 {
+		return
+	}
+	info := &TimingInfo{
+		Frames:          len(ta.samples),
+		Wraps:           ta.wraps,
+		Jumps:           ta.jumps,
+		MaxJump:         float64(ta.maxJump) / float64(time.Millisecond),
+		Backwards:       ta.backwards,
+		ReorderedFrames: ta.reordered,
+		SDPFPS:          mi.Framerate,
+	}
+	idx := mi.Index
+	add := func(code string, sev Severity, format string, args ...any) {
+		info.Findings = append(info.Findings, Finding{Code: code, Severity: sev, Media: &idx, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if ta.backwards > 0 {
+		add("timestamp_backwards", SeverityError, "RTP timestamp stepped backwards %d times", ta.backwards)
+	}
+	if ta.jumps > 0 {
+		add("timestamp_jump", SeverityWarning, "RTP timestamp jumped %d times (largest %.0f ms off arrival time)", ta.jumps, info.MaxJump)
+	}
+
+	first, last := ta.samples[0], ta.samples[len(ta.samples)-1]
+	if ta.jumps == 0 && ta.backwards == 0 && last.received.Sub(first.received) >= minClockRateSpan {
+		xs, ys := make([]float64, len(ta.samples)), make([]float64, len(ta.samples))
+		for i, s := range ta.samples {
+			xs[i] = s.received.Sub(first.received).Seconds()
+			ys[i] = float64(s.ts - first.ts)
+		}
+		if slope, ok := linearSlope(xs, ys); ok {
+			info.MeasuredClockRate = slope
+			if math.Abs(slope/float64(ta.clockRate)-1) > clockRateTolerance {
+				add("clock_rate_mismatch", SeverityError, "timestamps advance at %.0f Hz but the SDP declares %d Hz", slope, ta.clockRate)
+			}
+		}
+	}
+
+	interval, stddev, ok := ta.frameInterval()
+	if !ok {
+		mi.Timing = info
+		return
+	}
+	info.FrameInterval = interval * 1000 / float64(ta.clockRate)
+	info.FrameIntervalStdDev = stddev * 1000 / float64(ta.clockRate)
+
+	if ta.video {
+		info.MeasuredFPS = float64(ta.clockRate) / interval
+		if fps := ta.vuiFPS(); fps > 0 && !math.IsInf(fps, 0) {
+			info.VUIFPS = &fps
+			if math.Abs(info.MeasuredFPS/fps-1) > frameRateTolerance {
+				add("framerate_mismatch_vui", SeverityWarning, "measured %.2f fps but the SPS VUI declares %.2f fps", info.MeasuredFPS, fps)
+			}
+		}
+		if mi.Framerate != nil && *mi.Framerate > 0 && math.Abs(info.MeasuredFPS / *mi.Framerate - 1) > frameRateTolerance {
+			add("framerate_mismatch_sdp", SeverityWarning, "measured %.2f fps but a=framerate declares %.2f", info.MeasuredFPS, *mi.Framerate)
+		}
+	}
+	mi.Timing = info
+}
+
+// frameInterval returns the median and standard deviation (in ticks) of the gaps between sorted distinct
+// timestamps, which is independent of B-frame reordering.
+func (ta *timingAnalyzer) frameInterval() (median, stddev float64, ok bool) {
+	ts := make([]int64, len(ta.samples))
+	for i, s := range ta.samples {
+		ts[i] = s.ts
+	}
+	sort.Slice(ts, func(i, j int) bool { return ts[i] < ts[j] })
+
+	var deltas []float64
+	for i := 1; i < len(ts); i++ {
+		if d := ts[i] - ts[i-1]; d > 0 {
+			deltas = append(deltas, float64(d))
+		}
+	}
+	if len(deltas) == 0 {
+		return 0, 0, false
+	}
+	var sum, sq float64
+	for _, d := range deltas {
+		sum += d
+		sq += d * d
+	}
+	mean := sum / float64(len(deltas))
+	sort.Float64s(deltas)
+	return deltas[len(deltas)/2], math.Sqrt(math.Max(0, sq/float64(len(deltas))-mean*mean)), true
+}
+
+// vuiFPS returns the frame rate declared by the timing info of the current SPS, or 0.
+func (ta *timingAnalyzer) vuiFPS() float64 {
+	if ta.decoder == nil || ta.decoder.sps == nil {
+		return 0
+	}
+	if ta.decoder.codec == "H265" {
+		var sps h265conf.SPS
+		if sps.Unmarshal(ta.decoder.sps) != nil {
+			return 0
+		}
+		return sps.FPS()
+	}
+	var sps h264conf.SPS
+	if sps.Unmarshal(ta.decoder.sps) != nil {
+		return 0
+	}
+	return sps.FPS()
+}
@@ -0,0 +1,120 @@
+package rtspeek
+
+import (
+	"testing"
+	"time"
+
+	"github.com/0x524A/rtspeek/pkg/rtspeektest"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/pion/rtp"
+)
+
+// h264SPS30fps is a 1280x720 SPS whose VUI timing info declares 30 fps.
+var h264SPS30fps = []byte{
+	0x67, 0x64, 0x00, 0x1f, 0xac, 0xd9, 0x40, 0x50,
+	0x05, 0xbb, 0x01, 0x6c, 0x80, 0x00, 0x00, 0x03,
+	0x00, 0x80, 0x00, 0x00, 0x1e, 0x07, 0x8c, 0x18,
+	0xcb,
+}
+
+// timingFrame is one RTP packet: timestamp in ticks and arrival offset.
+type timingFrame struct {
+	ts uint32
+	at time.Duration
+}
+
+// evenFrames returns n frames spaced tsStep ticks and every arrival apart, starting at ts0.
+func evenFrames(n int, ts0, tsStep uint32, every time.Duration) []timingFrame {
+	frames := make([]timingFrame, n)
+	for i := range frames {
+		frames[i] = timingFrame{ts: ts0 + uint32(i)*tsStep, at: time.Duration(i) * every}
+	}
+	return frames
+}
+
+func feedTiming(t *testing.T, m *description.Media, framerate *float64, frames []timingFrame) *TimingInfo {
+	t.Helper()
+	ta := newTimingAnalyzer(m, newTrackDecoder(m.Formats[0]))
+	start := time.Now()
+	for i, f := range frames {
+		ta.onRTP(&rtp.Packet{Header: rtp.Header{SequenceNumber: uint16(i), Timestamp: f.ts, Marker: true}}, start.Add(f.at))
+	}
+	mi := MediaInfo{Index: 0, Framerate: framerate}
+	ta.finish(&mi, frames[len(frames)-1].at)
+	if mi.Timing == nil {
+		t.Fatalf("expected timing info")
+	}
+	return mi.Timing
+}
+
+func findingCodes(findings []Finding) []string {
+	var codes []string
+	for _, f := range findings {
+		codes = append(codes, f.Code)
+	}
+	return codes
+}
+
+func TestTimingAnalyzer(t *testing.T) {
+	fps30 := 30.0
+	frame := 40 * time.Millisecond
+	vuiMedia := &description.Media{Type: description.MediaTypeVideo, Formats: []format.Format{
+		&format.H264{PayloadTyp: 96, SPS: h264SPS30fps, PPS: rtspeektest.H264PPS, PacketizationMode: 1},
+	}}
+
+	// Decode order P2 B0 B1 P5 B3 B4 ...: presentation timestamps step back by two frames
+	var bframes []timingFrame
+	for g := 0; g < 20; g++ {
+		for _, d := range []int{2, 0, 1} {
+			bframes = append(bframes, timingFrame{ts: uint32((3*g + d) * 3600), at: time.Duration(len(bframes)) * frame})
+		}
+	}
+
+	jump := evenFrames(50, 0, 3600, frame)
+	for i := 25; i < len(jump); i++ {
+		jump[i].ts += 10 * 90000
+	}
+	backwards := evenFrames(100, 0, 160, 20*time.Millisecond)
+	for i := 50; i < len(backwards); i++ {
+		backwards[i].ts -= 8000
+	}
+
+	tests := []struct {
+		name      string
+		media     *description.Media
+		framerate *float64
+		frames    []timingFrame
+		fps       float64
+		reordered int
+		codes     []string
+	}{
+		{name: "clean 25 fps", media: h264Media(), frames: evenFrames(50, 4294967296-3600*10, 3600, frame), fps: 25},
+		{name: "b-frames", media: h264Media(), frames: bframes, fps: 25, reordered: 20},
+		{name: "jump", media: h264Media(), frames: jump, fps: 25, codes: []string{"timestamp_jump"}},
+		{name: "audio backwards", media: g711Media(), frames: backwards, codes: []string{"timestamp_backwards"}},
+		{name: "wrong clock rate", media: h264Media(), frames: evenFrames(50, 0, 40, frame), fps: 2250, codes: []string{"clock_rate_mismatch"}},
+		{name: "a=framerate", media: h264Media(), framerate: &fps30, frames: evenFrames(50, 0, 3600, frame), fps: 25, codes: []string{"framerate_mismatch_sdp"}},
+		{name: "vui", media: vuiMedia, frames: evenFrames(50, 0, 3600, frame), fps: 25, codes: []string{"framerate_mismatch_vui"}},
+		{name: "vui matches", media: vuiMedia, framerate: &fps30, frames: evenFrames(50, 0, 3000, 33*time.Millisecond), fps: 30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ti := feedTiming(t, tt.media, tt.framerate, tt.frames)
+			assertStrings(t, "findings", findingCodes(ti.Findings), tt.codes)
+			if ti.MeasuredFPS != tt.fps || ti.ReorderedFrames != tt.reordered {
+				t.Fatalf("expected %v fps, got %+v", tt.fps, ti)
+			}
+		})
+	}
+}
+
+func TestTimingAnalyzerDetails(t *testing.T) {
+	ti := feedTiming(t, h264Media(), nil, evenFrames(50, 4294967296-3600*10, 3600, 40*time.Millisecond))
+	if ti.Wraps != 1 || ti.Frames != 50 || ti.FrameInterval != 40 || ti.FrameIntervalStdDev != 0 {
+		t.Fatalf("unexpected timing: %+v", ti)
+	}
+	if ti.MeasuredClockRate < 89999 || ti.MeasuredClockRate > 90001 {
+		t.Fatalf("expected a 90 kHz clock, got %v", ti.MeasuredClockRate)
+	}
+}
@@ -31,6 +31,17 @@ type StreamInfo interface {
 	GetMediaTypes() []string
 	HasVideo() bool
 	GetFirstVideoMedia() *MediaInfo
+	GetMediasByRole(role string) []MediaInfo
+	HasBackchannel() bool
+
+	// Session-level SDP details (nil if DESCRIBE did not succeed)
+	GetSessionDetails() *SessionDetails
+	// Raw SDP text, only populated when requested via WithRawSDP
+	GetRawSDP() string
+	// Live probe summary, only populated when requested via WithLiveProbe
+	GetLiveProbe() *LiveProbeInfo
+	// Capture frames that could not be decoded, only populated by AnalyzeCapture
+	GetCapture() *CaptureSummary
 
 	// Underlying raw description (may be nil)
 	Raw() *description.Session
@@ -48,6 +59,9 @@ type streamInfo struct {
 	AudioMedias    []MediaInfo          `json:"audio_medias,omitempty"`
 	OtherMedias    []MediaInfo          `json:"other_medias,omitempty"`
 	DebugTrace     []string             `json:"debug_trace,omitempty"`
+	Session        *SessionDetails      `json:"session,omitempty"`
+	LiveProbe      *LiveProbeInfo       `json:"live_probe,omitempty"`
+	Capture        *CaptureSummary      `json:"capture,omitempty"`
 	RawDescription *description.Session `json:"-"`
 }
 
@@ -64,6 +78,29 @@ func (s *streamInfo) GetOtherMedias() []MediaInfo { return s.OtherMedias }
 func (s *streamInfo) GetMediaCount() int          { return s.MediaCount }
 func (s *streamInfo) Raw() *description.Session   { return s.RawDescription }
 
+func (s *streamInfo) GetSessionDetails() *SessionDetails { return s.Session }
+func (s *streamInfo) GetLiveProbe() *LiveProbeInfo       { return s.LiveProbe }
+func (s *streamInfo) GetCapture() *CaptureSummary        { return s.Capture }
+
+func (s *streamInfo) GetRawSDP() string {
+	if s.Session == nil {
+		return ""
+	}
+	return s.Session.RawSDP
+}
+
+// mediaByIndex returns a pointer to the stored MediaInfo with the given SDP index.
+func (s *streamInfo) mediaByIndex(idx int) *MediaInfo {
+	for _, list := range [][]MediaInfo{s.VideoMedias, s.AudioMedias, s.OtherMedias} {
+		for i := range list {
+			if list[i].Index == idx {
+				return &list[i]
+			}
+		}
+	}
+	return nil
+}
+
 func (s *streamInfo) GetMedias() []MediaInfo {
 	allMedias := make([]MediaInfo, 0, s.MediaCount)
 	allMedias = append(allMedias, s.VideoMedias...)
@@ -108,6 +145,20 @@ func (s *streamInfo) GetMediaTypes() []string {
 
 func (s *streamInfo) HasVideo() bool { return len(s.VideoMedias) > 0 }
 
+func (s *streamInfo) GetMediasByRole(role string) []MediaInfo {
+	var res []MediaInfo
+	for _, m := range s.GetMedias() {
+		if m.Role == role {
+			res = append(res, m)
+		}
+	}
+	return res
+}
+
+func (s *streamInfo) HasBackchannel() bool {
+	return len(s.GetMediasByRole(MediaRoleBackchannel)) > 0
+}
+
 func (s *streamInfo) GetFirstVideoMedia() *MediaInfo {
 	if len(s.VideoMedias) > 0 {
 		return &s.VideoMedias[0]
@@ -122,15 +173,38 @@ func (s *streamInfo) GetVideoResolutionString() string {
 	return ""
 }
 
+// Media roles for tracks that are not plain audio/video.
+const (
+	MediaRoleBackchannel   = "backchannel"    // ONVIF audio backchannel (client -> camera)
+	MediaRoleONVIFMetadata = "onvif_metadata" // ONVIF vnd.onvif.metadata XML stream
+	MediaRoleKLV           = "klv"            // SMPTE 336M KLV / MISB data
+)
+
 // MediaInfo holds simplified per-media (track) information.
 type MediaInfo struct {
 	Index         int            `json:"index"`
 	Type          string         `json:"type"`
+	Role          string         `json:"role,omitempty"`
 	ClockRate     *int           `json:"clock_rate,omitempty"`
 	Format        string         `json:"format,omitempty"`
 	PayloadType   *uint8         `json:"payload_type,omitempty"`
 	Resolution    *Resolution    `json:"resolution,omitempty"`
 	CodecSpecific map[string]any `json:"codec_specific,omitempty"`
+
+	// SDP attributes declared for this media
+	Control    string      `json:"control,omitempty"`
+	Direction  string      `json:"direction,omitempty"`
+	Bandwidths []Bandwidth `json:"bandwidths,omitempty"`
+	Framerate  *float64    `json:"framerate,omitempty"`
+	Dimensions *Resolution `json:"dimensions,omitempty"`
+
+	// Live probe analysis (only with WithLiveProbe)
+	Metadata *MetadataSummary  `json:"metadata,omitempty"`
+	GOP      *GOPInfo          `json:"gop,omitempty"`
+	RTP      *RTPStats         `json:"rtp,omitempty"`
+	RTCP     *SenderReportInfo `json:"rtcp,omitempty"`
+	Timing   *TimingInfo       `json:"timing,omitempty"`
+	Bitrate  *BitrateInfo      `json:"bitrate,omitempty"`
 }
 
 // Resolution expresses width x height.
@@ -151,6 +225,7 @@ func GetVideoResolutionString(si StreamInfo) string    { return si.GetVideoResol
 func GetMediaTypes(si StreamInfo) []string             { return si.GetMediaTypes() }
 func GetMedias(si StreamInfo) []MediaInfo              { return si.GetMedias() }
 func HasVideo(si StreamInfo) bool                      { return si.HasVideo() }
+func HasBackchannel(si StreamInfo) bool                { return si.HasBackchannel() }
 func GetFirstVideoMedia(si StreamInfo) *MediaInfo      { return si.GetFirstVideoMedia() }
 
 // Helper to get first video resolution (for backward compatibility)
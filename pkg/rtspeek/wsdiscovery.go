@@ -0,0 +1,272 @@
+package rtspeek
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/ipv4"
+)
+
+// WSDiscoveryAddress is the IPv4 multicast group and port of WS-Discovery.
+const WSDiscoveryAddress = "239.255.255.250:3702"
+
+// WS-Discovery defaults.
+const (
+	// DefaultWSDiscoveryWait is how long ProbeMatches are collected.
+	DefaultWSDiscoveryWait = 3 * time.Second
+	// DefaultWSDiscoveryProbes is the number of Probe messages sent, spread over the first second, since
+	// UDP multicast is lossy.
+	DefaultWSDiscoveryProbes = 2
+)
+
+// WSDiscoveryOptions configures DiscoverONVIF.
+type WSDiscoveryOptions struct {
+	// Address the Probe is sent to (WSDiscoveryAddress if empty); a unicast address probes one device.
+	Address string
+	// Interface names the network interface multicast Probes leave from (the system default if empty).
+	Interface string
+	// Wait is how long ProbeMatches are collected (DefaultWSDiscoveryWait if 0).
+	Wait time.Duration
+	// Probes is the number of Probe messages sent (DefaultWSDiscoveryProbes if 0).
+	Probes int
+	// ResolveStreams runs ProbeONVIF on every device found, with User and Pass.
+	ResolveStreams bool
+	User           string
+	Pass           string
+	// OnDevice, if set, is called as each device answers, before its streams are resolved.
+	OnDevice func(ONVIFDevice)
+}
+
+// ONVIFDevice is a device that answered a WS-Discovery Probe.
+type ONVIFDevice struct {
+	Endpoint string   `json:"endpoint"` // EndpointReference address, usually urn:uuid:...
+	Address  string   `json:"address"`  // source of the ProbeMatch
+	XAddrs   []string `json:"xaddrs"`   // device service URLs
+	Types    []string `json:"types,omitempty"`
+	Scopes   []string `json:"scopes,omitempty"`
+	Hardware string   `json:"hardware,omitempty"` // from the onvif://www.onvif.org/hardware/ scope
+	Name     string   `json:"name,omitempty"`
+	Location string   `json:"location,omitempty"`
+	// Streams is the ProbeONVIF report when WSDiscoveryOptions.ResolveStreams is set, or Error its failure.
+	Streams *ONVIFReport `json:"streams,omitempty"`
+	Error   string       `json:"error,omitempty"`
+}
+
+// wsProbeMatches is the part of a ProbeMatches message DiscoverONVIF reads.
+type wsProbeMatches struct {
+	RelatesTo string `xml:"Header>RelatesTo"`
+	Matches   []struct {
+		Endpoint string `xml:"EndpointReference>Address"`
+		Types    string `xml:"Types"`
+		Scopes   string `xml:"Scopes"`
+		XAddrs   string `xml:"XAddrs"`
+	} `xml:"Body>ProbeMatches>ProbeMatch"`
+}
+
+// DiscoverONVIF sends WS-Discovery Probes for network video transmitters and collects the devices that
+// answer within opts.Wait, sorted by address. With ResolveStreams each device then gets ProbeONVIF with
+// timeout per call; otherwise timeout is unused. Cancelling ctx ends collection early.
+func DiscoverONVIF(ctx context.Context, timeout time.Duration, opts WSDiscoveryOptions) ([]ONVIFDevice, error) {
+	dest := opts.Address
+	if dest == "" {
+		dest = WSDiscoveryAddress
+	}
+	raddr, err := net.ResolveUDPAddr("udp4", dest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WS-Discovery address: %w", err)
+	}
+	wait := opts.Wait
+	if wait <= 0 {
+		wait = DefaultWSDiscoveryWait
+	}
+	probes := opts.Probes
+	if probes <= 0 {
+		probes = DefaultWSDiscoveryProbes
+	}
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if opts.Interface != "" {
+		ifi, err := net.InterfaceByName(opts.Interface)
+		if err != nil {
+			return nil, err
+		}
+		if err := ipv4.NewPacketConn(conn).SetMulticastInterface(ifi); err != nil {
+			return nil, fmt.Errorf("select interface %s: %w", opts.Interface, err)
+		}
+	}
+
+	messageID := "uuid:" + newUUID()
+	probe := []byte(wsProbeMessage(messageID))
+	deadline := time.Now().Add(wait)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetReadDeadline(deadline)
+
+	// Resend the Probe while collecting; closing the socket on cancellation unblocks the read loop
+	done := make(chan struct{})
+	defer close(done)
+	if _, err := conn.WriteToUDP(probe, raddr); err != nil {
+		return nil, fmt.Errorf("send probe: %w", err)
+	}
+	go func() {
+		interval := time.Second / time.Duration(probes)
+		for i := 1; i < probes; i++ {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				_ = conn.Close()
+				return
+			case <-time.After(interval):
+				_, _ = conn.WriteToUDP(probe, raddr)
+			}
+		}
+		select {
+		case <-done:
+		case <-ctx.Done():
+			_ = conn.Close()
+		}
+	}()
+
+	found := make(map[string]bool)
+	devices := []ONVIFDevice{}
+	buf := make([]byte, 64<<10)
+	for {
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			break
+		}
+		var msg wsProbeMatches
+		if xml.Unmarshal(buf[:n], &msg) != nil {
+			continue
+		}
+		if msg.RelatesTo != "" && strings.TrimSpace(msg.RelatesTo) != messageID {
+			continue // an answer to someone else's Probe
+		}
+		for _, m := range msg.Matches {
+			dev := newONVIFDevice(strings.TrimSpace(m.Endpoint), src.String(), m.Types, m.Scopes, m.XAddrs)
+			key := dev.Endpoint
+			if key == "" {
+				key = dev.Address
+			}
+			if found[key] {
+				continue
+			}
+			found[key] = true
+			devices = append(devices, dev)
+			if opts.OnDevice != nil {
+				opts.OnDevice(dev)
+			}
+		}
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		a, _ := netip.ParseAddrPort(devices[i].Address)
+		b, _ := netip.ParseAddrPort(devices[j].Address)
+		if c := a.Addr().Compare(b.Addr()); c != 0 {
+			return c < 0
+		}
+		return devices[i].Endpoint < devices[j].Endpoint
+	})
+	if opts.ResolveStreams && ctx.Err() == nil {
+		resolveONVIFStreams(ctx, devices, timeout, opts.User, opts.Pass)
+	}
+	return devices, nil
+}
+
+// resolveONVIFStreams runs ProbeONVIF on the devices, a few at a time.
+func resolveONVIFStreams(ctx context.Context, devices []ONVIFDevice, timeout time.Duration, user, pass string) {
+	sem := make(chan struct{}, 4)
+	var wg sync.WaitGroup
+	for i := range devices {
+		dev := &devices[i]
+		if len(dev.XAddrs) == 0 {
+			dev.Error = "device announced no XAddrs"
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			report, err := ProbeONVIF(ctx, dev.XAddrs[0], user, pass, timeout)
+			if err != nil {
+				dev.Error = err.Error()
+				return
+			}
+			dev.Streams = report
+		}()
+	}
+	wg.Wait()
+}
+
+// newONVIFDevice decodes the fields of a ProbeMatch. XAddrs on the host the answer came from are listed
+// first, since multi-homed devices also announce addresses that are unreachable from here.
+func newONVIFDevice(endpoint, source, types, scopes, xaddrs string) ONVIFDevice {
+	dev := ONVIFDevice{Endpoint: endpoint, Address: source, XAddrs: []string{}, Types: strings.Fields(types), Scopes: strings.Fields(scopes)}
+	host, _, _ := net.SplitHostPort(source)
+	var others []string
+	for _, x := range strings.Fields(xaddrs) {
+		if u, err := url.Parse(x); err == nil && u.Hostname() == host {
+			dev.XAddrs = append(dev.XAddrs, x)
+		} else {
+			others = append(others, x)
+		}
+	}
+	dev.XAddrs = append(dev.XAddrs, others...)
+
+	for _, s := range dev.Scopes {
+		rest, ok := strings.CutPrefix(s, "onvif://www.onvif.org/")
+		if !ok {
+			continue
+		}
+		kind, value, _ := strings.Cut(rest, "/")
+		if v, err := url.PathUnescape(value); err == nil {
+			value = v
+		}
+		switch kind {
+		case "hardware":
+			dev.Hardware = value
+		case "name":
+			dev.Name = value
+		case "location":
+			dev.Location = value
+		}
+	}
+	return dev
+}
+
+// wsProbeMessage builds a Probe for ONVIF network video transmitters.
+func wsProbeMessage(messageID string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>` +
+		`<s:Envelope xmlns:s="` + onvifNSSoap + `" xmlns:a="http://schemas.xmlsoap.org/ws/2004/08/addressing"` +
+		` xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery" xmlns:dn="http://www.onvif.org/ver10/network/wsdl">` +
+		`<s:Header><a:Action s:mustUnderstand="1">http://schemas.xmlsoap.org/ws/2005/04/discovery/Probe</a:Action>` +
+		`<a:MessageID>` + messageID + `</a:MessageID>` +
+		`<a:ReplyTo><a:Address>http://schemas.xmlsoap.org/ws/2004/08/addressing/role/anonymous</a:Address></a:ReplyTo>` +
+		`<a:To s:mustUnderstand="1">urn:schemas-xmlsoap-org:ws:2005:04:discovery</a:To></s:Header>` +
+		`<s:Body><d:Probe><d:Types>dn:NetworkVideoTransmitter</d:Types></d:Probe></s:Body></s:Envelope>`
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
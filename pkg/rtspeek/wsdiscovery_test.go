@@ -0,0 +1,82 @@
+package rtspeek
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0x524A/rtspeek/pkg/rtspeektest"
+)
+
+func TestDiscoverONVIF(t *testing.T) {
+	rtsp := rtspeektest.Start(t, rtspeektest.Config{User: "admin", Pass: "secret", FrameInterval: -1})
+	device := rtspeektest.StartONVIF(t, rtspeektest.ONVIFConfig{
+		User: "admin", Pass: "secret",
+		Profiles: []rtspeektest.ONVIFProfile{
+			{Token: "main", Name: "MainStream", StreamURI: rtsp.URL, Encoding: "H264", Width: 1280, Height: 720},
+		},
+	})
+	responder := rtspeektest.StartWSDiscovery(t,
+		rtspeektest.DiscoveryMatch{
+			Endpoint: "urn:uuid:cam-1",
+			XAddrs:   []string{"http://192.0.2.10/onvif/device_service", device.URL},
+			Scopes: []string{
+				"onvif://www.onvif.org/type/video_encoder",
+				"onvif://www.onvif.org/hardware/DS-2CD2143G2-I",
+				"onvif://www.onvif.org/name/Lobby%20Camera",
+				"onvif://www.onvif.org/location/building/1",
+			},
+		},
+		rtspeektest.DiscoveryMatch{Endpoint: "urn:uuid:cam-2", XAddrs: []string{"http://127.0.0.1:1/onvif/device_service"}},
+	)
+
+	var announced []string
+	devices, err := DiscoverONVIF(context.Background(), 2*time.Second, WSDiscoveryOptions{
+		Address:        responder.Addr,
+		Wait:           600 * time.Millisecond,
+		Probes:         4,
+		ResolveStreams: true,
+		User:           "admin",
+		Pass:           "secret",
+		OnDevice:       func(d ONVIFDevice) { announced = append(announced, d.Endpoint) },
+	})
+	if err != nil {
+		t.Fatalf("DiscoverONVIF: %v", err)
+	}
+	if responder.Probes() < 2 {
+		t.Fatalf("responder got %d probes, want repeated probes", responder.Probes())
+	}
+	if len(devices) != 2 || len(announced) != 2 {
+		t.Fatalf("got %d devices (%d announced), want 2 without duplicates", len(devices), len(announced))
+	}
+
+	cam := devices[0]
+	if cam.Endpoint != "urn:uuid:cam-1" || cam.Hardware != "DS-2CD2143G2-I" || cam.Name != "Lobby Camera" || cam.Location != "building/1" {
+		t.Fatalf("unexpected scopes %+v", cam)
+	}
+	if cam.XAddrs[0] != device.URL || len(cam.XAddrs) != 2 {
+		t.Fatalf("XAddrs %v, want the reachable one first", cam.XAddrs)
+	}
+	if cam.Error != "" || cam.Streams == nil || len(cam.Streams.Profiles) != 1 || !cam.Streams.Profiles[0].Match {
+		t.Fatalf("unexpected stream resolution %+v (%s)", cam.Streams, cam.Error)
+	}
+
+	if other := devices[1]; other.Streams != nil || !strings.Contains(other.Error, "GetCapabilities") {
+		t.Fatalf("unexpected unreachable device %+v", other)
+	}
+}
+
+func TestDiscoverONVIFNoAnswer(t *testing.T) {
+	responder := rtspeektest.StartWSDiscovery(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	devices, err := DiscoverONVIF(ctx, time.Second, WSDiscoveryOptions{Address: responder.Addr, Wait: 5 * time.Second})
+	if err != nil || len(devices) != 0 {
+		t.Fatalf("DiscoverONVIF = %v, %v", devices, err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("collection ignored the context deadline (%s)", elapsed)
+	}
+}
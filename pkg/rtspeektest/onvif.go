@@ -0,0 +1,206 @@
+package rtspeektest
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ONVIFProfile is a media profile served by ONVIFServer.
+type ONVIFProfile struct {
+	Token string
+	Name  string
+	// StreamURI is returned by GetStreamUri, typically the URL of a Server.
+	StreamURI string
+	// Video encoder configuration; Encoding empty leaves it out of the profile.
+	Encoding  string // H264, H265, JPEG or MPEG4
+	Width     int
+	Height    int
+	FrameRate int
+	Bitrate   int // kbit/s
+	GovLength int
+}
+
+// ONVIFConfig describes an ONVIF device stand-in.
+type ONVIFConfig struct {
+	// User and Pass require a WS-Security UsernameToken (PasswordDigest) on every call except
+	// GetSystemDateAndTime when User is set.
+	User string
+	Pass string
+	// Profiles served by GetProfiles.
+	Profiles []ONVIFProfile
+	// ClockOffset shifts the device clock; tokens created more than five minutes away from it are rejected.
+	ClockOffset time.Duration
+}
+
+// ONVIFServer is a running ONVIF stand-in with a device service and a media service.
+type ONVIFServer struct {
+	// URL of the device service, e.g. http://127.0.0.1:45123/onvif/device_service.
+	URL string
+
+	cfg ONVIFConfig
+	srv *httptest.Server
+
+	mu    sync.Mutex
+	calls []string
+}
+
+// StartONVIF starts an ONVIF stand-in and closes it when the test ends.
+func StartONVIF(tb testing.TB, cfg ONVIFConfig) *ONVIFServer {
+	tb.Helper()
+	s := &ONVIFServer{cfg: cfg}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.handle))
+	s.URL = s.srv.URL + "/onvif/device_service"
+	tb.Cleanup(s.srv.Close)
+	return s
+}
+
+// Calls returns the names of the operations received so far.
+func (s *ONVIFServer) Calls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.calls...)
+}
+
+// onvifRequest picks the parts of a request envelope the stand-in looks at.
+type onvifRequest struct {
+	Token struct {
+		Username string `xml:"Username"`
+		Password string `xml:"Password"`
+		Nonce    string `xml:"Nonce"`
+		Created  string `xml:"Created"`
+	} `xml:"Header>Security>UsernameToken"`
+	Body struct {
+		Operation struct {
+			XMLName      xml.Name
+			ProfileToken string `xml:"ProfileToken"`
+		} `xml:",any"`
+	} `xml:"Body"`
+}
+
+func (s *ONVIFServer) handle(w http.ResponseWriter, r *http.Request) {
+	data, _ := io.ReadAll(r.Body)
+	var req onvifRequest
+	if err := xml.Unmarshal(data, &req); err != nil {
+		s.fault(w, "env:Sender", "ter:WellFormed", err.Error())
+		return
+	}
+	op := req.Body.Operation.XMLName.Local
+	s.mu.Lock()
+	s.calls = append(s.calls, op)
+	s.mu.Unlock()
+
+	if op != "GetSystemDateAndTime" && !s.authorized(&req) {
+		s.fault(w, "env:Sender", "ter:NotAuthorized", "Sender not Authorized")
+		return
+	}
+
+	var body string
+	switch {
+	case op == "GetSystemDateAndTime":
+		now := time.Now().Add(s.cfg.ClockOffset).UTC()
+		body = fmt.Sprintf(`<tds:GetSystemDateAndTimeResponse><tds:SystemDateAndTime><tt:DateTimeType>NTP</tt:DateTimeType>`+
+			`<tt:UTCDateTime><tt:Time><tt:Hour>%d</tt:Hour><tt:Minute>%d</tt:Minute><tt:Second>%d</tt:Second></tt:Time>`+
+			`<tt:Date><tt:Year>%d</tt:Year><tt:Month>%d</tt:Month><tt:Day>%d</tt:Day></tt:Date></tt:UTCDateTime>`+
+			`</tds:SystemDateAndTime></tds:GetSystemDateAndTimeResponse>`,
+			now.Hour(), now.Minute(), now.Second(), now.Year(), int(now.Month()), now.Day())
+	case op == "GetCapabilities" && strings.HasSuffix(r.URL.Path, "/device_service"):
+		body = fmt.Sprintf(`<tds:GetCapabilitiesResponse><tds:Capabilities>`+
+			`<tt:Device><tt:XAddr>%[1]s/onvif/device_service</tt:XAddr></tt:Device>`+
+			`<tt:Media><tt:XAddr>%[1]s/onvif/media_service</tt:XAddr><tt:StreamingCapabilities>`+
+			`<tt:RTPMulticast>false</tt:RTPMulticast><tt:RTP_TCP>true</tt:RTP_TCP><tt:RTP_RTSP_TCP>true</tt:RTP_RTSP_TCP>`+
+			`</tt:StreamingCapabilities></tt:Media></tds:Capabilities></tds:GetCapabilitiesResponse>`, s.srv.URL)
+	case op == "GetProfiles" && strings.HasSuffix(r.URL.Path, "/media_service"):
+		var b strings.Builder
+		b.WriteString(`<trt:GetProfilesResponse>`)
+		for _, p := range s.cfg.Profiles {
+			fmt.Fprintf(&b, `<trt:Profiles token="%s" fixed="true"><tt:Name>%s</tt:Name>`, escape(p.Token), escape(p.Name))
+			if p.Encoding != "" {
+				fmt.Fprintf(&b, `<tt:VideoEncoderConfiguration token="venc_%s"><tt:Name>venc</tt:Name><tt:Encoding>%s</tt:Encoding>`+
+					`<tt:Resolution><tt:Width>%d</tt:Width><tt:Height>%d</tt:Height></tt:Resolution>`+
+					`<tt:RateControl><tt:FrameRateLimit>%d</tt:FrameRateLimit><tt:EncodingInterval>1</tt:EncodingInterval>`+
+					`<tt:BitrateLimit>%d</tt:BitrateLimit></tt:RateControl>`+
+					`<tt:H264><tt:GovLength>%d</tt:GovLength><tt:H264Profile>Main</tt:H264Profile></tt:H264>`+
+					`</tt:VideoEncoderConfiguration>`,
+					escape(p.Token), escape(p.Encoding), p.Width, p.Height, p.FrameRate, p.Bitrate, p.GovLength)
+			}
+			b.WriteString(`</trt:Profiles>`)
+		}
+		b.WriteString(`</trt:GetProfilesResponse>`)
+		body = b.String()
+	case op == "GetStreamUri" && strings.HasSuffix(r.URL.Path, "/media_service"):
+		for _, p := range s.cfg.Profiles {
+			if p.Token == req.Body.Operation.ProfileToken {
+				body = fmt.Sprintf(`<trt:GetStreamUriResponse><trt:MediaUri><tt:Uri>%s</tt:Uri>`+
+					`<tt:InvalidAfterConnect>false</tt:InvalidAfterConnect><tt:InvalidAfterReboot>false</tt:InvalidAfterReboot>`+
+					`<tt:Timeout>PT0S</tt:Timeout></trt:MediaUri></trt:GetStreamUriResponse>`, escape(p.StreamURI))
+			}
+		}
+		if body == "" {
+			s.fault(w, "env:Sender", "ter:NoProfile", "Profile token does not exist")
+			return
+		}
+	default:
+		s.fault(w, "env:Receiver", "ter:ActionNotSupported", "Optional Action Not Implemented")
+		return
+	}
+	w.Header().Set("Content-Type", "application/soap+xml; charset=utf-8")
+	_, _ = io.WriteString(w, envelope(body))
+}
+
+// authorized checks the UsernameToken digest and its creation time against the device clock.
+func (s *ONVIFServer) authorized(req *onvifRequest) bool {
+	if s.cfg.User == "" {
+		return true
+	}
+	tok := req.Token
+	if tok.Username != s.cfg.User {
+		return false
+	}
+	nonce, err := base64.StdEncoding.DecodeString(tok.Nonce)
+	if err != nil {
+		return false
+	}
+	created, err := time.Parse(time.RFC3339Nano, tok.Created)
+	if err != nil {
+		return false
+	}
+	if skew := created.Sub(time.Now().Add(s.cfg.ClockOffset)); skew > 5*time.Minute || skew < -5*time.Minute {
+		return false
+	}
+	h := sha1.New()
+	h.Write(nonce)
+	h.Write([]byte(tok.Created))
+	h.Write([]byte(s.cfg.Pass))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)) == strings.TrimSpace(tok.Password)
+}
+
+func (s *ONVIFServer) fault(w http.ResponseWriter, code, subcode, reason string) {
+	w.Header().Set("Content-Type", "application/soap+xml; charset=utf-8")
+	w.WriteHeader(http.StatusBadRequest)
+	_, _ = io.WriteString(w, envelope(fmt.Sprintf(`<env:Fault><env:Code><env:Value>%s</env:Value><env:Subcode>`+
+		`<env:Value>%s</env:Value></env:Subcode></env:Code><env:Reason><env:Text xml:lang="en">%s</env:Text></env:Reason>`+
+		`</env:Fault>`, code, subcode, escape(reason))))
+}
+
+func envelope(body string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>` +
+		`<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope" xmlns:tt="http://www.onvif.org/ver10/schema"` +
+		` xmlns:tds="http://www.onvif.org/ver10/device/wsdl" xmlns:trt="http://www.onvif.org/ver10/media/wsdl"` +
+		` xmlns:ter="http://www.onvif.org/ver10/error"><env:Body>` + body + `</env:Body></env:Envelope>`
+}
+
+func escape(s string) string {
+	var b bytes.Buffer
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,167 @@
+package rtspeektest
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+)
+
+// Camera quirk profiles for Config.Quirks.
+const (
+	// QuirkNoContentBase answers DESCRIBE without a Content-Base header.
+	QuirkNoContentBase = "no-content-base"
+	// QuirkSDPBareLF sends the SDP with bare LF line endings and no final line break.
+	QuirkSDPBareLF = "sdp-bare-lf"
+	// QuirkCloseAfterOptions closes the socket right after answering OPTIONS.
+	QuirkCloseAfterOptions = "close-after-options"
+	// QuirkAuthEverySecond answers every second request with 401, whatever the credentials.
+	QuirkAuthEverySecond = "auth-every-second-request"
+	// QuirkWrongCSeq answers with a CSeq that matches no request.
+	QuirkWrongCSeq = "wrong-cseq"
+	// QuirkTrickle writes responses one byte at a time (Trickle defaults to 1ms).
+	QuirkTrickle = "trickle"
+	// QuirkNeverAnswers accepts connections and reads requests but never answers.
+	QuirkNeverAnswers = "never-answers"
+)
+
+// wrongCSeq is the CSeq sent by QuirkWrongCSeq.
+const wrongCSeq = "9999"
+
+// quirks modify a Config; request-level quirks chain onto Config.Intercept so profiles combine.
+var quirks = map[string]func(*Config){
+	QuirkNoContentBase: func(cfg *Config) {
+		intercept(cfg, func(_ int, req *base.Request) Response {
+			if req.Method == base.Describe {
+				return Response{OmitHeaders: []string{"Content-Base"}}
+			}
+			return Response{}
+		})
+	},
+	QuirkSDPBareLF: func(cfg *Config) {
+		// The controls are rewritten on a copy, leaving the caller's description untouched; the server
+		// streams the copy (see Server.Stream).
+		src := cfg.Description
+		if src == nil {
+			src = DefaultDescription()
+		}
+		desc := *src
+		desc.Medias = make([]*description.Media, len(src.Medias))
+		for i, m := range src.Medias {
+			cp := *m
+			cp.Control = fmt.Sprintf("trackID=%d", i)
+			desc.Medias[i] = &cp
+		}
+		cfg.Description = &desc
+		raw, err := desc.Marshal(false)
+		if err != nil {
+			return
+		}
+		cfg.SDP = bytes.TrimSuffix(bytes.ReplaceAll(raw, []byte("\r\n"), []byte("\n")), []byte("\n"))
+	},
+	QuirkCloseAfterOptions: func(cfg *Config) {
+		intercept(cfg, func(_ int, req *base.Request) Response {
+			if req.Method == base.Options {
+				return Response{Close: true}
+			}
+			return Response{}
+		})
+	},
+	QuirkAuthEverySecond: func(cfg *Config) {
+		intercept(cfg, func(n int, _ *base.Request) Response {
+			if n%2 == 0 {
+				return Response{
+					Status: base.StatusUnauthorized,
+					Header: base.Header{"WWW-Authenticate": base.HeaderValue{`Basic realm="camera"`}},
+				}
+			}
+			return Response{}
+		})
+	},
+	QuirkWrongCSeq: func(cfg *Config) {
+		intercept(cfg, func(int, *base.Request) Response {
+			return Response{Header: base.Header{"CSeq": base.HeaderValue{wrongCSeq}}}
+		})
+	},
+	QuirkTrickle: func(cfg *Config) {
+		if cfg.Trickle <= 0 {
+			cfg.Trickle = time.Millisecond
+		}
+	},
+	QuirkNeverAnswers: func(cfg *Config) {
+		intercept(cfg, func(int, *base.Request) Response {
+			return Response{Hang: true}
+		})
+	},
+}
+
+// Quirks returns the names of the available quirk profiles, sorted.
+func Quirks() []string {
+	names := make([]string, 0, len(quirks))
+	for name := range quirks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// intercept chains f in front of the current Config.Intercept.
+func intercept(cfg *Config, f func(n int, req *base.Request) Response) {
+	prev := cfg.Intercept
+	cfg.Intercept = func(n int, req *base.Request) Response {
+		if r := f(n, req); !isZero(r) {
+			return r
+		}
+		if prev != nil {
+			return prev(n, req)
+		}
+		return Response{}
+	}
+}
+
+// quirkListener hands out quirkConns.
+type quirkListener struct {
+	net.Listener
+	trickle time.Duration
+}
+
+func (l *quirkListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &quirkConn{Conn: c, trickle: l.trickle}, nil
+}
+
+// quirkConn can slow down writes and close itself after a response.
+type quirkConn struct {
+	net.Conn
+	trickle         time.Duration
+	closeAfterWrite atomic.Bool
+}
+
+func (c *quirkConn) Write(b []byte) (int, error) {
+	n, err := c.write(b)
+	if c.closeAfterWrite.Load() {
+		_ = c.Conn.Close()
+	}
+	return n, err
+}
+
+func (c *quirkConn) write(b []byte) (int, error) {
+	if c.trickle <= 0 {
+		return c.Conn.Write(b)
+	}
+	for i := range b {
+		if _, err := c.Conn.Write(b[i : i+1]); err != nil {
+			return i, err
+		}
+		time.Sleep(c.trickle)
+	}
+	return len(b), nil
+}
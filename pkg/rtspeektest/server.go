@@ -0,0 +1,385 @@
+// Package rtspeektest provides an in-process RTSP server for testing code built on rtspeek.
+//
+// The server serves a configurable SDP, can require Basic/Digest authentication, answers each RTSP
+// method according to a script (status codes, delays, dropped connections) and streams synthetic RTP
+// to playing clients:
+//
+//	srv := rtspeektest.Start(t, rtspeektest.Config{
+//		User: "admin", Pass: "secret",
+//		Responses: map[base.Method][]rtspeektest.Response{
+//			base.Describe: {{Status: base.StatusServiceUnavailable}, {}}, // fail once, then answer normally
+//		},
+//	})
+//	info, err := rtspeek.DescribeStream(ctx, srv.URLWithCredentials("admin", "secret"), time.Second)
+//
+// StartONVIF adds an ONVIF device stand-in whose profiles can point at such a server, and
+// StartWSDiscovery a WS-Discovery responder that announces it.
+package rtspeektest
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/auth"
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/liberrors"
+	"github.com/bluenviron/gortsplib/v4/pkg/sdp"
+)
+
+// DefaultFrameInterval is the spacing of synthetic frames (25 fps).
+const DefaultFrameInterval = 40 * time.Millisecond
+
+// Response scripts how the server answers one request.
+type Response struct {
+	// Status replaces the status code of the answer; 0 keeps the server's own answer.
+	Status base.StatusCode
+	// Header is merged into the answer.
+	Header base.Header
+	// Delay is waited before the request is handled.
+	Delay time.Duration
+	// Drop closes the connection instead of answering.
+	Drop bool
+	// Hang never answers; the connection stays open until the client gives up or the server closes.
+	Hang bool
+	// Close closes the connection right after the answer is written.
+	Close bool
+	// OmitHeaders are removed from the answer, e.g. Content-Base.
+	OmitHeaders []string
+}
+
+// Config describes the server. The zero value serves one H264 video track with synthetic frames.
+type Config struct {
+	// Description is served on DESCRIBE and streamed after PLAY.
+	Description *description.Session
+	// SDP, if set, is sent verbatim as the DESCRIBE body. Unless Description is also set, it is parsed to
+	// build the stream for SETUP and PLAY, which match tracks by their a=control:trackID=N attribute.
+	SDP []byte
+	// User and Pass require credentials on DESCRIBE, SETUP and PLAY when User is set.
+	User string
+	Pass string
+	// AuthMethods offered to clients (default Basic and Digest MD5).
+	AuthMethods []auth.VerifyMethod
+	// Responses scripts the answers per method, consumed in order; the last entry also applies to every
+	// later request of that method. A zero Response answers normally.
+	Responses map[base.Method][]Response
+	// UDP enables the UDP transport next to TCP.
+	UDP bool
+	// FrameInterval spaces the frames written to the stream (default 40ms); negative disables RTP output.
+	FrameInterval time.Duration
+	// Generate writes frame n to the stream (default: synthetic packets for every media, see Synthesizer).
+	Generate func(stream *gortsplib.ServerStream, n int)
+	// Intercept is called for every request with its 1-based number on the server; a non-zero result
+	// is used instead of the scripted Response.
+	Intercept func(n int, req *base.Request) Response
+	// Trickle writes everything sent to clients one byte at a time, waiting this long between bytes.
+	Trickle time.Duration
+	// Quirks applies named camera quirk profiles (see Quirks) on top of the other settings.
+	Quirks []string
+}
+
+// Server is a running test server.
+type Server struct {
+	// URL of the stream, e.g. rtsp://127.0.0.1:45123/stream.
+	URL string
+
+	cfg    Config
+	srv    *gortsplib.Server
+	stream *gortsplib.ServerStream
+	done   chan struct{}
+	wg     sync.WaitGroup
+
+	mu       sync.Mutex
+	script   map[base.Method][]Response
+	pending  map[*gortsplib.ServerConn]Response
+	sessions []*gortsplib.ServerSession
+	requests []base.Method
+}
+
+// Start starts a server and closes it when the test ends, failing the test if it cannot start.
+func Start(tb testing.TB, cfg Config) *Server {
+	tb.Helper()
+	s, err := NewServer(cfg)
+	if err != nil {
+		tb.Fatalf("rtspeektest: %v", err)
+	}
+	tb.Cleanup(s.Close)
+	return s
+}
+
+// NewServer starts a server on a free loopback port. Close it when done.
+func NewServer(cfg Config) (*Server, error) {
+	for _, name := range cfg.Quirks {
+		apply, ok := quirks[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown quirk %q", name)
+		}
+		apply(&cfg)
+	}
+
+	desc := cfg.Description
+	if cfg.SDP != nil && desc == nil {
+		var ssd sdp.SessionDescription
+		if err := ssd.Unmarshal(cfg.SDP); err != nil {
+			return nil, fmt.Errorf("parse SDP: %w", err)
+		}
+		desc = &description.Session{}
+		if err := desc.Unmarshal(&ssd); err != nil {
+			return nil, fmt.Errorf("parse SDP: %w", err)
+		}
+	}
+	if desc == nil {
+		desc = DefaultDescription()
+	}
+	if cfg.FrameInterval == 0 {
+		cfg.FrameInterval = DefaultFrameInterval
+	}
+
+	addr, err := freeTCPAddr()
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		URL:     "rtsp://" + addr + "/stream",
+		cfg:     cfg,
+		done:    make(chan struct{}),
+		script:  make(map[base.Method][]Response),
+		pending: make(map[*gortsplib.ServerConn]Response),
+	}
+	for m, list := range cfg.Responses {
+		s.script[m] = append([]Response(nil), list...)
+	}
+	s.srv = &gortsplib.Server{Handler: serverHandler{s}, RTSPAddress: addr, AuthMethods: cfg.AuthMethods, Listen: s.listen}
+	if cfg.UDP {
+		if s.srv.UDPRTPAddress, s.srv.UDPRTCPAddress, err = freeUDPPair(); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.srv.Start(); err != nil {
+		return nil, err
+	}
+	s.stream = gortsplib.NewServerStream(s.srv, desc)
+
+	if cfg.FrameInterval > 0 {
+		generate := cfg.Generate
+		if generate == nil {
+			generate = NewSynthesizer(desc, cfg.FrameInterval).WriteFrame
+		}
+		s.wg.Add(1)
+		go s.produce(generate)
+	}
+	return s, nil
+}
+
+// URLWithCredentials returns URL with user and pass in its userinfo.
+func (s *Server) URLWithCredentials(user, pass string) string {
+	u, _ := url.Parse(s.URL)
+	u.User = url.UserPassword(user, pass)
+	return u.String()
+}
+
+// Stream returns the stream served to clients, e.g. to write hand-made packets.
+func (s *Server) Stream() *gortsplib.ServerStream {
+	return s.stream
+}
+
+// Requests returns the methods received so far, in order.
+func (s *Server) Requests() []base.Method {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]base.Method(nil), s.requests...)
+}
+
+// CloseSessions drops every client that reached PLAY.
+func (s *Server) CloseSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ss := range s.sessions {
+		ss.Close()
+	}
+	s.sessions = nil
+}
+
+// Close stops RTP output and the server.
+func (s *Server) Close() {
+	close(s.done)
+	s.wg.Wait()
+	s.stream.Close()
+	s.srv.Close()
+}
+
+func (s *Server) produce(generate func(*gortsplib.ServerStream, int)) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.cfg.FrameInterval)
+	defer ticker.Stop()
+	for n := 0; ; n++ {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			generate(s.stream, n)
+		}
+	}
+}
+
+// next pops the scripted response for a method, keeping the last one.
+func (s *Server) next(m base.Method) Response {
+	list := s.script[m]
+	if len(list) == 0 {
+		return Response{}
+	}
+	if len(list) > 1 {
+		s.script[m] = list[1:]
+	}
+	return list[0]
+}
+
+// serverHandler implements the gortsplib handler interfaces without exporting them on Server.
+type serverHandler struct{ *Server }
+
+// OnRequest applies the scripted delay or drop before gortsplib handles the request.
+func (s serverHandler) OnRequest(sc *gortsplib.ServerConn, req *base.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, req.Method)
+	r := s.next(req.Method)
+	if s.cfg.Intercept != nil {
+		if ir := s.cfg.Intercept(len(s.requests), req); !isZero(ir) {
+			r = ir
+		}
+	}
+	s.pending[sc] = r
+	s.mu.Unlock()
+
+	if r.Delay > 0 {
+		time.Sleep(r.Delay)
+	}
+	if r.Hang {
+		<-s.done
+	}
+	if r.Drop {
+		// Closing the socket makes the pending response write fail
+		_ = sc.NetConn().Close()
+	}
+}
+
+// OnResponse rewrites the answer according to the script.
+func (s serverHandler) OnResponse(sc *gortsplib.ServerConn, res *base.Response) {
+	s.mu.Lock()
+	r := s.pending[sc]
+	delete(s.pending, sc)
+	s.mu.Unlock()
+
+	if r.Status != 0 && r.Status != res.StatusCode {
+		res.StatusCode = r.Status
+		res.StatusMessage = ""
+		res.Body = nil
+		delete(res.Header, "Content-Base")
+		delete(res.Header, "Content-Type")
+	}
+	for k, v := range r.Header {
+		res.Header[k] = v
+	}
+	for _, k := range r.OmitHeaders {
+		delete(res.Header, k)
+	}
+	if qc, ok := sc.NetConn().(*quirkConn); ok && r.Close {
+		qc.closeAfterWrite.Store(true)
+	}
+}
+
+// isZero reports whether r leaves the answer untouched.
+func isZero(r Response) bool {
+	return r.Status == 0 && r.Header == nil && r.Delay == 0 && !r.Drop && !r.Hang && !r.Close && r.OmitHeaders == nil
+}
+
+// listen wraps accepted connections so quirks can act on the byte stream.
+func (s *Server) listen(network, address string) (net.Listener, error) {
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return &quirkListener{Listener: l, trickle: s.cfg.Trickle}, nil
+}
+
+// OnConnClose forgets the state of a closed connection.
+func (s serverHandler) OnConnClose(ctx *gortsplib.ServerHandlerOnConnCloseCtx) {
+	s.mu.Lock()
+	delete(s.pending, ctx.Conn)
+	s.mu.Unlock()
+}
+
+// authorize checks credentials when the config requires them.
+func (s serverHandler) authorize(sc *gortsplib.ServerConn, req *base.Request) (*base.Response, error) {
+	if s.cfg.User == "" || sc.VerifyCredentials(req, s.cfg.User, s.cfg.Pass) {
+		return nil, nil
+	}
+	return &base.Response{StatusCode: base.StatusUnauthorized}, liberrors.ErrServerAuth{}
+}
+
+// OnDescribe serves the configured SDP.
+func (s serverHandler) OnDescribe(ctx *gortsplib.ServerHandlerOnDescribeCtx) (*base.Response, *gortsplib.ServerStream, error) {
+	if res, err := s.authorize(ctx.Conn, ctx.Request); res != nil {
+		return res, nil, err
+	}
+	if s.cfg.SDP != nil {
+		return &base.Response{StatusCode: base.StatusOK, Body: s.cfg.SDP}, nil, nil
+	}
+	return &base.Response{StatusCode: base.StatusOK}, s.stream, nil
+}
+
+// OnSetup attaches the client to the stream.
+func (s serverHandler) OnSetup(ctx *gortsplib.ServerHandlerOnSetupCtx) (*base.Response, *gortsplib.ServerStream, error) {
+	if res, err := s.authorize(ctx.Conn, ctx.Request); res != nil {
+		return res, nil, err
+	}
+	return &base.Response{StatusCode: base.StatusOK}, s.stream, nil
+}
+
+// OnPlay starts delivery and remembers the session for CloseSessions.
+func (s serverHandler) OnPlay(ctx *gortsplib.ServerHandlerOnPlayCtx) (*base.Response, error) {
+	if res, err := s.authorize(ctx.Conn, ctx.Request); res != nil {
+		return res, err
+	}
+	s.mu.Lock()
+	s.sessions = append(s.sessions, ctx.Session)
+	s.mu.Unlock()
+	return &base.Response{StatusCode: base.StatusOK}, nil
+}
+
+// freeTCPAddr returns a loopback address with a free port.
+func freeTCPAddr() (string, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+	return l.Addr().String(), nil
+}
+
+// freeUDPPair returns loopback addresses of a free even RTP port and the following RTCP port.
+func freeUDPPair() (rtpAddr, rtcpAddr string, err error) {
+	for range 20 {
+		c, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			return "", "", err
+		}
+		port := c.LocalAddr().(*net.UDPAddr).Port
+		c.Close()
+		if port%2 != 0 || port == 65535 {
+			continue
+		}
+		c2, err := net.ListenPacket("udp", fmt.Sprintf("127.0.0.1:%d", port+1))
+		if err != nil {
+			continue
+		}
+		c2.Close()
+		return fmt.Sprintf("127.0.0.1:%d", port), fmt.Sprintf("127.0.0.1:%d", port+1), nil
+	}
+	return "", "", errors.New("no free UDP port pair")
+}
@@ -0,0 +1,178 @@
+package rtspeektest_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	rtpeek "github.com/0x524A/rtspeek/pkg/rtspeek"
+	"github.com/0x524A/rtspeek/pkg/rtspeektest"
+	"github.com/bluenviron/gortsplib/v4/pkg/auth"
+	"github.com/bluenviron/gortsplib/v4/pkg/base"
+)
+
+func TestServerDefaultStream(t *testing.T) {
+	for _, transport := range []string{"tcp", "udp"} {
+		t.Run(transport, func(t *testing.T) {
+			srv := rtspeektest.Start(t, rtspeektest.Config{UDP: true})
+			ctx := rtpeek.WithLiveProbe(context.Background(), rtpeek.LiveProbeOptions{Duration: 1200 * time.Millisecond, Transport: transport})
+			info, err := rtpeek.DescribeStream(ctx, srv.URL, 2*time.Second)
+			if err != nil {
+				t.Fatalf("describe: %v", err)
+			}
+			if info.GetVideoResolutionString() != "1280x720" || info.GetLiveProbe().Transport != transport {
+				t.Fatalf("unexpected stream: %s over %s", info.GetVideoResolutionString(), info.GetLiveProbe().Transport)
+			}
+			gop := info.GetVideoMedias()[0].GOP
+			if gop == nil || gop.Keyframes < 1 || gop.Frames < 20 {
+				t.Fatalf("expected synthetic frames with keyframes, got %+v", gop)
+			}
+		})
+	}
+}
+
+func TestServerAuth(t *testing.T) {
+	tests := []struct {
+		name    string
+		methods []auth.VerifyMethod
+	}{
+		{name: "basic", methods: []auth.VerifyMethod{auth.VerifyMethodBasic}},
+		{name: "digest", methods: []auth.VerifyMethod{auth.VerifyMethodDigestMD5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := rtspeektest.Start(t, rtspeektest.Config{User: "admin", Pass: "secret", AuthMethods: tt.methods, FrameInterval: -1})
+			if _, err := rtpeek.DescribeStream(context.Background(), srv.URL, time.Second); err == nil {
+				t.Fatalf("expected an error without credentials")
+			}
+			if _, err := rtpeek.DescribeStream(context.Background(), srv.URLWithCredentials("admin", "wrong"), time.Second); err == nil {
+				t.Fatalf("expected an error with a wrong password")
+			}
+			if _, err := rtpeek.DescribeStream(context.Background(), srv.URLWithCredentials("admin", "secret"), time.Second); err != nil {
+				t.Fatalf("describe with credentials: %v", err)
+			}
+		})
+	}
+}
+
+func TestServerScriptedResponses(t *testing.T) {
+	srv := rtspeektest.Start(t, rtspeektest.Config{
+		FrameInterval: -1,
+		Responses: map[base.Method][]rtspeektest.Response{
+			base.Describe: {{Status: base.StatusNotFound}, {Status: base.StatusServiceUnavailable, Header: base.Header{"Retry-After": base.HeaderValue{"3"}}}, {}},
+		},
+	})
+	for i, want := range []string{"404", "503", ""} {
+		_, err := rtpeek.DescribeStream(context.Background(), srv.URL, time.Second)
+		switch {
+		case want == "" && err != nil:
+			t.Fatalf("attempt %d: expected success, got %v", i, err)
+		case want != "" && (err == nil || !strings.Contains(err.Error(), want)):
+			t.Fatalf("attempt %d: expected a %s error, got %v", i, want, err)
+		}
+	}
+	if got := srv.Requests(); len(got) < 6 || got[len(got)-1] != base.Describe {
+		t.Fatalf("unexpected requests %v", got)
+	}
+}
+
+func TestServerDelayAndDrop(t *testing.T) {
+	srv := rtspeektest.Start(t, rtspeektest.Config{
+		FrameInterval: -1,
+		Responses: map[base.Method][]rtspeektest.Response{
+			base.Describe: {{Delay: time.Second}, {Drop: true}},
+		},
+	})
+	start := time.Now()
+	if _, err := rtpeek.DescribeStream(context.Background(), srv.URL, 300*time.Millisecond); err == nil {
+		t.Fatalf("expected a timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 900*time.Millisecond {
+		t.Fatalf("client waited for the delayed answer (%v)", elapsed)
+	}
+	info, err := rtpeek.DescribeStream(context.Background(), srv.URL, time.Second)
+	if err == nil || !info.IsReachable() || info.IsDescribeSucceeded() {
+		t.Fatalf("expected a dropped connection after connecting, got %v", err)
+	}
+}
+
+func TestServerRawSDP(t *testing.T) {
+	raw := "v=0\r\no=- 0 0 IN IP4 127.0.0.1\r\ns=Quirky Camera\r\nt=0 0\r\n" +
+		"m=video 0 RTP/AVP 96\r\na=control:trackID=0\r\na=rtpmap:96 H264/90000\r\n" +
+		"a=fmtp:96 packetization-mode=1;sprop-parameter-sets=Z0LAH5WoFAFumwQEBKA=,aM48gA==\r\n" +
+		"m=audio 0 RTP/AVP 0\r\na=control:trackID=1\r\na=rtpmap:0 PCMU/8000\r\n"
+	srv := rtspeektest.Start(t, rtspeektest.Config{SDP: []byte(raw)})
+
+	ctx := rtpeek.WithLiveProbe(rtpeek.WithRawSDP(context.Background()), rtpeek.LiveProbeOptions{Duration: 500 * time.Millisecond, Transport: "tcp"})
+	info, err := rtpeek.DescribeStream(ctx, srv.URL, 2*time.Second)
+	if err != nil {
+		t.Fatalf("describe: %v", err)
+	}
+	if info.GetRawSDP() != raw || info.GetSessionDetails().Name != "Quirky Camera" {
+		t.Fatalf("expected the SDP verbatim, got %q", info.GetRawSDP())
+	}
+	if rtp := info.GetAudioMedias()[0].RTP; rtp == nil || rtp.Packets == 0 {
+		t.Fatalf("expected synthetic audio, got %+v", rtp)
+	}
+}
+
+func TestServerCloseSessions(t *testing.T) {
+	srv := rtspeektest.Start(t, rtspeektest.Config{})
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+		srv.CloseSessions()
+	}()
+	report, err := rtpeek.Soak(context.Background(), srv.URL, time.Second, rtpeek.SoakOptions{
+		Duration: 1500 * time.Millisecond, ReconnectDelay: 100 * time.Millisecond, Transport: "tcp",
+	})
+	if err != nil {
+		t.Fatalf("soak: %v", err)
+	}
+	if report.Disconnects != 1 || report.Reconnects != 1 {
+		t.Fatalf("expected one dropped and restored session, got %+v", report)
+	}
+}
+
+func TestServerBareLFKeepsDescription(t *testing.T) {
+	desc := rtspeektest.DefaultDescription()
+	desc.Medias[0].Control = "video"
+	srv := rtspeektest.Start(t, rtspeektest.Config{
+		FrameInterval: -1,
+		Description:   desc,
+		Quirks:        []string{rtspeektest.QuirkSDPBareLF},
+	})
+	if desc.Medias[0].Control != "video" {
+		t.Fatalf("quirk rewrote the caller's control to %q", desc.Medias[0].Control)
+	}
+	info, err := rtpeek.DescribeStream(rtpeek.WithRawSDP(context.Background()), srv.URL, time.Second)
+	if err != nil {
+		t.Fatalf("describe: %v", err)
+	}
+	if raw := info.GetRawSDP(); !strings.Contains(raw, "a=control:trackID=0") {
+		t.Fatalf("expected the rewritten control in the served SDP, got %q", raw)
+	}
+}
+
+func TestServerUnknownQuirk(t *testing.T) {
+	if _, err := rtspeektest.NewServer(rtspeektest.Config{Quirks: []string{"no-such-quirk"}}); err == nil {
+		t.Fatalf("expected an error for an unknown quirk")
+	}
+}
+
+func TestServerCombinedQuirks(t *testing.T) {
+	srv := rtspeektest.Start(t, rtspeektest.Config{
+		FrameInterval: -1,
+		Quirks:        []string{rtspeektest.QuirkNoContentBase, rtspeektest.QuirkSDPBareLF},
+	})
+	info, err := rtpeek.DescribeStream(rtpeek.WithRawSDP(context.Background()), srv.URL, time.Second)
+	if err != nil {
+		t.Fatalf("describe: %v", err)
+	}
+	if raw := info.GetRawSDP(); strings.Contains(raw, "\r") || strings.HasSuffix(raw, "\n") {
+		t.Fatalf("expected bare LF line endings, got %q", raw)
+	}
+	if d := info.GetSessionDetails(); d.ContentBase != "" {
+		t.Fatalf("expected no Content-Base, got %q", d.ContentBase)
+	}
+}
@@ -0,0 +1,143 @@
+package rtspeektest
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/bluenviron/gortsplib/v4/pkg/format/rtph264"
+	"github.com/pion/rtp"
+)
+
+// Parameter sets of the default H264 track: baseline profile, 1280x720.
+var (
+	H264SPS = []byte{0x67, 0x42, 0xc0, 0x1f, 0x95, 0xa8, 0x14, 0x01, 0x6e, 0x9b, 0x04, 0x04, 0x04, 0xa0}
+	H264PPS = []byte{0x68, 0xce, 0x3c, 0x80}
+)
+
+// Synthetic stream shape.
+const (
+	// SyntheticGOP is the number of frames from one IDR to the next.
+	SyntheticGOP = 25
+	// syntheticSliceSize is the default Synthesizer.SliceSize.
+	syntheticSliceSize = 1000
+	// syntheticPayloadSize is the payload of packets for codecs without a synthetic encoder.
+	syntheticPayloadSize = 160
+)
+
+// DefaultDescription is a single H264 video track using H264SPS and H264PPS.
+func DefaultDescription() *description.Session {
+	return &description.Session{Medias: []*description.Media{{
+		Type:    description.MediaTypeVideo,
+		Formats: []format.Format{&format.H264{PayloadTyp: 96, SPS: H264SPS, PPS: H264PPS, PacketizationMode: 1}},
+	}}}
+}
+
+// Synthesizer produces RTP for every media of a description. H264 tracks carry decodable access units
+// (SPS, PPS and an IDR every GOP frames, P slices otherwise); other formats get one packet of filler per
+// frame with a correctly advancing timestamp.
+//
+// The exported fields may be changed between frames, e.g. SPS to switch resolution mid-stream.
+type Synthesizer struct {
+	// GOP is the number of frames from one IDR to the next (SyntheticGOP by default).
+	GOP int
+	// SliceSize is the length of a P slice; IDR slices are twice as long. Slices larger than an RTP
+	// payload are fragmented (FU-A).
+	SliceSize int
+	// SPS, if set, is sent in front of every IDR instead of the SPS of the format.
+	SPS []byte
+
+	interval time.Duration
+	tracks   []*synthTrack
+}
+
+type synthTrack struct {
+	media *description.Media
+	forma format.Format
+	h264  *rtph264.Encoder
+	sps   []byte
+	pps   []byte
+	seq   uint16
+}
+
+// NewSynthesizer prepares encoders for the first format of every media; frames are interval apart.
+func NewSynthesizer(desc *description.Session, interval time.Duration) *Synthesizer {
+	sy := &Synthesizer{GOP: SyntheticGOP, SliceSize: syntheticSliceSize, interval: interval}
+	for _, m := range desc.Medias {
+		if len(m.Formats) == 0 || m.IsBackChannel {
+			continue
+		}
+		t := &synthTrack{media: m, forma: m.Formats[0]}
+		if f, ok := t.forma.(*format.H264); ok {
+			if enc, err := f.CreateEncoder(); err == nil {
+				t.h264 = enc
+				t.sps, t.pps = f.SafeParams()
+				if t.sps == nil || t.pps == nil {
+					t.sps, t.pps = H264SPS, H264PPS
+				}
+			}
+		}
+		sy.tracks = append(sy.tracks, t)
+	}
+	return sy
+}
+
+// Packets returns the packets of frame n for each media.
+func (sy *Synthesizer) Packets(n int) map[*description.Media][]*rtp.Packet {
+	out := make(map[*description.Media][]*rtp.Packet, len(sy.tracks))
+	for _, t := range sy.tracks {
+		ts := uint32(int64(n) * int64(t.forma.ClockRate()) * int64(sy.interval) / int64(time.Second))
+		if t.h264 != nil {
+			out[t.media] = sy.h264Frame(t, n, ts)
+			continue
+		}
+		out[t.media] = []*rtp.Packet{{
+			Header: rtp.Header{
+				Version: 2, PayloadType: t.forma.PayloadType(), SequenceNumber: t.next(), Timestamp: ts, Marker: true,
+			},
+			Payload: make([]byte, syntheticPayloadSize),
+		}}
+	}
+	return out
+}
+
+// WriteFrame writes frame n of every media to stream; it fits Config.Generate.
+func (sy *Synthesizer) WriteFrame(stream *gortsplib.ServerStream, n int) {
+	for m, pkts := range sy.Packets(n) {
+		for _, pkt := range pkts {
+			_ = stream.WritePacketRTP(m, pkt)
+		}
+	}
+}
+
+func (t *synthTrack) next() uint16 {
+	t.seq++
+	return t.seq - 1
+}
+
+func (sy *Synthesizer) h264Frame(t *synthTrack, n int, ts uint32) []*rtp.Packet {
+	var au [][]byte
+	if n%sy.GOP == 0 {
+		sps := t.sps
+		if sy.SPS != nil {
+			sps = sy.SPS
+		}
+		idr := bytes.Repeat([]byte{0xaa}, sy.SliceSize*2)
+		idr[0], idr[1] = 0x65, 0x88 // first_mb_in_slice 0, slice_type I
+		au = [][]byte{sps, t.pps, idr}
+	} else {
+		slice := bytes.Repeat([]byte{0xbb}, sy.SliceSize)
+		slice[0], slice[1] = 0x41, 0x9a // first_mb_in_slice 0, slice_type P
+		au = [][]byte{slice}
+	}
+	pkts, err := t.h264.Encode(au)
+	if err != nil {
+		return nil
+	}
+	for _, p := range pkts {
+		p.Timestamp = ts
+	}
+	return pkts
+}
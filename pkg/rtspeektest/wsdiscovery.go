@@ -0,0 +1,112 @@
+package rtspeektest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// DiscoveryMatch is a device announced by a WSDiscoveryResponder.
+type DiscoveryMatch struct {
+	// Endpoint is the EndpointReference address (urn:uuid:<n> if empty).
+	Endpoint string
+	// XAddrs are the device service URLs, e.g. the URL of an ONVIFServer.
+	XAddrs []string
+	// Scopes such as onvif://www.onvif.org/name/Lobby.
+	Scopes []string
+	// Types (dn:NetworkVideoTransmitter tds:Device if empty).
+	Types []string
+}
+
+// WSDiscoveryResponder answers WS-Discovery Probes sent to Addr on loopback, as the devices of a site
+// would answer a multicast Probe: each match in its own ProbeMatches message.
+type WSDiscoveryResponder struct {
+	// Addr is the UDP address to send Probes to.
+	Addr string
+
+	conn    *net.UDPConn
+	matches []DiscoveryMatch
+	mu      sync.Mutex
+	probes  int
+}
+
+// StartWSDiscovery starts a responder and closes it when the test ends.
+func StartWSDiscovery(tb testing.TB, matches ...DiscoveryMatch) *WSDiscoveryResponder {
+	tb.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		tb.Fatalf("rtspeektest: %v", err)
+	}
+	r := &WSDiscoveryResponder{Addr: conn.LocalAddr().String(), conn: conn, matches: matches}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.serve()
+	}()
+	tb.Cleanup(func() {
+		_ = conn.Close()
+		<-done
+	})
+	return r
+}
+
+// Probes returns the number of Probe messages received.
+func (r *WSDiscoveryResponder) Probes() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.probes
+}
+
+func (r *WSDiscoveryResponder) serve() {
+	buf := make([]byte, 64<<10)
+	for {
+		n, src, err := r.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		var probe struct {
+			MessageID string `xml:"Header>MessageID"`
+			Types     string `xml:"Body>Probe>Types"`
+		}
+		if xml.Unmarshal(buf[:n], &probe) != nil || probe.MessageID == "" {
+			continue
+		}
+		if probe.Types != "" && !strings.Contains(probe.Types, "NetworkVideoTransmitter") {
+			continue
+		}
+		r.mu.Lock()
+		r.probes++
+		r.mu.Unlock()
+		for i, m := range r.matches {
+			_, _ = r.conn.WriteToUDP([]byte(probeMatches(probe.MessageID, i, m)), src)
+		}
+	}
+}
+
+// probeMatches builds the answer announcing match i.
+func probeMatches(relatesTo string, i int, m DiscoveryMatch) string {
+	endpoint := m.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("urn:uuid:00000000-0000-4000-8000-%012d", i+1)
+	}
+	types := m.Types
+	if len(types) == 0 {
+		types = []string{"dn:NetworkVideoTransmitter", "tds:Device"}
+	}
+	return `<?xml version="1.0" encoding="UTF-8"?>` +
+		`<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:a="http://schemas.xmlsoap.org/ws/2004/08/addressing"` +
+		` xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery" xmlns:dn="http://www.onvif.org/ver10/network/wsdl"` +
+		` xmlns:tds="http://www.onvif.org/ver10/device/wsdl"><s:Header>` +
+		`<a:MessageID>urn:uuid:` + fmt.Sprintf("10000000-0000-4000-8000-%012d", i+1) + `</a:MessageID>` +
+		`<a:RelatesTo>` + escape(relatesTo) + `</a:RelatesTo>` +
+		`<a:To>http://schemas.xmlsoap.org/ws/2004/08/addressing/role/anonymous</a:To>` +
+		`<a:Action>http://schemas.xmlsoap.org/ws/2005/04/discovery/ProbeMatches</a:Action></s:Header>` +
+		`<s:Body><d:ProbeMatches><d:ProbeMatch><a:EndpointReference><a:Address>` + escape(endpoint) + `</a:Address></a:EndpointReference>` +
+		`<d:Types>` + escape(strings.Join(types, " ")) + `</d:Types>` +
+		`<d:Scopes>` + escape(strings.Join(m.Scopes, " ")) + `</d:Scopes>` +
+		`<d:XAddrs>` + escape(strings.Join(m.XAddrs, " ")) + `</d:XAddrs>` +
+		`<d:MetadataVersion>1</d:MetadataVersion></d:ProbeMatch></d:ProbeMatches></s:Body></s:Envelope>`
+}